@@ -0,0 +1,157 @@
+// Package apikey manages the API keys merchants call the API with.
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+// Service provides API key service methods.
+// Create and Rotate return the secret of the key, which is not stored and cannot be shown again.
+// Authenticate returns the key of a secret, or ErrInvalidKey if no key has the secret.
+type Service interface {
+	Create(name string) (*Key, string, error)
+	List() ([]*Key, error)
+	Rotate(id int) (*Key, string, error)
+	Authenticate(secret string) (*Key, error)
+}
+
+// Key represents an API key. Only the SHA-256 hash of its secret is stored, Prefix is the start of the secret
+// which identifies the key in lists without revealing the secret.
+// RotatedAt is zero if the secret was never rotated, the previous secret stops working once it is rotated.
+type Key struct {
+	ID        int
+	Name      string
+	Prefix    string
+	Hash      string
+	CreatedAt time.Time
+	RotatedAt time.Time
+}
+
+// Repository provides access API keys in a data source.
+// FindByHash returns ErrInvalidKey if no key has the hash.
+// UpdateSecret replaces the prefix and the hash of the secret of the key with the given id.
+type Repository interface {
+	Create(key *Key) error
+	Find(id int) (*Key, error)
+	FindByHash(hash string) (*Key, error)
+	FindAll() ([]*Key, error)
+	UpdateSecret(id int, prefix, hash string, rotatedAt time.Time) error
+}
+
+// MaxNameLength is the maximum length of the name of a key.
+const MaxNameLength = 100
+
+// Errors
+var (
+	ErrKeyNotFound = &payment.Error{Code: payment.ErrorCodeNotFound, Message: "API key not found"}
+	ErrInvalidKey  = &payment.Error{Code: payment.ErrorCodeUnauthorized, Message: "API key is invalid"}
+)
+
+const (
+	// secretPrefix marks the secrets of the service so that a leaked secret is recognized, e.g. by secret scanners.
+	secretPrefix = "psk_"
+	// secretSize is the number of random bytes of a secret.
+	secretSize = 32
+	// displayPrefixLength is the length of the prefix of a secret which identifies its key.
+	displayPrefixLength = len(secretPrefix) + 8
+)
+
+type service struct {
+	repo Repository
+	now  func() time.Time
+}
+
+// NewService returns a new API key service.
+func NewService(repo Repository) Service {
+	return &service{
+		repo: repo,
+		now:  time.Now,
+	}
+}
+
+// Create creates an API key with the given name and a random secret.
+func (s *service) Create(name string) (*Key, string, error) {
+	name = strings.TrimSpace(name)
+	var errs []payment.FieldError
+	switch {
+	case name == "":
+		errs = append(errs, payment.FieldError{Field: "name", Code: payment.CodeRequired, Message: "name is required"})
+	case len(name) > MaxNameLength:
+		errs = append(errs, payment.FieldError{Field: "name", Code: payment.CodeTooLong, Message: fmt.Sprintf("name must not exceed %d characters", MaxNameLength)})
+	}
+	if len(errs) > 0 {
+		return nil, "", &payment.ValidationError{Errors: errs}
+	}
+
+	secret, err := newSecret()
+	if err != nil {
+		return nil, "", err
+	}
+
+	key := &Key{
+		Name:   name,
+		Prefix: secret[:displayPrefixLength],
+		Hash:   hash(secret),
+	}
+	if err := s.repo.Create(key); err != nil {
+		return nil, "", err
+	}
+
+	return key, secret, nil
+}
+
+// List lists the API keys, oldest first.
+func (s *service) List() ([]*Key, error) {
+	return s.repo.FindAll()
+}
+
+// Rotate replaces the secret of the API key with the given id with a new random secret.
+func (s *service) Rotate(id int) (*Key, string, error) {
+	if _, err := s.repo.Find(id); err != nil {
+		return nil, "", err
+	}
+
+	secret, err := newSecret()
+	if err != nil {
+		return nil, "", err
+	}
+	if err := s.repo.UpdateSecret(id, secret[:displayPrefixLength], hash(secret), s.now()); err != nil {
+		return nil, "", err
+	}
+
+	key, err := s.repo.Find(id)
+	if err != nil {
+		return nil, "", err
+	}
+	return key, secret, nil
+}
+
+// Authenticate finds the API key of a secret by its hash. The secrets are random, so their hashes are looked up
+// directly; a slow password hash is not needed.
+func (s *service) Authenticate(secret string) (*Key, error) {
+	if !strings.HasPrefix(secret, secretPrefix) {
+		return nil, ErrInvalidKey
+	}
+	return s.repo.FindByHash(hash(secret))
+}
+
+func newSecret() (string, error) {
+	b := make([]byte, secretSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return secretPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,31 @@
+package apikey
+
+import "time"
+
+type mockRepository struct {
+	CreateFn       func(key *Key) error
+	FindFn         func(id int) (*Key, error)
+	FindByHashFn   func(hash string) (*Key, error)
+	FindAllFn      func() ([]*Key, error)
+	UpdateSecretFn func(id int, prefix, hash string, rotatedAt time.Time) error
+}
+
+func (m *mockRepository) Create(key *Key) error {
+	return m.CreateFn(key)
+}
+
+func (m *mockRepository) Find(id int) (*Key, error) {
+	return m.FindFn(id)
+}
+
+func (m *mockRepository) FindByHash(hash string) (*Key, error) {
+	return m.FindByHashFn(hash)
+}
+
+func (m *mockRepository) FindAll() ([]*Key, error) {
+	return m.FindAllFn()
+}
+
+func (m *mockRepository) UpdateSecret(id int, prefix, hash string, rotatedAt time.Time) error {
+	return m.UpdateSecretFn(id, prefix, hash, rotatedAt)
+}
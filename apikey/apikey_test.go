@@ -0,0 +1,143 @@
+package apikey
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+var now = time.Date(2021, 1, 31, 9, 0, 0, 0, time.UTC)
+
+// newTestRepository returns a repository of the keys by id, looked up by their hash.
+func newTestRepository(keys map[int]*Key) *mockRepository {
+	repo := &mockRepository{}
+	repo.CreateFn = func(key *Key) error {
+		key.ID = len(keys) + 1
+		copied := *key
+		keys[key.ID] = &copied
+		return nil
+	}
+	repo.FindFn = func(id int) (*Key, error) {
+		key, ok := keys[id]
+		if !ok {
+			return nil, ErrKeyNotFound
+		}
+		copied := *key
+		return &copied, nil
+	}
+	repo.FindByHashFn = func(hash string) (*Key, error) {
+		for _, key := range keys {
+			if key.Hash == hash {
+				copied := *key
+				return &copied, nil
+			}
+		}
+		return nil, ErrInvalidKey
+	}
+	repo.UpdateSecretFn = func(id int, prefix, hash string, rotatedAt time.Time) error {
+		key := keys[id]
+		key.Prefix, key.Hash, key.RotatedAt = prefix, hash, rotatedAt
+		return nil
+	}
+	return repo
+}
+
+func TestService_Create(t *testing.T) {
+	tests := []struct {
+		name    string
+		keyName string
+		wantErr error
+	}{
+		{
+			name:    "valid",
+			keyName: "  order service ",
+		},
+		{
+			name:    "no name",
+			keyName: " ",
+			wantErr: &payment.ValidationError{Errors: []payment.FieldError{{Field: "name", Code: payment.CodeRequired, Message: "name is required"}}},
+		},
+		{
+			name:    "name too long",
+			keyName: strings.Repeat("a", MaxNameLength+1),
+			wantErr: &payment.ValidationError{Errors: []payment.FieldError{{Field: "name", Code: payment.CodeTooLong, Message: "name must not exceed 100 characters"}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys := map[int]*Key{}
+			s := NewService(newTestRepository(keys))
+
+			key, secret, err := s.Create(tt.keyName)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Fatalf("Service.Create() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if key.Name != "order service" {
+				t.Errorf("Service.Create() name = %q, want %q", key.Name, "order service")
+			}
+			if !strings.HasPrefix(secret, key.Prefix) || !strings.HasPrefix(secret, "psk_") {
+				t.Errorf("Service.Create() secret %q does not start with the prefix %q", secret, key.Prefix)
+			}
+			if strings.Contains(keys[key.ID].Hash, secret) {
+				t.Errorf("Service.Create() stored the secret")
+			}
+
+			got, err := s.Authenticate(secret)
+			if err != nil || got.ID != key.ID {
+				t.Errorf("Service.Authenticate() = %v, %v, want key %d", got, err, key.ID)
+			}
+		})
+	}
+}
+
+func TestService_Rotate(t *testing.T) {
+	keys := map[int]*Key{}
+	s := NewService(newTestRepository(keys)).(*service)
+	s.now = func() time.Time { return now }
+
+	key, previous, err := s.Create("order service")
+	if err != nil {
+		t.Fatalf("Service.Create() error = %v", err)
+	}
+
+	rotated, secret, err := s.Rotate(key.ID)
+	if err != nil {
+		t.Fatalf("Service.Rotate() error = %v", err)
+	}
+	if secret == previous || rotated.Prefix == key.Prefix && rotated.Hash == key.Hash {
+		t.Errorf("Service.Rotate() kept the secret")
+	}
+	if !rotated.RotatedAt.Equal(now) {
+		t.Errorf("Service.Rotate() rotated at %v, want %v", rotated.RotatedAt, now)
+	}
+
+	if _, err := s.Authenticate(previous); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Service.Authenticate() previous secret error = %v, want %v", err, ErrInvalidKey)
+	}
+	if got, err := s.Authenticate(secret); err != nil || got.ID != key.ID {
+		t.Errorf("Service.Authenticate() = %v, %v, want key %d", got, err, key.ID)
+	}
+
+	if _, _, err := s.Rotate(2); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Service.Rotate() error = %v, want %v", err, ErrKeyNotFound)
+	}
+}
+
+func TestService_Authenticate_withoutPrefix(t *testing.T) {
+	repo := &mockRepository{}
+	repo.FindByHashFn = func(hash string) (*Key, error) {
+		t.Fatal("Service.Authenticate() looked up a secret without the prefix")
+		return nil, nil
+	}
+
+	if _, err := NewService(repo).Authenticate("alice-token"); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Service.Authenticate() error = %v, want %v", err, ErrInvalidKey)
+	}
+}
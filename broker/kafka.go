@@ -0,0 +1,63 @@
+package broker
+
+import (
+	"context"
+	"time"
+
+	"github.com/noppawitt/paymentsvc/payment"
+	"github.com/segmentio/kafka-go"
+)
+
+// Kafka publishes payment events to a Kafka topic.
+// Messages are keyed by payment id and partitioned by key hash, so the events of a payment are in the same
+// partition and consumed in order.
+type Kafka struct {
+	writer  *kafka.Writer
+	timeout time.Duration
+}
+
+// NewKafka returns a new Kafka publisher to the topic, each publish waits for every in-sync replica
+// to acknowledge the message within timeout.
+func NewKafka(brokers []string, topic string, timeout time.Duration) *Kafka {
+	return &Kafka{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			// events are published one at a time, waiting for a batch only delays them.
+			BatchTimeout: time.Millisecond,
+		},
+		timeout: timeout,
+	}
+}
+
+// Publish publishes the event, it does nothing if the event is not a lifecycle event.
+func (k *Kafka) Publish(e *payment.Event) error {
+	m, ok := newMessage(e)
+	if !ok {
+		return nil
+	}
+
+	body, err := m.body()
+	if err != nil {
+		return err
+	}
+
+	msg := kafka.Message{
+		Key:   []byte(m.key()),
+		Value: body,
+	}
+	for key, value := range m.headers() {
+		msg.Headers = append(msg.Headers, kafka.Header{Key: key, Value: []byte(value)})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), k.timeout)
+	defer cancel()
+	return k.writer.WriteMessages(ctx, msg)
+}
+
+// Close closes the connections to the brokers.
+func (k *Kafka) Close() error {
+	return k.writer.Close()
+}
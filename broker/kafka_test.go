@@ -0,0 +1,71 @@
+package broker
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/noppawitt/paymentsvc/payment"
+	"github.com/segmentio/kafka-go"
+)
+
+// TestKafka_Publish runs against the local brokers in KAFKA_BROKERS, e.g. a Kafka container.
+func TestKafka_Publish(t *testing.T) {
+	brokers := os.Getenv("KAFKA_BROKERS")
+	if brokers == "" {
+		t.Skip("KAFKA_BROKERS is not set")
+	}
+	topic := "paymentsvc-test-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	createTopic(t, strings.Split(brokers, ",")[0], topic)
+
+	k := NewKafka(strings.Split(brokers, ","), topic, 10*time.Second)
+	defer k.Close()
+
+	if err := k.Publish(newTestEvent(payment.EventStatusChanged, payment.StatusSuccessful)); err != nil {
+		t.Fatalf("Kafka.Publish() error = %v", err)
+	}
+
+	r := kafka.NewReader(kafka.ReaderConfig{Brokers: strings.Split(brokers, ","), Topic: topic})
+	defer r.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	msg, err := r.ReadMessage(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(msg.Key) != "1" {
+		t.Errorf("key = %s, want 1", msg.Key)
+	}
+	headers := make(map[string]string)
+	for _, h := range msg.Headers {
+		headers[h.Key] = string(h.Value)
+	}
+	if headers[HeaderEventID] != "payment.status_changed:1:successful" || headers[HeaderEventType] != string(EventPaymentSucceeded) {
+		t.Errorf("headers = %v", headers)
+	}
+}
+
+func createTopic(t *testing.T, broker, topic string) {
+	conn, err := kafka.Dial("tcp", broker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	controller, err := conn.Controller()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cconn, err := kafka.Dial("tcp", net.JoinHostPort(controller.Host, strconv.Itoa(controller.Port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cconn.Close()
+	if err := cconn.CreateTopics(kafka.TopicConfig{Topic: topic, NumPartitions: 1, ReplicationFactor: 1}); err != nil {
+		t.Fatal(err)
+	}
+}
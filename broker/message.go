@@ -0,0 +1,136 @@
+// Package broker publishes payment events to message brokers for other systems to consume.
+package broker
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+// SchemaVersion is the version of the message schema, it is increased on a breaking change so that
+// consumers can tell the messages they cannot read. Adding a field is not a breaking change.
+const SchemaVersion = 1
+
+// Headers of a message
+const (
+	HeaderEventID       = "event-id"
+	HeaderEventType     = "event-type"
+	HeaderSchemaVersion = "schema-version"
+)
+
+// EventType is the type of a payment lifecycle event.
+type EventType string
+
+// Event types
+const (
+	EventPaymentCreated   EventType = "payment.created"
+	EventPaymentSucceeded EventType = "payment.succeeded"
+	EventPaymentFailed    EventType = "payment.failed"
+	EventPaymentExpired   EventType = "payment.expired"
+	EventPaymentRefunded  EventType = "payment.refunded"
+)
+
+// statusEventTypes maps payment statuses to the type of the event published when a payment changes to the status.
+// There is no event for the other statuses.
+var statusEventTypes = map[payment.Status]EventType{
+	payment.StatusSuccessful: EventPaymentSucceeded,
+	payment.StatusCaptured:   EventPaymentSucceeded,
+	payment.StatusFailed:     EventPaymentFailed,
+	payment.StatusExpired:    EventPaymentExpired,
+}
+
+// message is the JSON body of a message. ID is the deduplication id of the payment event.
+// Refund is the refund of a refunded event.
+type message struct {
+	SchemaVersion  int            `json:"schema_version"`
+	ID             string         `json:"id"`
+	Type           EventType      `json:"type"`
+	OccurredAt     time.Time      `json:"occurred_at"`
+	PreviousStatus payment.Status `json:"previous_status,omitempty"`
+	Refund         *refundData    `json:"refund,omitempty"`
+	Payment        paymentData    `json:"payment"`
+}
+
+type refundData struct {
+	ID       string `json:"id"`
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+type paymentData struct {
+	ID             int               `json:"id"`
+	Reference      string            `json:"reference,omitempty"`
+	Description    string            `json:"description,omitempty"`
+	Metadata       map[string]string `json:"metadata,omitempty"`
+	Status         payment.Status    `json:"status"`
+	Amount         int64             `json:"amount"`
+	Currency       string            `json:"currency"`
+	SourceType     string            `json:"source_type"`
+	FailureCode    string            `json:"failure_code,omitempty"`
+	FailureMessage string            `json:"failure_message,omitempty"`
+	CreatedAt      time.Time         `json:"created_at"`
+	UpdatedAt      time.Time         `json:"updated_at"`
+}
+
+// newMessage returns the message of a payment event, or false if the event is not published.
+func newMessage(e *payment.Event) (*message, bool) {
+	var t EventType
+	var refund *refundData
+	switch e.Type {
+	case payment.EventCreated:
+		t = EventPaymentCreated
+	case payment.EventRefunded:
+		t = EventPaymentRefunded
+		refund = &refundData{ID: e.RefundID, Amount: e.Amount.Amount, Currency: e.Amount.Currency}
+	case payment.EventStatusChanged:
+		var ok bool
+		if t, ok = statusEventTypes[e.Payment.Status]; !ok {
+			return nil, false
+		}
+	default:
+		return nil, false
+	}
+
+	p := &e.Payment
+	return &message{
+		SchemaVersion:  SchemaVersion,
+		ID:             e.DeduplicationID,
+		Type:           t,
+		OccurredAt:     e.CreatedAt,
+		PreviousStatus: e.PreviousStatus,
+		Refund:         refund,
+		Payment: paymentData{
+			ID:             p.ID,
+			Reference:      p.Reference,
+			Description:    p.Description,
+			Metadata:       p.Metadata,
+			Status:         p.Status,
+			Amount:         p.Amount.Amount,
+			Currency:       p.Amount.Currency,
+			SourceType:     p.OmiseCharge.SourceType,
+			FailureCode:    p.OmiseCharge.FailureCode,
+			FailureMessage: p.OmiseCharge.FailureMessage,
+			CreatedAt:      p.CreatedAt,
+			UpdatedAt:      p.UpdatedAt,
+		},
+	}, true
+}
+
+// key returns the key of the message, the events of a payment have the same key so that they are kept in order.
+func (m *message) key() string {
+	return strconv.Itoa(m.Payment.ID)
+}
+
+func (m *message) headers() map[string]string {
+	return map[string]string{
+		HeaderEventID:       m.ID,
+		HeaderEventType:     string(m.Type),
+		HeaderSchemaVersion: strconv.Itoa(m.SchemaVersion),
+	}
+}
+
+func (m *message) body() ([]byte, error) {
+	return json.Marshal(m)
+}
@@ -0,0 +1,88 @@
+package broker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+var now = time.Date(2021, 1, 31, 9, 0, 0, 0, time.UTC)
+
+func newTestEvent(t payment.EventType, status payment.Status) *payment.Event {
+	return &payment.Event{
+		ID:              1,
+		DeduplicationID: "payment.status_changed:1:" + string(status),
+		Type:            t,
+		PaymentID:       1,
+		PreviousStatus:  payment.StatusPending,
+		Payment: payment.Payment{
+			ID:          1,
+			Reference:   "order-1001",
+			Status:      status,
+			Amount:      payment.NewMoney(2000, "THB"),
+			OmiseCharge: &payment.OmiseCharge{SourceType: "promptpay"},
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		},
+		CreatedAt: now,
+	}
+}
+
+func TestNewMessage(t *testing.T) {
+	tests := []struct {
+		name      string
+		eventType payment.EventType
+		status    payment.Status
+		want      EventType
+	}{
+		{name: "created", eventType: payment.EventCreated, status: payment.StatusPending, want: EventPaymentCreated},
+		{name: "succeeded", eventType: payment.EventStatusChanged, status: payment.StatusSuccessful, want: EventPaymentSucceeded},
+		{name: "captured", eventType: payment.EventStatusChanged, status: payment.StatusCaptured, want: EventPaymentSucceeded},
+		{name: "failed", eventType: payment.EventStatusChanged, status: payment.StatusFailed, want: EventPaymentFailed},
+		{name: "expired", eventType: payment.EventStatusChanged, status: payment.StatusExpired, want: EventPaymentExpired},
+		{name: "refunded", eventType: payment.EventRefunded, status: payment.StatusSuccessful, want: EventPaymentRefunded},
+		{name: "authorized is not published", eventType: payment.EventStatusChanged, status: payment.StatusAuthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := newMessage(newTestEvent(tt.eventType, tt.status))
+			if ok != (tt.want != "") {
+				t.Fatalf("newMessage() ok = %v, want %v", ok, tt.want != "")
+			}
+			if ok && got.Type != tt.want {
+				t.Errorf("newMessage() type = %v, want %v", got.Type, tt.want)
+			}
+		})
+	}
+}
+
+func TestMessage_body(t *testing.T) {
+	m, _ := newMessage(newTestEvent(payment.EventStatusChanged, payment.StatusSuccessful))
+	got, err := m.body()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"schema_version":1,"id":"payment.status_changed:1:successful","type":"payment.succeeded","occurred_at":"2021-01-31T09:00:00Z","previous_status":"pending","payment":{"id":1,"reference":"order-1001","status":"successful","amount":2000,"currency":"THB","source_type":"promptpay","created_at":"2021-01-31T09:00:00Z","updated_at":"2021-01-31T09:00:00Z"}}`
+	if string(got) != want {
+		t.Errorf("message.body() = %s, want %s", got, want)
+	}
+	if m.key() != "1" {
+		t.Errorf("message.key() = %v, want 1", m.key())
+	}
+
+	e := newTestEvent(payment.EventRefunded, payment.StatusSuccessful)
+	e.DeduplicationID = "payment.refunded:1:rfnd_1"
+	e.PreviousStatus = ""
+	e.RefundID = "rfnd_1"
+	e.Amount = payment.NewMoney(500, "THB")
+	m, _ = newMessage(e)
+	if got, err = m.body(); err != nil {
+		t.Fatal(err)
+	}
+	want = `{"schema_version":1,"id":"payment.refunded:1:rfnd_1","type":"payment.refunded","occurred_at":"2021-01-31T09:00:00Z","refund":{"id":"rfnd_1","amount":500,"currency":"THB"},"payment":{"id":1,"reference":"order-1001","status":"successful","amount":2000,"currency":"THB","source_type":"promptpay","created_at":"2021-01-31T09:00:00Z","updated_at":"2021-01-31T09:00:00Z"}}`
+	if string(got) != want {
+		t.Errorf("message.body() = %s, want %s", got, want)
+	}
+}
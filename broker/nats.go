@@ -0,0 +1,77 @@
+package broker
+
+import (
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+// NATS publishes payment events to NATS on the subject <subject>.<payment id>, consumers subscribe to <subject>.>.
+// A single connection publishes the events in order, so the events of a payment are received in order.
+// With JetStream, each publish waits for the stream to store the message and the stream drops a message
+// with a deduplication id it has already stored. Without JetStream, a publish only waits for the server
+// to receive the message.
+type NATS struct {
+	conn    *nats.Conn
+	js      nats.JetStreamContext
+	subject string
+	timeout time.Duration
+}
+
+// NewNATS connects to the NATS server at url and returns a new NATS publisher to the subject.
+func NewNATS(url, subject string, jetStream bool, timeout time.Duration) (*NATS, error) {
+	conn, err := nats.Connect(url, nats.Name("paymentsvc"), nats.Timeout(timeout))
+	if err != nil {
+		return nil, err
+	}
+
+	n := &NATS{
+		conn:    conn,
+		subject: subject,
+		timeout: timeout,
+	}
+	if jetStream {
+		n.js, err = conn.JetStream(nats.MaxWait(timeout))
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+// Publish publishes the event, it does nothing if the event is not a lifecycle event.
+func (n *NATS) Publish(e *payment.Event) error {
+	m, ok := newMessage(e)
+	if !ok {
+		return nil
+	}
+
+	body, err := m.body()
+	if err != nil {
+		return err
+	}
+
+	msg := nats.NewMsg(n.subject + "." + m.key())
+	msg.Data = body
+	for key, value := range m.headers() {
+		msg.Header.Set(key, value)
+	}
+
+	if n.js != nil {
+		msg.Header.Set(nats.MsgIdHdr, m.ID)
+		_, err := n.js.PublishMsg(msg)
+		return err
+	}
+
+	if err := n.conn.PublishMsg(msg); err != nil {
+		return err
+	}
+	return n.conn.FlushTimeout(n.timeout)
+}
+
+// Close closes the connection to the server.
+func (n *NATS) Close() {
+	n.conn.Close()
+}
@@ -0,0 +1,114 @@
+package broker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+// runNATSServer runs an in-process NATS server with JetStream.
+func runNATSServer(t *testing.T) *server.Server {
+	s, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      server.RANDOM_PORT,
+		NoLog:     true,
+		NoSigs:    true,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Start()
+	if !s.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server is not ready")
+	}
+	t.Cleanup(s.Shutdown)
+	return s
+}
+
+func TestNATS_Publish(t *testing.T) {
+	s := runNATSServer(t)
+
+	conn, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	sub, err := conn.SubscribeSync("payments.>")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := NewNATS(s.ClientURL(), "payments", false, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	if err := n.Publish(newTestEvent(payment.EventStatusChanged, payment.StatusAuthorized)); err != nil {
+		t.Fatalf("NATS.Publish() error = %v", err)
+	}
+	if err := n.Publish(newTestEvent(payment.EventStatusChanged, payment.StatusSuccessful)); err != nil {
+		t.Fatalf("NATS.Publish() error = %v", err)
+	}
+
+	msg, err := sub.NextMsg(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Subject != "payments.1" {
+		t.Errorf("subject = %v, want payments.1", msg.Subject)
+	}
+	if got := msg.Header.Get(HeaderEventType); got != string(EventPaymentSucceeded) {
+		t.Errorf("%s = %v, want %v", HeaderEventType, got, EventPaymentSucceeded)
+	}
+	if got := msg.Header.Get(HeaderSchemaVersion); got != "1" {
+		t.Errorf("%s = %v, want 1", HeaderSchemaVersion, got)
+	}
+	if _, err := sub.NextMsg(100 * time.Millisecond); err != nats.ErrTimeout {
+		t.Errorf("NextMsg() error = %v, want only the succeeded event", err)
+	}
+}
+
+func TestNATS_Publish_jetStream(t *testing.T) {
+	s := runNATSServer(t)
+
+	conn, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	js, err := conn.JetStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := js.AddStream(&nats.StreamConfig{Name: "PAYMENTS", Subjects: []string{"payments.>"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := NewNATS(s.ClientURL(), "payments", true, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	// the same event published twice is stored once.
+	e := newTestEvent(payment.EventStatusChanged, payment.StatusSuccessful)
+	for i := 0; i < 2; i++ {
+		if err := n.Publish(e); err != nil {
+			t.Fatalf("NATS.Publish() error = %v", err)
+		}
+	}
+
+	info, err := js.StreamInfo("PAYMENTS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.State.Msgs != 1 {
+		t.Errorf("stream messages = %v, want 1", info.State.Msgs)
+	}
+}
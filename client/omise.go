@@ -1,7 +1,12 @@
 package client
 
 import (
+	"errors"
 	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/noppawitt/paymentsvc/payment"
 	"github.com/omise/omise-go"
@@ -9,76 +14,473 @@ import (
 )
 
 // Omise is a wrapper of the Omise Go client.
+// The payer is returned from the payment gateway to the service's return page of the payment under returnURL,
+// or to the merchant's return URI directly if returnURL is empty.
 type Omise struct {
-	client *omise.Client
+	client    *omise.Client
+	returnURL string
 }
 
 // NewOmise returns a new omise client.
-func NewOmise(publicKey, secretKey string) *Omise {
+func NewOmise(publicKey, secretKey, returnURL string) *Omise {
 	client, err := omise.NewClient(publicKey, secretKey)
 	if err != nil {
 		log.Fatal(err)
 	}
 	return &Omise{
-		client: client,
+		client:    client,
+		returnURL: strings.TrimSuffix(returnURL, "/"),
 	}
 }
 
 // Charge charges the payment source.
-func (c *Omise) Charge(req *payment.Request) (*payment.OmiseCharge, error) {
-	source := &omise.Source{}
-	createSource := &operations.CreateSource{
-		Type:     req.SourceType,
-		Amount:   req.Amount,
-		Currency: req.Currency,
+// A card is charged by its token, or by its card id if it is saved to the customer.
+// Any other source type is created as an Omise source before charging.
+// Card charges requiring 3-D Secure are pending until the payer is authenticated at the authorize URI.
+// The payer returns to the service's return page of the payment instead of the merchant's return URI, if any,
+// which redirects to the merchant's return URI with the signed payment result.
+func (c *Omise) Charge(id int, req *payment.Request, customer *payment.Customer) (*payment.OmiseCharge, error) {
+	createCharge := &operations.CreateCharge{
+		Amount:      req.Amount.Amount,
+		Currency:    req.Amount.Currency,
+		Description: req.Description,
+		Metadata:    chargeMetadata(req),
 	}
-
-	if err := c.client.Do(source, createSource); err != nil {
-		return nil, err
+	switch {
+	case req.ReturnURI == "":
+	case c.returnURL == "":
+		createCharge.ReturnURI = req.ReturnURI
+	default:
+		createCharge.ReturnURI = c.returnURL + "/" + strconv.Itoa(id)
 	}
 
-	charge := &omise.Charge{}
-	createCharge := &operations.CreateCharge{
-		Source:    source.ID,
-		Amount:    source.Amount,
-		Currency:  source.Currency,
-		ReturnURI: req.ReturnURI,
-	}
+	if req.SourceType == payment.SourceTypeCard {
+		createCharge.Card = req.CardToken
+		if customer != nil {
+			createCharge.Customer = customer.OmiseCustomerID
+			createCharge.Card = req.CardID
+		}
+		if !req.Capture {
+			// pre-authorization allows capturing less than the authorized amount.
+			createCharge.DontCapture = true
+			createCharge.AuthorizationType = omise.PreAuth
+		}
+	} else {
+		source := &omise.Source{}
+		createSource := &operations.CreateSource{
+			Type:                     req.SourceType,
+			Amount:                   req.Amount.Amount,
+			Currency:                 req.Amount.Currency,
+			PhoneNumber:              req.PhoneNumber,
+			Email:                    req.Email,
+			Name:                     req.Name,
+			PlatformType:             req.PlatformType,
+			InstallmentTerm:          int64(req.InstallmentTerm),
+			ZeroInterestInstallments: req.ZeroInterestInstallments,
+		}
 
-	if err := c.client.Do(charge, createCharge); err != nil {
-		return nil, err
+		if err := c.client.Do(source, createSource); err != nil {
+			return nil, translateError(err)
+		}
+		createCharge.Source = source.ID
 	}
 
-	omiseCharge := &payment.OmiseCharge{
-		ID:           charge.ID,
-		Status:       payment.Status(charge.Status),
-		Amount:       charge.Amount,
-		Currency:     charge.Currency,
-		AuthorizeURI: charge.AuthorizeURI,
-		SourceType:   charge.Source.Type,
-		ReturnURI:    charge.ReturnURI,
+	charge := &omiseCharge{}
+	if err := c.client.Do(charge, createCharge); err != nil {
+		return nil, translateError(err)
 	}
 
-	return omiseCharge, nil
+	return newOmiseCharge(charge), nil
 }
 
 // GetCharge gets a charge with the given charge id.
 func (c *Omise) GetCharge(id string) (*payment.OmiseCharge, error) {
-	charge := &omise.Charge{}
+	charge := &omiseCharge{}
 	retrieve := &operations.RetrieveCharge{ChargeID: id}
 	if err := c.client.Do(charge, retrieve); err != nil {
-		return nil, err
+		return nil, translateError(err)
 	}
 
+	return newOmiseCharge(charge), nil
+}
+
+// listChargesLimit is the largest page of charges the Omise API returns.
+const listChargesLimit = 100
+
+// ListCharges lists the charges created in [from, to), oldest first.
+func (c *Omise) ListCharges(from, to time.Time) ([]*payment.OmiseCharge, error) {
+	var charges []*payment.OmiseCharge
+	for offset := 0; ; {
+		list := &struct {
+			omise.List
+			Data []*omiseCharge `json:"data"`
+		}{}
+		operation := &operations.ListCharges{List: operations.List{
+			Offset: offset,
+			Limit:  listChargesLimit,
+			From:   from,
+			To:     to,
+			Order:  omise.Chronological,
+		}}
+		if err := c.client.Do(list, operation); err != nil {
+			return nil, translateError(err)
+		}
+
+		for _, charge := range list.Data {
+			// the Omise API includes a charge created at the end of the range.
+			if !charge.Created.Before(to) {
+				continue
+			}
+			charges = append(charges, newOmiseCharge(charge))
+		}
+		offset += len(list.Data)
+		if len(list.Data) == 0 || offset >= list.Total {
+			return charges, nil
+		}
+	}
+}
+
+// Capture captures an authorized charge with the given charge id.
+// A zero amount captures the whole authorized amount.
+func (c *Omise) Capture(id string, amount payment.Money) (*payment.OmiseCharge, error) {
+	charge := &omiseCharge{}
+	capture := &operations.CaptureCharge{
+		ChargeID:      id,
+		CaptureAmount: amount.Amount,
+	}
+	if err := c.client.Do(charge, capture); err != nil {
+		return nil, translateError(err)
+	}
+
+	return newOmiseCharge(charge), nil
+}
+
+// Void voids an authorized charge with the given charge id by reversing it.
+func (c *Omise) Void(id string) (*payment.OmiseCharge, error) {
+	charge := &omiseCharge{}
+	reverse := &operations.ReverseCharge{ChargeID: id}
+	if err := c.client.Do(charge, reverse); err != nil {
+		return nil, translateError(err)
+	}
+
+	return newOmiseCharge(charge), nil
+}
+
+// Refund refunds the given amount of a paid charge with the given charge id.
+func (c *Omise) Refund(chargeID string, amount payment.Money) (*payment.Refund, error) {
+	refund := &omise.Refund{}
+	create := &operations.CreateRefund{
+		ChargeID: chargeID,
+		Amount:   amount.Amount,
+	}
+	if err := c.client.Do(refund, create); err != nil {
+		return nil, translateError(err)
+	}
+
+	return &payment.Refund{
+		ID:        refund.ID,
+		Amount:    payment.NewMoney(refund.Amount, strings.ToUpper(refund.Currency)),
+		CreatedAt: refund.Created,
+	}, nil
+}
+
+// Card returns the card a card payment request charges, retrieving the token does not use it up.
+func (c *Omise) Card(req *payment.Request, customer *payment.Customer) (*payment.Card, error) {
+	if customer != nil {
+		card := &omise.Card{}
+		retrieve := &operations.RetrieveCard{
+			CustomerID: customer.OmiseCustomerID,
+			CardID:     req.CardID,
+		}
+		if err := c.client.Do(card, retrieve); err != nil {
+			return nil, translateError(err)
+		}
+		return newCard(card), nil
+	}
+
+	token := &omise.Token{}
+	if err := c.client.Do(token, &operations.RetrieveToken{ID: req.CardToken}); err != nil {
+		return nil, translateError(err)
+	}
+	return newCard(token.Card), nil
+}
+
+// PaymentMethods returns the payment methods enabled for the Omise account.
+func (c *Omise) PaymentMethods() ([]payment.PaymentMethod, error) {
+	capability := &omise.Capability{}
+	if err := c.client.Do(capability, &operations.RetrieveCapability{}); err != nil {
+		return nil, translateError(err)
+	}
+
+	methods := make([]payment.PaymentMethod, len(capability.PaymentMethods))
+	for i, m := range capability.PaymentMethods {
+		currencies := make([]string, len(m.Currencies))
+		for j, c := range m.Currencies {
+			currencies[j] = strings.ToUpper(c)
+		}
+		methods[i] = payment.PaymentMethod{
+			SourceType: payment.SourceType{
+				Name:       m.Name,
+				Currencies: currencies,
+			},
+			CardBrands:       m.CardBrands,
+			InstallmentTerms: m.InstallmentTerms,
+		}
+	}
+
+	return methods, nil
+}
+
+// CreateCustomer creates an Omise customer and returns its id.
+func (c *Omise) CreateCustomer(customer *payment.Customer) (string, error) {
+	omiseCustomer := &omise.Customer{}
+	create := &operations.CreateCustomer{
+		Email:       customer.Email,
+		Description: customer.Description,
+	}
+	if err := c.client.Do(omiseCustomer, create); err != nil {
+		return "", translateError(err)
+	}
+
+	return omiseCustomer.ID, nil
+}
+
+// AttachCard saves the card of the card token to the Omise customer.
+// The card is returned from the updated customer as its newest card.
+func (c *Omise) AttachCard(omiseCustomerID, cardToken string) (*payment.SavedCard, error) {
+	omiseCustomer := &omise.Customer{}
+	update := &operations.UpdateCustomer{
+		CustomerID: omiseCustomerID,
+		Card:       cardToken,
+	}
+	if err := c.client.Do(omiseCustomer, update); err != nil {
+		return nil, translateError(err)
+	}
+
+	var newest *omise.Card
+	if omiseCustomer.Cards != nil {
+		for _, card := range omiseCustomer.Cards.Data {
+			if newest == nil || card.Created.After(newest.Created) {
+				newest = card
+			}
+		}
+	}
+	if newest == nil {
+		return nil, translateError(errors.New("attached card is missing from the customer"))
+	}
+
+	return newSavedCard(newest), nil
+}
+
+// Cards returns the cards saved to the Omise customer.
+func (c *Omise) Cards(omiseCustomerID string) ([]payment.SavedCard, error) {
+	cards := &omise.CardList{}
+	list := &operations.ListCards{CustomerID: omiseCustomerID}
+	if err := c.client.Do(cards, list); err != nil {
+		return nil, translateError(err)
+	}
+
+	saved := make([]payment.SavedCard, len(cards.Data))
+	for i, card := range cards.Data {
+		saved[i] = *newSavedCard(card)
+	}
+
+	return saved, nil
+}
+
+// DeleteCard deletes a card saved to the Omise customer.
+func (c *Omise) DeleteCard(omiseCustomerID, cardID string) error {
+	deletion := &omise.Deletion{}
+	destroy := &operations.DestroyCard{
+		CustomerID: omiseCustomerID,
+		CardID:     cardID,
+	}
+	if err := c.client.Do(deletion, destroy); err != nil {
+		return translateError(err)
+	}
+
+	return nil
+}
+
+func newCard(card *omise.Card) *payment.Card {
+	return &payment.Card{
+		Brand:           card.Brand,
+		LastDigits:      card.LastDigits,
+		ExpirationMonth: int(card.ExpirationMonth),
+		ExpirationYear:  card.ExpirationYear,
+		Fingerprint:     card.Fingerprint,
+		Country:         card.Country,
+	}
+}
+
+func newSavedCard(card *omise.Card) *payment.SavedCard {
+	return &payment.SavedCard{
+		ID:        card.ID,
+		Card:      *newCard(card),
+		CreatedAt: card.Created,
+	}
+}
+
+// omiseCharge extends the Omise charge object with attributes the Omise Go client does not decode.
+type omiseCharge struct {
+	omise.Charge
+	Source *omiseSource `json:"source"`
+	Fee    int64        `json:"fee"`
+	FeeVAT int64        `json:"fee_vat"`
+	Net    int64        `json:"net"`
+	PaidAt *time.Time   `json:"paid_at"`
+}
+
+type omiseSource struct {
+	omise.Source
+	ScannableCode *omiseScannableCode `json:"scannable_code"`
+	References    *omiseReferences    `json:"references"`
+}
+
+// omiseReferences contains the references of a bill payment source.
+// The barcode of the Omise Go client is the URI of the rendered barcode.
+type omiseReferences struct {
+	omise.References
+	ReferenceNumber1 string `json:"reference_number_1"`
+	ReferenceNumber2 string `json:"reference_number_2"`
+	OmiseTaxID       string `json:"omise_tax_id"`
+}
+
+type omiseScannableCode struct {
+	omise.ScannableCode
+	RawData string `json:"raw_data"`
+}
+
+func newOmiseCharge(charge *omiseCharge) *payment.OmiseCharge {
 	omiseCharge := &payment.OmiseCharge{
-		ID:           charge.ID,
-		Status:       payment.Status(charge.Status),
-		Amount:       charge.Amount,
-		Currency:     charge.Currency,
-		AuthorizeURI: charge.AuthorizeURI,
-		SourceType:   charge.Source.Type,
-		ReturnURI:    charge.ReturnURI,
+		ID:             charge.ID,
+		Status:         chargeStatus(charge),
+		Amount:         payment.NewMoney(charge.Amount, strings.ToUpper(charge.Currency)),
+		AuthorizeURI:   charge.AuthorizeURI,
+		ReturnURI:      charge.ReturnURI,
+		CapturedAmount: payment.NewMoney(charge.CapturedAmount, strings.ToUpper(charge.Currency)),
+		TransactionID:  charge.Transaction,
+	}
+
+	// the fees are known once the charge is paid.
+	if charge.PaidAt != nil {
+		currency := strings.ToUpper(charge.Currency)
+		omiseCharge.Fee = payment.NewMoney(charge.Fee, currency)
+		omiseCharge.FeeVAT = payment.NewMoney(charge.FeeVAT, currency)
+		omiseCharge.Net = payment.NewMoney(charge.Net, currency)
+		omiseCharge.PaidAt = *charge.PaidAt
+	}
+
+	if charge.FailureCode != nil {
+		omiseCharge.FailureCode = *charge.FailureCode
+	}
+	if charge.FailureMessage != nil {
+		omiseCharge.FailureMessage = *charge.FailureMessage
+	}
+
+	if card := charge.Card; card != nil {
+		omiseCharge.SourceType = payment.SourceTypeCard
+		omiseCharge.Card = newCard(card)
+	}
+
+	if charge.Source != nil {
+		omiseCharge.SourceType = charge.Source.Type
+		if code := charge.Source.ScannableCode; code != nil {
+			omiseCharge.QRCode = &payment.QRCode{
+				Payload:   code.RawData,
+				ExpiresAt: charge.ExpiresAt,
+			}
+			if code.Image != nil {
+				omiseCharge.QRCode.ImageURI = code.Image.DownloadURI
+			}
+		}
+		if refs := charge.Source.References; refs != nil {
+			omiseCharge.BillPayment = &payment.BillPayment{
+				TaxID:           refs.OmiseTaxID,
+				Reference1:      refs.ReferenceNumber1,
+				Reference2:      refs.ReferenceNumber2,
+				BarcodeImageURI: refs.Barcode,
+				ExpiresAt:       refs.ExpiresAt,
+			}
+		}
+	}
+
+	return omiseCharge
+}
+
+// chargeStatus returns the payment status of the charge.
+// Charges which are not captured on creation are authorized, captured or voided instead of
+// pending, successful or reversed.
+func chargeStatus(charge *omiseCharge) payment.Status {
+	if charge.Capture {
+		return payment.Status(charge.Status)
+	}
+	switch {
+	case charge.Status == omise.ChargePending && charge.Authorized:
+		return payment.StatusAuthorized
+	case charge.Status == omise.ChargeSuccessful:
+		return payment.StatusCaptured
+	case charge.Status == omise.ChargeReversed:
+		return payment.StatusVoided
+	default:
+		return payment.Status(charge.Status)
+	}
+}
+
+// chargeMetadata converts the payment metadata to the Omise charge metadata.
+// The merchant reference is included so the charge can be found on the Omise dashboard.
+func chargeMetadata(req *payment.Request) map[string]interface{} {
+	if len(req.Metadata) == 0 && req.Reference == "" {
+		return nil
+	}
+	metadata := make(map[string]interface{}, len(req.Metadata)+1)
+	for k, v := range req.Metadata {
+		metadata[k] = v
+	}
+	if req.Reference != "" {
+		metadata["reference"] = req.Reference
+	}
+	return metadata
+}
+
+// declinedErrorCodes contains Omise error codes of charges rejected by the gateway or the issuer.
+var declinedErrorCodes = map[string]bool{
+	"failed_processing":     true,
+	"insufficient_fund":     true,
+	"insufficient_balance":  true,
+	"invalid_security_code": true,
+	"payment_rejected":      true,
+	"stolen_or_lost_card":   true,
+	"failed_fraud_check":    true,
+	"failed_capture":        true,
+	"failed_refund":         true,
+}
+
+// translateError translates an error returned by the Omise client into a payment error.
+// Errors which are not caused by the request are reported as the gateway is unavailable
+// without exposing their details.
+func translateError(err error) error {
+	perr := &payment.Error{
+		Code:    payment.ErrorCodeGatewayUnavailable,
+		Message: "payment gateway is unavailable",
+		Err:     err,
+	}
+
+	oerr, ok := err.(*omise.Error)
+	if !ok {
+		return perr
+	}
+
+	switch {
+	case oerr.Code == "not_found":
+		perr.Code, perr.Message = payment.ErrorCodeNotFound, oerr.Message
+	case declinedErrorCodes[oerr.Code]:
+		perr.Code, perr.Message = payment.ErrorCodeGatewayDeclined, oerr.Message
+	case oerr.StatusCode == http.StatusConflict:
+		perr.Code, perr.Message = payment.ErrorCodeConflict, oerr.Message
+	case oerr.StatusCode >= 400 && oerr.StatusCode < 500 && oerr.StatusCode != http.StatusUnauthorized:
+		perr.Code, perr.Message = payment.ErrorCodeInvalidRequest, oerr.Message
 	}
 
-	return omiseCharge, nil
+	return perr
 }
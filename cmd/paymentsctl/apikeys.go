@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+type apiKey struct {
+	ID        int        `json:"id"`
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix"`
+	Secret    string     `json:"secret"`
+	CreatedAt time.Time  `json:"created_at"`
+	RotatedAt *time.Time `json:"rotated_at"`
+}
+
+const apiKeysUsage = `usage: paymentsctl api-keys <list|create|rotate> [flags]
+
+  list                  list the API keys without their secrets
+  create -name <name>   create an API key and print its secret
+  rotate <key id>       replace the secret of an API key and print the new secret
+`
+
+// apiKeys lists, creates or rotates the API keys through the admin API.
+// A secret is only printed when it is created or rotated, the service cannot show it again.
+func apiKeys(c *apiClient, args []string) {
+	if len(args) < 1 {
+		fmt.Fprint(os.Stderr, apiKeysUsage)
+		os.Exit(2)
+	}
+
+	flags := flag.NewFlagSet("api-keys "+args[0], flag.ExitOnError)
+	output := outputFlag(flags)
+	var keys []*apiKey
+	switch args[0] {
+	case "list":
+		flags.Parse(args[1:])
+		var list struct {
+			APIKeys []*apiKey `json:"api_keys"`
+		}
+		if err := c.do(http.MethodGet, "/admin/api-keys", nil, "", nil, &list); err != nil {
+			log.Fatal(err)
+		}
+		keys = list.APIKeys
+	case "create":
+		name := flags.String("name", "", "name of the API key, such as the service which uses it")
+		flags.Parse(args[1:])
+		body, err := json.Marshal(map[string]string{"name": *name})
+		if err != nil {
+			log.Fatal(err)
+		}
+		key := &apiKey{}
+		if err := c.do(http.MethodPost, "/admin/api-keys", nil, "application/json", bytes.NewReader(body), key); err != nil {
+			log.Fatal(err)
+		}
+		keys = []*apiKey{key}
+	case "rotate":
+		flags.Parse(args[1:])
+		if flags.NArg() != 1 {
+			fmt.Fprint(os.Stderr, apiKeysUsage)
+			os.Exit(2)
+		}
+		id := flags.Arg(0)
+		if _, err := strconv.Atoi(id); err != nil {
+			log.Fatal("API key id must be a number")
+		}
+		key := &apiKey{}
+		if err := c.do(http.MethodPost, "/admin/api-keys/"+id+"/rotate", nil, "", nil, key); err != nil {
+			log.Fatal(err)
+		}
+		keys = []*apiKey{key}
+	default:
+		fmt.Fprint(os.Stderr, apiKeysUsage)
+		os.Exit(2)
+	}
+
+	if *output == outputJSON {
+		printJSON(keys)
+		return
+	}
+	rows := make([][]string, len(keys))
+	for i, k := range keys {
+		rotatedAt := ""
+		if k.RotatedAt != nil {
+			rotatedAt = formatTime(*k.RotatedAt)
+		}
+		rows[i] = []string{strconv.Itoa(k.ID), k.Name, k.Prefix, formatTime(k.CreatedAt), rotatedAt}
+	}
+	printTable([]string{"ID", "NAME", "PREFIX", "CREATED AT", "ROTATED AT"}, rows)
+	if len(keys) == 1 && keys[0].Secret != "" {
+		fmt.Println("\nSecret:", keys[0].Secret)
+		log.Print("the secret cannot be shown again, store it now")
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+)
+
+// export writes the payments created between two days to a file, which is removed if the export is incomplete.
+func export(c *apiClient, args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	from := flags.String("from", "", "first day of the payments to export, in the YYYY-MM-DD format (required)")
+	to := flags.String("to", "", "last day of the payments to export, in the YYYY-MM-DD format (required)")
+	timezone := flags.String("timezone", "", "time zone of the days, UTC by default")
+	format := flags.String("format", "csv", "format of the export, csv or jsonl")
+	output := flags.String("o", "", "file to write, payments-<from>-<to>.<format> by default")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: paymentsctl export -from YYYY-MM-DD -to YYYY-MM-DD [flags]\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	query := url.Values{
+		"from":   {*from},
+		"to":     {*to},
+		"format": {*format},
+	}
+	if *timezone != "" {
+		query.Set("timezone", *timezone)
+	}
+	if *output == "" {
+		*output = "payments-" + *from + "-" + *to + "." + *format
+	}
+
+	f, err := os.Create(*output)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = c.download("/payments/export", query, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(*output)
+		log.Fatal(err)
+	}
+	log.Printf("exported payments to %s", *output)
+}
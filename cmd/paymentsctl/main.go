@@ -0,0 +1,188 @@
+// Command paymentsctl operates the payment service through its API.
+//
+// Usage:
+//
+//	paymentsctl <command> [flags]
+//
+// The service is at the PAYMENTSVC_URL environment variable, http://localhost:8080 by default.
+// Requests are authenticated with the API key of the PAYMENTSVC_API_KEY environment variable, or without one
+// with the operator token of PAYMENTSVC_ADMIN_TOKEN, and the requests to the admin API with the operator token.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultURL = "http://localhost:8080"
+	// requestTimeout is long enough for the service to list a month of charges from the payment gateway,
+	// or to export a month of payments.
+	requestTimeout = 10 * time.Minute
+)
+
+const usage = `usage: paymentsctl <command> [flags]
+
+commands:
+  list       list the payments matching filters
+  show       show a payment with its events
+  refresh    refresh a payment from its charge
+  refund     refund a paid payment
+  expire     refresh the stale pending payments, expiring those the payment gateway expired
+  export     export the payments as CSV or JSON lines to a file
+  reconcile  reconcile the payments with the charges of the payment gateway
+  api-keys   list, create or rotate the API keys
+
+Run paymentsctl <command> -h for the flags of a command.
+Commands printing results print a table, or JSON with -output json.
+`
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("paymentsctl: ")
+
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	c := &apiClient{
+		baseURL:    strings.TrimSuffix(getEnv("PAYMENTSVC_URL", defaultURL), "/"),
+		apiKey:     getEnv("PAYMENTSVC_API_KEY", ""),
+		adminToken: getEnv("PAYMENTSVC_ADMIN_TOKEN", ""),
+		client:     &http.Client{Timeout: requestTimeout},
+	}
+	switch os.Args[1] {
+	case "list":
+		listPayments(c, os.Args[2:])
+	case "show":
+		showPayment(c, os.Args[2:])
+	case "refresh":
+		refreshPayment(c, os.Args[2:])
+	case "refund":
+		refundPayment(c, os.Args[2:])
+	case "expire":
+		expirePayments(c, os.Args[2:])
+	case "export":
+		export(c, os.Args[2:])
+	case "reconcile":
+		reconcile(c, os.Args[2:])
+	case "api-keys":
+		apiKeys(c, os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+// apiClient calls the API of the service.
+// The admin API is called with the admin token, the rest of the API with the API key, or the admin token without one.
+type apiClient struct {
+	baseURL    string
+	apiKey     string
+	adminToken string
+	client     *http.Client
+}
+
+type fieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// apiError is an error response of the service.
+type apiError struct {
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Errors  []fieldError `json:"errors"`
+}
+
+func (e *apiError) Error() string {
+	msg := e.Code + ": " + e.Message
+	for _, fe := range e.Errors {
+		msg += "\n  " + fe.Field + ": " + fe.Message
+	}
+	return msg
+}
+
+// send sends a request with an optional body of the content type.
+// An error response is returned as an *apiError, the caller closes the body of any other response.
+func (c *apiClient) send(method, path string, query url.Values, contentType string, body io.Reader) (*http.Response, error) {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	token := c.apiKey
+	if token == "" || strings.HasPrefix(path, "/admin/") {
+		token = c.adminToken
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode >= http.StatusBadRequest {
+		defer res.Body.Close()
+		apiErr := &apiError{}
+		if err := json.NewDecoder(res.Body).Decode(apiErr); err != nil {
+			return nil, fmt.Errorf("%s %s: %s", method, path, res.Status)
+		}
+		return nil, apiErr
+	}
+	return res, nil
+}
+
+// do sends a request with an optional body of the content type and decodes the JSON response into v.
+func (c *apiClient) do(method, path string, query url.Values, contentType string, body io.Reader, v interface{}) error {
+	res, err := c.send(method, path, query, contentType, body)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// download sends a GET request and copies the response body to w.
+func (c *apiClient) download(path string, query url.Values, w io.Writer) error {
+	res, err := c.send(http.MethodGet, path, query, "", nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, err = io.Copy(w, res.Body)
+	return err
+}
+
+// printJSON prints v as indented JSON to the standard output.
+func printJSON(v interface{}) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func getEnv(key, fallback string) string {
+	val, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	return val
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// outputMode is the output mode of a command, set with the -output flag.
+type outputMode string
+
+// Output modes
+const (
+	outputTable outputMode = "table"
+	outputJSON  outputMode = "json"
+)
+
+func (o *outputMode) String() string {
+	return string(*o)
+}
+
+func (o *outputMode) Set(s string) error {
+	if mode := outputMode(s); mode != outputTable && mode != outputJSON {
+		return errors.New("must be table or json")
+	}
+	*o = outputMode(s)
+	return nil
+}
+
+// outputFlag defines the -output flag of a command, a table by default.
+func outputFlag(flags *flag.FlagSet) *outputMode {
+	mode := outputTable
+	flags.Var(&mode, "output", "output mode, table or json")
+	return &mode
+}
+
+// printTable prints the rows as a table with aligned columns to the standard output.
+func printTable(header []string, rows [][]string) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	tw.Flush()
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// payment is the part of a payment of the API the tables show, JSON output prints the whole payment.
+type payment struct {
+	ID             int       `json:"id"`
+	Reference      string    `json:"reference"`
+	Status         string    `json:"status"`
+	AmountDecimal  string    `json:"amount_decimal"`
+	Currency       string    `json:"currency"`
+	SourceType     string    `json:"source_type"`
+	FailureMessage string    `json:"failure_message"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+type paymentList struct {
+	Payments []json.RawMessage `json:"payments"`
+	HasMore  bool              `json:"has_more"`
+}
+
+type paymentEvent struct {
+	ID             int                  `json:"id"`
+	Type           string               `json:"type"`
+	PreviousStatus string               `json:"previous_status"`
+	Status         string               `json:"status"`
+	CreatedAt      time.Time            `json:"created_at"`
+	Published      map[string]time.Time `json:"published"`
+	Parked         map[string]time.Time `json:"parked"`
+}
+
+var paymentHeader = []string{"ID", "REFERENCE", "STATUS", "SOURCE TYPE", "AMOUNT", "CURRENCY", "CREATED AT"}
+
+func paymentRow(p *payment) []string {
+	return []string{
+		strconv.Itoa(p.ID), p.Reference, p.Status, p.SourceType, p.AmountDecimal, p.Currency, formatTime(p.CreatedAt),
+	}
+}
+
+func formatTime(t time.Time) string {
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+// decodePayments decodes the payments of a list for a table.
+func decodePayments(raw []json.RawMessage) []*payment {
+	payments := make([]*payment, len(raw))
+	for i, r := range raw {
+		payments[i] = &payment{}
+		if err := json.Unmarshal(r, payments[i]); err != nil {
+			log.Fatal(err)
+		}
+	}
+	return payments
+}
+
+// listPayments lists a page of the payments matching the flags.
+func listPayments(c *apiClient, args []string) {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	status := flags.String("status", "", "status of the payments")
+	sourceType := flags.String("source-type", "", "source type of the payments")
+	customerID := flags.Int("customer", 0, "id of the customer of the payments")
+	riskDecision := flags.String("risk-decision", "", "risk decision of the payments, allow, review or block")
+	from := flags.String("from", "", "first day the payments were created, in the YYYY-MM-DD format, with -to")
+	to := flags.String("to", "", "last day the payments were created, in the YYYY-MM-DD format, with -from")
+	timezone := flags.String("timezone", "", "time zone of the days, UTC by default")
+	afterID := flags.Int("after", 0, "list the payments after this payment id")
+	limit := flags.Int("limit", 20, "maximum number of payments, at most 100")
+	output := outputFlag(flags)
+	flags.Parse(args)
+
+	query := url.Values{"limit": {strconv.Itoa(*limit)}}
+	for key, value := range map[string]string{
+		"status":        *status,
+		"source_type":   *sourceType,
+		"risk_decision": *riskDecision,
+		"from":          *from,
+		"to":            *to,
+		"timezone":      *timezone,
+	} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	if *customerID != 0 {
+		query.Set("customer_id", strconv.Itoa(*customerID))
+	}
+	if *afterID != 0 {
+		query.Set("after_id", strconv.Itoa(*afterID))
+	}
+
+	var list paymentList
+	if err := c.do(http.MethodGet, "/payments", query, "", nil, &list); err != nil {
+		log.Fatal(err)
+	}
+	if *output == outputJSON {
+		printJSON(list)
+		return
+	}
+
+	payments := decodePayments(list.Payments)
+	rows := make([][]string, len(payments))
+	for i, p := range payments {
+		rows[i] = paymentRow(p)
+	}
+	printTable(paymentHeader, rows)
+	if list.HasMore {
+		log.Printf("more payments match, list them with -after %d", payments[len(payments)-1].ID)
+	}
+}
+
+// showPayment shows a payment with its events.
+func showPayment(c *apiClient, args []string) {
+	flags := flag.NewFlagSet("show", flag.ExitOnError)
+	output := outputFlag(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: paymentsctl show [flags] <payment id>\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	id := paymentIDArg(flags)
+
+	var raw json.RawMessage
+	if err := c.do(http.MethodGet, "/payments/"+id, nil, "", nil, &raw); err != nil {
+		log.Fatal(err)
+	}
+	var events struct {
+		Events []*paymentEvent `json:"events"`
+	}
+	if err := c.do(http.MethodGet, "/payments/"+id+"/events", nil, "", nil, &events); err != nil {
+		log.Fatal(err)
+	}
+	if *output == outputJSON {
+		printJSON(map[string]interface{}{"payment": raw, "events": events.Events})
+		return
+	}
+
+	p := decodePayments([]json.RawMessage{raw})[0]
+	printTable(paymentHeader, [][]string{paymentRow(p)})
+	if p.FailureMessage != "" {
+		fmt.Println("\nFailure:", p.FailureMessage)
+	}
+	fmt.Println()
+	rows := make([][]string, len(events.Events))
+	for i, e := range events.Events {
+		published := relayNames(e.Published)
+		if published == "" {
+			published = "no"
+		}
+		rows[i] = []string{strconv.Itoa(e.ID), e.Type, e.PreviousStatus, e.Status, formatTime(e.CreatedAt), published, relayNames(e.Parked)}
+	}
+	printTable([]string{"EVENT", "TYPE", "PREVIOUS STATUS", "STATUS", "CREATED AT", "PUBLISHED TO", "PARKED BY"}, rows)
+}
+
+// relayNames returns the sorted names of the relays of an event, separated by commas.
+func relayNames(times map[string]time.Time) string {
+	relays := make([]string, 0, len(times))
+	for relay := range times {
+		relays = append(relays, relay)
+	}
+	sort.Strings(relays)
+	return strings.Join(relays, ",")
+}
+
+// refreshPayment refreshes a payment from its charge whatever its status.
+func refreshPayment(c *apiClient, args []string) {
+	flags := flag.NewFlagSet("refresh", flag.ExitOnError)
+	output := outputFlag(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: paymentsctl refresh [flags] <payment id>\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	id := paymentIDArg(flags)
+
+	var raw json.RawMessage
+	if err := c.do(http.MethodPost, "/payments/"+id+"/refresh", nil, "", nil, &raw); err != nil {
+		log.Fatal(err)
+	}
+	if *output == outputJSON {
+		printJSON(raw)
+		return
+	}
+	printTable(paymentHeader, [][]string{paymentRow(decodePayments([]json.RawMessage{raw})[0])})
+}
+
+// refundPayment refunds a paid payment, the amount which is not refunded yet without the -amount flag.
+func refundPayment(c *apiClient, args []string) {
+	flags := flag.NewFlagSet("refund", flag.ExitOnError)
+	amount := flags.String("amount", "", "decimal amount to refund, such as 150.00, with -currency")
+	currency := flags.String("currency", "", "currency of the amount, such as THB")
+	output := outputFlag(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: paymentsctl refund [flags] <payment id>\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	id := paymentIDArg(flags)
+
+	var body io.Reader
+	if *amount != "" {
+		b, err := json.Marshal(map[string]string{"amount": *amount, "currency": *currency})
+		if err != nil {
+			log.Fatal(err)
+		}
+		body = bytes.NewReader(b)
+	}
+
+	var raw json.RawMessage
+	if err := c.do(http.MethodPost, "/payments/"+id+"/refunds", nil, "application/json", body, &raw); err != nil {
+		log.Fatal(err)
+	}
+	if *output == outputJSON {
+		printJSON(raw)
+		return
+	}
+	var refunded struct {
+		Refunds []struct {
+			ID        string    `json:"id"`
+			Amount    int64     `json:"amount"`
+			CreatedAt time.Time `json:"created_at"`
+		} `json:"refunds"`
+	}
+	if err := json.Unmarshal(raw, &refunded); err != nil {
+		log.Fatal(err)
+	}
+	p := decodePayments([]json.RawMessage{raw})[0]
+	printTable(paymentHeader, [][]string{paymentRow(p)})
+	fmt.Println()
+	rows := make([][]string, len(refunded.Refunds))
+	for i, r := range refunded.Refunds {
+		rows[i] = []string{r.ID, strconv.FormatInt(r.Amount, 10), p.Currency, formatTime(r.CreatedAt)}
+	}
+	printTable([]string{"REFUND", "AMOUNT (SMALLEST UNIT)", "CURRENCY", "CREATED AT"}, rows)
+}
+
+// expirePayments refreshes the pending payments older than a duration, so that those the payment gateway expired
+// are expired. Payments are only expired by the payment gateway, never by the service itself.
+func expirePayments(c *apiClient, args []string) {
+	flags := flag.NewFlagSet("expire", flag.ExitOnError)
+	olderThan := flags.Duration("older-than", 24*time.Hour, "refresh the pending payments created longer ago than this")
+	dryRun := flags.Bool("dry-run", false, "list the stale payments without refreshing them")
+	output := outputFlag(flags)
+	flags.Parse(args)
+
+	cutoff := time.Now().Add(-*olderThan)
+	var stale []*payment
+	query := url.Values{"status": {"pending"}, "limit": {"100"}}
+	for {
+		var list paymentList
+		if err := c.do(http.MethodGet, "/payments", query, "", nil, &list); err != nil {
+			log.Fatal(err)
+		}
+		payments := decodePayments(list.Payments)
+		for _, p := range payments {
+			if p.CreatedAt.Before(cutoff) {
+				stale = append(stale, p)
+			}
+		}
+		if !list.HasMore {
+			break
+		}
+		query.Set("after_id", strconv.Itoa(payments[len(payments)-1].ID))
+	}
+
+	type result struct {
+		ID             int    `json:"id"`
+		PreviousStatus string `json:"previous_status"`
+		Status         string `json:"status"`
+		Error          string `json:"error,omitempty"`
+	}
+	results := make([]result, len(stale))
+	failed := false
+	for i, p := range stale {
+		results[i] = result{ID: p.ID, PreviousStatus: p.Status, Status: p.Status}
+		if *dryRun {
+			continue
+		}
+		var refreshed payment
+		if err := c.do(http.MethodPost, "/payments/"+strconv.Itoa(p.ID)+"/refresh", nil, "", nil, &refreshed); err != nil {
+			results[i].Error = err.Error()
+			failed = true
+			continue
+		}
+		results[i].Status = refreshed.Status
+	}
+
+	if *output == outputJSON {
+		printJSON(results)
+	} else {
+		rows := make([][]string, len(results))
+		for i, r := range results {
+			rows[i] = []string{strconv.Itoa(r.ID), r.PreviousStatus, r.Status, r.Error}
+		}
+		printTable([]string{"ID", "PREVIOUS STATUS", "STATUS", "ERROR"}, rows)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// paymentIDArg returns the payment id argument of a command, it exits with the usage if there is none.
+func paymentIDArg(flags *flag.FlagSet) string {
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	id := flags.Arg(0)
+	if _, err := strconv.Atoi(id); err != nil {
+		log.Fatal("payment id must be a number")
+	}
+	return id
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+)
+
+// exitMismatches is the exit status of a reconciliation with mismatches which are not corrected.
+const exitMismatches = 3
+
+type mismatch struct {
+	Type          string `json:"type"`
+	ChargeID      string `json:"charge_id"`
+	PaymentID     int    `json:"payment_id"`
+	LocalStatus   string `json:"local_status"`
+	GatewayStatus string `json:"gateway_status"`
+	LocalAmount   int64  `json:"local_amount"`
+	GatewayAmount int64  `json:"gateway_amount"`
+	Currency      string `json:"currency"`
+	Corrected     bool   `json:"corrected"`
+	Error         string `json:"error"`
+}
+
+// reconciliation is the report of a reconciliation, JSON output prints the whole report as it is.
+type reconciliation struct {
+	Records    int        `json:"records"`
+	Matched    int        `json:"matched"`
+	Mismatches []mismatch `json:"mismatches"`
+}
+
+// reconcile reconciles the payments with a charge export, or with the charges listed from the payment gateway
+// if there is no export, and prints the report.
+func reconcile(c *apiClient, args []string) {
+	flags := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	from := flags.String("from", "", "first day of the payments to reconcile, in the YYYY-MM-DD format (required)")
+	to := flags.String("to", "", "last day of the payments to reconcile, in the YYYY-MM-DD format (required)")
+	timezone := flags.String("timezone", "", "time zone of the days, UTC by default")
+	file := flags.String("file", "", "CSV charge export to reconcile with instead of the payment gateway")
+	correct := flags.Bool("correct", false, "refresh the payments with a status mismatch from their charges, as the operator of PAYMENTSVC_ADMIN_TOKEN")
+	output := outputFlag(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: paymentsctl reconcile -from YYYY-MM-DD -to YYYY-MM-DD [flags]\n\n"+
+			"The exit status is %d if a mismatch is not corrected.\n\n", exitMismatches)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	query := url.Values{
+		"from":    {*from},
+		"to":      {*to},
+		"correct": {strconv.FormatBool(*correct)},
+	}
+	if *timezone != "" {
+		query.Set("timezone", *timezone)
+	}
+
+	var body io.Reader
+	var contentType string
+	if *file != "" {
+		f, err := os.Open(*file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		body, contentType = f, "text/csv"
+	}
+
+	// reconciliations are run by operators, corrections are made on their behalf.
+	var report json.RawMessage
+	if err := c.do(http.MethodPost, "/admin/reconciliations", query, contentType, body, &report); err != nil {
+		log.Fatal(err)
+	}
+	var r reconciliation
+	if err := json.Unmarshal(report, &r); err != nil {
+		log.Fatal(err)
+	}
+	if *output == outputJSON {
+		printJSON(report)
+	} else {
+		printReconciliation(&r)
+	}
+
+	for _, m := range r.Mismatches {
+		if !m.Corrected {
+			os.Exit(exitMismatches)
+		}
+	}
+}
+
+// printReconciliation prints the mismatches of a report as a table, the amounts are in the smallest currency unit.
+func printReconciliation(r *reconciliation) {
+	fmt.Printf("%d records, %d matched, %d mismatches\n", r.Records, r.Matched, len(r.Mismatches))
+	if len(r.Mismatches) == 0 {
+		return
+	}
+	fmt.Println()
+	rows := make([][]string, len(r.Mismatches))
+	for i, m := range r.Mismatches {
+		paymentID := ""
+		if m.PaymentID != 0 {
+			paymentID = strconv.Itoa(m.PaymentID)
+		}
+		corrected := "no"
+		if m.Corrected {
+			corrected = "yes"
+		}
+		rows[i] = []string{
+			m.Type, m.ChargeID, paymentID, m.LocalStatus, m.GatewayStatus,
+			formatAmount(m.LocalAmount), formatAmount(m.GatewayAmount), m.Currency, corrected, m.Error,
+		}
+	}
+	printTable([]string{
+		"TYPE", "CHARGE", "PAYMENT", "LOCAL STATUS", "GATEWAY STATUS", "LOCAL AMOUNT", "GATEWAY AMOUNT", "CURRENCY", "CORRECTED", "ERROR",
+	}, rows)
+}
+
+func formatAmount(amount int64) string {
+	if amount == 0 {
+		return ""
+	}
+	return strconv.FormatInt(amount, 10)
+}
@@ -1,9 +1,13 @@
 module github.com/noppawitt/paymentsvc
 
-go 1.15
+go 1.16
 
 require (
+	github.com/boombuler/barcode v1.0.1
 	github.com/gorilla/mux v1.8.0
-	github.com/omise/omise-go v1.0.5
-	github.com/stretchr/testify v1.7.0 // indirect
+	github.com/jung-kurt/gofpdf v1.16.2
+	github.com/nats-io/nats-server/v2 v2.3.0
+	github.com/nats-io/nats.go v1.11.0
+	github.com/omise/omise-go v1.5.0
+	github.com/segmentio/kafka-go v0.4.17
 )
@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+// Operator represents an operator of the admin API, who is authenticated by a bearer token.
+// The name identifies the operator in the audit log.
+type Operator struct {
+	Name  string
+	Token string
+}
+
+// Admin represents an admin handler for operations staff, it is appended to a router which authenticates
+// the operators with Authenticate, since the overrides are recorded with the operator.
+type Admin struct {
+	service payment.Service
+}
+
+// NewAdmin returns a new admin handler.
+func NewAdmin(service payment.Service) *Admin {
+	return &Admin{
+		service: service,
+	}
+}
+
+// Append appends routes to the router.
+func (h *Admin) Append(r *mux.Router) {
+	r.HandleFunc("/payments/{id}/status", h.overridePaymentStatus).Methods(http.MethodPost)
+	r.HandleFunc("/payments/{id}/status-overrides", h.listStatusOverrides).Methods(http.MethodGet)
+}
+
+type operatorContextKey struct{}
+
+// Authenticate returns a middleware which authenticates every request as one of the operators
+// by the bearer token of the Authorization header, the name of the operator is kept in the request context
+// for the audit log. It protects the routes for operations staff, such as the admin API.
+func Authenticate(operators []Operator) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			operator, ok := findOperator(operators, r.Header.Get("Authorization"))
+			if !ok {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				respondError(w, payment.ErrorCodeUnauthorized, "a valid admin token is required", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), operatorContextKey{}, operator)))
+		})
+	}
+}
+
+// findOperator returns the name of the operator of the token, tokens are compared in constant time.
+func findOperator(operators []Operator, authorization string) (string, bool) {
+	token, ok := bearerToken(authorization)
+	if !ok {
+		return "", false
+	}
+
+	name, ok := "", false
+	for _, o := range operators {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(o.Token)) == 1 {
+			name, ok = o.Name, true
+		}
+	}
+	return name, ok
+}
+
+// operatorName returns the name of the operator the request was authenticated as.
+func operatorName(r *http.Request) string {
+	operator, _ := r.Context().Value(operatorContextKey{}).(string)
+	return operator
+}
+
+// bearerToken returns the token of a bearer Authorization header.
+func bearerToken(authorization string) (string, bool) {
+	const prefix = "Bearer "
+	if len(authorization) <= len(prefix) || !strings.EqualFold(authorization[:len(prefix)], prefix) {
+		return "", false
+	}
+	return authorization[len(prefix):], true
+}
+
+type overridePaymentStatusRequest struct {
+	Status payment.Status `json:"status"`
+	Reason string         `json:"reason"`
+}
+
+// overridePaymentStatus changes the status of a payment on behalf of the operator, such as after the payment gateway
+// support confirmed the outcome of its charge. The status must follow the lifecycle of a charge.
+func (h *Admin) overridePaymentStatus(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "payment")
+	if !ok {
+		return
+	}
+
+	req := &overridePaymentStatusRequest{}
+	if err := decodeJSON(r, req); err != nil {
+		respondDecodeError(w, err)
+		return
+	}
+	if req.Status != "" && !paymentStatuses[req.Status] {
+		respondValidationError(w, []payment.FieldError{{Field: "status", Code: payment.CodeInvalid, Message: "status must be a payment status"}})
+		return
+	}
+
+	payment, err := h.service.OverrideStatus(id, req.Status, req.Reason, operatorName(r))
+	if err != nil {
+		respondServiceError(w, err)
+		return
+	}
+
+	respondJSON(w, newGetPaymentResponse(payment), http.StatusOK)
+}
+
+type statusOverrideResponse struct {
+	ID             int            `json:"id"`
+	PreviousStatus payment.Status `json:"previous_status"`
+	Status         payment.Status `json:"status"`
+	Reason         string         `json:"reason"`
+	Operator       string         `json:"operator"`
+	CreatedAt      time.Time      `json:"created_at"`
+}
+
+type listStatusOverridesResponse struct {
+	StatusOverrides []statusOverrideResponse `json:"status_overrides"`
+}
+
+// listStatusOverrides lists the audit log of the status overrides of a payment, oldest first.
+func (h *Admin) listStatusOverrides(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "payment")
+	if !ok {
+		return
+	}
+
+	overrides, err := h.service.StatusOverrides(id)
+	if err != nil {
+		respondServiceError(w, err)
+		return
+	}
+
+	res := &listStatusOverridesResponse{StatusOverrides: make([]statusOverrideResponse, len(overrides))}
+	for i, o := range overrides {
+		res.StatusOverrides[i] = statusOverrideResponse{
+			ID:             o.ID,
+			PreviousStatus: o.PreviousStatus,
+			Status:         o.Status,
+			Reason:         o.Reason,
+			Operator:       o.Operator,
+			CreatedAt:      o.CreatedAt,
+		}
+	}
+	respondJSON(w, res, http.StatusOK)
+}
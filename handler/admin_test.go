@@ -0,0 +1,166 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+var testOperators = []Operator{
+	{Name: "alice", Token: "alice-token"},
+	{Name: "bob", Token: "bob-token"},
+}
+
+func TestAdmin_overridePaymentStatus(t *testing.T) {
+	tests := []struct {
+		name          string
+		authorization string
+		body          string
+		overrideErr   error
+		wantOverride  bool
+		want          string
+		wantStatus    int
+	}{
+		{
+			name:          "success",
+			authorization: "Bearer bob-token",
+			body:          `{"status":"successful","reason":"Omise support confirmed the payment"}`,
+			wantOverride:  true,
+			want:          fmt.Sprintf(`{"id":1,"status":"successful","amount":20000,"amount_decimal":"200.00","currency":"THB","source_type":"bill_payment_tesco_lotus","created_at":%s,"updated_at":%s}`, nowJSON, nowJSON),
+			wantStatus:    http.StatusOK,
+		},
+		{
+			name:       "no token",
+			body:       `{"status":"successful","reason":"confirmed"}`,
+			want:       `{"code":"unauthorized","message":"a valid admin token is required"}`,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:          "unknown token",
+			authorization: "Bearer carol-token",
+			body:          `{"status":"successful","reason":"confirmed"}`,
+			want:          `{"code":"unauthorized","message":"a valid admin token is required"}`,
+			wantStatus:    http.StatusUnauthorized,
+		},
+		{
+			name:          "unknown status",
+			authorization: "Bearer bob-token",
+			body:          `{"status":"paid","reason":"confirmed"}`,
+			want:          `{"code":"invalid_request","message":"invalid request","errors":[{"field":"status","code":"invalid","message":"status must be a payment status"}]}`,
+			wantStatus:    http.StatusUnprocessableEntity,
+		},
+		{
+			name:          "invalid request",
+			authorization: "Bearer bob-token",
+			body:          `{"status":"successful"}`,
+			wantOverride:  true,
+			overrideErr:   &payment.ValidationError{Errors: []payment.FieldError{{Field: "reason", Code: payment.CodeRequired, Message: "reason is required"}}},
+			want:          `{"code":"invalid_request","message":"invalid request","errors":[{"field":"reason","code":"required","message":"reason is required"}]}`,
+			wantStatus:    http.StatusUnprocessableEntity,
+		},
+		{
+			name:          "not allowed",
+			authorization: "Bearer bob-token",
+			body:          `{"status":"failed","reason":"confirmed"}`,
+			wantOverride:  true,
+			overrideErr:   &payment.Error{Code: payment.ErrorCodeConflict, Message: "successful payment cannot be changed to failed"},
+			want:          `{"code":"conflict","message":"successful payment cannot be changed to failed"}`,
+			wantStatus:    http.StatusConflict,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			overridden := false
+			s := &mockService{}
+			s.OverrideStatusFn = func(id int, status payment.Status, reason, operator string) (*payment.Payment, error) {
+				overridden = true
+				if operator != "bob" {
+					t.Errorf("handler overrode the status as %q want %q", operator, "bob")
+				}
+				if tt.overrideErr != nil {
+					return nil, tt.overrideErr
+				}
+				return &payment.Payment{
+					ID:          id,
+					Status:      status,
+					Amount:      payment.NewMoney(20000, "THB"),
+					OmiseCharge: &payment.OmiseCharge{SourceType: "bill_payment_tesco_lotus"},
+					CreatedAt:   now,
+					UpdatedAt:   now,
+				}, nil
+			}
+
+			r := mux.NewRouter().PathPrefix("/admin").Subrouter()
+			r.Use(Authenticate(testOperators))
+			NewAdmin(s).Append(r)
+
+			req, err := http.NewRequest(http.MethodPost, "/admin/payments/1/status", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			if overridden != tt.wantOverride {
+				t.Errorf("handler overrode the status = %v want %v", overridden, tt.wantOverride)
+			}
+
+			if gotStatus := rr.Code; gotStatus != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", gotStatus, tt.wantStatus)
+			}
+
+			got := strings.TrimSpace(rr.Body.String())
+			if got != tt.want {
+				t.Errorf("handler returned unexpected body: got %v want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdmin_listStatusOverrides(t *testing.T) {
+	s := &mockService{}
+	s.StatusOverridesFn = func(id int) ([]*payment.StatusOverride, error) {
+		return []*payment.StatusOverride{{
+			ID:             1,
+			PaymentID:      id,
+			PreviousStatus: payment.StatusExpired,
+			Status:         payment.StatusSuccessful,
+			Reason:         "paid at the counter before it expired",
+			Operator:       "alice",
+			CreatedAt:      time.Date(2021, 2, 1, 10, 0, 0, 0, time.UTC),
+		}}, nil
+	}
+
+	r := mux.NewRouter().PathPrefix("/admin").Subrouter()
+	r.Use(Authenticate(testOperators))
+	NewAdmin(s).Append(r)
+
+	req, err := http.NewRequest(http.MethodGet, "/admin/payments/1/status-overrides", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer alice-token")
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	if gotStatus := rr.Code; gotStatus != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", gotStatus, http.StatusOK)
+	}
+
+	want := `{"status_overrides":[{"id":1,"previous_status":"expired","status":"successful","reason":"paid at the counter before it expired","operator":"alice","created_at":"2021-02-01T10:00:00Z"}]}`
+	got := strings.TrimSpace(rr.Body.String())
+	if got != want {
+		t.Errorf("handler returned unexpected body: got %v want %v", got, want)
+	}
+}
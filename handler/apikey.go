@@ -0,0 +1,183 @@
+package handler
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/noppawitt/paymentsvc/apikey"
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+// APIKey represents an API key handler for operations staff, it is appended to a router which authenticates
+// the operators such as the admin router.
+type APIKey struct {
+	service apikey.Service
+}
+
+// NewAPIKey returns a new API key handler.
+func NewAPIKey(service apikey.Service) *APIKey {
+	return &APIKey{
+		service: service,
+	}
+}
+
+// Append appends routes to the router.
+func (h *APIKey) Append(r *mux.Router) {
+	r.HandleFunc("", h.createAPIKey).Methods(http.MethodPost)
+	r.HandleFunc("", h.listAPIKeys).Methods(http.MethodGet)
+	r.HandleFunc("/{id}/rotate", h.rotateAPIKey).Methods(http.MethodPost)
+}
+
+// payerRoutes are the names of the routes the payer's browser opens from the payment page of a payment link,
+// they do not require an API key.
+var payerRoutes = map[string]bool{
+	routePaymentQRCode:     true,
+	routePaymentSlip:       true,
+	routePaymentSlipFormat: true,
+}
+
+// RequireAPIKey returns a middleware which requires a valid API key as the bearer token of every request
+// to the merchant API, except the routes the payer opens.
+func RequireAPIKey(keys apikey.Service) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if route := mux.CurrentRoute(r); route != nil && payerRoutes[route.GetName()] {
+				next.ServeHTTP(w, r)
+				return
+			}
+			secret, ok := bearerToken(r.Header.Get("Authorization"))
+			if ok {
+				_, err := keys.Authenticate(secret)
+				ok = err == nil
+			}
+			if !ok {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				respondError(w, payment.ErrorCodeUnauthorized, "a valid API key is required", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// privilegedRoutes are the names of the routes of the merchant API which move money or change a payment outside
+// the payment flow, they require a credential even if API keys are not required.
+var privilegedRoutes = map[string]bool{
+	routePaymentCapture: true,
+	routePaymentVoid:    true,
+	routePaymentRefund:  true,
+	routePaymentRefresh: true,
+}
+
+// RequireCredential returns a middleware which requires a valid API key or operator token as the bearer token
+// of the requests to the privileged routes, or to every route if all is true. The routes are closed rather than open
+// if there are neither API keys nor operator tokens. Every request it lets through is logged with its credential.
+func RequireCredential(keys apikey.Service, operators []Operator, all bool) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if route := mux.CurrentRoute(r); !all && (route == nil || !privilegedRoutes[route.GetName()]) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			authorization := r.Header.Get("Authorization")
+			if operator, ok := findOperator(operators, authorization); ok {
+				log.Printf("%s %s by operator %s", r.Method, r.URL.Path, operator)
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), operatorContextKey{}, operator)))
+				return
+			}
+			if secret, ok := bearerToken(authorization); ok {
+				if key, err := keys.Authenticate(secret); err == nil {
+					log.Printf("%s %s by API key %s", r.Method, r.URL.Path, key.Prefix)
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			respondError(w, payment.ErrorCodeUnauthorized, "a valid API key or admin token is required", http.StatusUnauthorized)
+		})
+	}
+}
+
+type createAPIKeyRequest struct {
+	Name string `json:"name"`
+}
+
+type apiKeyResponse struct {
+	ID        int        `json:"id"`
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix"`
+	Secret    string     `json:"secret,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	RotatedAt *time.Time `json:"rotated_at,omitempty"`
+}
+
+// newAPIKeyResponse returns the response of an API key, the secret is only given when it is created or rotated.
+func newAPIKeyResponse(key *apikey.Key, secret string) *apiKeyResponse {
+	res := &apiKeyResponse{
+		ID:        key.ID,
+		Name:      key.Name,
+		Prefix:    key.Prefix,
+		Secret:    secret,
+		CreatedAt: key.CreatedAt,
+	}
+	if !key.RotatedAt.IsZero() {
+		res.RotatedAt = &key.RotatedAt
+	}
+	return res
+}
+
+// createAPIKey creates an API key, its secret is in the response and cannot be shown again.
+func (h *APIKey) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	req := &createAPIKeyRequest{}
+	if err := decodeJSON(r, req); err != nil {
+		respondDecodeError(w, err)
+		return
+	}
+
+	key, secret, err := h.service.Create(req.Name)
+	if err != nil {
+		respondServiceError(w, err)
+		return
+	}
+
+	respondJSON(w, newAPIKeyResponse(key, secret), http.StatusCreated)
+}
+
+type listAPIKeysResponse struct {
+	APIKeys []*apiKeyResponse `json:"api_keys"`
+}
+
+// listAPIKeys lists the API keys without their secrets.
+func (h *APIKey) listAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.service.List()
+	if err != nil {
+		respondServiceError(w, err)
+		return
+	}
+
+	res := &listAPIKeysResponse{APIKeys: make([]*apiKeyResponse, len(keys))}
+	for i, key := range keys {
+		res.APIKeys[i] = newAPIKeyResponse(key, "")
+	}
+	respondJSON(w, res, http.StatusOK)
+}
+
+// rotateAPIKey replaces the secret of an API key, the previous secret stops working right away.
+func (h *APIKey) rotateAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "API key")
+	if !ok {
+		return
+	}
+
+	key, secret, err := h.service.Rotate(id)
+	if err != nil {
+		respondServiceError(w, err)
+		return
+	}
+
+	respondJSON(w, newAPIKeyResponse(key, secret), http.StatusOK)
+}
@@ -0,0 +1,238 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/noppawitt/paymentsvc/apikey"
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+func apiKeyRouter(s apikey.Service) *mux.Router {
+	r := mux.NewRouter()
+	admin := r.PathPrefix("/admin").Subrouter()
+	admin.Use(Authenticate(testOperators))
+	NewAdmin(&mockService{}).Append(admin)
+	NewAPIKey(s).Append(admin.PathPrefix("/api-keys").Subrouter())
+	return r
+}
+
+func TestAPIKey(t *testing.T) {
+	key := &apikey.Key{ID: 1, Name: "order service", Prefix: "psk_abcdefgh", CreatedAt: now}
+	rotated := &apikey.Key{ID: 1, Name: "order service", Prefix: "psk_ijklmnop", CreatedAt: now, RotatedAt: now}
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		authorization string
+		body          string
+		want          string
+		wantStatus    int
+	}{
+		{
+			name:          "create",
+			method:        http.MethodPost,
+			path:          "/admin/api-keys",
+			authorization: "Bearer alice-token",
+			body:          `{"name":"order service"}`,
+			want:          fmt.Sprintf(`{"id":1,"name":"order service","prefix":"psk_abcdefgh","secret":"psk_abcdefgh-secret","created_at":%s}`, nowJSON),
+			wantStatus:    http.StatusCreated,
+		},
+		{
+			name:          "create without a name",
+			method:        http.MethodPost,
+			path:          "/admin/api-keys",
+			authorization: "Bearer alice-token",
+			body:          `{"name":" "}`,
+			want:          `{"code":"invalid_request","message":"invalid request","errors":[{"field":"name","code":"required","message":"name is required"}]}`,
+			wantStatus:    http.StatusUnprocessableEntity,
+		},
+		{
+			name:          "list without secrets",
+			method:        http.MethodGet,
+			path:          "/admin/api-keys",
+			authorization: "Bearer alice-token",
+			want:          fmt.Sprintf(`{"api_keys":[{"id":1,"name":"order service","prefix":"psk_abcdefgh","created_at":%s}]}`, nowJSON),
+			wantStatus:    http.StatusOK,
+		},
+		{
+			name:          "rotate",
+			method:        http.MethodPost,
+			path:          "/admin/api-keys/1/rotate",
+			authorization: "Bearer alice-token",
+			want:          fmt.Sprintf(`{"id":1,"name":"order service","prefix":"psk_ijklmnop","secret":"psk_ijklmnop-secret","created_at":%s,"rotated_at":%s}`, nowJSON, nowJSON),
+			wantStatus:    http.StatusOK,
+		},
+		{
+			name:          "rotate unknown key",
+			method:        http.MethodPost,
+			path:          "/admin/api-keys/2/rotate",
+			authorization: "Bearer alice-token",
+			want:          `{"code":"not_found","message":"API key not found"}`,
+			wantStatus:    http.StatusNotFound,
+		},
+		{
+			name:       "without an admin token",
+			method:     http.MethodGet,
+			path:       "/admin/api-keys",
+			want:       `{"code":"unauthorized","message":"a valid admin token is required"}`,
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &mockAPIKeyService{}
+			s.CreateFn = func(name string) (*apikey.Key, string, error) {
+				if strings.TrimSpace(name) == "" {
+					return nil, "", &payment.ValidationError{Errors: []payment.FieldError{{Field: "name", Code: payment.CodeRequired, Message: "name is required"}}}
+				}
+				return key, key.Prefix + "-secret", nil
+			}
+			s.ListFn = func() ([]*apikey.Key, error) {
+				return []*apikey.Key{key}, nil
+			}
+			s.RotateFn = func(id int) (*apikey.Key, string, error) {
+				if id != 1 {
+					return nil, "", apikey.ErrKeyNotFound
+				}
+				return rotated, rotated.Prefix + "-secret", nil
+			}
+
+			req, err := http.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+
+			rr := httptest.NewRecorder()
+			apiKeyRouter(s).ServeHTTP(rr, req)
+
+			if gotStatus := rr.Code; gotStatus != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", gotStatus, tt.wantStatus)
+			}
+
+			got := strings.TrimSpace(rr.Body.String())
+			if got != tt.want {
+				t.Errorf("handler returned unexpected body: got %v want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireAPIKey(t *testing.T) {
+	tests := []struct {
+		name          string
+		path          string
+		authorization string
+		wantStatus    int
+	}{
+		{name: "valid key", path: "/payments/1", authorization: "Bearer psk_valid", wantStatus: http.StatusOK},
+		{name: "invalid key", path: "/payments/1", authorization: "Bearer psk_invalid", wantStatus: http.StatusUnauthorized},
+		{name: "no key", path: "/payments/1", wantStatus: http.StatusUnauthorized},
+		{name: "QR code the payer opens", path: "/payments/1/qr.svg", wantStatus: http.StatusOK},
+		{name: "slip the payer opens", path: "/payments/1/slip", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys := &mockAPIKeyService{}
+			keys.AuthenticateFn = func(secret string) (*apikey.Key, error) {
+				if secret != "psk_valid" {
+					return nil, apikey.ErrInvalidKey
+				}
+				return &apikey.Key{ID: 1}, nil
+			}
+			s := &mockService{}
+			s.FindFn = func(id int) (*payment.Payment, error) {
+				return &payment.Payment{
+					ID:          id,
+					Status:      payment.StatusPending,
+					Amount:      payment.NewMoney(20000, "THB"),
+					QRCode:      &payment.QRCode{Payload: "00020101021230"},
+					BillPayment: &payment.BillPayment{TaxID: "010554614953100", Reference1: "1", Reference2: "2"},
+					OmiseCharge: &payment.OmiseCharge{SourceType: "promptpay"},
+				}, nil
+			}
+
+			r := paymentRouter()
+			r.Use(RequireAPIKey(keys))
+			NewPayment(s).Append(r)
+
+			req, err := http.NewRequest(http.MethodGet, tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			if gotStatus := rr.Code; gotStatus != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v, body %s", gotStatus, tt.wantStatus, rr.Body)
+			}
+		})
+	}
+}
+
+func TestRequireCredential(t *testing.T) {
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		authorization string
+		all           bool
+		wantStatus    int
+	}{
+		{name: "void without a credential", method: http.MethodPost, path: "/payments/1/void", wantStatus: http.StatusUnauthorized},
+		{name: "void with an invalid key", method: http.MethodPost, path: "/payments/1/void", authorization: "Bearer psk_invalid", wantStatus: http.StatusUnauthorized},
+		{name: "void with a valid key", method: http.MethodPost, path: "/payments/1/void", authorization: "Bearer psk_valid", wantStatus: http.StatusOK},
+		{name: "void with an operator token", method: http.MethodPost, path: "/payments/1/void", authorization: "Bearer alice-token", wantStatus: http.StatusOK},
+		{name: "find without a credential", method: http.MethodGet, path: "/payments/1", wantStatus: http.StatusOK},
+		{name: "find without a credential on a router of operators", method: http.MethodGet, path: "/payments/1", all: true, wantStatus: http.StatusUnauthorized},
+		{name: "find with an operator token on a router of operators", method: http.MethodGet, path: "/payments/1", authorization: "Bearer bob-token", all: true, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys := &mockAPIKeyService{}
+			keys.AuthenticateFn = func(secret string) (*apikey.Key, error) {
+				if secret != "psk_valid" {
+					return nil, apikey.ErrInvalidKey
+				}
+				return &apikey.Key{ID: 1, Prefix: "psk_vali"}, nil
+			}
+			s := &mockService{}
+			s.FindFn = func(id int) (*payment.Payment, error) {
+				return &payment.Payment{ID: id, Status: payment.StatusPending, Amount: payment.NewMoney(20000, "THB"), OmiseCharge: &payment.OmiseCharge{SourceType: "promptpay"}}, nil
+			}
+			s.VoidFn = func(id int) (*payment.Payment, error) {
+				return &payment.Payment{ID: id, Status: payment.StatusVoided, Amount: payment.NewMoney(20000, "THB"), OmiseCharge: &payment.OmiseCharge{SourceType: "promptpay"}}, nil
+			}
+
+			r := paymentRouter()
+			r.Use(RequireCredential(keys, testOperators, tt.all))
+			NewPayment(s).Append(r)
+
+			req, err := http.NewRequest(tt.method, tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			if gotStatus := rr.Code; gotStatus != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v, body %s", gotStatus, tt.wantStatus, rr.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,324 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/noppawitt/paymentsvc/payment"
+	"github.com/noppawitt/paymentsvc/paymentlink"
+)
+
+// Checkout represents the handler of the hosted pages of payment links.
+// Card tokens are created in the browser with the Omise public key so that card numbers never reach the service.
+type Checkout struct {
+	service        paymentlink.Service
+	omisePublicKey string
+}
+
+// NewCheckout returns a new checkout handler.
+func NewCheckout(service paymentlink.Service, omisePublicKey string) *Checkout {
+	return &Checkout{
+		service:        service,
+		omisePublicKey: omisePublicKey,
+	}
+}
+
+// Append appends routes to the router.
+func (h *Checkout) Append(r *mux.Router) {
+	r.HandleFunc("/{slug}", h.getCheckout).Methods(http.MethodGet)
+	r.HandleFunc("/{slug}", h.payCheckout).Methods(http.MethodPost)
+}
+
+// checkoutFieldLabels are the labels of the source fields the payer fills in on the hosted page.
+var checkoutFieldLabels = map[string]string{
+	payment.FieldPhoneNumber:     "Phone number",
+	payment.FieldEmail:           "Email",
+	payment.FieldName:            "Name",
+	payment.FieldInstallmentTerm: "Number of months",
+}
+
+// checkoutFieldTypes are the input types of the source fields, text is the default.
+var checkoutFieldTypes = map[string]string{
+	payment.FieldPhoneNumber:     "tel",
+	payment.FieldEmail:           "email",
+	payment.FieldInstallmentTerm: "number",
+}
+
+// checkout contains the details shown on the hosted page of a payment link.
+// Unavailable is the reason the link cannot be paid, the payment methods are not shown if it is set.
+type checkout struct {
+	Slug        string
+	Description string
+	Amount      string
+	Methods     []checkoutMethod
+	Card        bool
+	PublicKey   string
+	Errors      []string
+	Unavailable string
+}
+
+type checkoutMethod struct {
+	SourceType string
+	Fields     []checkoutField
+}
+
+type checkoutField struct {
+	Name  string
+	Label string
+	Type  string
+}
+
+var checkoutTemplate = template.Must(template.New("checkout").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Payment</title>
+<style>
+body { font-family: sans-serif; max-width: 480px; margin: 2em auto; padding: 0 1em; }
+form { border: 1px solid #ccc; border-radius: 4px; padding: 1em; margin-bottom: 1em; }
+label { display: block; margin-bottom: 0.5em; }
+input { display: block; width: 100%; box-sizing: border-box; }
+.errors { color: #b00020; }
+</style>
+</head>
+<body>
+<h1>{{.Amount}}</h1>
+{{- if .Description}}
+<p>{{.Description}}</p>
+{{- end}}
+{{- if .Errors}}
+<ul class="errors">
+{{- range .Errors}}
+<li>{{.}}</li>
+{{- end}}
+</ul>
+{{- end}}
+{{- if .Unavailable}}
+<p class="errors">{{.Unavailable}}</p>
+{{- else}}
+{{- range .Methods}}
+{{- if eq .SourceType "card"}}
+<form id="card-form" method="post" action="/l/{{$.Slug}}">
+<input type="hidden" name="source_type" value="card">
+<input type="hidden" name="card_token">
+<label>Name on card <input data-omise="name" autocomplete="cc-name" required></label>
+<label>Card number <input data-omise="number" autocomplete="cc-number" inputmode="numeric" required></label>
+<label>Expiration month <input data-omise="expiration_month" autocomplete="cc-exp-month" inputmode="numeric" required></label>
+<label>Expiration year <input data-omise="expiration_year" autocomplete="cc-exp-year" inputmode="numeric" required></label>
+<label>Security code <input data-omise="security_code" autocomplete="cc-csc" inputmode="numeric" required></label>
+<button type="submit">Pay by card</button>
+</form>
+{{- else}}
+<form method="post" action="/l/{{$.Slug}}">
+<input type="hidden" name="source_type" value="{{.SourceType}}">
+{{- range .Fields}}
+<label>{{.Label}} <input type="{{.Type}}" name="{{.Name}}" required></label>
+{{- end}}
+<button type="submit">Pay with {{.SourceType}}</button>
+</form>
+{{- end}}
+{{- end}}
+{{- if .Card}}
+<script src="https://cdn.omise.co/omise.js"></script>
+<script>
+Omise.setPublicKey({{.PublicKey}});
+document.getElementById("card-form").addEventListener("submit", function (e) {
+  var form = e.target;
+  e.preventDefault();
+  var card = {};
+  form.querySelectorAll("[data-omise]").forEach(function (input) {
+    card[input.dataset.omise] = input.value;
+  });
+  Omise.createToken("card", card, function (status, res) {
+    if (status !== 200) {
+      alert(res.message);
+      return;
+    }
+    form.card_token.value = res.id;
+    form.submit();
+  });
+});
+</script>
+{{- end}}
+{{- end}}
+</body>
+</html>
+`))
+
+// getCheckout renders the hosted page of a payment link, where the payer chooses a payment method.
+func (h *Checkout) getCheckout(w http.ResponseWriter, r *http.Request) {
+	link, err := h.service.FindBySlug(mux.Vars(r)["slug"])
+	if err != nil {
+		h.renderError(w, err)
+		return
+	}
+
+	page := h.newCheckout(link)
+	status := http.StatusOK
+	switch link.Status(time.Now()) {
+	case paymentlink.StatusExpired:
+		page.Unavailable = "This payment link has expired."
+		status = http.StatusGone
+	case paymentlink.StatusUsedUp:
+		page.Unavailable = "This payment link has already been used."
+		status = http.StatusGone
+	}
+
+	h.render(w, page, status)
+}
+
+// payCheckout makes a payment with the method chosen on the hosted page, then redirects the payer to pay it.
+// Errors are shown on the hosted page so that the payer can choose again.
+func (h *Checkout) payCheckout(w http.ResponseWriter, r *http.Request) {
+	slug := mux.Vars(r)["slug"]
+	link, err := h.service.FindBySlug(slug)
+	if err != nil {
+		h.renderError(w, err)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		h.renderErrors(w, link, []string{"invalid request body"}, http.StatusBadRequest)
+		return
+	}
+
+	req := &paymentlink.PayRequest{
+		SourceType: r.PostFormValue("source_type"),
+		SourceDetails: payment.SourceDetails{
+			CardToken:   r.PostFormValue(payment.FieldCardToken),
+			PhoneNumber: r.PostFormValue(payment.FieldPhoneNumber),
+			Email:       r.PostFormValue(payment.FieldEmail),
+			Name:        r.PostFormValue(payment.FieldName),
+		},
+	}
+	// the payer posts the checkout page, so the remote address is the payer's unless the service is behind a proxy.
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		req.IPAddress = host
+	}
+	if term := r.PostFormValue(payment.FieldInstallmentTerm); term != "" {
+		n, err := strconv.Atoi(term)
+		if err != nil {
+			h.renderErrors(w, link, []string{"installment_term must be a number"}, http.StatusUnprocessableEntity)
+			return
+		}
+		req.InstallmentTerm = n
+	}
+
+	p, err := h.service.Pay(slug, req)
+	if err != nil {
+		var verr *payment.ValidationError
+		if errors.As(err, &verr) {
+			msgs := make([]string, len(verr.Errors))
+			for i, fe := range verr.Errors {
+				msgs[i] = fe.Message
+			}
+			h.renderErrors(w, link, msgs, http.StatusUnprocessableEntity)
+			return
+		}
+		msg, status := checkoutError(err)
+		h.renderErrors(w, link, []string{msg}, status)
+		return
+	}
+
+	if p.Status == payment.StatusFailed {
+		h.renderErrors(w, link, []string{"The payment failed: " + p.OmiseCharge.FailureMessage}, http.StatusPaymentRequired)
+		return
+	}
+
+	http.Redirect(w, r, checkoutRedirectURI(p), http.StatusSeeOther)
+}
+
+// checkoutRedirectURI returns where the payer pays the payment: the authorize URI of redirect payments,
+// the QR code or the slip of offline payments, or the return page if the payment needs nothing more,
+// which redirects to the return URI of the link with the payment result, signed if the service has a secret.
+func checkoutRedirectURI(p *payment.Payment) string {
+	switch {
+	case p.OmiseCharge.AuthorizeURI != "":
+		return p.OmiseCharge.AuthorizeURI
+	case p.QRCode != nil && p.QRCode.Payload != "":
+		return fmt.Sprintf("/payments/%d/qr.svg", p.ID)
+	case p.BillPayment != nil:
+		return fmt.Sprintf("/payments/%d/slip", p.ID)
+	default:
+		return fmt.Sprintf("/return/%d", p.ID)
+	}
+}
+
+func (h *Checkout) newCheckout(link *paymentlink.Link) *checkout {
+	page := &checkout{
+		Slug:        link.Slug,
+		Description: link.Description,
+		Amount:      link.Amount.String(),
+		PublicKey:   h.omisePublicKey,
+	}
+	for _, name := range link.SourceTypes {
+		if name == payment.SourceTypeCard {
+			page.Card = true
+		}
+		method := checkoutMethod{SourceType: name}
+		source, _ := payment.LookupSourceType(name)
+		for _, field := range source.RequiredFields {
+			label, ok := checkoutFieldLabels[field]
+			if !ok {
+				continue
+			}
+			typ := checkoutFieldTypes[field]
+			if typ == "" {
+				typ = "text"
+			}
+			method.Fields = append(method.Fields, checkoutField{Name: field, Label: label, Type: typ})
+		}
+		page.Methods = append(page.Methods, method)
+	}
+	return page
+}
+
+func (h *Checkout) renderErrors(w http.ResponseWriter, link *paymentlink.Link, msgs []string, status int) {
+	page := h.newCheckout(link)
+	page.Errors = msgs
+	h.render(w, page, status)
+}
+
+// renderError renders an error page without the payment link, e.g. if it does not exist.
+func (h *Checkout) renderError(w http.ResponseWriter, err error) {
+	msg, status := checkoutError(err)
+	h.render(w, &checkout{Unavailable: msg}, status)
+}
+
+// render renders the page before writing so that a rendering error is not sent as a partial page.
+func (h *Checkout) render(w http.ResponseWriter, page *checkout, status int) {
+	var buf bytes.Buffer
+	if err := checkoutTemplate.Execute(&buf, page); err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	buf.WriteTo(w)
+}
+
+// checkoutError returns the message and the status code of a service error shown to the payer.
+func checkoutError(err error) (string, int) {
+	// the payer is not told which risk rules blocked the payment.
+	if errors.Is(err, payment.ErrRiskBlocked) {
+		return "The payment cannot be made, please use another payment method.", statusCodes[payment.ErrorCodeRiskBlocked]
+	}
+	var perr *payment.Error
+	if errors.As(err, &perr) {
+		if status, ok := statusCodes[perr.Code]; ok {
+			return strings.ToUpper(perr.Error()[:1]) + perr.Error()[1:] + ".", status
+		}
+	}
+	return "Something went wrong, please try again later.", http.StatusInternalServerError
+}
@@ -0,0 +1,166 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+// Customer represents a customer handler.
+type Customer struct {
+	service payment.CustomerService
+}
+
+// NewCustomer returns a new customer handler.
+func NewCustomer(service payment.CustomerService) *Customer {
+	return &Customer{
+		service: service,
+	}
+}
+
+// Append appends routes to the router.
+func (h *Customer) Append(r *mux.Router) {
+	r.HandleFunc("", h.createCustomer).Methods(http.MethodPost)
+	r.HandleFunc("/{id}", h.getCustomer).Methods(http.MethodGet)
+	r.HandleFunc("/{id}/cards", h.attachCard).Methods(http.MethodPost)
+	r.HandleFunc("/{id}/cards", h.listCards).Methods(http.MethodGet)
+	r.HandleFunc("/{id}/cards/{card_id}", h.deleteCard).Methods(http.MethodDelete)
+}
+
+type createCustomerRequest struct {
+	Email       string `json:"email"`
+	Description string `json:"description"`
+}
+
+type customerResponse struct {
+	ID          int       `json:"id"`
+	Email       string    `json:"email"`
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func newCustomerResponse(customer *payment.Customer) *customerResponse {
+	return &customerResponse{
+		ID:          customer.ID,
+		Email:       customer.Email,
+		Description: customer.Description,
+		CreatedAt:   customer.CreatedAt,
+		UpdatedAt:   customer.UpdatedAt,
+	}
+}
+
+type attachCardRequest struct {
+	CardToken string `json:"card_token"`
+}
+
+type savedCardResponse struct {
+	ID string `json:"id"`
+	cardResponse
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newSavedCardResponse(card *payment.SavedCard) *savedCardResponse {
+	return &savedCardResponse{
+		ID:           card.ID,
+		cardResponse: *newCardResponse(&card.Card),
+		CreatedAt:    card.CreatedAt,
+	}
+}
+
+type listCardsResponse struct {
+	Cards []*savedCardResponse `json:"cards"`
+}
+
+func (h *Customer) createCustomer(w http.ResponseWriter, r *http.Request) {
+	req := &createCustomerRequest{}
+	if err := decodeJSON(r, req); err != nil {
+		respondDecodeError(w, err)
+		return
+	}
+
+	customer, err := h.service.CreateCustomer(&payment.CustomerRequest{
+		Email:       req.Email,
+		Description: req.Description,
+	})
+	if err != nil {
+		respondServiceError(w, err)
+		return
+	}
+
+	respondJSON(w, newCustomerResponse(customer), http.StatusOK)
+}
+
+func (h *Customer) getCustomer(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "customer")
+	if !ok {
+		return
+	}
+
+	customer, err := h.service.FindCustomer(id)
+	if err != nil {
+		respondServiceError(w, err)
+		return
+	}
+
+	respondJSON(w, newCustomerResponse(customer), http.StatusOK)
+}
+
+func (h *Customer) attachCard(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "customer")
+	if !ok {
+		return
+	}
+
+	req := &attachCardRequest{}
+	if err := decodeJSON(r, req); err != nil {
+		respondDecodeError(w, err)
+		return
+	}
+
+	card, err := h.service.AttachCard(id, req.CardToken)
+	if err != nil {
+		respondServiceError(w, err)
+		return
+	}
+
+	respondJSON(w, newSavedCardResponse(card), http.StatusOK)
+}
+
+func (h *Customer) listCards(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "customer")
+	if !ok {
+		return
+	}
+
+	cards, err := h.service.Cards(id)
+	if err != nil {
+		respondServiceError(w, err)
+		return
+	}
+
+	res := &listCardsResponse{
+		Cards: make([]*savedCardResponse, len(cards)),
+	}
+	for i := range cards {
+		res.Cards[i] = newSavedCardResponse(&cards[i])
+	}
+
+	respondJSON(w, res, http.StatusOK)
+}
+
+func (h *Customer) deleteCard(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "customer")
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteCard(id, mux.Vars(r)["card_id"]); err != nil {
+		respondServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
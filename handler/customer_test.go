@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+func customerRouter() *mux.Router {
+	return mux.NewRouter().PathPrefix("/customers").Subrouter()
+}
+
+func TestCustomer(t *testing.T) {
+	customer := &payment.Customer{
+		ID:              1,
+		Email:           "john@example.com",
+		OmiseCustomerID: "cust_test_1",
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	savedCard := payment.SavedCard{
+		ID:        "card_test_1",
+		Card:      payment.Card{Brand: "Visa", LastDigits: "4242", ExpirationMonth: 12, ExpirationYear: 2030},
+		CreatedAt: now,
+	}
+	customerJSON := `{"id":1,"email":"john@example.com","created_at":` + string(nowJSON) + `,"updated_at":` + string(nowJSON) + `}`
+	cardJSON := `{"id":"card_test_1","brand":"Visa","last_digits":"4242","expiration_month":12,"expiration_year":2030,"created_at":` + string(nowJSON) + `}`
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		want       string
+		wantStatus int
+	}{
+		{
+			name:       "create customer",
+			method:     http.MethodPost,
+			path:       "/customers",
+			body:       `{"email":"john@example.com"}`,
+			want:       customerJSON,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "create customer with unknown field",
+			method:     http.MethodPost,
+			path:       "/customers",
+			body:       `{"email":"john@example.com","name":"John"}`,
+			want:       `{"code":"invalid_request","message":"invalid request","errors":[{"field":"name","code":"unknown_field","message":"unknown field name"}]}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "get customer",
+			method:     http.MethodGet,
+			path:       "/customers/1",
+			want:       customerJSON,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "customer not found",
+			method:     http.MethodGet,
+			path:       "/customers/2",
+			want:       `{"code":"not_found","message":"customer not found"}`,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "attach card",
+			method:     http.MethodPost,
+			path:       "/customers/1/cards",
+			body:       `{"card_token":"tokn_test_1"}`,
+			want:       cardJSON,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "list cards",
+			method:     http.MethodGet,
+			path:       "/customers/1/cards",
+			want:       `{"cards":[` + cardJSON + `]}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "delete card",
+			method:     http.MethodDelete,
+			path:       "/customers/1/cards/card_test_1",
+			want:       ``,
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "invalid customer id",
+			method:     http.MethodGet,
+			path:       "/customers/abc/cards",
+			want:       `{"code":"invalid_request","message":"customer id must be a number"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &mockCustomerService{}
+			find := func(id int) (*payment.Customer, error) {
+				if id != customer.ID {
+					return nil, payment.ErrCustomerNotFound
+				}
+				return customer, nil
+			}
+			s.CreateCustomerFn = func(req *payment.CustomerRequest) (*payment.Customer, error) {
+				return customer, nil
+			}
+			s.FindCustomerFn = find
+			s.AttachCardFn = func(customerID int, cardToken string) (*payment.SavedCard, error) {
+				if _, err := find(customerID); err != nil {
+					return nil, err
+				}
+				return &savedCard, nil
+			}
+			s.CardsFn = func(customerID int) ([]payment.SavedCard, error) {
+				if _, err := find(customerID); err != nil {
+					return nil, err
+				}
+				return []payment.SavedCard{savedCard}, nil
+			}
+			s.DeleteCardFn = func(customerID int, cardID string) error {
+				_, err := find(customerID)
+				return err
+			}
+
+			r := customerRouter()
+			h := NewCustomer(s)
+			h.Append(r)
+
+			req, err := http.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			if gotStatus := rr.Code; gotStatus != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", gotStatus, tt.wantStatus)
+			}
+
+			got := strings.TrimSpace(rr.Body.String())
+			if got != tt.want {
+				t.Errorf("handler returned unexpected body: got %v want %v", got, tt.want)
+			}
+		})
+	}
+}
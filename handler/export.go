@@ -0,0 +1,218 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+// exportColumns are the columns of a CSV export, the fields of a JSONL export have the same names.
+// The refund columns are empty if the payment has no refunds.
+var exportColumns = []string{
+	"id", "reference", "charge_id", "status", "source_type", "currency", "amount", "captured_amount",
+	"fee", "fee_vat", "net", "transaction_id", "created_at", "updated_at", "paid_at",
+	"refunded_amount", "refund_count", "first_refunded_at", "last_refunded_at",
+}
+
+// exportWriter writes the payments of an export in a format.
+type exportWriter interface {
+	Write(p *payment.Payment) error
+	Flush() error
+}
+
+type exportFormat struct {
+	contentType string
+	newWriter   func(w io.Writer) (exportWriter, error)
+}
+
+var exportFormats = map[string]exportFormat{
+	"csv":   {"text/csv; charset=utf-8", newCSVExportWriter},
+	"jsonl": {"application/x-ndjson", newJSONLExportWriter},
+}
+
+// exportPayments streams the payments created from the from date to the to date inclusive as CSV, by default,
+// or as JSON lines. The CSV amounts are decimals in the currency while the JSON amounts are in the smallest unit.
+func (h *Payment) exportPayments(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	from, to, _, errs := parseDateRange(query, time.UTC)
+	name := query.Get("format")
+	if name == "" {
+		name = "csv"
+	}
+	format, ok := exportFormats[name]
+	if !ok {
+		errs = append(errs, payment.FieldError{Field: "format", Code: payment.CodeInvalid, Message: "format must be one of csv, jsonl"})
+	}
+	if len(errs) > 0 {
+		respondValidationError(w, errs)
+		return
+	}
+
+	// the response starts with the first payment, so that an error reading the first page is still responded.
+	var ew exportWriter
+	start := func() error {
+		w.Header().Set("Content-Type", format.contentType)
+		w.Header().Set("Content-Disposition", `attachment; filename="payments-`+query.Get("from")+`-`+query.Get("to")+`.`+name+`"`)
+		w.WriteHeader(http.StatusOK)
+		var err error
+		ew, err = format.newWriter(w)
+		return err
+	}
+	err := h.service.Export(from, to, func(p *payment.Payment) error {
+		if ew == nil {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		return ew.Write(p)
+	})
+	if ew == nil {
+		if err != nil {
+			respondServiceError(w, err)
+			return
+		}
+		err = start()
+	}
+	if err == nil {
+		err = ew.Flush()
+	}
+	if err != nil {
+		// the status is already sent, aborting the response tells the client that the export is incomplete.
+		panic(http.ErrAbortHandler)
+	}
+}
+
+type csvExportWriter struct {
+	w *csv.Writer
+}
+
+func newCSVExportWriter(w io.Writer) (exportWriter, error) {
+	cw := csv.NewWriter(w)
+	return &csvExportWriter{w: cw}, cw.Write(exportColumns)
+}
+
+func (ew *csvExportWriter) Write(p *payment.Payment) error {
+	charge := p.OmiseCharge
+	var refunded, refundCount, firstRefundedAt, lastRefundedAt string
+	if n := len(p.Refunds); n > 0 {
+		refunded = p.RefundedAmount().Format()
+		refundCount = strconv.Itoa(n)
+		firstRefundedAt = formatExportTime(p.Refunds[0].CreatedAt)
+		lastRefundedAt = formatExportTime(p.Refunds[n-1].CreatedAt)
+	}
+	return ew.w.Write([]string{
+		strconv.Itoa(p.ID),
+		p.Reference,
+		charge.ID,
+		string(p.Status),
+		charge.SourceType,
+		p.Amount.Currency,
+		p.Amount.Format(),
+		formatExportAmount(charge.CapturedAmount),
+		formatExportAmount(charge.Fee),
+		formatExportAmount(charge.FeeVAT),
+		formatExportAmount(charge.Net),
+		charge.TransactionID,
+		formatExportTime(p.CreatedAt),
+		formatExportTime(p.UpdatedAt),
+		formatExportTime(charge.PaidAt),
+		refunded,
+		refundCount,
+		firstRefundedAt,
+		lastRefundedAt,
+	})
+}
+
+func (ew *csvExportWriter) Flush() error {
+	ew.w.Flush()
+	return ew.w.Error()
+}
+
+// formatExportAmount formats an amount of the charge, which is empty until the charge has it.
+func formatExportAmount(m payment.Money) string {
+	if m.Currency == "" {
+		return ""
+	}
+	return m.Format()
+}
+
+func formatExportTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+type exportedPayment struct {
+	ID              int            `json:"id"`
+	Reference       string         `json:"reference,omitempty"`
+	ChargeID        string         `json:"charge_id"`
+	Status          payment.Status `json:"status"`
+	SourceType      string         `json:"source_type"`
+	Currency        string         `json:"currency"`
+	Amount          int64          `json:"amount"`
+	CapturedAmount  int64          `json:"captured_amount,omitempty"`
+	Fee             int64          `json:"fee,omitempty"`
+	FeeVAT          int64          `json:"fee_vat,omitempty"`
+	Net             int64          `json:"net,omitempty"`
+	TransactionID   string         `json:"transaction_id,omitempty"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	PaidAt          *time.Time     `json:"paid_at,omitempty"`
+	RefundedAmount  int64          `json:"refunded_amount,omitempty"`
+	RefundCount     int            `json:"refund_count,omitempty"`
+	FirstRefundedAt *time.Time     `json:"first_refunded_at,omitempty"`
+	LastRefundedAt  *time.Time     `json:"last_refunded_at,omitempty"`
+}
+
+type jsonlExportWriter struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func newJSONLExportWriter(w io.Writer) (exportWriter, error) {
+	bw := bufio.NewWriter(w)
+	return &jsonlExportWriter{w: bw, enc: json.NewEncoder(bw)}, nil
+}
+
+func (ew *jsonlExportWriter) Write(p *payment.Payment) error {
+	charge := p.OmiseCharge
+	exported := &exportedPayment{
+		ID:             p.ID,
+		Reference:      p.Reference,
+		ChargeID:       charge.ID,
+		Status:         p.Status,
+		SourceType:     charge.SourceType,
+		Currency:       p.Amount.Currency,
+		Amount:         p.Amount.Amount,
+		CapturedAmount: charge.CapturedAmount.Amount,
+		Fee:            charge.Fee.Amount,
+		FeeVAT:         charge.FeeVAT.Amount,
+		Net:            charge.Net.Amount,
+		TransactionID:  charge.TransactionID,
+		CreatedAt:      p.CreatedAt,
+		UpdatedAt:      p.UpdatedAt,
+	}
+	if !charge.PaidAt.IsZero() {
+		exported.PaidAt = &charge.PaidAt
+	}
+	// refunds are kept in the order they were made.
+	if n := len(p.Refunds); n > 0 {
+		exported.RefundedAmount = p.RefundedAmount().Amount
+		exported.RefundCount = n
+		exported.FirstRefundedAt = &p.Refunds[0].CreatedAt
+		exported.LastRefundedAt = &p.Refunds[n-1].CreatedAt
+	}
+	// the encoder ends every value with a newline.
+	return ew.enc.Encode(exported)
+}
+
+func (ew *jsonlExportWriter) Flush() error {
+	return ew.w.Flush()
+}
@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+func TestPayment_exportPayments(t *testing.T) {
+	createdAt := time.Date(2021, 2, 1, 10, 0, 0, 0, time.UTC)
+	paidAt := createdAt.Add(time.Minute)
+	payments := []*payment.Payment{
+		{
+			ID:        1,
+			Reference: "order-1",
+			Status:    payment.StatusSuccessful,
+			Amount:    payment.NewMoney(20000, "THB"),
+			OmiseCharge: &payment.OmiseCharge{
+				ID:            "chrg_test_1",
+				SourceType:    "promptpay",
+				Fee:           payment.NewMoney(330, "THB"),
+				FeeVAT:        payment.NewMoney(23, "THB"),
+				Net:           payment.NewMoney(19647, "THB"),
+				PaidAt:        paidAt,
+				TransactionID: "trxn_test_1",
+			},
+			Refunds: []*payment.Refund{
+				{ID: "rfnd_test_1", Amount: payment.NewMoney(5000, "THB"), CreatedAt: paidAt.Add(time.Hour)},
+				{ID: "rfnd_test_2", Amount: payment.NewMoney(2500, "THB"), CreatedAt: paidAt.Add(2 * time.Hour)},
+			},
+			CreatedAt: createdAt,
+			UpdatedAt: paidAt,
+		},
+		{
+			ID:          2,
+			Status:      payment.StatusPending,
+			Amount:      payment.NewMoney(5000, "THB"),
+			OmiseCharge: &payment.OmiseCharge{ID: "chrg_test_2", SourceType: "card"},
+			CreatedAt:   createdAt,
+			UpdatedAt:   createdAt,
+		},
+	}
+
+	tests := []struct {
+		name            string
+		query           string
+		payments        []*payment.Payment
+		exportErr       error
+		want            string
+		wantStatus      int
+		wantContentType string
+	}{
+		{
+			name:     "csv",
+			query:    "from=2021-02-01&to=2021-02-07",
+			payments: payments,
+			want: "id,reference,charge_id,status,source_type,currency,amount,captured_amount,fee,fee_vat,net,transaction_id,created_at,updated_at,paid_at,refunded_amount,refund_count,first_refunded_at,last_refunded_at\n" +
+				"1,order-1,chrg_test_1,successful,promptpay,THB,200.00,,3.30,0.23,196.47,trxn_test_1,2021-02-01T10:00:00Z,2021-02-01T10:01:00Z,2021-02-01T10:01:00Z,75.00,2,2021-02-01T11:01:00Z,2021-02-01T12:01:00Z\n" +
+				"2,,chrg_test_2,pending,card,THB,50.00,,,,,,2021-02-01T10:00:00Z,2021-02-01T10:00:00Z,,,,,\n",
+			wantStatus:      http.StatusOK,
+			wantContentType: "text/csv; charset=utf-8",
+		},
+		{
+			name:     "jsonl",
+			query:    "from=2021-02-01&to=2021-02-07&format=jsonl",
+			payments: payments,
+			want: `{"id":1,"reference":"order-1","charge_id":"chrg_test_1","status":"successful","source_type":"promptpay","currency":"THB","amount":20000,"fee":330,"fee_vat":23,"net":19647,"transaction_id":"trxn_test_1","created_at":"2021-02-01T10:00:00Z","updated_at":"2021-02-01T10:01:00Z","paid_at":"2021-02-01T10:01:00Z","refunded_amount":7500,"refund_count":2,"first_refunded_at":"2021-02-01T11:01:00Z","last_refunded_at":"2021-02-01T12:01:00Z"}` + "\n" +
+				`{"id":2,"charge_id":"chrg_test_2","status":"pending","source_type":"card","currency":"THB","amount":5000,"created_at":"2021-02-01T10:00:00Z","updated_at":"2021-02-01T10:00:00Z"}` + "\n",
+			wantStatus:      http.StatusOK,
+			wantContentType: "application/x-ndjson",
+		},
+		{
+			name:            "no payments",
+			query:           "from=2021-02-01&to=2021-02-07",
+			want:            "id,reference,charge_id,status,source_type,currency,amount,captured_amount,fee,fee_vat,net,transaction_id,created_at,updated_at,paid_at,refunded_amount,refund_count,first_refunded_at,last_refunded_at\n",
+			wantStatus:      http.StatusOK,
+			wantContentType: "text/csv; charset=utf-8",
+		},
+		{
+			name:            "invalid format",
+			query:           "from=2021-02-01&to=2021-02-07&format=xml",
+			want:            `{"code":"invalid_request","message":"invalid request","errors":[{"field":"format","code":"invalid","message":"format must be one of csv, jsonl"}]}` + "\n",
+			wantStatus:      http.StatusUnprocessableEntity,
+			wantContentType: "application/json",
+		},
+		{
+			name:            "error",
+			query:           "from=2021-02-01&to=2021-02-07",
+			exportErr:       errors.New("some error"),
+			want:            `{"code":"internal_error","message":"internal server error"}` + "\n",
+			wantStatus:      http.StatusInternalServerError,
+			wantContentType: "application/json",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &mockService{}
+			s.ExportFn = func(from, to time.Time, fn func(p *payment.Payment) error) error {
+				if want := time.Date(2021, 2, 8, 0, 0, 0, 0, time.UTC); !to.Equal(want) {
+					t.Errorf("handler exported to %v want %v", to, want)
+				}
+				for _, p := range tt.payments {
+					if err := fn(p); err != nil {
+						return err
+					}
+				}
+				return tt.exportErr
+			}
+
+			r := paymentRouter()
+			h := NewPayment(s)
+			h.Append(r)
+
+			req, err := http.NewRequest(http.MethodGet, "/payments/export?"+tt.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			if gotStatus := rr.Code; gotStatus != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", gotStatus, tt.wantStatus)
+			}
+			if got := rr.Header().Get("Content-Type"); got != tt.wantContentType {
+				t.Errorf("handler returned wrong content type: got %v want %v", got, tt.wantContentType)
+			}
+			if got := rr.Body.String(); got != tt.want {
+				t.Errorf("handler returned unexpected body: got %v want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPayment_exportPayments_incomplete(t *testing.T) {
+	s := &mockService{}
+	s.ExportFn = func(from, to time.Time, fn func(p *payment.Payment) error) error {
+		p := &payment.Payment{ID: 1, Amount: payment.NewMoney(100, "THB"), OmiseCharge: &payment.OmiseCharge{}}
+		if err := fn(p); err != nil {
+			return err
+		}
+		return errors.New("some error")
+	}
+
+	r := paymentRouter()
+	h := NewPayment(s)
+	h.Append(r)
+
+	req, err := http.NewRequest(http.MethodGet, "/payments/export?from=2021-02-01&to=2021-02-07", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		if got := recover(); got != http.ErrAbortHandler {
+			t.Errorf("handler panicked with %v want %v", got, http.ErrAbortHandler)
+		}
+	}()
+	r.ServeHTTP(httptest.NewRecorder(), req)
+}
@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+)
+
+type feeSummaryResponse struct {
+	Date       string `json:"date"`
+	Currency   string `json:"currency"`
+	SourceType string `json:"source_type"`
+	Count      int    `json:"count"`
+	Amount     int64  `json:"amount"`
+	Fee        int64  `json:"fee"`
+	FeeVAT     int64  `json:"fee_vat"`
+	Net        int64  `json:"net"`
+}
+
+type listFeeSummariesResponse struct {
+	Fees []feeSummaryResponse `json:"fees"`
+}
+
+// listFeeSummaries lists the fees of the payments paid from the from date to the to date inclusive,
+// summed by day, currency and source type. The days are in the timezone query parameter, UTC by default.
+func (h *Payment) listFeeSummaries(w http.ResponseWriter, r *http.Request) {
+	from, to, loc, errs := parseDateRange(r.URL.Query(), time.UTC)
+	if len(errs) > 0 {
+		respondValidationError(w, errs)
+		return
+	}
+
+	summaries, err := h.service.FeeSummaries(from, to, loc)
+	if err != nil {
+		respondServiceError(w, err)
+		return
+	}
+
+	res := &listFeeSummariesResponse{Fees: make([]feeSummaryResponse, len(summaries))}
+	for i, s := range summaries {
+		res.Fees[i] = feeSummaryResponse{
+			Date:       s.Date,
+			Currency:   s.Currency,
+			SourceType: s.SourceType,
+			Count:      s.Count,
+			Amount:     s.Amount.Amount,
+			Fee:        s.Fee.Amount,
+			FeeVAT:     s.FeeVAT.Amount,
+			Net:        s.Net.Amount,
+		}
+	}
+	respondJSON(w, res, http.StatusOK)
+}
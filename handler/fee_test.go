@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+func TestPayment_listFeeSummaries(t *testing.T) {
+	thb := func(amount int64) payment.Money { return payment.NewMoney(amount, "THB") }
+	summaries := []payment.FeeSummary{
+		{Date: "2021-02-01", Currency: "THB", SourceType: "card", Count: 2, Amount: thb(25000), Fee: thb(913), FeeVAT: thb(64), Net: thb(24023)},
+	}
+
+	tests := []struct {
+		name            string
+		query           string
+		wantFrom        string
+		wantTo          string
+		wantLocation    string
+		FeeSummariesErr error
+		want            string
+		wantStatus      int
+	}{
+		{
+			name:         "success",
+			query:        "from=2021-02-01&to=2021-02-28",
+			wantFrom:     "2021-02-01T00:00:00Z",
+			wantTo:       "2021-03-01T00:00:00Z",
+			wantLocation: "UTC",
+			want:         `{"fees":[{"date":"2021-02-01","currency":"THB","source_type":"card","count":2,"amount":25000,"fee":913,"fee_vat":64,"net":24023}]}`,
+			wantStatus:   http.StatusOK,
+		},
+		{
+			name:         "timezone",
+			query:        "from=2021-02-01&to=2021-02-01&timezone=Asia/Bangkok",
+			wantFrom:     "2021-02-01T00:00:00+07:00",
+			wantTo:       "2021-02-02T00:00:00+07:00",
+			wantLocation: "Asia/Bangkok",
+			want:         `{"fees":[{"date":"2021-02-01","currency":"THB","source_type":"card","count":2,"amount":25000,"fee":913,"fee_vat":64,"net":24023}]}`,
+			wantStatus:   http.StatusOK,
+		},
+		{
+			name:       "missing dates",
+			query:      "",
+			want:       `{"code":"invalid_request","message":"invalid request","errors":[{"field":"from","code":"required","message":"from is required"},{"field":"to","code":"required","message":"to is required"}]}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "invalid date and timezone",
+			query:      "from=2021-02-30&to=2021-02-28&timezone=Mars/Olympus",
+			want:       `{"code":"invalid_request","message":"invalid request","errors":[{"field":"timezone","code":"invalid","message":"timezone must be an IANA time zone name"},{"field":"from","code":"invalid","message":"from must be a date in the YYYY-MM-DD format"}]}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "to before from",
+			query:      "from=2021-02-28&to=2021-02-01",
+			want:       `{"code":"invalid_request","message":"invalid request","errors":[{"field":"to","code":"out_of_range","message":"to must not be before from"}]}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:            "error",
+			query:           "from=2021-02-01&to=2021-02-28",
+			wantFrom:        "2021-02-01T00:00:00Z",
+			wantTo:          "2021-03-01T00:00:00Z",
+			wantLocation:    "UTC",
+			FeeSummariesErr: errors.New("some error"),
+			want:            `{"code":"internal_error","message":"internal server error"}`,
+			wantStatus:      http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &mockService{}
+			s.FeeSummariesFn = func(from, to time.Time, loc *time.Location) ([]payment.FeeSummary, error) {
+				if got := from.Format(time.RFC3339); got != tt.wantFrom {
+					t.Errorf("handler requested from %v want %v", got, tt.wantFrom)
+				}
+				if got := to.Format(time.RFC3339); got != tt.wantTo {
+					t.Errorf("handler requested to %v want %v", got, tt.wantTo)
+				}
+				if loc.String() != tt.wantLocation {
+					t.Errorf("handler requested location %v want %v", loc, tt.wantLocation)
+				}
+				if tt.FeeSummariesErr != nil {
+					return nil, tt.FeeSummariesErr
+				}
+				return summaries, nil
+			}
+
+			r := paymentRouter()
+			h := NewPayment(s)
+			h.Append(r)
+
+			req, err := http.NewRequest(http.MethodGet, "/payments/fees?"+tt.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			if gotStatus := rr.Code; gotStatus != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", gotStatus, tt.wantStatus)
+			}
+
+			got := strings.TrimSpace(rr.Body.String())
+			if got != tt.want {
+				t.Errorf("handler returned unexpected body: got %v want %v", got, tt.want)
+			}
+		})
+	}
+}
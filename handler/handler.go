@@ -1,14 +1,17 @@
 package handler
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
-	"github.com/noppawitt/paymentsvc/inmem"
 	"github.com/noppawitt/paymentsvc/payment"
 )
 
@@ -24,91 +27,465 @@ func NewPayment(service payment.Service) *Payment {
 	}
 }
 
+// Names of the routes the payer opens from the payment page of a payment link.
+const (
+	routePaymentQRCode     = "payment_qr_code"
+	routePaymentSlip       = "payment_slip"
+	routePaymentSlipFormat = "payment_slip_format"
+)
+
+// Names of the routes which move money or change a payment outside the payment flow.
+const (
+	routePaymentCapture = "payment_capture"
+	routePaymentVoid    = "payment_void"
+	routePaymentRefund  = "payment_refund"
+	routePaymentRefresh = "payment_refresh"
+)
+
 // Append appends routes to the router.
 func (h *Payment) Append(r *mux.Router) {
 	r.HandleFunc("", h.createPaymentRequest).Methods(http.MethodPost)
+	r.HandleFunc("", h.getPaymentByReference).Methods(http.MethodGet).Queries("reference", "{reference}")
+	r.HandleFunc("", h.listPayments).Methods(http.MethodGet)
+	r.HandleFunc("/fees", h.listFeeSummaries).Methods(http.MethodGet)
+	r.HandleFunc("/export", h.exportPayments).Methods(http.MethodGet)
 	r.HandleFunc("/{id}", h.getPayment).Methods(http.MethodGet)
+	r.HandleFunc("/{id}/qr.{format:png|svg}", h.getPaymentQRCode).Methods(http.MethodGet).Name(routePaymentQRCode)
+	r.HandleFunc("/{id}/slip", h.getPaymentSlip).Methods(http.MethodGet).Name(routePaymentSlip)
+	r.HandleFunc("/{id}/slip.{format:html|pdf}", h.getPaymentSlip).Methods(http.MethodGet).Name(routePaymentSlipFormat)
+	r.HandleFunc("/{id}/capture", h.capturePayment).Methods(http.MethodPost).Name(routePaymentCapture)
+	r.HandleFunc("/{id}/void", h.voidPayment).Methods(http.MethodPost).Name(routePaymentVoid)
+	r.HandleFunc("/{id}/refunds", h.refundPayment).Methods(http.MethodPost).Name(routePaymentRefund)
+	r.HandleFunc("/{id}/refresh", h.refreshPayment).Methods(http.MethodPost).Name(routePaymentRefresh)
+	r.HandleFunc("/{id}/events", h.listPaymentEvents).Methods(http.MethodGet)
 }
 
 type createPaymentRequestRequest struct {
-	Amount     int64  `json:"amount"`
-	Currency   string `json:"currency"`
-	ReturnURI  string `json:"return_uri"`
-	SourceType string `json:"source_type"`
+	Amount          json.RawMessage   `json:"amount"`
+	Currency        string            `json:"currency"`
+	ReturnURI       string            `json:"return_uri"`
+	SourceType      string            `json:"source_type"`
+	CardToken       string            `json:"card_token"`
+	CustomerID      int               `json:"customer_id"`
+	CardID          string            `json:"card_id"`
+	PhoneNumber     string            `json:"phone_number"`
+	Email           string            `json:"email"`
+	Name            string            `json:"name"`
+	PlatformType    string            `json:"platform_type"`
+	InstallmentTerm int               `json:"installment_term"`
+	ZeroInterest    bool              `json:"zero_interest_installments"`
+	Capture         *bool             `json:"capture"`
+	Reference       string            `json:"reference"`
+	Description     string            `json:"description"`
+	Metadata        map[string]string `json:"metadata"`
+	IPAddress       string            `json:"ip_address"`
 }
 
 type createPaymentRequestResponse struct {
-	ID            int    `json:"id"`
-	AuthorizedURI string `json:"authorized_uri"`
+	ID            int                  `json:"id"`
+	Status        payment.Status       `json:"status"`
+	AuthorizedURI string               `json:"authorized_uri,omitempty"`
+	QRCode        *qrCodeResponse      `json:"qr_code,omitempty"`
+	BillPayment   *billPaymentResponse `json:"bill_payment,omitempty"`
+	Risk          *riskResponse        `json:"risk,omitempty"`
+}
+
+type riskResponse struct {
+	Decision     payment.RiskDecision `json:"decision"`
+	MatchedRules []string             `json:"matched_rules"`
+}
+
+func newRiskResponse(risk *payment.Risk) *riskResponse {
+	if risk == nil {
+		return nil
+	}
+	return &riskResponse{
+		Decision:     risk.Decision,
+		MatchedRules: risk.MatchedRules,
+	}
+}
+
+type qrCodeResponse struct {
+	Payload   string    `json:"payload"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type cardResponse struct {
+	Brand           string `json:"brand"`
+	LastDigits      string `json:"last_digits"`
+	ExpirationMonth int    `json:"expiration_month"`
+	ExpirationYear  int    `json:"expiration_year"`
+}
+
+func newCardResponse(card *payment.Card) *cardResponse {
+	if card == nil {
+		return nil
+	}
+	return &cardResponse{
+		Brand:           card.Brand,
+		LastDigits:      card.LastDigits,
+		ExpirationMonth: card.ExpirationMonth,
+		ExpirationYear:  card.ExpirationYear,
+	}
+}
+
+type billPaymentResponse struct {
+	TaxID      string    `json:"tax_id"`
+	Reference1 string    `json:"reference_1"`
+	Reference2 string    `json:"reference_2"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+func newBillPaymentResponse(billPayment *payment.BillPayment) *billPaymentResponse {
+	if billPayment == nil {
+		return nil
+	}
+	return &billPaymentResponse{
+		TaxID:      billPayment.TaxID,
+		Reference1: billPayment.Reference1,
+		Reference2: billPayment.Reference2,
+		ExpiresAt:  billPayment.ExpiresAt,
+	}
+}
+
+func newQRCodeResponse(qrCode *payment.QRCode) *qrCodeResponse {
+	if qrCode == nil || qrCode.Payload == "" {
+		return nil
+	}
+	return &qrCodeResponse{
+		Payload:   qrCode.Payload,
+		ExpiresAt: qrCode.ExpiresAt,
+	}
 }
 
 func (h *Payment) createPaymentRequest(w http.ResponseWriter, r *http.Request) {
 	req := &createPaymentRequestRequest{}
-	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
-		respondError(w, "invalid request body", http.StatusBadRequest)
+	if err := decodeJSON(r, req); err != nil {
+		respondDecodeError(w, err)
+		return
+	}
+
+	amount, err := payment.ParseJSONAmount(req.Amount, strings.ToUpper(req.Currency))
+	if err != nil {
+		respondValidationError(w, []payment.FieldError{amountFieldError(err)})
 		return
 	}
 
 	paymentReq := &payment.Request{
-		Amount:     req.Amount,
-		Currency:   strings.ToUpper(req.Currency),
+		Amount:     amount,
 		ReturnURI:  req.ReturnURI,
 		SourceType: req.SourceType,
+		SourceDetails: payment.SourceDetails{
+			CardToken:       req.CardToken,
+			CardID:          req.CardID,
+			PhoneNumber:     req.PhoneNumber,
+			Email:           req.Email,
+			Name:            req.Name,
+			PlatformType:    strings.ToUpper(req.PlatformType),
+			InstallmentTerm: req.InstallmentTerm,
+
+			ZeroInterestInstallments: req.ZeroInterest,
+		},
+		CustomerID:  req.CustomerID,
+		Capture:     req.Capture == nil || *req.Capture,
+		Reference:   req.Reference,
+		Description: req.Description,
+		Metadata:    req.Metadata,
+		IPAddress:   req.IPAddress,
 	}
 
 	payment, err := h.service.CreatePaymentRequest(paymentReq)
 	if err != nil {
-		respondError(w, err.Error(), http.StatusInternalServerError)
+		respondServiceError(w, err)
 		return
 	}
 
 	res := &createPaymentRequestResponse{
 		ID:            payment.ID,
+		Status:        payment.Status,
 		AuthorizedURI: payment.OmiseCharge.AuthorizeURI,
+		QRCode:        newQRCodeResponse(payment.QRCode),
+		BillPayment:   newBillPaymentResponse(payment.BillPayment),
+		Risk:          newRiskResponse(payment.Risk),
 	}
 
 	respondJSON(w, res, http.StatusOK)
 }
 
+func amountFieldError(err error) payment.FieldError {
+	switch err {
+	case payment.ErrUnknownCurrency:
+		return payment.FieldError{Field: "currency", Code: payment.CodeUnsupported, Message: "currency is not supported"}
+	case payment.ErrAmountOverflow:
+		return payment.FieldError{Field: "amount", Code: payment.CodeOutOfRange, Message: "amount is too large"}
+	default:
+		return payment.FieldError{Field: "amount", Code: payment.CodeInvalid, Message: "amount must be an integer in the smallest currency unit or a decimal string"}
+	}
+}
+
 type getPaymentResponse struct {
-	ID         int            `json:"id"`
-	Status     payment.Status `json:"status"`
-	Amount     int64          `json:"amount"`
-	Currency   string         `json:"currency"`
-	SourceType string         `json:"source_type"`
-	CreatedAt  time.Time      `json:"created_at"`
-	UpdatedAt  time.Time      `json:"updated_at"`
+	ID             int                  `json:"id"`
+	CustomerID     int                  `json:"customer_id,omitempty"`
+	Reference      string               `json:"reference,omitempty"`
+	Description    string               `json:"description,omitempty"`
+	Metadata       map[string]string    `json:"metadata,omitempty"`
+	Status         payment.Status       `json:"status"`
+	Amount         int64                `json:"amount"`
+	AmountDecimal  string               `json:"amount_decimal"`
+	Currency       string               `json:"currency"`
+	CapturedAmount int64                `json:"captured_amount,omitempty"`
+	Fee            int64                `json:"fee,omitempty"`
+	FeeVAT         int64                `json:"fee_vat,omitempty"`
+	Net            int64                `json:"net,omitempty"`
+	PaidAt         *time.Time           `json:"paid_at,omitempty"`
+	TransactionID  string               `json:"transaction_id,omitempty"`
+	SourceType     string               `json:"source_type"`
+	QRCode         *qrCodeResponse      `json:"qr_code,omitempty"`
+	Card           *cardResponse        `json:"card,omitempty"`
+	BillPayment    *billPaymentResponse `json:"bill_payment,omitempty"`
+	FailureCode    string               `json:"failure_code,omitempty"`
+	FailureMessage string               `json:"failure_message,omitempty"`
+	IPAddress      string               `json:"ip_address,omitempty"`
+	Risk           *riskResponse        `json:"risk,omitempty"`
+	RefundedAmount int64                `json:"refunded_amount,omitempty"`
+	Refunds        []*refundResponse    `json:"refunds,omitempty"`
+	CreatedAt      time.Time            `json:"created_at"`
+	UpdatedAt      time.Time            `json:"updated_at"`
+}
+
+type refundResponse struct {
+	ID        string    `json:"id"`
+	Amount    int64     `json:"amount"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 func (h *Payment) getPayment(w http.ResponseWriter, r *http.Request) {
-	idStr := mux.Vars(r)["id"]
-	id, err := strconv.Atoi(idStr)
-	if err != nil {
-		respondError(w, "payment id must be a number", http.StatusBadRequest)
+	id, ok := pathID(w, r, "payment")
+	if !ok {
 		return
 	}
 
 	payment, err := h.service.Find(id)
 	if err != nil {
-		code := http.StatusInternalServerError
-		if err == inmem.ErrPaymentNotFound {
-			code = http.StatusBadRequest
-		}
-		respondError(w, err.Error(), code)
+		respondServiceError(w, err)
+		return
+	}
+
+	respondJSON(w, newGetPaymentResponse(payment), http.StatusOK)
+}
+
+func (h *Payment) getPaymentByReference(w http.ResponseWriter, r *http.Request) {
+	reference := mux.Vars(r)["reference"]
+
+	payment, err := h.service.FindByReference(reference)
+	if err != nil {
+		respondServiceError(w, err)
+		return
+	}
+
+	respondJSON(w, newGetPaymentResponse(payment), http.StatusOK)
+}
+
+type capturePaymentRequest struct {
+	Amount   json.RawMessage `json:"amount"`
+	Currency string          `json:"currency"`
+}
+
+// capturePayment captures an authorized payment.
+// The body is optional, without an amount the whole authorized amount is captured.
+func (h *Payment) capturePayment(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "payment")
+	if !ok {
+		return
+	}
+
+	req := &capturePaymentRequest{}
+	if err := decodeJSON(r, req); err != nil && err != io.EOF {
+		respondDecodeError(w, err)
+		return
+	}
+
+	currency := strings.ToUpper(req.Currency)
+	if currency == "" && isJSONString(req.Amount) {
+		respondValidationError(w, []payment.FieldError{{Field: "currency", Code: payment.CodeRequired, Message: "currency is required for a decimal amount"}})
+		return
+	}
+	amount, err := payment.ParseJSONAmount(req.Amount, currency)
+	if err != nil {
+		respondValidationError(w, []payment.FieldError{amountFieldError(err)})
+		return
+	}
+
+	payment, err := h.service.Capture(id, amount)
+	if err != nil {
+		respondServiceError(w, err)
+		return
+	}
+
+	respondJSON(w, newGetPaymentResponse(payment), http.StatusOK)
+}
+
+type refundPaymentRequest struct {
+	Amount   json.RawMessage `json:"amount"`
+	Currency string          `json:"currency"`
+}
+
+// refundPayment refunds a paid payment, the whole amount not refunded yet if the request has no amount.
+func (h *Payment) refundPayment(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "payment")
+	if !ok {
 		return
 	}
 
+	req := &refundPaymentRequest{}
+	if err := decodeJSON(r, req); err != nil && err != io.EOF {
+		respondDecodeError(w, err)
+		return
+	}
+
+	currency := strings.ToUpper(req.Currency)
+	if currency == "" && isJSONString(req.Amount) {
+		respondValidationError(w, []payment.FieldError{{Field: "currency", Code: payment.CodeRequired, Message: "currency is required for a decimal amount"}})
+		return
+	}
+	amount, err := payment.ParseJSONAmount(req.Amount, currency)
+	if err != nil {
+		respondValidationError(w, []payment.FieldError{amountFieldError(err)})
+		return
+	}
+
+	payment, err := h.service.Refund(id, amount)
+	if err != nil {
+		respondServiceError(w, err)
+		return
+	}
+
+	respondJSON(w, newGetPaymentResponse(payment), http.StatusOK)
+}
+
+func (h *Payment) voidPayment(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "payment")
+	if !ok {
+		return
+	}
+
+	payment, err := h.service.Void(id)
+	if err != nil {
+		respondServiceError(w, err)
+		return
+	}
+
+	respondJSON(w, newGetPaymentResponse(payment), http.StatusOK)
+}
+
+// refreshPayment refreshes a payment from its charge whatever its status, for operators to correct a payment
+// which went out of sync with the payment gateway.
+func (h *Payment) refreshPayment(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "payment")
+	if !ok {
+		return
+	}
+
+	payment, err := h.service.Refresh(id)
+	if err != nil {
+		respondServiceError(w, err)
+		return
+	}
+
+	respondJSON(w, newGetPaymentResponse(payment), http.StatusOK)
+}
+
+func isJSONString(data json.RawMessage) bool {
+	data = bytes.TrimSpace(data)
+	return len(data) > 0 && data[0] == '"'
+}
+
+// pathID parses the id of the resource in the path, it responds an error if the id is invalid.
+func pathID(w http.ResponseWriter, r *http.Request, resource string) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, payment.ErrorCodeInvalidRequest, resource+" id must be a number", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+func newGetPaymentResponse(payment *payment.Payment) *getPaymentResponse {
 	res := &getPaymentResponse{
-		ID:         payment.ID,
-		Status:     payment.Status,
-		Amount:     payment.Amount,
-		Currency:   payment.Currency,
-		SourceType: payment.OmiseCharge.SourceType,
-		CreatedAt:  payment.CreatedAt,
-		UpdatedAt:  payment.UpdatedAt,
+		ID:             payment.ID,
+		CustomerID:     payment.CustomerID,
+		Reference:      payment.Reference,
+		Description:    payment.Description,
+		Metadata:       payment.Metadata,
+		Status:         payment.Status,
+		Amount:         payment.Amount.Amount,
+		AmountDecimal:  payment.Amount.Format(),
+		Currency:       payment.Amount.Currency,
+		CapturedAmount: payment.OmiseCharge.CapturedAmount.Amount,
+		Fee:            payment.OmiseCharge.Fee.Amount,
+		FeeVAT:         payment.OmiseCharge.FeeVAT.Amount,
+		Net:            payment.OmiseCharge.Net.Amount,
+		TransactionID:  payment.OmiseCharge.TransactionID,
+		SourceType:     payment.OmiseCharge.SourceType,
+		QRCode:         newQRCodeResponse(payment.QRCode),
+		Card:           newCardResponse(payment.Card),
+		BillPayment:    newBillPaymentResponse(payment.BillPayment),
+		FailureCode:    payment.OmiseCharge.FailureCode,
+		FailureMessage: payment.OmiseCharge.FailureMessage,
+		IPAddress:      payment.IPAddress,
+		Risk:           newRiskResponse(payment.Risk),
+		CreatedAt:      payment.CreatedAt,
+		UpdatedAt:      payment.UpdatedAt,
+	}
+	if paidAt := payment.OmiseCharge.PaidAt; !paidAt.IsZero() {
+		res.PaidAt = &paidAt
+	}
+	if len(payment.Refunds) > 0 {
+		res.RefundedAmount = payment.RefundedAmount().Amount
+		res.Refunds = make([]*refundResponse, len(payment.Refunds))
+		for i, refund := range payment.Refunds {
+			res.Refunds[i] = &refundResponse{
+				ID:        refund.ID,
+				Amount:    refund.Amount.Amount,
+				CreatedAt: refund.CreatedAt,
+			}
+		}
 	}
+	return res
+}
 
-	respondJSON(w, res, http.StatusOK)
+// dateLayout is the layout of the dates in query parameters.
+const dateLayout = "2006-01-02"
+
+// parseDateRange parses the from and to dates of the query, both inclusive, into the range [from, to) of times.
+// The dates are in the timezone query parameter, the given location by default, which is also returned.
+func parseDateRange(query url.Values, defaultLoc *time.Location) (from, to time.Time, loc *time.Location, errs []payment.FieldError) {
+	loc = defaultLoc
+	if tz := query.Get("timezone"); tz != "" {
+		l, err := time.LoadLocation(tz)
+		if err != nil {
+			errs = append(errs, payment.FieldError{Field: "timezone", Code: payment.CodeInvalid, Message: "timezone must be an IANA time zone name"})
+		} else {
+			loc = l
+		}
+	}
+	parseDate := func(field string) time.Time {
+		s := query.Get(field)
+		if s == "" {
+			errs = append(errs, payment.FieldError{Field: field, Code: payment.CodeRequired, Message: field + " is required"})
+			return time.Time{}
+		}
+		date, err := time.ParseInLocation(dateLayout, s, loc)
+		if err != nil {
+			errs = append(errs, payment.FieldError{Field: field, Code: payment.CodeInvalid, Message: field + " must be a date in the YYYY-MM-DD format"})
+		}
+		return date
+	}
+	from, to = parseDate("from"), parseDate("to")
+	if len(errs) == 0 && to.Before(from) {
+		errs = append(errs, payment.FieldError{Field: "to", Code: payment.CodeOutOfRange, Message: "to must not be before from"})
+	}
+	return from, to.AddDate(0, 0, 1), loc, errs
 }
 
 func respondJSON(w http.ResponseWriter, v interface{}, code int) {
@@ -117,6 +494,77 @@ func respondJSON(w http.ResponseWriter, v interface{}, code int) {
 	json.NewEncoder(w).Encode(v)
 }
 
-func respondError(w http.ResponseWriter, err string, code int) {
-	respondJSON(w, map[string]interface{}{"message": err}, code)
+// errorCodeInternal is the error code of unexpected errors, their details are not exposed to clients.
+const errorCodeInternal payment.ErrorCode = "internal_error"
+
+type errorResponse struct {
+	Code    payment.ErrorCode    `json:"code"`
+	Message string               `json:"message"`
+	Errors  []payment.FieldError `json:"errors,omitempty"`
+}
+
+func respondError(w http.ResponseWriter, code payment.ErrorCode, message string, status int) {
+	respondJSON(w, &errorResponse{Code: code, Message: message}, status)
+}
+
+func respondValidationError(w http.ResponseWriter, errs []payment.FieldError) {
+	res := &errorResponse{
+		Code:    payment.ErrorCodeInvalidRequest,
+		Message: "invalid request",
+		Errors:  errs,
+	}
+	respondJSON(w, res, http.StatusUnprocessableEntity)
+}
+
+// statusCodes maps domain error codes to HTTP status codes.
+var statusCodes = map[payment.ErrorCode]int{
+	payment.ErrorCodeNotFound:           http.StatusNotFound,
+	payment.ErrorCodeInvalidRequest:     http.StatusBadRequest,
+	payment.ErrorCodeGatewayDeclined:    http.StatusPaymentRequired,
+	payment.ErrorCodeGatewayUnavailable: http.StatusBadGateway,
+	payment.ErrorCodeConflict:           http.StatusConflict,
+	payment.ErrorCodeRiskBlocked:        http.StatusForbidden,
+	payment.ErrorCodeUnauthorized:       http.StatusUnauthorized,
+}
+
+// respondServiceError responds an error returned by a service.
+func respondServiceError(w http.ResponseWriter, err error) {
+	var verr *payment.ValidationError
+	if errors.As(err, &verr) {
+		respondValidationError(w, verr.Errors)
+		return
+	}
+
+	var perr *payment.Error
+	if errors.As(err, &perr) {
+		if status, ok := statusCodes[perr.Code]; ok {
+			respondError(w, perr.Code, perr.Error(), status)
+			return
+		}
+	}
+
+	respondError(w, errorCodeInternal, "internal server error", http.StatusInternalServerError)
+}
+
+// decodeJSON decodes the request body into v, rejecting fields that v does not have.
+func decodeJSON(r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// respondDecodeError responds an unknown field as a validation error since the decoder does not
+// expose a typed error for it, any other decoding error is a malformed body.
+func respondDecodeError(w http.ResponseWriter, err error) {
+	const unknownFieldPrefix = "json: unknown field "
+	if msg := err.Error(); strings.HasPrefix(msg, unknownFieldPrefix) {
+		field, _ := strconv.Unquote(strings.TrimPrefix(msg, unknownFieldPrefix))
+		respondValidationError(w, []payment.FieldError{{
+			Field:   field,
+			Code:    payment.CodeUnknownField,
+			Message: "unknown field " + field,
+		}})
+		return
+	}
+	respondError(w, payment.ErrorCodeInvalidRequest, "invalid request body", http.StatusBadRequest)
 }
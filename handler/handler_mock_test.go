@@ -1,10 +1,35 @@
 package handler
 
-import "github.com/noppawitt/paymentsvc/payment"
+import (
+	"time"
+
+	"github.com/noppawitt/paymentsvc/apikey"
+	"github.com/noppawitt/paymentsvc/ledger"
+	"github.com/noppawitt/paymentsvc/payment"
+	"github.com/noppawitt/paymentsvc/paymentlink"
+	"github.com/noppawitt/paymentsvc/reconcile"
+	"github.com/noppawitt/paymentsvc/report"
+	"github.com/noppawitt/paymentsvc/subscription"
+	"github.com/noppawitt/paymentsvc/webhook"
+)
 
 type mockService struct {
 	CreatePaymentRequestFn func(req *payment.Request) (*payment.Payment, error)
 	FindFn                 func(id int) (*payment.Payment, error)
+	RefreshFn              func(id int) (*payment.Payment, error)
+	FindByReferenceFn      func(reference string) (*payment.Payment, error)
+	CaptureFn              func(id int, amount payment.Money) (*payment.Payment, error)
+	VoidFn                 func(id int) (*payment.Payment, error)
+	RefundFn               func(id int, amount payment.Money) (*payment.Payment, error)
+	PaymentMethodsFn       func() ([]payment.PaymentMethod, error)
+	InstallmentsFn         func(amount payment.Money, zeroInterest bool) ([]payment.Installment, error)
+	FeeSummariesFn         func(from, to time.Time, loc *time.Location) ([]payment.FeeSummary, error)
+	ExportFn               func(from, to time.Time, fn func(payment *payment.Payment) error) error
+	SearchFn               func(q *payment.Query) ([]*payment.Payment, error)
+	EventsFn               func(id int) ([]*payment.Event, error)
+	OverrideStatusFn       func(id int, status payment.Status, reason, operator string) (*payment.Payment, error)
+	CorrectStatusFn        func(id int, reason, operator string) (*payment.Payment, error)
+	StatusOverridesFn      func(id int) ([]*payment.StatusOverride, error)
 }
 
 func (m *mockService) CreatePaymentRequest(req *payment.Request) (*payment.Payment, error) {
@@ -14,3 +39,270 @@ func (m *mockService) CreatePaymentRequest(req *payment.Request) (*payment.Payme
 func (m *mockService) Find(id int) (*payment.Payment, error) {
 	return m.FindFn(id)
 }
+
+func (m *mockService) Refresh(id int) (*payment.Payment, error) {
+	return m.RefreshFn(id)
+}
+
+func (m *mockService) FindByReference(reference string) (*payment.Payment, error) {
+	return m.FindByReferenceFn(reference)
+}
+
+func (m *mockService) Capture(id int, amount payment.Money) (*payment.Payment, error) {
+	return m.CaptureFn(id, amount)
+}
+
+func (m *mockService) Void(id int) (*payment.Payment, error) {
+	return m.VoidFn(id)
+}
+
+func (m *mockService) Refund(id int, amount payment.Money) (*payment.Payment, error) {
+	return m.RefundFn(id, amount)
+}
+
+func (m *mockService) PaymentMethods() ([]payment.PaymentMethod, error) {
+	return m.PaymentMethodsFn()
+}
+
+func (m *mockService) Installments(amount payment.Money, zeroInterest bool) ([]payment.Installment, error) {
+	return m.InstallmentsFn(amount, zeroInterest)
+}
+
+func (m *mockService) FeeSummaries(from, to time.Time, loc *time.Location) ([]payment.FeeSummary, error) {
+	return m.FeeSummariesFn(from, to, loc)
+}
+
+func (m *mockService) Export(from, to time.Time, fn func(payment *payment.Payment) error) error {
+	return m.ExportFn(from, to, fn)
+}
+
+func (m *mockService) Search(q *payment.Query) ([]*payment.Payment, error) {
+	return m.SearchFn(q)
+}
+
+func (m *mockService) Events(id int) ([]*payment.Event, error) {
+	return m.EventsFn(id)
+}
+
+func (m *mockService) OverrideStatus(id int, status payment.Status, reason, operator string) (*payment.Payment, error) {
+	return m.OverrideStatusFn(id, status, reason, operator)
+}
+
+func (m *mockService) CorrectStatus(id int, reason, operator string) (*payment.Payment, error) {
+	return m.CorrectStatusFn(id, reason, operator)
+}
+
+func (m *mockService) StatusOverrides(id int) ([]*payment.StatusOverride, error) {
+	return m.StatusOverridesFn(id)
+}
+
+type mockCustomerService struct {
+	CreateCustomerFn func(req *payment.CustomerRequest) (*payment.Customer, error)
+	FindCustomerFn   func(id int) (*payment.Customer, error)
+	AttachCardFn     func(customerID int, cardToken string) (*payment.SavedCard, error)
+	CardsFn          func(customerID int) ([]payment.SavedCard, error)
+	DeleteCardFn     func(customerID int, cardID string) error
+}
+
+func (m *mockCustomerService) CreateCustomer(req *payment.CustomerRequest) (*payment.Customer, error) {
+	return m.CreateCustomerFn(req)
+}
+
+func (m *mockCustomerService) FindCustomer(id int) (*payment.Customer, error) {
+	return m.FindCustomerFn(id)
+}
+
+func (m *mockCustomerService) AttachCard(customerID int, cardToken string) (*payment.SavedCard, error) {
+	return m.AttachCardFn(customerID, cardToken)
+}
+
+func (m *mockCustomerService) Cards(customerID int) ([]payment.SavedCard, error) {
+	return m.CardsFn(customerID)
+}
+
+func (m *mockCustomerService) DeleteCard(customerID int, cardID string) error {
+	return m.DeleteCardFn(customerID, cardID)
+}
+
+type mockSubscriptionService struct {
+	CreatePlanFn func(req *subscription.PlanRequest) (*subscription.Plan, error)
+	FindPlanFn   func(id int) (*subscription.Plan, error)
+	CreateFn     func(req *subscription.Request) (*subscription.Subscription, error)
+	FindFn       func(id int) (*subscription.Subscription, error)
+	PauseFn      func(id int) (*subscription.Subscription, error)
+	ResumeFn     func(id int) (*subscription.Subscription, error)
+	CancelFn     func(id int) (*subscription.Subscription, error)
+	ChargesFn    func(id int) ([]subscription.Charge, error)
+	ChargeDueFn  func(now time.Time) error
+}
+
+func (m *mockSubscriptionService) CreatePlan(req *subscription.PlanRequest) (*subscription.Plan, error) {
+	return m.CreatePlanFn(req)
+}
+
+func (m *mockSubscriptionService) FindPlan(id int) (*subscription.Plan, error) {
+	return m.FindPlanFn(id)
+}
+
+func (m *mockSubscriptionService) Create(req *subscription.Request) (*subscription.Subscription, error) {
+	return m.CreateFn(req)
+}
+
+func (m *mockSubscriptionService) Find(id int) (*subscription.Subscription, error) {
+	return m.FindFn(id)
+}
+
+func (m *mockSubscriptionService) Pause(id int) (*subscription.Subscription, error) {
+	return m.PauseFn(id)
+}
+
+func (m *mockSubscriptionService) Resume(id int) (*subscription.Subscription, error) {
+	return m.ResumeFn(id)
+}
+
+func (m *mockSubscriptionService) Cancel(id int) (*subscription.Subscription, error) {
+	return m.CancelFn(id)
+}
+
+func (m *mockSubscriptionService) Charges(id int) ([]subscription.Charge, error) {
+	return m.ChargesFn(id)
+}
+
+func (m *mockSubscriptionService) ChargeDue(now time.Time) error {
+	return m.ChargeDueFn(now)
+}
+
+type mockPaymentLinkService struct {
+	CreateFn     func(req *paymentlink.Request) (*paymentlink.Link, error)
+	FindFn       func(id int) (*paymentlink.Link, error)
+	FindBySlugFn func(slug string) (*paymentlink.Link, error)
+	PayFn        func(slug string, req *paymentlink.PayRequest) (*payment.Payment, error)
+	PaymentsFn   func(id int) ([]*payment.Payment, error)
+}
+
+func (m *mockPaymentLinkService) Create(req *paymentlink.Request) (*paymentlink.Link, error) {
+	return m.CreateFn(req)
+}
+
+func (m *mockPaymentLinkService) Find(id int) (*paymentlink.Link, error) {
+	return m.FindFn(id)
+}
+
+func (m *mockPaymentLinkService) FindBySlug(slug string) (*paymentlink.Link, error) {
+	return m.FindBySlugFn(slug)
+}
+
+func (m *mockPaymentLinkService) Pay(slug string, req *paymentlink.PayRequest) (*payment.Payment, error) {
+	return m.PayFn(slug, req)
+}
+
+func (m *mockPaymentLinkService) Payments(id int) ([]*payment.Payment, error) {
+	return m.PaymentsFn(id)
+}
+
+type mockWebhookService struct {
+	CreateEndpointFn func(req *webhook.EndpointRequest) (*webhook.Endpoint, error)
+	FindEndpointFn   func(id int) (*webhook.Endpoint, error)
+	EndpointsFn      func() ([]webhook.Endpoint, error)
+	DeleteEndpointFn func(id int) error
+	DeliveriesFn     func(endpointID int, status webhook.DeliveryStatus) ([]webhook.Delivery, error)
+	ReplayFn         func(eventID int) ([]webhook.Delivery, error)
+}
+
+func (m *mockWebhookService) CreateEndpoint(req *webhook.EndpointRequest) (*webhook.Endpoint, error) {
+	return m.CreateEndpointFn(req)
+}
+
+func (m *mockWebhookService) FindEndpoint(id int) (*webhook.Endpoint, error) {
+	return m.FindEndpointFn(id)
+}
+
+func (m *mockWebhookService) Endpoints() ([]webhook.Endpoint, error) {
+	return m.EndpointsFn()
+}
+
+func (m *mockWebhookService) DeleteEndpoint(id int) error {
+	return m.DeleteEndpointFn(id)
+}
+
+func (m *mockWebhookService) Deliveries(endpointID int, status webhook.DeliveryStatus) ([]webhook.Delivery, error) {
+	return m.DeliveriesFn(endpointID, status)
+}
+
+func (m *mockWebhookService) Replay(eventID int) ([]webhook.Delivery, error) {
+	return m.ReplayFn(eventID)
+}
+
+func (m *mockWebhookService) Publish(event *payment.Event) error {
+	panic("not implemented")
+}
+
+func (m *mockWebhookService) DeliverDue(now time.Time) error {
+	panic("not implemented")
+}
+
+type mockLedgerService struct {
+	EntriesFn  func(paymentID int) ([]ledger.Entry, error)
+	BalancesFn func() ([]ledger.Balance, error)
+	CheckFn    func() ([]payment.Money, error)
+}
+
+func (m *mockLedgerService) Publish(event *payment.Event) error {
+	panic("not implemented")
+}
+
+func (m *mockLedgerService) Entries(paymentID int) ([]ledger.Entry, error) {
+	return m.EntriesFn(paymentID)
+}
+
+func (m *mockLedgerService) Balances() ([]ledger.Balance, error) {
+	return m.BalancesFn()
+}
+
+func (m *mockLedgerService) Check() ([]payment.Money, error) {
+	return m.CheckFn()
+}
+
+type mockReconcileService struct {
+	ReconcileFn        func(records []reconcile.Record, from, to time.Time, operator string) (*reconcile.Report, error)
+	ReconcileGatewayFn func(from, to time.Time, operator string) (*reconcile.Report, error)
+}
+
+func (m *mockReconcileService) Reconcile(records []reconcile.Record, from, to time.Time, operator string) (*reconcile.Report, error) {
+	return m.ReconcileFn(records, from, to, operator)
+}
+
+func (m *mockReconcileService) ReconcileGateway(from, to time.Time, operator string) (*reconcile.Report, error) {
+	return m.ReconcileGatewayFn(from, to, operator)
+}
+
+type mockReportService struct {
+	SalesFn func(from, to time.Time, period report.Period, loc *time.Location) ([]report.Sales, error)
+}
+
+func (m *mockReportService) Sales(from, to time.Time, period report.Period, loc *time.Location) ([]report.Sales, error) {
+	return m.SalesFn(from, to, period, loc)
+}
+
+type mockAPIKeyService struct {
+	CreateFn       func(name string) (*apikey.Key, string, error)
+	ListFn         func() ([]*apikey.Key, error)
+	RotateFn       func(id int) (*apikey.Key, string, error)
+	AuthenticateFn func(secret string) (*apikey.Key, error)
+}
+
+func (m *mockAPIKeyService) Create(name string) (*apikey.Key, string, error) {
+	return m.CreateFn(name)
+}
+
+func (m *mockAPIKeyService) List() ([]*apikey.Key, error) {
+	return m.ListFn()
+}
+
+func (m *mockAPIKeyService) Rotate(id int) (*apikey.Key, string, error) {
+	return m.RotateFn(id)
+}
+
+func (m *mockAPIKeyService) Authenticate(secret string) (*apikey.Key, error) {
+	return m.AuthenticateFn(secret)
+}
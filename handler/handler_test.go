@@ -11,7 +11,6 @@ import (
 	"time"
 
 	"github.com/gorilla/mux"
-	"github.com/noppawitt/paymentsvc/inmem"
 	"github.com/noppawitt/paymentsvc/payment"
 )
 
@@ -30,22 +29,21 @@ func TestPayment_createPaymentRequest(t *testing.T) {
 		reqBody                    string
 		createPaymentRequestReturn *payment.Payment
 		createPaymentRequestErr    error
+		wantAuthorizeOnly          bool
 		want                       string
 		wantStatus                 int
 	}{
 		{
 			name:    "success",
-			reqBody: `{"amount":2000,"currency":"THB","return_uri":"http://localhost:8080","payment_type":"internet_banking_scb"}`,
+			reqBody: `{"amount":2000,"currency":"THB","return_uri":"http://localhost:8080","source_type":"internet_banking_scb"}`,
 			createPaymentRequestReturn: &payment.Payment{
-				ID:       1,
-				Status:   payment.StatusPending,
-				Amount:   2000,
-				Currency: "THB",
+				ID:     1,
+				Status: payment.StatusPending,
+				Amount: payment.NewMoney(2000, "THB"),
 				OmiseCharge: &payment.OmiseCharge{
 					ID:           "charge-1",
 					Status:       payment.StatusPending,
-					Amount:       2000,
-					Currency:     "THB",
+					Amount:       payment.NewMoney(2000, "THB"),
 					AuthorizeURI: "http://authuri.com",
 					SourceType:   "internet_banking_scb",
 					ReturnURI:    "http://returnuri.com",
@@ -54,23 +52,165 @@ func TestPayment_createPaymentRequest(t *testing.T) {
 				UpdatedAt: now,
 			},
 			createPaymentRequestErr: nil,
-			want:                    `{"id":1,"authorized_uri":"http://authuri.com"}`,
+			want:                    `{"id":1,"status":"pending","authorized_uri":"http://authuri.com"}`,
 			wantStatus:              http.StatusOK,
 		},
+		{
+			name:    "decimal amount",
+			reqBody: `{"amount":"20.00","currency":"thb","return_uri":"http://localhost:8080","source_type":"internet_banking_scb"}`,
+			createPaymentRequestReturn: &payment.Payment{
+				ID:     1,
+				Status: payment.StatusPending,
+				Amount: payment.NewMoney(2000, "THB"),
+				OmiseCharge: &payment.OmiseCharge{
+					ID:           "charge-1",
+					Status:       payment.StatusPending,
+					Amount:       payment.NewMoney(2000, "THB"),
+					AuthorizeURI: "http://authuri.com",
+					SourceType:   "internet_banking_scb",
+					ReturnURI:    "http://returnuri.com",
+				},
+				CreatedAt: now,
+				UpdatedAt: now,
+			},
+			createPaymentRequestErr: nil,
+			want:                    `{"id":1,"status":"pending","authorized_uri":"http://authuri.com"}`,
+			wantStatus:              http.StatusOK,
+		},
+		{
+			name:                       "invalid decimal amount",
+			reqBody:                    `{"amount":"20.001","currency":"THB","return_uri":"http://localhost:8080","source_type":"internet_banking_scb"}`,
+			createPaymentRequestReturn: nil,
+			createPaymentRequestErr:    nil,
+			want:                       `{"code":"invalid_request","message":"invalid request","errors":[{"field":"amount","code":"invalid","message":"amount must be an integer in the smallest currency unit or a decimal string"}]}`,
+			wantStatus:                 http.StatusUnprocessableEntity,
+		},
+		{
+			name:    "card without 3-D Secure",
+			reqBody: `{"amount":2000,"currency":"THB","return_uri":"http://localhost:8080","source_type":"card","card_token":"tokn_test_1"}`,
+			createPaymentRequestReturn: &payment.Payment{
+				ID:     1,
+				Status: payment.StatusSuccessful,
+				Amount: payment.NewMoney(2000, "THB"),
+				Card:   &payment.Card{Brand: "Visa", LastDigits: "4242", ExpirationMonth: 12, ExpirationYear: 2030},
+				OmiseCharge: &payment.OmiseCharge{
+					ID:         "charge-1",
+					Status:     payment.StatusSuccessful,
+					Amount:     payment.NewMoney(2000, "THB"),
+					SourceType: payment.SourceTypeCard,
+					Card:       &payment.Card{Brand: "Visa", LastDigits: "4242", ExpirationMonth: 12, ExpirationYear: 2030},
+				},
+				CreatedAt: now,
+				UpdatedAt: now,
+			},
+			createPaymentRequestErr: nil,
+			want:                    `{"id":1,"status":"successful"}`,
+			wantStatus:              http.StatusOK,
+		},
+		{
+			name:    "risk review",
+			reqBody: `{"amount":2000,"currency":"THB","return_uri":"http://localhost:8080","source_type":"card","card_token":"tokn_test_1","ip_address":"203.0.113.7"}`,
+			createPaymentRequestReturn: &payment.Payment{
+				ID:        1,
+				Status:    payment.StatusSuccessful,
+				Amount:    payment.NewMoney(2000, "THB"),
+				IPAddress: "203.0.113.7",
+				Risk:      &payment.Risk{Decision: payment.RiskReview, MatchedRules: []string{"velocity_ip"}},
+				OmiseCharge: &payment.OmiseCharge{
+					ID:         "charge-1",
+					Status:     payment.StatusSuccessful,
+					Amount:     payment.NewMoney(2000, "THB"),
+					SourceType: payment.SourceTypeCard,
+				},
+				CreatedAt: now,
+				UpdatedAt: now,
+			},
+			createPaymentRequestErr: nil,
+			want:                    `{"id":1,"status":"successful","risk":{"decision":"review","matched_rules":["velocity_ip"]}}`,
+			wantStatus:              http.StatusOK,
+		},
+		{
+			name:                       "risk blocked",
+			reqBody:                    `{"amount":2000,"currency":"THB","return_uri":"http://localhost:8080","source_type":"card","card_token":"tokn_test_1"}`,
+			createPaymentRequestReturn: nil,
+			createPaymentRequestErr:    &payment.Error{Code: payment.ErrorCodeRiskBlocked, Message: "payment request is blocked by risk rules: card_country"},
+			want:                       `{"code":"risk_blocked","message":"payment request is blocked by risk rules: card_country"}`,
+			wantStatus:                 http.StatusForbidden,
+		},
 		{
 			name:                       "invalid request body",
 			reqBody:                    `x`,
 			createPaymentRequestReturn: nil,
 			createPaymentRequestErr:    nil,
-			want:                       `{"message":"invalid request body"}`,
+			want:                       `{"code":"invalid_request","message":"invalid request body"}`,
 			wantStatus:                 http.StatusBadRequest,
 		},
 		{
-			name:                       "error",
+			name:                       "unknown field",
 			reqBody:                    `{"amount":2000,"currency":"THB","return_uri":"http://localhost:8080","payment_type":"internet_banking_scb"}`,
 			createPaymentRequestReturn: nil,
+			createPaymentRequestErr:    nil,
+			want:                       `{"code":"invalid_request","message":"invalid request","errors":[{"field":"payment_type","code":"unknown_field","message":"unknown field payment_type"}]}`,
+			wantStatus:                 http.StatusUnprocessableEntity,
+		},
+		{
+			name:                       "validation error",
+			reqBody:                    `{"amount":-1,"currency":"THB","return_uri":"http://localhost:8080","source_type":"internet_banking_scb"}`,
+			createPaymentRequestReturn: nil,
+			createPaymentRequestErr: &payment.ValidationError{Errors: []payment.FieldError{
+				{Field: "amount", Code: payment.CodeInvalid, Message: "amount must be positive"},
+			}},
+			want:       `{"code":"invalid_request","message":"invalid request","errors":[{"field":"amount","code":"invalid","message":"amount must be positive"}]}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:                       "duplicate reference",
+			reqBody:                    `{"amount":2000,"currency":"THB","return_uri":"http://localhost:8080","source_type":"internet_banking_scb","reference":"order-1"}`,
+			createPaymentRequestReturn: nil,
+			createPaymentRequestErr:    payment.ErrDuplicateReference,
+			want:                       `{"code":"conflict","message":"payment with the given reference already exists"}`,
+			wantStatus:                 http.StatusConflict,
+		},
+		{
+			name:                       "gateway declined",
+			reqBody:                    `{"amount":2000,"currency":"THB","return_uri":"http://localhost:8080","source_type":"internet_banking_scb"}`,
+			createPaymentRequestReturn: nil,
+			createPaymentRequestErr:    &payment.Error{Code: payment.ErrorCodeGatewayDeclined, Message: "insufficient funds"},
+			want:                       `{"code":"gateway_declined","message":"insufficient funds"}`,
+			wantStatus:                 http.StatusPaymentRequired,
+		},
+		{
+			name:    "card authorized only",
+			reqBody: `{"amount":2000,"currency":"THB","return_uri":"http://localhost:8080","source_type":"card","card_token":"tokn_test_1","capture":false}`,
+			createPaymentRequestReturn: &payment.Payment{
+				ID:     1,
+				Status: payment.StatusAuthorized,
+				Amount: payment.NewMoney(2000, "THB"),
+				OmiseCharge: &payment.OmiseCharge{
+					ID:         "charge-1",
+					Status:     payment.StatusAuthorized,
+					Amount:     payment.NewMoney(2000, "THB"),
+					SourceType: payment.SourceTypeCard,
+				},
+			},
+			wantAuthorizeOnly: true,
+			want:              `{"id":1,"status":"authorized"}`,
+			wantStatus:        http.StatusOK,
+		},
+		{
+			name:                       "gateway unavailable",
+			reqBody:                    `{"amount":2000,"currency":"THB","return_uri":"http://localhost:8080","source_type":"internet_banking_scb"}`,
+			createPaymentRequestReturn: nil,
+			createPaymentRequestErr:    &payment.Error{Code: payment.ErrorCodeGatewayUnavailable, Message: "payment gateway is unavailable", Err: errors.New("timeout")},
+			want:                       `{"code":"gateway_unavailable","message":"payment gateway is unavailable"}`,
+			wantStatus:                 http.StatusBadGateway,
+		},
+		{
+			name:                       "error",
+			reqBody:                    `{"amount":2000,"currency":"THB","return_uri":"http://localhost:8080","source_type":"internet_banking_scb"}`,
+			createPaymentRequestReturn: nil,
 			createPaymentRequestErr:    errors.New("some error"),
-			want:                       `{"message":"some error"}`,
+			want:                       `{"code":"internal_error","message":"internal server error"}`,
 			wantStatus:                 http.StatusInternalServerError,
 		},
 	}
@@ -78,6 +218,15 @@ func TestPayment_createPaymentRequest(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			s := &mockService{}
 			s.CreatePaymentRequestFn = func(req *payment.Request) (*payment.Payment, error) {
+				if tt.createPaymentRequestReturn != nil && req.Amount != tt.createPaymentRequestReturn.Amount {
+					t.Errorf("handler requested amount %v want %v", req.Amount, tt.createPaymentRequestReturn.Amount)
+				}
+				if req.Capture == tt.wantAuthorizeOnly {
+					t.Errorf("handler requested capture %v want %v", req.Capture, !tt.wantAuthorizeOnly)
+				}
+				if tt.createPaymentRequestReturn != nil && req.IPAddress != tt.createPaymentRequestReturn.IPAddress {
+					t.Errorf("handler requested ip address %v want %v", req.IPAddress, tt.createPaymentRequestReturn.IPAddress)
+				}
 				return tt.createPaymentRequestReturn, tt.createPaymentRequestErr
 			}
 
@@ -119,15 +268,13 @@ func TestPayment_getPayment(t *testing.T) {
 			name:      "success",
 			paymentID: "1",
 			FindReturn: &payment.Payment{
-				ID:       1,
-				Status:   payment.StatusSuccessful,
-				Amount:   20000,
-				Currency: "THB",
+				ID:     1,
+				Status: payment.StatusSuccessful,
+				Amount: payment.NewMoney(20000, "THB"),
 				OmiseCharge: &payment.OmiseCharge{
 					ID:           "charge-1",
 					Status:       payment.StatusSuccessful,
-					Amount:       20000,
-					Currency:     "THB",
+					Amount:       payment.NewMoney(20000, "THB"),
 					AuthorizeURI: "http://authuri.com",
 					SourceType:   "internet_banking_scb",
 					ReturnURI:    "http://returnuri.com",
@@ -136,31 +283,79 @@ func TestPayment_getPayment(t *testing.T) {
 				UpdatedAt: now,
 			},
 			FindErr:    nil,
-			want:       fmt.Sprintf(`{"id":1,"status":"successful","amount":20000,"currency":"THB","source_type":"internet_banking_scb","created_at":%s,"updated_at":%s}`, nowJSON, nowJSON),
+			want:       fmt.Sprintf(`{"id":1,"status":"successful","amount":20000,"amount_decimal":"200.00","currency":"THB","source_type":"internet_banking_scb","created_at":%s,"updated_at":%s}`, nowJSON, nowJSON),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:      "card",
+			paymentID: "1",
+			FindReturn: &payment.Payment{
+				ID:     1,
+				Status: payment.StatusFailed,
+				Amount: payment.NewMoney(20000, "THB"),
+				Card:   &payment.Card{Brand: "Visa", LastDigits: "4242", ExpirationMonth: 12, ExpirationYear: 2030, Fingerprint: "fp"},
+				OmiseCharge: &payment.OmiseCharge{
+					ID:             "charge-1",
+					Status:         payment.StatusFailed,
+					Amount:         payment.NewMoney(20000, "THB"),
+					SourceType:     payment.SourceTypeCard,
+					FailureCode:    "insufficient_fund",
+					FailureMessage: "insufficient funds in the account or the card has reached the credit limit",
+				},
+				CreatedAt: now,
+				UpdatedAt: now,
+			},
+			FindErr:    nil,
+			want:       fmt.Sprintf(`{"id":1,"status":"failed","amount":20000,"amount_decimal":"200.00","currency":"THB","source_type":"card","card":{"brand":"Visa","last_digits":"4242","expiration_month":12,"expiration_year":2030},"failure_code":"insufficient_fund","failure_message":"insufficient funds in the account or the card has reached the credit limit","created_at":%s,"updated_at":%s}`, nowJSON, nowJSON),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:      "paid",
+			paymentID: "1",
+			FindReturn: &payment.Payment{
+				ID:     1,
+				Status: payment.StatusSuccessful,
+				Amount: payment.NewMoney(20000, "THB"),
+				OmiseCharge: &payment.OmiseCharge{
+					ID:            "charge-1",
+					Status:        payment.StatusSuccessful,
+					Amount:        payment.NewMoney(20000, "THB"),
+					SourceType:    "promptpay",
+					Fee:           payment.NewMoney(330, "THB"),
+					FeeVAT:        payment.NewMoney(23, "THB"),
+					Net:           payment.NewMoney(19647, "THB"),
+					PaidAt:        now,
+					TransactionID: "trxn-1",
+				},
+				CreatedAt: now,
+				UpdatedAt: now,
+			},
+			FindErr:    nil,
+			want:       fmt.Sprintf(`{"id":1,"status":"successful","amount":20000,"amount_decimal":"200.00","currency":"THB","fee":330,"fee_vat":23,"net":19647,"paid_at":%s,"transaction_id":"trxn-1","source_type":"promptpay","created_at":%s,"updated_at":%s}`, nowJSON, nowJSON, nowJSON),
 			wantStatus: http.StatusOK,
 		},
 		{
 			name:       "invalid payment id",
 			paymentID:  "x",
 			FindReturn: nil,
-			FindErr:    inmem.ErrPaymentNotFound,
-			want:       `{"message":"payment id must be a number"}`,
+			FindErr:    payment.ErrPaymentNotFound,
+			want:       `{"code":"invalid_request","message":"payment id must be a number"}`,
 			wantStatus: http.StatusBadRequest,
 		},
 		{
 			name:       "not found",
 			paymentID:  "1",
 			FindReturn: nil,
-			FindErr:    inmem.ErrPaymentNotFound,
-			want:       `{"message":"payment not found"}`,
-			wantStatus: http.StatusBadRequest,
+			FindErr:    payment.ErrPaymentNotFound,
+			want:       `{"code":"not_found","message":"payment not found"}`,
+			wantStatus: http.StatusNotFound,
 		},
 		{
 			name:       "error",
 			paymentID:  "1",
 			FindReturn: nil,
 			FindErr:    errors.New("some error"),
-			want:       `{"message":"some error"}`,
+			want:       `{"code":"internal_error","message":"internal server error"}`,
 			wantStatus: http.StatusInternalServerError,
 		},
 	}
@@ -194,3 +389,316 @@ func TestPayment_getPayment(t *testing.T) {
 		})
 	}
 }
+
+func TestPayment_getPaymentByReference(t *testing.T) {
+	tests := []struct {
+		name                  string
+		reference             string
+		FindByReferenceReturn *payment.Payment
+		FindByReferenceErr    error
+		want                  string
+		wantStatus            int
+	}{
+		{
+			name:      "success",
+			reference: "order-1",
+			FindByReferenceReturn: &payment.Payment{
+				ID:          1,
+				Reference:   "order-1",
+				Description: "Order #1",
+				Metadata:    map[string]string{"customer": "c-1"},
+				Status:      payment.StatusSuccessful,
+				Amount:      payment.NewMoney(20000, "THB"),
+				OmiseCharge: &payment.OmiseCharge{
+					ID:           "charge-1",
+					Status:       payment.StatusSuccessful,
+					Amount:       payment.NewMoney(20000, "THB"),
+					AuthorizeURI: "http://authuri.com",
+					SourceType:   "internet_banking_scb",
+					ReturnURI:    "http://returnuri.com",
+				},
+				CreatedAt: now,
+				UpdatedAt: now,
+			},
+			FindByReferenceErr: nil,
+			want:               fmt.Sprintf(`{"id":1,"reference":"order-1","description":"Order #1","metadata":{"customer":"c-1"},"status":"successful","amount":20000,"amount_decimal":"200.00","currency":"THB","source_type":"internet_banking_scb","created_at":%s,"updated_at":%s}`, nowJSON, nowJSON),
+			wantStatus:         http.StatusOK,
+		},
+		{
+			name:                  "not found",
+			reference:             "order-1",
+			FindByReferenceReturn: nil,
+			FindByReferenceErr:    payment.ErrPaymentNotFound,
+			want:                  `{"code":"not_found","message":"payment not found"}`,
+			wantStatus:            http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &mockService{}
+			s.FindByReferenceFn = func(reference string) (*payment.Payment, error) {
+				return tt.FindByReferenceReturn, tt.FindByReferenceErr
+			}
+
+			r := paymentRouter()
+			h := NewPayment(s)
+			h.Append(r)
+
+			req, err := http.NewRequest(http.MethodGet, "/payments?reference="+tt.reference, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			if gotStatus := rr.Code; gotStatus != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", gotStatus, tt.wantStatus)
+			}
+
+			got := strings.TrimSpace(rr.Body.String())
+			if got != tt.want {
+				t.Errorf("handler returned unexpected body: got %v want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPayment_capturePayment(t *testing.T) {
+	captured := &payment.Payment{
+		ID:     1,
+		Status: payment.StatusCaptured,
+		Amount: payment.NewMoney(20000, "THB"),
+		OmiseCharge: &payment.OmiseCharge{
+			ID:             "charge-1",
+			Status:         payment.StatusCaptured,
+			Amount:         payment.NewMoney(20000, "THB"),
+			SourceType:     payment.SourceTypeCard,
+			CapturedAmount: payment.NewMoney(15000, "THB"),
+		},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	tests := []struct {
+		name       string
+		reqBody    string
+		wantAmount payment.Money
+		CaptureErr error
+		want       string
+		wantStatus int
+	}{
+		{
+			name:       "full capture",
+			reqBody:    ``,
+			wantAmount: payment.NewMoney(0, ""),
+			want:       fmt.Sprintf(`{"id":1,"status":"captured","amount":20000,"amount_decimal":"200.00","currency":"THB","captured_amount":15000,"source_type":"card","created_at":%s,"updated_at":%s}`, nowJSON, nowJSON),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "partial capture",
+			reqBody:    `{"amount":"150.00","currency":"THB"}`,
+			wantAmount: payment.NewMoney(15000, "THB"),
+			want:       fmt.Sprintf(`{"id":1,"status":"captured","amount":20000,"amount_decimal":"200.00","currency":"THB","captured_amount":15000,"source_type":"card","created_at":%s,"updated_at":%s}`, nowJSON, nowJSON),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "decimal amount without currency",
+			reqBody:    `{"amount":"150.00"}`,
+			want:       `{"code":"invalid_request","message":"invalid request","errors":[{"field":"currency","code":"required","message":"currency is required for a decimal amount"}]}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "not authorized",
+			reqBody:    `{"amount":15000}`,
+			wantAmount: payment.NewMoney(15000, ""),
+			CaptureErr: payment.ErrNotAuthorized,
+			want:       `{"code":"conflict","message":"payment is not authorized"}`,
+			wantStatus: http.StatusConflict,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &mockService{}
+			s.CaptureFn = func(id int, amount payment.Money) (*payment.Payment, error) {
+				if amount != tt.wantAmount {
+					t.Errorf("handler captured amount %v want %v", amount, tt.wantAmount)
+				}
+				if tt.CaptureErr != nil {
+					return nil, tt.CaptureErr
+				}
+				return captured, nil
+			}
+
+			r := paymentRouter()
+			h := NewPayment(s)
+			h.Append(r)
+
+			req, err := http.NewRequest(http.MethodPost, "/payments/1/capture", strings.NewReader(tt.reqBody))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			if gotStatus := rr.Code; gotStatus != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", gotStatus, tt.wantStatus)
+			}
+
+			got := strings.TrimSpace(rr.Body.String())
+			if got != tt.want {
+				t.Errorf("handler returned unexpected body: got %v want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPayment_refundPayment(t *testing.T) {
+	refunded := &payment.Payment{
+		ID:     1,
+		Status: payment.StatusSuccessful,
+		Amount: payment.NewMoney(20000, "THB"),
+		Refunds: []*payment.Refund{
+			{ID: "rfnd_1", Amount: payment.NewMoney(5000, "THB"), CreatedAt: now},
+			{ID: "rfnd_2", Amount: payment.NewMoney(15000, "THB"), CreatedAt: now},
+		},
+		OmiseCharge: &payment.OmiseCharge{
+			ID:         "charge-1",
+			Status:     payment.StatusSuccessful,
+			Amount:     payment.NewMoney(20000, "THB"),
+			SourceType: payment.SourceTypeCard,
+		},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	tests := []struct {
+		name       string
+		reqBody    string
+		wantAmount payment.Money
+		refundErr  error
+		want       string
+		wantStatus int
+	}{
+		{
+			name:       "rest of the amount",
+			reqBody:    ``,
+			wantAmount: payment.NewMoney(0, ""),
+			want:       fmt.Sprintf(`{"id":1,"status":"successful","amount":20000,"amount_decimal":"200.00","currency":"THB","source_type":"card","refunded_amount":20000,"refunds":[{"id":"rfnd_1","amount":5000,"created_at":%s},{"id":"rfnd_2","amount":15000,"created_at":%s}],"created_at":%s,"updated_at":%s}`, nowJSON, nowJSON, nowJSON, nowJSON),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "partial refund",
+			reqBody:    `{"amount":"150.00","currency":"THB"}`,
+			wantAmount: payment.NewMoney(15000, "THB"),
+			want:       fmt.Sprintf(`{"id":1,"status":"successful","amount":20000,"amount_decimal":"200.00","currency":"THB","source_type":"card","refunded_amount":20000,"refunds":[{"id":"rfnd_1","amount":5000,"created_at":%s},{"id":"rfnd_2","amount":15000,"created_at":%s}],"created_at":%s,"updated_at":%s}`, nowJSON, nowJSON, nowJSON, nowJSON),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "not paid",
+			reqBody:    `{"amount":15000}`,
+			wantAmount: payment.NewMoney(15000, ""),
+			refundErr:  payment.ErrNotPaid,
+			want:       `{"code":"conflict","message":"payment is not paid"}`,
+			wantStatus: http.StatusConflict,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &mockService{}
+			s.RefundFn = func(id int, amount payment.Money) (*payment.Payment, error) {
+				if amount != tt.wantAmount {
+					t.Errorf("handler refunded amount %v want %v", amount, tt.wantAmount)
+				}
+				if tt.refundErr != nil {
+					return nil, tt.refundErr
+				}
+				return refunded, nil
+			}
+
+			r := paymentRouter()
+			h := NewPayment(s)
+			h.Append(r)
+
+			req, err := http.NewRequest(http.MethodPost, "/payments/1/refunds", strings.NewReader(tt.reqBody))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			if gotStatus := rr.Code; gotStatus != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", gotStatus, tt.wantStatus)
+			}
+
+			got := strings.TrimSpace(rr.Body.String())
+			if got != tt.want {
+				t.Errorf("handler returned unexpected body: got %v want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPayment_voidPayment(t *testing.T) {
+	tests := []struct {
+		name       string
+		VoidReturn *payment.Payment
+		VoidErr    error
+		want       string
+		wantStatus int
+	}{
+		{
+			name: "success",
+			VoidReturn: &payment.Payment{
+				ID:     1,
+				Status: payment.StatusVoided,
+				Amount: payment.NewMoney(20000, "THB"),
+				OmiseCharge: &payment.OmiseCharge{
+					ID:         "charge-1",
+					Status:     payment.StatusVoided,
+					Amount:     payment.NewMoney(20000, "THB"),
+					SourceType: payment.SourceTypeCard,
+				},
+				CreatedAt: now,
+				UpdatedAt: now,
+			},
+			want:       fmt.Sprintf(`{"id":1,"status":"voided","amount":20000,"amount_decimal":"200.00","currency":"THB","source_type":"card","created_at":%s,"updated_at":%s}`, nowJSON, nowJSON),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "not found",
+			VoidErr:    payment.ErrPaymentNotFound,
+			want:       `{"code":"not_found","message":"payment not found"}`,
+			wantStatus: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &mockService{}
+			s.VoidFn = func(id int) (*payment.Payment, error) {
+				return tt.VoidReturn, tt.VoidErr
+			}
+
+			r := paymentRouter()
+			h := NewPayment(s)
+			h.Append(r)
+
+			req, err := http.NewRequest(http.MethodPost, "/payments/1/void", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			if gotStatus := rr.Code; gotStatus != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", gotStatus, tt.wantStatus)
+			}
+
+			got := strings.TrimSpace(rr.Body.String())
+			if got != tt.want {
+				t.Errorf("handler returned unexpected body: got %v want %v", got, tt.want)
+			}
+		})
+	}
+}
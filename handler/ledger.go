@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/noppawitt/paymentsvc/ledger"
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+// Ledger represents a ledger handler.
+type Ledger struct {
+	service ledger.Service
+}
+
+// NewLedger returns a new ledger handler.
+func NewLedger(service ledger.Service) *Ledger {
+	return &Ledger{
+		service: service,
+	}
+}
+
+// Append appends routes to the router.
+func (h *Ledger) Append(r *mux.Router) {
+	r.HandleFunc("/entries", h.listLedgerEntries).Methods(http.MethodGet)
+	r.HandleFunc("/balances", h.listLedgerBalances).Methods(http.MethodGet)
+	r.HandleFunc("/check", h.checkLedger).Methods(http.MethodGet)
+}
+
+type ledgerAmountResponse struct {
+	Amount        int64  `json:"amount"`
+	AmountDecimal string `json:"amount_decimal"`
+	Currency      string `json:"currency"`
+}
+
+func newLedgerAmountResponse(m payment.Money) ledgerAmountResponse {
+	return ledgerAmountResponse{
+		Amount:        m.Amount,
+		AmountDecimal: m.Format(),
+		Currency:      m.Currency,
+	}
+}
+
+type ledgerLineResponse struct {
+	Account ledger.Account `json:"account"`
+	ledgerAmountResponse
+}
+
+type ledgerEntryResponse struct {
+	ID        int                  `json:"id"`
+	Type      ledger.EntryType     `json:"type"`
+	PaymentID int                  `json:"payment_id"`
+	Lines     []ledgerLineResponse `json:"lines"`
+	CreatedAt time.Time            `json:"created_at"`
+}
+
+type listLedgerEntriesResponse struct {
+	Entries []*ledgerEntryResponse `json:"entries"`
+}
+
+type listLedgerBalancesResponse struct {
+	Balances []ledgerLineResponse `json:"balances"`
+}
+
+type checkLedgerResponse struct {
+	Balanced   bool                   `json:"balanced"`
+	Imbalances []ledgerAmountResponse `json:"imbalances,omitempty"`
+}
+
+// listLedgerEntries lists the journal entries, of a payment if the payment_id query parameter is given.
+func (h *Ledger) listLedgerEntries(w http.ResponseWriter, r *http.Request) {
+	var paymentID int
+	if s := r.URL.Query().Get("payment_id"); s != "" {
+		id, err := strconv.Atoi(s)
+		if err != nil {
+			respondError(w, payment.ErrorCodeInvalidRequest, "payment_id must be a number", http.StatusBadRequest)
+			return
+		}
+		paymentID = id
+	}
+
+	entries, err := h.service.Entries(paymentID)
+	if err != nil {
+		respondServiceError(w, err)
+		return
+	}
+
+	res := &listLedgerEntriesResponse{
+		Entries: make([]*ledgerEntryResponse, len(entries)),
+	}
+	for i, e := range entries {
+		entry := &ledgerEntryResponse{
+			ID:        e.ID,
+			Type:      e.Type,
+			PaymentID: e.PaymentID,
+			Lines:     make([]ledgerLineResponse, len(e.Lines)),
+			CreatedAt: e.CreatedAt,
+		}
+		for j, l := range e.Lines {
+			entry.Lines[j] = ledgerLineResponse{Account: l.Account, ledgerAmountResponse: newLedgerAmountResponse(l.Amount)}
+		}
+		res.Entries[i] = entry
+	}
+
+	respondJSON(w, res, http.StatusOK)
+}
+
+func (h *Ledger) listLedgerBalances(w http.ResponseWriter, r *http.Request) {
+	balances, err := h.service.Balances()
+	if err != nil {
+		respondServiceError(w, err)
+		return
+	}
+
+	res := &listLedgerBalancesResponse{
+		Balances: make([]ledgerLineResponse, len(balances)),
+	}
+	for i, b := range balances {
+		res.Balances[i] = ledgerLineResponse{Account: b.Account, ledgerAmountResponse: newLedgerAmountResponse(b.Amount)}
+	}
+
+	respondJSON(w, res, http.StatusOK)
+}
+
+// checkLedger checks that the entries sum to zero, it responds the sum of every currency which does not.
+func (h *Ledger) checkLedger(w http.ResponseWriter, r *http.Request) {
+	imbalances, err := h.service.Check()
+	if err != nil {
+		respondServiceError(w, err)
+		return
+	}
+
+	res := &checkLedgerResponse{
+		Balanced: len(imbalances) == 0,
+	}
+	for _, m := range imbalances {
+		res.Imbalances = append(res.Imbalances, newLedgerAmountResponse(m))
+	}
+
+	respondJSON(w, res, http.StatusOK)
+}
@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/noppawitt/paymentsvc/ledger"
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+func TestLedger(t *testing.T) {
+	entry := ledger.Entry{
+		ID:        1,
+		Type:      ledger.EntryPaymentRefunded,
+		PaymentID: 1,
+		Lines: []ledger.Line{
+			{Account: ledger.AccountRefunds, Amount: payment.NewMoney(500, "THB")},
+			{Account: ledger.AccountGatewayClearing, Amount: payment.NewMoney(-500, "THB")},
+		},
+		CreatedAt: now,
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		imbalances []payment.Money
+		want       string
+		wantStatus int
+	}{
+		{
+			name:       "list entries",
+			path:       "/ledger/entries",
+			want:       `{"entries":[{"id":1,"type":"payment_refunded","payment_id":1,"lines":[{"account":"refunds","amount":500,"amount_decimal":"5.00","currency":"THB"},{"account":"gateway_clearing","amount":-500,"amount_decimal":"-5.00","currency":"THB"}],"created_at":` + string(nowJSON) + `}]}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "list entries of a payment",
+			path:       "/ledger/entries?payment_id=2",
+			want:       `{"entries":[]}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "invalid payment id",
+			path:       "/ledger/entries?payment_id=abc",
+			want:       `{"code":"invalid_request","message":"payment_id must be a number"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "list balances",
+			path:       "/ledger/balances",
+			want:       `{"balances":[{"account":"gateway_clearing","amount":-500,"amount_decimal":"-5.00","currency":"THB"}]}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "balanced",
+			path:       "/ledger/check",
+			want:       `{"balanced":true}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "unbalanced",
+			path:       "/ledger/check",
+			imbalances: []payment.Money{payment.NewMoney(100, "USD")},
+			want:       `{"balanced":false,"imbalances":[{"amount":100,"amount_decimal":"1.00","currency":"USD"}]}`,
+			wantStatus: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &mockLedgerService{}
+			s.EntriesFn = func(paymentID int) ([]ledger.Entry, error) {
+				if paymentID != 0 && paymentID != entry.PaymentID {
+					return nil, nil
+				}
+				return []ledger.Entry{entry}, nil
+			}
+			s.BalancesFn = func() ([]ledger.Balance, error) {
+				return []ledger.Balance{{Account: ledger.AccountGatewayClearing, Amount: payment.NewMoney(-500, "THB")}}, nil
+			}
+			s.CheckFn = func() ([]payment.Money, error) {
+				return tt.imbalances, nil
+			}
+
+			r := mux.NewRouter().PathPrefix("/ledger").Subrouter()
+			h := NewLedger(s)
+			h.Append(r)
+
+			req, err := http.NewRequest(http.MethodGet, tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			if gotStatus := rr.Code; gotStatus != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", gotStatus, tt.wantStatus)
+			}
+
+			got := strings.TrimSpace(rr.Body.String())
+			if got != tt.want {
+				t.Errorf("handler returned unexpected body: got %v want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/noppawitt/paymentsvc/payment"
+	"github.com/noppawitt/paymentsvc/paymentlink"
+)
+
+// PaymentLink represents a payment link handler.
+// The URL of a link is its hosted page under baseURL.
+type PaymentLink struct {
+	service paymentlink.Service
+	baseURL string
+}
+
+// NewPaymentLink returns a new payment link handler.
+func NewPaymentLink(service paymentlink.Service, baseURL string) *PaymentLink {
+	return &PaymentLink{
+		service: service,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+// Append appends routes to the router.
+func (h *PaymentLink) Append(r *mux.Router) {
+	r.HandleFunc("", h.createPaymentLink).Methods(http.MethodPost)
+	r.HandleFunc("/{id}", h.getPaymentLink).Methods(http.MethodGet)
+	r.HandleFunc("/{id}/payments", h.listPaymentLinkPayments).Methods(http.MethodGet)
+}
+
+type createPaymentLinkRequest struct {
+	Amount      json.RawMessage `json:"amount"`
+	Currency    string          `json:"currency"`
+	Description string          `json:"description"`
+	SourceTypes []string        `json:"source_types"`
+	ReturnURI   string          `json:"return_uri"`
+	ExpiresAt   *time.Time      `json:"expires_at"`
+	MaxUses     int             `json:"max_uses"`
+}
+
+type paymentLinkResponse struct {
+	ID            int                `json:"id"`
+	URL           string             `json:"url"`
+	Status        paymentlink.Status `json:"status"`
+	Amount        int64              `json:"amount"`
+	AmountDecimal string             `json:"amount_decimal"`
+	Currency      string             `json:"currency"`
+	Description   string             `json:"description,omitempty"`
+	SourceTypes   []string           `json:"source_types"`
+	ReturnURI     string             `json:"return_uri"`
+	ExpiresAt     *time.Time         `json:"expires_at,omitempty"`
+	MaxUses       int                `json:"max_uses,omitempty"`
+	Uses          int                `json:"uses"`
+	CreatedAt     time.Time          `json:"created_at"`
+	UpdatedAt     time.Time          `json:"updated_at"`
+}
+
+func (h *PaymentLink) newPaymentLinkResponse(link *paymentlink.Link) *paymentLinkResponse {
+	res := &paymentLinkResponse{
+		ID:            link.ID,
+		URL:           h.baseURL + "/l/" + link.Slug,
+		Status:        link.Status(time.Now()),
+		Amount:        link.Amount.Amount,
+		AmountDecimal: link.Amount.Format(),
+		Currency:      link.Amount.Currency,
+		Description:   link.Description,
+		SourceTypes:   link.SourceTypes,
+		ReturnURI:     link.ReturnURI,
+		MaxUses:       link.MaxUses,
+		Uses:          link.Uses,
+		CreatedAt:     link.CreatedAt,
+		UpdatedAt:     link.UpdatedAt,
+	}
+	if !link.ExpiresAt.IsZero() {
+		res.ExpiresAt = &link.ExpiresAt
+	}
+	return res
+}
+
+type listPaymentLinkPaymentsResponse struct {
+	Payments []*getPaymentResponse `json:"payments"`
+}
+
+func (h *PaymentLink) createPaymentLink(w http.ResponseWriter, r *http.Request) {
+	req := &createPaymentLinkRequest{}
+	if err := decodeJSON(r, req); err != nil {
+		respondDecodeError(w, err)
+		return
+	}
+
+	amount, err := payment.ParseJSONAmount(req.Amount, strings.ToUpper(req.Currency))
+	if err != nil {
+		respondValidationError(w, []payment.FieldError{amountFieldError(err)})
+		return
+	}
+
+	linkReq := &paymentlink.Request{
+		Amount:      amount,
+		Description: req.Description,
+		SourceTypes: req.SourceTypes,
+		ReturnURI:   req.ReturnURI,
+		MaxUses:     req.MaxUses,
+	}
+	if req.ExpiresAt != nil {
+		linkReq.ExpiresAt = *req.ExpiresAt
+	}
+
+	link, err := h.service.Create(linkReq)
+	if err != nil {
+		respondServiceError(w, err)
+		return
+	}
+
+	respondJSON(w, h.newPaymentLinkResponse(link), http.StatusOK)
+}
+
+func (h *PaymentLink) getPaymentLink(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "payment link")
+	if !ok {
+		return
+	}
+
+	link, err := h.service.Find(id)
+	if err != nil {
+		respondServiceError(w, err)
+		return
+	}
+
+	respondJSON(w, h.newPaymentLinkResponse(link), http.StatusOK)
+}
+
+func (h *PaymentLink) listPaymentLinkPayments(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "payment link")
+	if !ok {
+		return
+	}
+
+	payments, err := h.service.Payments(id)
+	if err != nil {
+		respondServiceError(w, err)
+		return
+	}
+
+	res := &listPaymentLinkPaymentsResponse{
+		Payments: make([]*getPaymentResponse, len(payments)),
+	}
+	for i, p := range payments {
+		res.Payments[i] = newGetPaymentResponse(p)
+	}
+
+	respondJSON(w, res, http.StatusOK)
+}
@@ -0,0 +1,315 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/noppawitt/paymentsvc/payment"
+	"github.com/noppawitt/paymentsvc/paymentlink"
+)
+
+func TestPaymentLink(t *testing.T) {
+	link := &paymentlink.Link{
+		ID:          1,
+		Slug:        "abc",
+		Amount:      payment.NewMoney(150000, "THB"),
+		Description: "Invoice #1",
+		SourceTypes: []string{"card", "promptpay"},
+		ReturnURI:   "https://example.com/thanks",
+		MaxUses:     1,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	linkJSON := `{"id":1,"url":"https://pay.example.com/l/abc","status":"active","amount":150000,"amount_decimal":"1500.00","currency":"THB","description":"Invoice #1","source_types":["card","promptpay"],"return_uri":"https://example.com/thanks","max_uses":1,"uses":0,"created_at":` + string(nowJSON) + `,"updated_at":` + string(nowJSON) + `}`
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		want       string
+		wantStatus int
+	}{
+		{
+			name:       "create payment link",
+			method:     http.MethodPost,
+			path:       "/payment-links",
+			body:       `{"amount":"1500.00","currency":"THB","description":"Invoice #1","source_types":["card","promptpay"],"return_uri":"https://example.com/thanks","max_uses":1}`,
+			want:       linkJSON,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "create payment link with invalid source type",
+			method:     http.MethodPost,
+			path:       "/payment-links",
+			body:       `{"amount":"1500.00","currency":"THB","source_types":["unknown"],"return_uri":"https://example.com/thanks"}`,
+			want:       `{"code":"invalid_request","message":"invalid request","errors":[{"field":"source_types[0]","code":"unsupported","message":"source type unknown is not supported"}]}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "get payment link",
+			method:     http.MethodGet,
+			path:       "/payment-links/1",
+			want:       linkJSON,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "payment link not found",
+			method:     http.MethodGet,
+			path:       "/payment-links/2",
+			want:       `{"code":"not_found","message":"payment link not found"}`,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "list payments",
+			method:     http.MethodGet,
+			path:       "/payment-links/1/payments",
+			want:       `{"payments":[{"id":10,"description":"Invoice #1","status":"successful","amount":150000,"amount_decimal":"1500.00","currency":"THB","source_type":"promptpay","created_at":` + string(nowJSON) + `,"updated_at":` + string(nowJSON) + `}]}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "invalid payment link id",
+			method:     http.MethodGet,
+			path:       "/payment-links/abc/payments",
+			want:       `{"code":"invalid_request","message":"payment link id must be a number"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &mockPaymentLinkService{}
+			s.CreateFn = func(req *paymentlink.Request) (*paymentlink.Link, error) {
+				if req.SourceTypes[0] == "unknown" {
+					return nil, &payment.ValidationError{Errors: []payment.FieldError{
+						{Field: "source_types[0]", Code: payment.CodeUnsupported, Message: "source type unknown is not supported"},
+					}}
+				}
+				if req.Amount != link.Amount || req.MaxUses != link.MaxUses || !req.ExpiresAt.IsZero() {
+					t.Errorf("Create() called with %v", req)
+				}
+				return link, nil
+			}
+			s.FindFn = func(id int) (*paymentlink.Link, error) {
+				if id != link.ID {
+					return nil, paymentlink.ErrLinkNotFound
+				}
+				return link, nil
+			}
+			s.PaymentsFn = func(id int) ([]*payment.Payment, error) {
+				return []*payment.Payment{{
+					ID:          10,
+					Description: "Invoice #1",
+					Status:      payment.StatusSuccessful,
+					Amount:      link.Amount,
+					OmiseCharge: &payment.OmiseCharge{SourceType: "promptpay"},
+					CreatedAt:   now,
+					UpdatedAt:   now,
+				}}, nil
+			}
+
+			r := mux.NewRouter().PathPrefix("/payment-links").Subrouter()
+			h := NewPaymentLink(s, "https://pay.example.com/")
+			h.Append(r)
+
+			req, err := http.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			if gotStatus := rr.Code; gotStatus != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", gotStatus, tt.wantStatus)
+			}
+
+			got := strings.TrimSpace(rr.Body.String())
+			if got != tt.want {
+				t.Errorf("handler returned unexpected body: got %v want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckout(t *testing.T) {
+	links := map[string]*paymentlink.Link{
+		"abc": {
+			ID:          1,
+			Slug:        "abc",
+			Amount:      payment.NewMoney(150000, "THB"),
+			Description: "Invoice #1",
+			SourceTypes: []string{"card", "truemoney", "promptpay", "bill_payment_tesco_lotus"},
+			ReturnURI:   "https://example.com/thanks",
+		},
+		"expired": {
+			ID:          2,
+			Slug:        "expired",
+			Amount:      payment.NewMoney(150000, "THB"),
+			SourceTypes: []string{"promptpay"},
+			ExpiresAt:   time.Now().Add(-time.Hour),
+		},
+	}
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		form         url.Values
+		wantStatus   int
+		wantLocation string
+		wantBody     []string
+	}{
+		{
+			name:       "show payment methods",
+			method:     http.MethodGet,
+			path:       "/l/abc",
+			wantStatus: http.StatusOK,
+			wantBody: []string{
+				"1500.00 THB",
+				"Invoice #1",
+				`<form id="card-form" method="post" action="/l/abc">`,
+				`<input type="tel" name="phone_number" required>`,
+				`<input type="hidden" name="source_type" value="promptpay">`,
+				`Omise.setPublicKey("pkey_test_1")`,
+			},
+		},
+		{
+			name:       "expired link",
+			method:     http.MethodGet,
+			path:       "/l/expired",
+			wantStatus: http.StatusGone,
+			wantBody:   []string{"This payment link has expired."},
+		},
+		{
+			name:       "link not found",
+			method:     http.MethodGet,
+			path:       "/l/unknown",
+			wantStatus: http.StatusNotFound,
+			wantBody:   []string{"Payment link not found."},
+		},
+		{
+			name:         "pay by redirect",
+			method:       http.MethodPost,
+			path:         "/l/abc",
+			form:         url.Values{"source_type": {"truemoney"}, "phone_number": {"0812345678"}},
+			wantStatus:   http.StatusSeeOther,
+			wantLocation: "https://pay.omise.co/payments/1/authorize",
+		},
+		{
+			name:         "pay by QR code",
+			method:       http.MethodPost,
+			path:         "/l/abc",
+			form:         url.Values{"source_type": {"promptpay"}},
+			wantStatus:   http.StatusSeeOther,
+			wantLocation: "/payments/10/qr.svg",
+		},
+		{
+			name:         "pay by bill payment",
+			method:       http.MethodPost,
+			path:         "/l/abc",
+			form:         url.Values{"source_type": {"bill_payment_tesco_lotus"}},
+			wantStatus:   http.StatusSeeOther,
+			wantLocation: "/payments/10/slip",
+		},
+		{
+			name:         "pay by card without 3-D Secure",
+			method:       http.MethodPost,
+			path:         "/l/abc",
+			form:         url.Values{"source_type": {"card"}, "card_token": {"tokn_test_1"}},
+			wantStatus:   http.StatusSeeOther,
+			wantLocation: "/return/10",
+		},
+		{
+			name:       "declined card",
+			method:     http.MethodPost,
+			path:       "/l/abc",
+			form:       url.Values{"source_type": {"card"}, "card_token": {"tokn_test_declined"}},
+			wantStatus: http.StatusPaymentRequired,
+			wantBody:   []string{"The payment failed: insufficient funds"},
+		},
+		{
+			name:       "invalid field",
+			method:     http.MethodPost,
+			path:       "/l/abc",
+			form:       url.Values{"source_type": {"truemoney"}, "phone_number": {"abc"}},
+			wantStatus: http.StatusUnprocessableEntity,
+			wantBody:   []string{"<li>phone_number must be a phone number</li>"},
+		},
+		{
+			name:       "pay expired link",
+			method:     http.MethodPost,
+			path:       "/l/expired",
+			form:       url.Values{"source_type": {"promptpay"}},
+			wantStatus: http.StatusConflict,
+			wantBody:   []string{"<li>Payment link is expired.</li>"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &mockPaymentLinkService{}
+			s.FindBySlugFn = func(slug string) (*paymentlink.Link, error) {
+				link, ok := links[slug]
+				if !ok {
+					return nil, paymentlink.ErrLinkNotFound
+				}
+				return link, nil
+			}
+			s.PayFn = func(slug string, req *paymentlink.PayRequest) (*payment.Payment, error) {
+				if slug == "expired" {
+					return nil, paymentlink.ErrLinkExpired
+				}
+				p := &payment.Payment{ID: 10, Status: payment.StatusPending, OmiseCharge: &payment.OmiseCharge{}}
+				switch req.SourceType {
+				case "truemoney":
+					if req.PhoneNumber != "0812345678" {
+						return nil, &payment.ValidationError{Errors: []payment.FieldError{
+							{Field: "phone_number", Code: payment.CodeInvalid, Message: "phone_number must be a phone number"},
+						}}
+					}
+					p.OmiseCharge.AuthorizeURI = "https://pay.omise.co/payments/1/authorize"
+				case "promptpay":
+					p.QRCode = &payment.QRCode{Payload: "000201"}
+				case "bill_payment_tesco_lotus":
+					p.BillPayment = &payment.BillPayment{Reference1: "1"}
+				case "card":
+					p.Status = payment.StatusSuccessful
+					if req.CardToken == "tokn_test_declined" {
+						p.Status = payment.StatusFailed
+						p.OmiseCharge.FailureMessage = "insufficient funds"
+					}
+				}
+				return p, nil
+			}
+
+			r := mux.NewRouter().PathPrefix("/l").Subrouter()
+			h := NewCheckout(s, "pkey_test_1")
+			h.Append(r)
+
+			req, err := http.NewRequest(tt.method, tt.path, strings.NewReader(tt.form.Encode()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			if gotStatus := rr.Code; gotStatus != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", gotStatus, tt.wantStatus)
+			}
+			if got := rr.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("handler returned wrong location: got %v want %v", got, tt.wantLocation)
+			}
+			for _, want := range tt.wantBody {
+				if !strings.Contains(rr.Body.String(), want) {
+					t.Errorf("handler returned body without %v: got %v", want, rr.Body.String())
+				}
+			}
+		})
+	}
+}
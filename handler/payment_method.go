@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+// PaymentMethod represents a payment method handler.
+type PaymentMethod struct {
+	service payment.Service
+}
+
+// NewPaymentMethod returns a new payment method handler.
+func NewPaymentMethod(service payment.Service) *PaymentMethod {
+	return &PaymentMethod{
+		service: service,
+	}
+}
+
+// Append appends routes to the router.
+func (h *PaymentMethod) Append(r *mux.Router) {
+	r.HandleFunc("", h.listPaymentMethods).Methods(http.MethodGet)
+	r.HandleFunc("/installments", h.listInstallments).Methods(http.MethodGet)
+}
+
+type paymentMethodResponse struct {
+	SourceType       string   `json:"source_type"`
+	Flow             string   `json:"flow"`
+	Currencies       []string `json:"currencies"`
+	MinAmount        int64    `json:"min_amount,omitempty"`
+	MaxAmount        int64    `json:"max_amount,omitempty"`
+	RequiredFields   []string `json:"required_fields"`
+	OptionalFields   []string `json:"optional_fields"`
+	CardBrands       []string `json:"card_brands,omitempty"`
+	InstallmentTerms []int    `json:"installment_terms,omitempty"`
+}
+
+type listPaymentMethodsResponse struct {
+	PaymentMethods []*paymentMethodResponse `json:"payment_methods"`
+}
+
+func (h *PaymentMethod) listPaymentMethods(w http.ResponseWriter, r *http.Request) {
+	methods, err := h.service.PaymentMethods()
+	if err != nil {
+		respondServiceError(w, err)
+		return
+	}
+
+	res := &listPaymentMethodsResponse{
+		PaymentMethods: make([]*paymentMethodResponse, len(methods)),
+	}
+	for i, m := range methods {
+		res.PaymentMethods[i] = &paymentMethodResponse{
+			SourceType:       m.Name,
+			Flow:             m.Flow,
+			Currencies:       m.Currencies,
+			MinAmount:        m.MinAmount,
+			MaxAmount:        m.MaxAmount,
+			RequiredFields:   nonNil(m.RequiredFields),
+			OptionalFields:   nonNil(m.OptionalFields),
+			CardBrands:       m.CardBrands,
+			InstallmentTerms: m.InstallmentTerms,
+		}
+	}
+
+	respondJSON(w, res, http.StatusOK)
+}
+
+type installmentTermResponse struct {
+	Term          int           `json:"term"`
+	MonthlyAmount payment.Money `json:"monthly_amount"`
+	Interest      payment.Money `json:"interest"`
+	TotalAmount   payment.Money `json:"total_amount"`
+	Estimated     bool          `json:"estimated"`
+}
+
+type installmentResponse struct {
+	SourceType string                     `json:"source_type"`
+	Terms      []*installmentTermResponse `json:"terms"`
+}
+
+type listInstallmentsResponse struct {
+	Amount       payment.Money          `json:"amount"`
+	ZeroInterest bool                   `json:"zero_interest_installments"`
+	Installments []*installmentResponse `json:"installments"`
+}
+
+// listInstallments lists the installment terms available for the amount query parameter.
+// The amount is an integer in the smallest currency unit or a decimal, the currency defaults to THB.
+func (h *PaymentMethod) listInstallments(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	currency := strings.ToUpper(query.Get("currency"))
+	if currency == "" {
+		currency = "THB"
+	}
+
+	amount, err := parseQueryAmount(query.Get("amount"), currency)
+	if err != nil {
+		respondValidationError(w, []payment.FieldError{amountFieldError(err)})
+		return
+	}
+
+	zeroInterest := false
+	if s := query.Get("zero_interest_installments"); s != "" {
+		if zeroInterest, err = strconv.ParseBool(s); err != nil {
+			respondValidationError(w, []payment.FieldError{{
+				Field:   "zero_interest_installments",
+				Code:    payment.CodeInvalid,
+				Message: "zero_interest_installments must be a boolean",
+			}})
+			return
+		}
+	}
+
+	installments, err := h.service.Installments(amount, zeroInterest)
+	if err != nil {
+		respondServiceError(w, err)
+		return
+	}
+
+	res := &listInstallmentsResponse{
+		Amount:       amount,
+		ZeroInterest: zeroInterest,
+		Installments: make([]*installmentResponse, len(installments)),
+	}
+	for i, inst := range installments {
+		terms := make([]*installmentTermResponse, len(inst.Terms))
+		for j, t := range inst.Terms {
+			terms[j] = &installmentTermResponse{
+				Term:          t.Term,
+				MonthlyAmount: t.MonthlyAmount,
+				Interest:      t.Interest,
+				TotalAmount:   t.TotalAmount,
+				Estimated:     t.Estimated,
+			}
+		}
+		res.Installments[i] = &installmentResponse{
+			SourceType: inst.SourceType,
+			Terms:      terms,
+		}
+	}
+
+	respondJSON(w, res, http.StatusOK)
+}
+
+// parseQueryAmount parses an amount query parameter, a decimal is in the major currency unit.
+func parseQueryAmount(s, currency string) (payment.Money, error) {
+	if s == "" {
+		return payment.Money{}, payment.ErrInvalidAmount
+	}
+	if strings.Contains(s, ".") {
+		return payment.ParseMoney(s, currency)
+	}
+	return payment.ParseJSONAmount(json.RawMessage(s), currency)
+}
+
+// nonNil returns an empty slice instead of nil so it is encoded as an empty JSON array.
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
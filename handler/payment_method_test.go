@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+func paymentMethodRouter() *mux.Router {
+	return mux.NewRouter().PathPrefix("/payment-methods").Subrouter()
+}
+
+func TestPaymentMethod_listPaymentMethods(t *testing.T) {
+	tests := []struct {
+		name                 string
+		PaymentMethodsReturn []payment.PaymentMethod
+		PaymentMethodsErr    error
+		want                 string
+		wantStatus           int
+	}{
+		{
+			name: "success",
+			PaymentMethodsReturn: []payment.PaymentMethod{
+				{
+					SourceType: payment.SourceType{
+						Name:           "truemoney",
+						Flow:           payment.FlowRedirect,
+						Currencies:     []string{"THB"},
+						MinAmount:      2000,
+						MaxAmount:      10000000,
+						RequiredFields: []string{payment.FieldPhoneNumber},
+					},
+				},
+			},
+			want:       `{"payment_methods":[{"source_type":"truemoney","flow":"redirect","currencies":["THB"],"min_amount":2000,"max_amount":10000000,"required_fields":["phone_number"],"optional_fields":[]}]}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:              "gateway unavailable",
+			PaymentMethodsErr: &payment.Error{Code: payment.ErrorCodeGatewayUnavailable, Message: "payment gateway is unavailable"},
+			want:              `{"code":"gateway_unavailable","message":"payment gateway is unavailable"}`,
+			wantStatus:        http.StatusBadGateway,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &mockService{}
+			s.PaymentMethodsFn = func() ([]payment.PaymentMethod, error) {
+				return tt.PaymentMethodsReturn, tt.PaymentMethodsErr
+			}
+
+			r := paymentMethodRouter()
+			h := NewPaymentMethod(s)
+			h.Append(r)
+
+			req, err := http.NewRequest(http.MethodGet, "/payment-methods", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			if gotStatus := rr.Code; gotStatus != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", gotStatus, tt.wantStatus)
+			}
+
+			got := strings.TrimSpace(rr.Body.String())
+			if got != tt.want {
+				t.Errorf("handler returned unexpected body: got %v want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPaymentMethod_listInstallments(t *testing.T) {
+	thb := func(amount int64) payment.Money {
+		return payment.NewMoney(amount, "THB")
+	}
+	tests := []struct {
+		name               string
+		query              string
+		InstallmentsReturn []payment.Installment
+		InstallmentsErr    error
+		wantAmount         payment.Money
+		wantZeroInterest   bool
+		want               string
+		wantStatus         int
+	}{
+		{
+			name:  "success",
+			query: "?amount=3000.00&zero_interest_installments=true",
+			InstallmentsReturn: []payment.Installment{
+				{
+					SourceType: "installment_kbank",
+					Terms: []payment.InstallmentTerm{
+						{Term: 3, MonthlyAmount: thb(100000), Interest: thb(0), TotalAmount: thb(300000)},
+					},
+				},
+			},
+			wantAmount:       thb(300000),
+			wantZeroInterest: true,
+			want:             `{"amount":{"amount":300000,"currency":"THB"},"zero_interest_installments":true,"installments":[{"source_type":"installment_kbank","terms":[{"term":3,"monthly_amount":{"amount":100000,"currency":"THB"},"interest":{"amount":0,"currency":"THB"},"total_amount":{"amount":300000,"currency":"THB"},"estimated":false}]}]}`,
+			wantStatus:       http.StatusOK,
+		},
+		{
+			name:               "amount in the smallest currency unit",
+			query:              "?amount=300000",
+			InstallmentsReturn: []payment.Installment{},
+			wantAmount:         thb(300000),
+			want:               `{"amount":{"amount":300000,"currency":"THB"},"zero_interest_installments":false,"installments":[]}`,
+			wantStatus:         http.StatusOK,
+		},
+		{
+			name:       "missing amount",
+			query:      "",
+			want:       `{"code":"invalid_request","message":"invalid request","errors":[{"field":"amount","code":"invalid","message":"amount must be an integer in the smallest currency unit or a decimal string"}]}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "invalid zero interest installments",
+			query:      "?amount=300000&zero_interest_installments=maybe",
+			want:       `{"code":"invalid_request","message":"invalid request","errors":[{"field":"zero_interest_installments","code":"invalid","message":"zero_interest_installments must be a boolean"}]}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &mockService{}
+			s.InstallmentsFn = func(amount payment.Money, zeroInterest bool) ([]payment.Installment, error) {
+				if amount != tt.wantAmount || zeroInterest != tt.wantZeroInterest {
+					t.Errorf("Installments() called with %v, %v, want %v, %v", amount, zeroInterest, tt.wantAmount, tt.wantZeroInterest)
+				}
+				return tt.InstallmentsReturn, tt.InstallmentsErr
+			}
+
+			r := paymentMethodRouter()
+			h := NewPaymentMethod(s)
+			h.Append(r)
+
+			req, err := http.NewRequest(http.MethodGet, "/payment-methods/installments"+tt.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			if gotStatus := rr.Code; gotStatus != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", gotStatus, tt.wantStatus)
+			}
+
+			got := strings.TrimSpace(rr.Body.String())
+			if got != tt.want {
+				t.Errorf("handler returned unexpected body: got %v want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"image/png"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/qr"
+	"github.com/gorilla/mux"
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+const (
+	// qrCodePNGSize is the width and height of QR code PNG images in pixels.
+	qrCodePNGSize = 512
+	// qrCodeSVGModuleSize is the width and height of a QR code module in SVG images.
+	qrCodeSVGModuleSize = 8
+	// qrCodeQuietZone is the number of blank modules around a QR code.
+	qrCodeQuietZone = 4
+)
+
+func (h *Payment) getPaymentQRCode(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "payment")
+	if !ok {
+		return
+	}
+
+	p, err := h.service.Find(id)
+	if err != nil {
+		respondServiceError(w, err)
+		return
+	}
+
+	if p.QRCode == nil || p.QRCode.Payload == "" {
+		respondError(w, payment.ErrorCodeNotFound, "payment has no QR code", http.StatusNotFound)
+		return
+	}
+	if !p.Payable(time.Now()) {
+		respondError(w, payment.ErrorCodeConflict, "QR code is no longer payable", http.StatusConflict)
+		return
+	}
+
+	code, err := qr.Encode(p.QRCode.Payload, qr.M, qr.Auto)
+	if err != nil {
+		respondError(w, errorCodeInternal, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// the image is rendered before writing so that a rendering error is not sent as a partial image.
+	buf := &bytes.Buffer{}
+	var contentType string
+	switch mux.Vars(r)["format"] {
+	case "png":
+		contentType = "image/png"
+		err = renderQRCodePNG(buf, code)
+	case "svg":
+		contentType = "image/svg+xml"
+		err = renderQRCodeSVG(buf, code)
+	}
+	if err != nil {
+		respondError(w, errorCodeInternal, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "no-store")
+	buf.WriteTo(w)
+}
+
+func renderQRCodePNG(w io.Writer, code barcode.Barcode) error {
+	scaled, err := barcode.Scale(code, qrCodePNGSize, qrCodePNGSize)
+	if err != nil {
+		return err
+	}
+	return png.Encode(w, scaled)
+}
+
+// renderQRCodeSVG renders each dark module as a square, surrounded by the quiet zone.
+func renderQRCodeSVG(w io.Writer, code barcode.Barcode) error {
+	bounds := code.Bounds()
+	size := (bounds.Dx() + 2*qrCodeQuietZone) * qrCodeSVGModuleSize
+
+	if _, err := fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, size, size, size, size); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, size, size); err != nil {
+		return err
+	}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if r, _, _, _ := code.At(x, y).RGBA(); r != 0 {
+				continue
+			}
+			px := (x - bounds.Min.X + qrCodeQuietZone) * qrCodeSVGModuleSize
+			py := (y - bounds.Min.Y + qrCodeQuietZone) * qrCodeSVGModuleSize
+			if _, err := fmt.Fprintf(w, "M%d %dh%dv%dh-%dz", px, py, qrCodeSVGModuleSize, qrCodeSVGModuleSize, qrCodeSVGModuleSize); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := io.WriteString(w, `"/></svg>`)
+	return err
+}
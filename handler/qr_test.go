@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+func TestPayment_getPaymentQRCode(t *testing.T) {
+	promptPayPayment := func(status payment.Status, qrCode *payment.QRCode) *payment.Payment {
+		return &payment.Payment{
+			ID:     1,
+			Status: status,
+			Amount: payment.NewMoney(20000, "THB"),
+			QRCode: qrCode,
+			OmiseCharge: &payment.OmiseCharge{
+				ID:         "charge-1",
+				Status:     status,
+				Amount:     payment.NewMoney(20000, "THB"),
+				SourceType: "promptpay",
+				QRCode:     qrCode,
+			},
+		}
+	}
+	validQRCode := &payment.QRCode{Payload: "00020101021230", ExpiresAt: now.Add(time.Hour)}
+
+	tests := []struct {
+		name            string
+		path            string
+		FindReturn      *payment.Payment
+		wantStatus      int
+		wantContentType string
+	}{
+		{
+			name:            "png",
+			path:            "/payments/1/qr.png",
+			FindReturn:      promptPayPayment(payment.StatusPending, validQRCode),
+			wantStatus:      http.StatusOK,
+			wantContentType: "image/png",
+		},
+		{
+			name:            "svg",
+			path:            "/payments/1/qr.svg",
+			FindReturn:      promptPayPayment(payment.StatusPending, validQRCode),
+			wantStatus:      http.StatusOK,
+			wantContentType: "image/svg+xml",
+		},
+		{
+			name:            "no QR code",
+			path:            "/payments/1/qr.png",
+			FindReturn:      promptPayPayment(payment.StatusPending, nil),
+			wantStatus:      http.StatusNotFound,
+			wantContentType: "application/json",
+		},
+		{
+			name:            "paid",
+			path:            "/payments/1/qr.png",
+			FindReturn:      promptPayPayment(payment.StatusSuccessful, validQRCode),
+			wantStatus:      http.StatusConflict,
+			wantContentType: "application/json",
+		},
+		{
+			name:            "expired",
+			path:            "/payments/1/qr.png",
+			FindReturn:      promptPayPayment(payment.StatusPending, &payment.QRCode{Payload: "00020101021230", ExpiresAt: now.Add(-time.Hour)}),
+			wantStatus:      http.StatusConflict,
+			wantContentType: "application/json",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &mockService{}
+			s.FindFn = func(id int) (*payment.Payment, error) {
+				return tt.FindReturn, nil
+			}
+
+			r := paymentRouter()
+			h := NewPayment(s)
+			h.Append(r)
+
+			req, err := http.NewRequest(http.MethodGet, tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			if gotStatus := rr.Code; gotStatus != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", gotStatus, tt.wantStatus)
+			}
+			if got := rr.Header().Get("Content-Type"); got != tt.wantContentType {
+				t.Errorf("handler returned wrong content type: got %v want %v", got, tt.wantContentType)
+			}
+
+			switch tt.wantContentType {
+			case "image/png":
+				if _, err := png.Decode(rr.Body); err != nil {
+					t.Errorf("handler returned invalid png: %v", err)
+				}
+			case "image/svg+xml":
+				if !strings.HasPrefix(rr.Body.String(), "<svg") {
+					t.Errorf("handler returned invalid svg: %v", rr.Body.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/noppawitt/paymentsvc/payment"
+	"github.com/noppawitt/paymentsvc/reconcile"
+)
+
+// Reconciliation represents a reconciliation handler for operations staff, it is appended to a router which
+// authenticates the operators such as the admin router, since the mismatches are corrected on their behalf.
+type Reconciliation struct {
+	service reconcile.Service
+}
+
+// NewReconciliation returns a new reconciliation handler.
+func NewReconciliation(service reconcile.Service) *Reconciliation {
+	return &Reconciliation{
+		service: service,
+	}
+}
+
+// Append appends routes to the router.
+func (h *Reconciliation) Append(r *mux.Router) {
+	r.HandleFunc("", h.createReconciliation).Methods(http.MethodPost)
+}
+
+type mismatchResponse struct {
+	Type          reconcile.MismatchType `json:"type"`
+	ChargeID      string                 `json:"charge_id"`
+	PaymentID     int                    `json:"payment_id,omitempty"`
+	LocalStatus   payment.Status         `json:"local_status,omitempty"`
+	GatewayStatus payment.Status         `json:"gateway_status,omitempty"`
+	LocalAmount   int64                  `json:"local_amount,omitempty"`
+	GatewayAmount int64                  `json:"gateway_amount,omitempty"`
+	Currency      string                 `json:"currency"`
+	Corrected     bool                   `json:"corrected,omitempty"`
+	Error         string                 `json:"error,omitempty"`
+}
+
+type reconciliationResponse struct {
+	From       time.Time          `json:"from"`
+	To         time.Time          `json:"to"`
+	Records    int                `json:"records"`
+	Matched    int                `json:"matched"`
+	Mismatches []mismatchResponse `json:"mismatches"`
+}
+
+// createReconciliation reconciles the payments created from the from date to the to date inclusive with a charge
+// export in a text/csv body, or with the charges listed from the payment gateway if there is no export.
+// The payments with a status mismatch are corrected on behalf of the operator if the correct query parameter is true.
+func (h *Reconciliation) createReconciliation(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	from, to, _, errs := parseDateRange(query, time.UTC)
+	var correct bool
+	if s := query.Get("correct"); s != "" {
+		var err error
+		if correct, err = strconv.ParseBool(s); err != nil {
+			errs = append(errs, payment.FieldError{Field: "correct", Code: payment.CodeInvalid, Message: "correct must be true or false"})
+		}
+	}
+	if len(errs) > 0 {
+		respondValidationError(w, errs)
+		return
+	}
+	var operator string
+	if correct {
+		operator = operatorName(r)
+	}
+
+	var report *reconcile.Report
+	var err error
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "text/csv" {
+		var records []reconcile.Record
+		if records, err = reconcile.ReadCSV(r.Body); err == nil {
+			report, err = h.service.Reconcile(records, from, to, operator)
+		}
+	} else {
+		report, err = h.service.ReconcileGateway(from, to, operator)
+	}
+	if err != nil {
+		respondServiceError(w, err)
+		return
+	}
+
+	res := &reconciliationResponse{
+		From:       report.From,
+		To:         report.To,
+		Records:    report.Records,
+		Matched:    report.Matched,
+		Mismatches: make([]mismatchResponse, len(report.Mismatches)),
+	}
+	for i, m := range report.Mismatches {
+		currency := m.LocalAmount.Currency
+		if currency == "" {
+			currency = m.GatewayAmount.Currency
+		}
+		res.Mismatches[i] = mismatchResponse{
+			Type:          m.Type,
+			ChargeID:      m.ChargeID,
+			PaymentID:     m.PaymentID,
+			LocalStatus:   m.LocalStatus,
+			GatewayStatus: m.GatewayStatus,
+			LocalAmount:   m.LocalAmount.Amount,
+			GatewayAmount: m.GatewayAmount.Amount,
+			Currency:      currency,
+			Corrected:     m.Corrected,
+			Error:         m.Error,
+		}
+	}
+	respondJSON(w, res, http.StatusOK)
+}
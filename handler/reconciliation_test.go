@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/noppawitt/paymentsvc/payment"
+	"github.com/noppawitt/paymentsvc/reconcile"
+)
+
+func TestReconciliation_createReconciliation(t *testing.T) {
+	from := time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 1)
+	report := &reconcile.Report{From: from, To: to, Records: 2, Matched: 1, Mismatches: []reconcile.Mismatch{
+		{
+			Type:          reconcile.MismatchStatus,
+			ChargeID:      "chrg_test_2",
+			PaymentID:     2,
+			LocalStatus:   payment.StatusPending,
+			GatewayStatus: payment.StatusSuccessful,
+			LocalAmount:   payment.NewMoney(20000, "THB"),
+			GatewayAmount: payment.NewMoney(20000, "THB"),
+			Corrected:     true,
+		},
+		{
+			Type:          reconcile.MismatchMissingLocally,
+			ChargeID:      "chrg_test_3",
+			GatewayStatus: payment.StatusFailed,
+			GatewayAmount: payment.NewMoney(5000, "THB"),
+		},
+	}}
+	reportJSON := `{"from":"2021-02-01T00:00:00Z","to":"2021-02-02T00:00:00Z","records":2,"matched":1,"mismatches":[` +
+		`{"type":"status_mismatch","charge_id":"chrg_test_2","payment_id":2,"local_status":"pending","gateway_status":"successful","local_amount":20000,"gateway_amount":20000,"currency":"THB","corrected":true},` +
+		`{"type":"missing_locally","charge_id":"chrg_test_3","gateway_status":"failed","gateway_amount":5000,"currency":"THB"}]}`
+
+	tests := []struct {
+		name         string
+		query        string
+		withoutToken bool
+		contentType  string
+		body         string
+		wantRecords  []reconcile.Record
+		wantOperator string
+		err          error
+		want         string
+		wantStatus   int
+	}{
+		{
+			name:        "charge export",
+			query:       "from=2021-02-01&to=2021-02-01",
+			contentType: "text/csv; charset=utf-8",
+			body:        "id,status,amount,currency\nchrg_test_1,successful,200.00,THB\n",
+			wantRecords: []reconcile.Record{{ChargeID: "chrg_test_1", Status: payment.StatusSuccessful, Amount: payment.NewMoney(20000, "THB")}},
+			want:        reportJSON,
+			wantStatus:  http.StatusOK,
+		},
+		{
+			name:         "corrected by an operator",
+			query:        "from=2021-02-01&to=2021-02-01&correct=true",
+			want:         reportJSON,
+			wantOperator: "alice",
+			wantStatus:   http.StatusOK,
+		},
+		{
+			name:         "without a token",
+			query:        "from=2021-02-01&to=2021-02-01",
+			withoutToken: true,
+			want:         `{"code":"unauthorized","message":"a valid admin token is required"}`,
+			wantStatus:   http.StatusUnauthorized,
+		},
+		{
+			name:       "gateway",
+			query:      "from=2021-02-01&to=2021-02-01",
+			want:       reportJSON,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:        "invalid charge export",
+			query:       "from=2021-02-01&to=2021-02-01",
+			contentType: "text/csv",
+			body:        "id,amount\n",
+			want:        `{"code":"invalid_request","message":"invalid request","errors":[{"field":"header","code":"required","message":"column status is required"},{"field":"header","code":"required","message":"column currency is required"}]}`,
+			wantStatus:  http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "invalid query",
+			query:      "to=2021-02-01&correct=yes",
+			want:       `{"code":"invalid_request","message":"invalid request","errors":[{"field":"from","code":"required","message":"from is required"},{"field":"correct","code":"invalid","message":"correct must be true or false"}]}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "gateway unavailable",
+			query:      "from=2021-02-01&to=2021-02-01",
+			err:        &payment.Error{Code: payment.ErrorCodeGatewayUnavailable, Message: "payment gateway is unavailable", Err: errors.New("timeout")},
+			want:       `{"code":"gateway_unavailable","message":"payment gateway is unavailable"}`,
+			wantStatus: http.StatusBadGateway,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &mockReconcileService{}
+			check := func(gotFrom, gotTo time.Time, operator string) {
+				if !gotFrom.Equal(from) || !gotTo.Equal(to) {
+					t.Errorf("handler reconciled %v to %v want %v to %v", gotFrom, gotTo, from, to)
+				}
+				if operator != tt.wantOperator {
+					t.Errorf("handler reconciled with operator %q want %q", operator, tt.wantOperator)
+				}
+			}
+			s.ReconcileFn = func(records []reconcile.Record, from, to time.Time, operator string) (*reconcile.Report, error) {
+				check(from, to, operator)
+				if !reflect.DeepEqual(records, tt.wantRecords) {
+					t.Errorf("handler reconciled records %v want %v", records, tt.wantRecords)
+				}
+				return report, tt.err
+			}
+			s.ReconcileGatewayFn = func(from, to time.Time, operator string) (*reconcile.Report, error) {
+				check(from, to, operator)
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return report, nil
+			}
+
+			r := mux.NewRouter().PathPrefix("/admin").Subrouter()
+			r.Use(Authenticate([]Operator{{Name: "alice", Token: "token-a"}}))
+			NewReconciliation(s).Append(r.PathPrefix("/reconciliations").Subrouter())
+
+			req, err := http.NewRequest(http.MethodPost, "/admin/reconciliations?"+tt.query, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.withoutToken {
+				req.Header.Set("Authorization", "Bearer token-a")
+			}
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			if gotStatus := rr.Code; gotStatus != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", gotStatus, tt.wantStatus)
+			}
+
+			got := strings.TrimSpace(rr.Body.String())
+			if got != tt.want {
+				t.Errorf("handler returned unexpected body: got %v want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/noppawitt/paymentsvc/payment"
+	"github.com/noppawitt/paymentsvc/report"
+)
+
+// Report represents a reporting handler.
+// The buckets of the reports are in the location of the timezone query parameter, or in the default location.
+type Report struct {
+	service    report.Service
+	defaultLoc *time.Location
+}
+
+// NewReport returns a new reporting handler.
+func NewReport(service report.Service, defaultLoc *time.Location) *Report {
+	return &Report{
+		service:    service,
+		defaultLoc: defaultLoc,
+	}
+}
+
+// Append appends routes to the router.
+func (h *Report) Append(r *mux.Router) {
+	r.HandleFunc("/sales", h.getSalesReport).Methods(http.MethodGet)
+}
+
+type totalResponse struct {
+	Count         int    `json:"count"`
+	Amount        int64  `json:"amount"`
+	AmountDecimal string `json:"amount_decimal"`
+}
+
+func newTotalResponse(t report.Total) totalResponse {
+	return totalResponse{
+		Count:         t.Count,
+		Amount:        t.Amount.Amount,
+		AmountDecimal: t.Amount.Format(),
+	}
+}
+
+type salesResponse struct {
+	Date       string        `json:"date"`
+	Currency   string        `json:"currency"`
+	SourceType string        `json:"source_type"`
+	Successful totalResponse `json:"successful"`
+	Failed     totalResponse `json:"failed"`
+	Expired    totalResponse `json:"expired"`
+	Refunded   totalResponse `json:"refunded"`
+}
+
+type getSalesReportResponse struct {
+	Period   report.Period   `json:"period"`
+	Timezone string          `json:"timezone"`
+	Sales    []salesResponse `json:"sales"`
+}
+
+// getSalesReport reports the payments created from the from date to the to date inclusive by the day, week or month
+// of the period query parameter, a day by default, with the refunds made in the same buckets.
+// The date of a bucket is the day it starts.
+func (h *Report) getSalesReport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	from, to, loc, errs := parseDateRange(query, h.defaultLoc)
+	period := report.Period(query.Get("period"))
+	if period == "" {
+		period = report.PeriodDay
+	}
+	if period != report.PeriodDay && period != report.PeriodWeek && period != report.PeriodMonth {
+		errs = append(errs, payment.FieldError{Field: "period", Code: payment.CodeInvalid, Message: "period must be one of day, week, month"})
+	}
+	if len(errs) > 0 {
+		respondValidationError(w, errs)
+		return
+	}
+
+	sales, err := h.service.Sales(from, to, period, loc)
+	if err != nil {
+		respondServiceError(w, err)
+		return
+	}
+
+	res := &getSalesReportResponse{
+		Period:   period,
+		Timezone: loc.String(),
+		Sales:    make([]salesResponse, len(sales)),
+	}
+	for i, s := range sales {
+		res.Sales[i] = salesResponse{
+			Date:       s.Start.Format(dateLayout),
+			Currency:   s.Currency,
+			SourceType: s.SourceType,
+			Successful: newTotalResponse(s.Successful),
+			Failed:     newTotalResponse(s.Failed),
+			Expired:    newTotalResponse(s.Expired),
+			Refunded:   newTotalResponse(s.Refunded),
+		}
+	}
+	respondJSON(w, res, http.StatusOK)
+}
@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/noppawitt/paymentsvc/payment"
+	"github.com/noppawitt/paymentsvc/report"
+)
+
+func TestReport_getSalesReport(t *testing.T) {
+	bangkok, err := time.LoadLocation("Asia/Bangkok")
+	if err != nil {
+		t.Fatal(err)
+	}
+	thb := func(amount int64) payment.Money { return payment.NewMoney(amount, "THB") }
+	sales := []report.Sales{{
+		Start:      time.Date(2021, 2, 1, 0, 0, 0, 0, bangkok),
+		Currency:   "THB",
+		SourceType: "card",
+		Successful: report.Total{Count: 3, Amount: thb(350000)},
+		Failed:     report.Total{Count: 1, Amount: thb(70000)},
+		Expired:    report.Total{Amount: thb(0)},
+		Refunded:   report.Total{Count: 1, Amount: thb(50000)},
+	}}
+	salesJSON := `[{"date":"2021-02-01","currency":"THB","source_type":"card","successful":{"count":3,"amount":350000,"amount_decimal":"3500.00"},"failed":{"count":1,"amount":70000,"amount_decimal":"700.00"},"expired":{"count":0,"amount":0,"amount_decimal":"0.00"},"refunded":{"count":1,"amount":50000,"amount_decimal":"500.00"}}]`
+
+	tests := []struct {
+		name       string
+		query      string
+		wantPeriod report.Period
+		wantFrom   string
+		wantTo     string
+		want       string
+		wantStatus int
+	}{
+		{
+			name:       "daily in the default timezone",
+			query:      "from=2021-02-01&to=2021-02-07",
+			wantPeriod: report.PeriodDay,
+			wantFrom:   "2021-02-01T00:00:00+07:00",
+			wantTo:     "2021-02-08T00:00:00+07:00",
+			want:       `{"period":"day","timezone":"Asia/Bangkok","sales":` + salesJSON + `}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "monthly in UTC",
+			query:      "from=2021-01-01&to=2021-03-31&period=month&timezone=UTC",
+			wantPeriod: report.PeriodMonth,
+			wantFrom:   "2021-01-01T00:00:00Z",
+			wantTo:     "2021-04-01T00:00:00Z",
+			want:       `{"period":"month","timezone":"UTC","sales":` + salesJSON + `}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "invalid period",
+			query:      "from=2021-02-01&to=2021-02-07&period=year",
+			want:       `{"code":"invalid_request","message":"invalid request","errors":[{"field":"period","code":"invalid","message":"period must be one of day, week, month"}]}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &mockReportService{}
+			s.SalesFn = func(from, to time.Time, period report.Period, loc *time.Location) ([]report.Sales, error) {
+				if period != tt.wantPeriod {
+					t.Errorf("handler reported period %v want %v", period, tt.wantPeriod)
+				}
+				if got := from.Format(time.RFC3339); got != tt.wantFrom {
+					t.Errorf("handler reported from %v want %v", got, tt.wantFrom)
+				}
+				if got := to.Format(time.RFC3339); got != tt.wantTo {
+					t.Errorf("handler reported to %v want %v", got, tt.wantTo)
+				}
+				return sales, nil
+			}
+
+			r := mux.NewRouter().PathPrefix("/reports").Subrouter()
+			h := NewReport(s, bangkok)
+			h.Append(r)
+
+			req, err := http.NewRequest(http.MethodGet, "/reports/sales?"+tt.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			if gotStatus := rr.Code; gotStatus != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", gotStatus, tt.wantStatus)
+			}
+
+			got := strings.TrimSpace(rr.Body.String())
+			if got != tt.want {
+				t.Errorf("handler returned unexpected body: got %v want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+// Return represents the handler of the return page, where the payment gateway returns the payer to
+// after the payment is authorized.
+// The payer is redirected to the merchant's return URI with the payment result signed with secret,
+// so the merchant can trust the result without getting the payment. Without a secret the payer is redirected
+// to the return URI as it is, since a result which is not signed could be forged by the payer.
+type Return struct {
+	service payment.Service
+	secret  []byte
+}
+
+// NewReturn returns a new return handler.
+func NewReturn(service payment.Service, secret []byte) *Return {
+	return &Return{
+		service: service,
+		secret:  secret,
+	}
+}
+
+// Append appends routes to the router.
+func (h *Return) Append(r *mux.Router) {
+	r.HandleFunc("/{id}", h.returnPayment).Methods(http.MethodGet)
+}
+
+// returnPayment refreshes the payment, then redirects the payer to the merchant's return URI with
+// payment_id, status and signature query parameters.
+func (h *Return) returnPayment(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "payment")
+	if !ok {
+		return
+	}
+
+	p, err := h.service.Find(id)
+	if err != nil {
+		respondServiceError(w, err)
+		return
+	}
+
+	if p.ReturnURI == "" {
+		respondError(w, payment.ErrorCodeNotFound, "payment has no return URI", http.StatusNotFound)
+		return
+	}
+
+	// the return URI was validated when the payment was created.
+	u, err := url.Parse(p.ReturnURI)
+	if err != nil {
+		respondError(w, errorCodeInternal, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	if len(h.secret) > 0 {
+		q := u.Query()
+		q.Set("payment_id", strconv.Itoa(p.ID))
+		q.Set("status", string(p.Status))
+		q.Set("signature", payment.SignResult(h.secret, p.ID, p.Status))
+		u.RawQuery = q.Encode()
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, u.String(), http.StatusSeeOther)
+}
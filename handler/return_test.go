@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+func TestReturn(t *testing.T) {
+	secret := []byte("secret")
+	payments := map[int]*payment.Payment{
+		1: {ID: 1, Status: payment.StatusSuccessful, ReturnURI: "https://example.com/orders/1?lang=th"},
+		2: {ID: 2, Status: payment.StatusPending},
+	}
+
+	tests := []struct {
+		name         string
+		path         string
+		wantStatus   int
+		wantLocation string
+		wantBody     string
+	}{
+		{
+			name:         "redirect with signed result",
+			path:         "/return/1",
+			wantStatus:   http.StatusSeeOther,
+			wantLocation: "https://example.com/orders/1?lang=th&payment_id=1&signature=" + payment.SignResult(secret, 1, payment.StatusSuccessful) + "&status=successful",
+		},
+		{
+			name:       "no return URI",
+			path:       "/return/2",
+			wantStatus: http.StatusNotFound,
+			wantBody:   `{"code":"not_found","message":"payment has no return URI"}`,
+		},
+		{
+			name:       "payment not found",
+			path:       "/return/3",
+			wantStatus: http.StatusNotFound,
+			wantBody:   `{"code":"not_found","message":"payment not found"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &mockService{}
+			s.FindFn = func(id int) (*payment.Payment, error) {
+				p, ok := payments[id]
+				if !ok {
+					return nil, payment.ErrPaymentNotFound
+				}
+				return p, nil
+			}
+
+			r := mux.NewRouter().PathPrefix("/return").Subrouter()
+			h := NewReturn(s, secret)
+			h.Append(r)
+
+			req, err := http.NewRequest(http.MethodGet, tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			if gotStatus := rr.Code; gotStatus != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", gotStatus, tt.wantStatus)
+			}
+			if got := rr.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("handler returned wrong location: got %v want %v", got, tt.wantLocation)
+			}
+			if tt.wantBody != "" {
+				if got := strings.TrimSpace(rr.Body.String()); got != tt.wantBody {
+					t.Errorf("handler returned unexpected body: got %v want %v", got, tt.wantBody)
+				}
+			}
+
+			if location := rr.Header().Get("Location"); location != "" {
+				u, err := url.Parse(location)
+				if err != nil {
+					t.Fatal(err)
+				}
+				q := u.Query()
+				if !payment.VerifyResult(secret, 1, payment.Status(q.Get("status")), q.Get("signature")) {
+					t.Errorf("handler returned a signature which does not verify")
+				}
+			}
+		})
+	}
+}
+
+func TestReturn_withoutSecret(t *testing.T) {
+	s := &mockService{}
+	s.FindFn = func(id int) (*payment.Payment, error) {
+		return &payment.Payment{ID: 1, Status: payment.StatusSuccessful, ReturnURI: "https://example.com/orders/1?lang=th"}, nil
+	}
+
+	r := mux.NewRouter().PathPrefix("/return").Subrouter()
+	NewReturn(s, nil).Append(r)
+
+	req, err := http.NewRequest(http.MethodGet, "/return/1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	if gotStatus := rr.Code; gotStatus != http.StatusSeeOther {
+		t.Errorf("handler returned wrong status code: got %v want %v", gotStatus, http.StatusSeeOther)
+	}
+	if got, want := rr.Header().Get("Location"), "https://example.com/orders/1?lang=th"; got != want {
+		t.Errorf("handler returned wrong location: got %v want %v", got, want)
+	}
+}
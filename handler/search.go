@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// paymentStatuses are the statuses payments are searched by.
+var paymentStatuses = map[payment.Status]bool{
+	payment.StatusPending:    true,
+	payment.StatusAuthorized: true,
+	payment.StatusCaptured:   true,
+	payment.StatusVoided:     true,
+	payment.StatusSuccessful: true,
+	payment.StatusFailed:     true,
+	payment.StatusExpired:    true,
+	payment.StatusReversed:   true,
+	payment.StatusBlocked:    true,
+}
+
+type listPaymentsResponse struct {
+	Payments []*getPaymentResponse `json:"payments"`
+	// HasMore reports whether more payments match, they are listed after the id of the last payment.
+	HasMore bool `json:"has_more"`
+}
+
+// listPayments lists the payments matching the status, source_type, customer_id, risk_decision and the from and to dates
+// query parameters, sorted by id. A page starts after the after_id query parameter and has at most limit payments.
+func (h *Payment) listPayments(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var errs []payment.FieldError
+	q := &payment.Query{
+		Status:       payment.Status(query.Get("status")),
+		SourceType:   query.Get("source_type"),
+		RiskDecision: payment.RiskDecision(query.Get("risk_decision")),
+		Limit:        defaultSearchLimit,
+	}
+	if q.Status != "" && !paymentStatuses[q.Status] {
+		errs = append(errs, payment.FieldError{Field: "status", Code: payment.CodeInvalid, Message: "status must be a payment status"})
+	}
+	switch q.RiskDecision {
+	case "", payment.RiskAllow, payment.RiskReview, payment.RiskBlock:
+	default:
+		errs = append(errs, payment.FieldError{Field: "risk_decision", Code: payment.CodeInvalid, Message: "risk_decision must be allow, review or block"})
+	}
+	parseID := func(field string) int {
+		if query.Get(field) == "" {
+			return 0
+		}
+		n, err := strconv.Atoi(query.Get(field))
+		if err != nil || n < 0 {
+			errs = append(errs, payment.FieldError{Field: field, Code: payment.CodeInvalid, Message: field + " must be a number"})
+		}
+		return n
+	}
+	q.CustomerID = parseID("customer_id")
+	q.AfterID = parseID("after_id")
+	if s := query.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxSearchLimit {
+			errs = append(errs, payment.FieldError{Field: "limit", Code: payment.CodeOutOfRange, Message: "limit must be between 1 and " + strconv.Itoa(maxSearchLimit)})
+		}
+		q.Limit = n
+	}
+	if query.Get("from") != "" || query.Get("to") != "" {
+		var dateErrs []payment.FieldError
+		q.From, q.To, _, dateErrs = parseDateRange(query, time.UTC)
+		errs = append(errs, dateErrs...)
+	}
+	if len(errs) > 0 {
+		respondValidationError(w, errs)
+		return
+	}
+
+	// one more payment tells whether there are more.
+	limit := q.Limit
+	q.Limit++
+	payments, err := h.service.Search(q)
+	if err != nil {
+		respondServiceError(w, err)
+		return
+	}
+
+	res := &listPaymentsResponse{Payments: make([]*getPaymentResponse, 0, limit)}
+	for i, p := range payments {
+		if i == limit {
+			res.HasMore = true
+			break
+		}
+		res.Payments = append(res.Payments, newGetPaymentResponse(p))
+	}
+	respondJSON(w, res, http.StatusOK)
+}
+
+type paymentEventResponse struct {
+	ID             int                  `json:"id"`
+	Type           payment.EventType    `json:"type"`
+	PreviousStatus payment.Status       `json:"previous_status,omitempty"`
+	Status         payment.Status       `json:"status"`
+	CreatedAt      time.Time            `json:"created_at"`
+	Published      map[string]time.Time `json:"published,omitempty"`
+	Parked         map[string]time.Time `json:"parked,omitempty"`
+}
+
+type listPaymentEventsResponse struct {
+	Events []paymentEventResponse `json:"events"`
+}
+
+// listPaymentEvents lists the events of a payment, oldest first, with the status the payment changed to
+// and the time the event was published or parked by each relay.
+func (h *Payment) listPaymentEvents(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "payment")
+	if !ok {
+		return
+	}
+
+	events, err := h.service.Events(id)
+	if err != nil {
+		respondServiceError(w, err)
+		return
+	}
+
+	res := &listPaymentEventsResponse{Events: make([]paymentEventResponse, len(events))}
+	for i, e := range events {
+		res.Events[i] = paymentEventResponse{
+			ID:             e.ID,
+			Type:           e.Type,
+			PreviousStatus: e.PreviousStatus,
+			Status:         e.Payment.Status,
+			CreatedAt:      e.CreatedAt,
+			Published:      e.Published,
+			Parked:         e.Parked,
+		}
+	}
+	respondJSON(w, res, http.StatusOK)
+}
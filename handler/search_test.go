@@ -0,0 +1,232 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+func TestPayment_listPayments(t *testing.T) {
+	newPayment := func(id int) *payment.Payment {
+		return &payment.Payment{
+			ID:          id,
+			Status:      payment.StatusPending,
+			Amount:      payment.NewMoney(20000, "THB"),
+			OmiseCharge: &payment.OmiseCharge{SourceType: "promptpay"},
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		}
+	}
+	paymentJSON := func(id int) string {
+		return fmt.Sprintf(`{"id":%d,"status":"pending","amount":20000,"amount_decimal":"200.00","currency":"THB","source_type":"promptpay","created_at":%s,"updated_at":%s}`, id, nowJSON, nowJSON)
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		wantQuery  *payment.Query
+		found      []*payment.Payment
+		want       string
+		wantStatus int
+	}{
+		{
+			name:       "first page",
+			query:      "",
+			wantQuery:  &payment.Query{Limit: defaultSearchLimit + 1},
+			found:      []*payment.Payment{newPayment(1), newPayment(2)},
+			want:       `{"payments":[` + paymentJSON(1) + `,` + paymentJSON(2) + `],"has_more":false}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:  "filtered page with more",
+			query: "status=pending&source_type=promptpay&customer_id=7&risk_decision=review&from=2021-02-01&to=2021-02-01&after_id=1&limit=1",
+			wantQuery: &payment.Query{
+				Status:       payment.StatusPending,
+				SourceType:   "promptpay",
+				CustomerID:   7,
+				RiskDecision: payment.RiskReview,
+				From:         time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC),
+				To:           time.Date(2021, 2, 2, 0, 0, 0, 0, time.UTC),
+				AfterID:      1,
+				Limit:        2,
+			},
+			found:      []*payment.Payment{newPayment(2), newPayment(3)},
+			want:       `{"payments":[` + paymentJSON(2) + `],"has_more":true}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "no payments",
+			query:      "status=expired",
+			wantQuery:  &payment.Query{Status: payment.StatusExpired, Limit: defaultSearchLimit + 1},
+			want:       `{"payments":[],"has_more":false}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "invalid query",
+			query:      "status=paid&risk_decision=deny&customer_id=x&limit=1000&from=2021-02-01",
+			want:       `{"code":"invalid_request","message":"invalid request","errors":[{"field":"status","code":"invalid","message":"status must be a payment status"},{"field":"risk_decision","code":"invalid","message":"risk_decision must be allow, review or block"},{"field":"customer_id","code":"invalid","message":"customer_id must be a number"},{"field":"limit","code":"out_of_range","message":"limit must be between 1 and 100"},{"field":"to","code":"required","message":"to is required"}]}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &mockService{}
+			s.SearchFn = func(q *payment.Query) ([]*payment.Payment, error) {
+				if !reflect.DeepEqual(q, tt.wantQuery) {
+					t.Errorf("handler searched %+v want %+v", q, tt.wantQuery)
+				}
+				return tt.found, nil
+			}
+
+			r := paymentRouter()
+			h := NewPayment(s)
+			h.Append(r)
+
+			req, err := http.NewRequest(http.MethodGet, "/payments?"+tt.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			if gotStatus := rr.Code; gotStatus != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", gotStatus, tt.wantStatus)
+			}
+
+			got := strings.TrimSpace(rr.Body.String())
+			if got != tt.want {
+				t.Errorf("handler returned unexpected body: got %v want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPayment_listPaymentEvents(t *testing.T) {
+	createdAt := time.Date(2021, 2, 1, 10, 0, 0, 0, time.UTC)
+	events := []*payment.Event{
+		{ID: 1, Type: payment.EventCreated, PaymentID: 1, Payment: payment.Payment{Status: payment.StatusPending}, CreatedAt: createdAt, Published: map[string]time.Time{"ledger": createdAt.Add(time.Second)}},
+		{ID: 4, Type: payment.EventStatusChanged, PaymentID: 1, PreviousStatus: payment.StatusPending, Payment: payment.Payment{Status: payment.StatusSuccessful}, CreatedAt: createdAt.Add(time.Minute)},
+	}
+
+	tests := []struct {
+		name       string
+		paymentID  string
+		eventsErr  error
+		want       string
+		wantStatus int
+	}{
+		{
+			name:       "success",
+			paymentID:  "1",
+			want:       `{"events":[{"id":1,"type":"payment.created","status":"pending","created_at":"2021-02-01T10:00:00Z","published":{"ledger":"2021-02-01T10:00:01Z"}},{"id":4,"type":"payment.status_changed","previous_status":"pending","status":"successful","created_at":"2021-02-01T10:01:00Z"}]}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "not found",
+			paymentID:  "2",
+			eventsErr:  payment.ErrPaymentNotFound,
+			want:       `{"code":"not_found","message":"payment not found"}`,
+			wantStatus: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &mockService{}
+			s.EventsFn = func(id int) ([]*payment.Event, error) {
+				if tt.eventsErr != nil {
+					return nil, tt.eventsErr
+				}
+				return events, nil
+			}
+
+			r := paymentRouter()
+			h := NewPayment(s)
+			h.Append(r)
+
+			req, err := http.NewRequest(http.MethodGet, "/payments/"+tt.paymentID+"/events", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			if gotStatus := rr.Code; gotStatus != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", gotStatus, tt.wantStatus)
+			}
+
+			got := strings.TrimSpace(rr.Body.String())
+			if got != tt.want {
+				t.Errorf("handler returned unexpected body: got %v want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPayment_refreshPayment(t *testing.T) {
+	tests := []struct {
+		name       string
+		refreshErr error
+		want       string
+		wantStatus int
+	}{
+		{
+			name:       "success",
+			want:       fmt.Sprintf(`{"id":1,"status":"expired","amount":20000,"amount_decimal":"200.00","currency":"THB","source_type":"promptpay","created_at":%s,"updated_at":%s}`, nowJSON, nowJSON),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "gateway unavailable",
+			refreshErr: &payment.Error{Code: payment.ErrorCodeGatewayUnavailable, Message: "payment gateway is unavailable", Err: errors.New("timeout")},
+			want:       `{"code":"gateway_unavailable","message":"payment gateway is unavailable"}`,
+			wantStatus: http.StatusBadGateway,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &mockService{}
+			s.RefreshFn = func(id int) (*payment.Payment, error) {
+				if tt.refreshErr != nil {
+					return nil, tt.refreshErr
+				}
+				return &payment.Payment{
+					ID:          id,
+					Status:      payment.StatusExpired,
+					Amount:      payment.NewMoney(20000, "THB"),
+					OmiseCharge: &payment.OmiseCharge{SourceType: "promptpay"},
+					CreatedAt:   now,
+					UpdatedAt:   now,
+				}, nil
+			}
+
+			r := paymentRouter()
+			h := NewPayment(s)
+			h.Append(r)
+
+			req, err := http.NewRequest(http.MethodPost, "/payments/1/refresh", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			if gotStatus := rr.Code; gotStatus != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", gotStatus, tt.wantStatus)
+			}
+
+			got := strings.TrimSpace(rr.Body.String())
+			if got != tt.want {
+				t.Errorf("handler returned unexpected body: got %v want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/code128"
+	"github.com/gorilla/mux"
+	"github.com/jung-kurt/gofpdf"
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+const (
+	// barcodeSVGModuleWidth is the width of a barcode module in SVG images.
+	barcodeSVGModuleWidth = 2
+	// barcodeSVGHeight is the height of barcodes in SVG images.
+	barcodeSVGHeight = 80
+	// barcodePDFModuleWidth is the width of a barcode module in PDF slips in millimeters.
+	barcodePDFModuleWidth = 0.33
+	// barcodePDFHeight is the height of barcodes in PDF slips in millimeters.
+	barcodePDFHeight = 20
+	// barcodeQuietZone is the number of blank modules on each side of a barcode.
+	barcodeQuietZone = 10
+
+	slipTimeFormat = "2 Jan 2006 15:04 MST"
+)
+
+// slip contains the details printed on a bill payment slip.
+type slip struct {
+	PaymentID   int
+	Reference   string
+	Description string
+	Amount      string
+	TaxID       string
+	Reference1  string
+	Reference2  string
+	ExpiresAt   string
+	Barcode     string
+	BarcodeSVG  template.HTML
+}
+
+var slipTemplate = template.Must(template.New("slip").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Bill Payment #{{.PaymentID}}</title>
+<style>
+body { font-family: sans-serif; max-width: 640px; margin: 2em auto; }
+table { border-collapse: collapse; width: 100%; }
+th { text-align: left; padding-right: 1em; }
+.barcode { text-align: center; margin-top: 2em; }
+@media print { body { margin: 0; } }
+</style>
+</head>
+<body>
+<h1>Bill Payment</h1>
+<p>Pay this slip at the counter before it expires.</p>
+<table>
+<tr><th>Payment</th><td>#{{.PaymentID}}</td></tr>
+{{- if .Reference}}
+<tr><th>Reference</th><td>{{.Reference}}</td></tr>
+{{- end}}
+{{- if .Description}}
+<tr><th>Description</th><td>{{.Description}}</td></tr>
+{{- end}}
+<tr><th>Amount</th><td>{{.Amount}}</td></tr>
+<tr><th>Tax ID</th><td>{{.TaxID}}</td></tr>
+<tr><th>Reference 1</th><td>{{.Reference1}}</td></tr>
+<tr><th>Reference 2</th><td>{{.Reference2}}</td></tr>
+{{- if .ExpiresAt}}
+<tr><th>Expires at</th><td>{{.ExpiresAt}}</td></tr>
+{{- end}}
+</table>
+<div class="barcode">{{.BarcodeSVG}}</div>
+</body>
+</html>
+`))
+
+// getPaymentSlip renders the printable slip of a pending bill payment as HTML or PDF.
+// The format is given by the path extension, or by the Accept header if there is no extension.
+func (h *Payment) getPaymentSlip(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "payment")
+	if !ok {
+		return
+	}
+
+	p, err := h.service.Find(id)
+	if err != nil {
+		respondServiceError(w, err)
+		return
+	}
+
+	if p.BillPayment == nil {
+		respondError(w, payment.ErrorCodeNotFound, "payment has no bill payment slip", http.StatusNotFound)
+		return
+	}
+	if !p.Payable(time.Now()) {
+		respondError(w, payment.ErrorCodeConflict, "bill payment is no longer payable", http.StatusConflict)
+		return
+	}
+
+	s := newSlip(p)
+	code, err := code128.Encode(s.Barcode)
+	if err != nil {
+		respondError(w, errorCodeInternal, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	format := mux.Vars(r)["format"]
+	if format == "" && strings.Contains(r.Header.Get("Accept"), "application/pdf") {
+		format = "pdf"
+	}
+
+	// the slip is rendered before writing so that a rendering error is not sent as a partial slip.
+	buf := &bytes.Buffer{}
+	contentType := "text/html; charset=utf-8"
+	switch format {
+	case "pdf":
+		contentType = "application/pdf"
+		err = renderSlipPDF(buf, s, code)
+	default:
+		s.BarcodeSVG = renderBarcodeSVG(code)
+		err = slipTemplate.Execute(buf, s)
+	}
+	if err != nil {
+		respondError(w, errorCodeInternal, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	if format == "pdf" {
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="slip-%d.pdf"`, p.ID))
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	buf.WriteTo(w)
+}
+
+func newSlip(p *payment.Payment) *slip {
+	s := &slip{
+		PaymentID:   p.ID,
+		Reference:   p.Reference,
+		Description: p.Description,
+		Amount:      p.Amount.String(),
+		TaxID:       p.BillPayment.TaxID,
+		Reference1:  p.BillPayment.Reference1,
+		Reference2:  p.BillPayment.Reference2,
+		Barcode:     p.BillPayment.Barcode(p.Amount),
+	}
+	if !p.BillPayment.ExpiresAt.IsZero() {
+		s.ExpiresAt = p.BillPayment.ExpiresAt.Format(slipTimeFormat)
+	}
+	return s
+}
+
+// renderBarcodeSVG renders each bar as a rectangle, surrounded by the quiet zone.
+func renderBarcodeSVG(code barcode.Barcode) template.HTML {
+	bounds := code.Bounds()
+	width := (bounds.Dx() + 2*barcodeQuietZone) * barcodeSVGModuleWidth
+
+	b := &strings.Builder{}
+	fmt.Fprintf(b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, width, barcodeSVGHeight, width, barcodeSVGHeight)
+	fmt.Fprintf(b, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, width, barcodeSVGHeight)
+	for x := bounds.Min.X; x < bounds.Max.X; x++ {
+		if r, _, _, _ := code.At(x, bounds.Min.Y).RGBA(); r != 0 {
+			continue
+		}
+		px := (x - bounds.Min.X + barcodeQuietZone) * barcodeSVGModuleWidth
+		fmt.Fprintf(b, "M%d 0h%dv%dh-%dz", px, barcodeSVGModuleWidth, barcodeSVGHeight, barcodeSVGModuleWidth)
+	}
+	b.WriteString(`"/></svg>`)
+
+	return template.HTML(b.String())
+}
+
+// renderSlipPDF renders the slip on an A4 page with the barcode drawn bar by bar.
+func renderSlipPDF(w io.Writer, s *slip, code barcode.Barcode) error {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetTitle(fmt.Sprintf("Bill Payment #%d", s.PaymentID), true)
+	pdf.AddPage()
+
+	pdf.SetFont("Helvetica", "B", 18)
+	pdf.CellFormat(0, 12, "Bill Payment", "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 11)
+	pdf.CellFormat(0, 8, "Pay this slip at the counter before it expires.", "", 1, "L", false, 0, "")
+	pdf.Ln(4)
+
+	// the core fonts only support latin-1, other characters are replaced.
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	row := func(label, value string) {
+		if value == "" {
+			return
+		}
+		pdf.SetFont("Helvetica", "B", 11)
+		pdf.CellFormat(40, 8, label, "", 0, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 11)
+		pdf.CellFormat(0, 8, tr(value), "", 1, "L", false, 0, "")
+	}
+	row("Payment", fmt.Sprintf("#%d", s.PaymentID))
+	row("Reference", s.Reference)
+	row("Description", s.Description)
+	row("Amount", s.Amount)
+	row("Tax ID", s.TaxID)
+	row("Reference 1", s.Reference1)
+	row("Reference 2", s.Reference2)
+	row("Expires at", s.ExpiresAt)
+
+	bounds := code.Bounds()
+	pageWidth, _ := pdf.GetPageSize()
+	x0 := (pageWidth - float64(bounds.Dx())*barcodePDFModuleWidth) / 2
+	y0 := pdf.GetY() + 10
+	pdf.SetFillColor(0, 0, 0)
+	for x := bounds.Min.X; x < bounds.Max.X; x++ {
+		if r, _, _, _ := code.At(x, bounds.Min.Y).RGBA(); r != 0 {
+			continue
+		}
+		pdf.Rect(x0+float64(x-bounds.Min.X)*barcodePDFModuleWidth, y0, barcodePDFModuleWidth, barcodePDFHeight, "F")
+	}
+
+	return pdf.Output(w)
+}
@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+func TestPayment_getPaymentSlip(t *testing.T) {
+	billPaymentPayment := func(status payment.Status, billPayment *payment.BillPayment) *payment.Payment {
+		return &payment.Payment{
+			ID:          1,
+			Reference:   "order-1",
+			Status:      status,
+			Amount:      payment.NewMoney(150000, "THB"),
+			BillPayment: billPayment,
+			OmiseCharge: &payment.OmiseCharge{
+				ID:          "charge-1",
+				Status:      status,
+				Amount:      payment.NewMoney(150000, "THB"),
+				SourceType:  "bill_payment_tesco_lotus",
+				BillPayment: billPayment,
+			},
+		}
+	}
+	validBillPayment := &payment.BillPayment{
+		TaxID:      "010554013654301",
+		Reference1: "1234567890",
+		Reference2: "0001",
+		ExpiresAt:  now.Add(72 * time.Hour),
+	}
+
+	tests := []struct {
+		name            string
+		path            string
+		accept          string
+		FindReturn      *payment.Payment
+		wantStatus      int
+		wantContentType string
+	}{
+		{
+			name:            "html",
+			path:            "/payments/1/slip",
+			FindReturn:      billPaymentPayment(payment.StatusPending, validBillPayment),
+			wantStatus:      http.StatusOK,
+			wantContentType: "text/html; charset=utf-8",
+		},
+		{
+			name:            "pdf",
+			path:            "/payments/1/slip.pdf",
+			FindReturn:      billPaymentPayment(payment.StatusPending, validBillPayment),
+			wantStatus:      http.StatusOK,
+			wantContentType: "application/pdf",
+		},
+		{
+			name:            "pdf by accept header",
+			path:            "/payments/1/slip",
+			accept:          "application/pdf",
+			FindReturn:      billPaymentPayment(payment.StatusPending, validBillPayment),
+			wantStatus:      http.StatusOK,
+			wantContentType: "application/pdf",
+		},
+		{
+			name:            "no bill payment",
+			path:            "/payments/1/slip",
+			FindReturn:      billPaymentPayment(payment.StatusPending, nil),
+			wantStatus:      http.StatusNotFound,
+			wantContentType: "application/json",
+		},
+		{
+			name:            "paid",
+			path:            "/payments/1/slip",
+			FindReturn:      billPaymentPayment(payment.StatusSuccessful, validBillPayment),
+			wantStatus:      http.StatusConflict,
+			wantContentType: "application/json",
+		},
+		{
+			name: "expired",
+			path: "/payments/1/slip.pdf",
+			FindReturn: billPaymentPayment(payment.StatusPending, &payment.BillPayment{
+				TaxID:      "010554013654301",
+				Reference1: "1234567890",
+				Reference2: "0001",
+				ExpiresAt:  now.Add(-time.Hour),
+			}),
+			wantStatus:      http.StatusConflict,
+			wantContentType: "application/json",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &mockService{}
+			s.FindFn = func(id int) (*payment.Payment, error) {
+				return tt.FindReturn, nil
+			}
+
+			r := paymentRouter()
+			h := NewPayment(s)
+			h.Append(r)
+
+			req, err := http.NewRequest(http.MethodGet, tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			if gotStatus := rr.Code; gotStatus != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", gotStatus, tt.wantStatus)
+			}
+			if got := rr.Header().Get("Content-Type"); got != tt.wantContentType {
+				t.Errorf("handler returned wrong content type: got %v want %v", got, tt.wantContentType)
+			}
+
+			switch tt.wantContentType {
+			case "application/pdf":
+				if !strings.HasPrefix(rr.Body.String(), "%PDF-") {
+					t.Errorf("handler returned invalid pdf")
+				}
+			case "text/html; charset=utf-8":
+				body := rr.Body.String()
+				for _, want := range []string{"1500.00 THB", "1234567890", "order-1", "<svg"} {
+					if !strings.Contains(body, want) {
+						t.Errorf("handler returned slip without %q", want)
+					}
+				}
+			}
+		})
+	}
+}
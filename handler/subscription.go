@@ -0,0 +1,283 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/noppawitt/paymentsvc/payment"
+	"github.com/noppawitt/paymentsvc/subscription"
+)
+
+// Plan represents a subscription plan handler.
+type Plan struct {
+	service subscription.Service
+}
+
+// NewPlan returns a new subscription plan handler.
+func NewPlan(service subscription.Service) *Plan {
+	return &Plan{
+		service: service,
+	}
+}
+
+// Append appends routes to the router.
+func (h *Plan) Append(r *mux.Router) {
+	r.HandleFunc("", h.createPlan).Methods(http.MethodPost)
+	r.HandleFunc("/{id}", h.getPlan).Methods(http.MethodGet)
+}
+
+// Subscription represents a subscription handler.
+type Subscription struct {
+	service subscription.Service
+}
+
+// NewSubscription returns a new subscription handler.
+func NewSubscription(service subscription.Service) *Subscription {
+	return &Subscription{
+		service: service,
+	}
+}
+
+// Append appends routes to the router.
+func (h *Subscription) Append(r *mux.Router) {
+	r.HandleFunc("", h.createSubscription).Methods(http.MethodPost)
+	r.HandleFunc("/{id}", h.getSubscription).Methods(http.MethodGet)
+	r.HandleFunc("/{id}/pause", h.pauseSubscription).Methods(http.MethodPost)
+	r.HandleFunc("/{id}/resume", h.resumeSubscription).Methods(http.MethodPost)
+	r.HandleFunc("/{id}/cancel", h.cancelSubscription).Methods(http.MethodPost)
+	r.HandleFunc("/{id}/charges", h.listSubscriptionCharges).Methods(http.MethodGet)
+}
+
+type createPlanRequest struct {
+	Name          string          `json:"name"`
+	Amount        json.RawMessage `json:"amount"`
+	Currency      string          `json:"currency"`
+	Interval      string          `json:"interval"`
+	IntervalCount int             `json:"interval_count"`
+}
+
+type planResponse struct {
+	ID            int       `json:"id"`
+	Name          string    `json:"name,omitempty"`
+	Amount        int64     `json:"amount"`
+	AmountDecimal string    `json:"amount_decimal"`
+	Currency      string    `json:"currency"`
+	Interval      string    `json:"interval"`
+	IntervalCount int       `json:"interval_count"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+func newPlanResponse(plan *subscription.Plan) *planResponse {
+	return &planResponse{
+		ID:            plan.ID,
+		Name:          plan.Name,
+		Amount:        plan.Amount.Amount,
+		AmountDecimal: plan.Amount.Format(),
+		Currency:      plan.Amount.Currency,
+		Interval:      string(plan.Interval),
+		IntervalCount: plan.IntervalCount,
+		CreatedAt:     plan.CreatedAt,
+	}
+}
+
+func (h *Plan) createPlan(w http.ResponseWriter, r *http.Request) {
+	req := &createPlanRequest{}
+	if err := decodeJSON(r, req); err != nil {
+		respondDecodeError(w, err)
+		return
+	}
+
+	amount, err := payment.ParseJSONAmount(req.Amount, strings.ToUpper(req.Currency))
+	if err != nil {
+		respondValidationError(w, []payment.FieldError{amountFieldError(err)})
+		return
+	}
+
+	intervalCount := req.IntervalCount
+	if intervalCount == 0 {
+		intervalCount = 1
+	}
+
+	plan, err := h.service.CreatePlan(&subscription.PlanRequest{
+		Name:          req.Name,
+		Amount:        amount,
+		Interval:      subscription.Interval(req.Interval),
+		IntervalCount: intervalCount,
+	})
+	if err != nil {
+		respondServiceError(w, err)
+		return
+	}
+
+	respondJSON(w, newPlanResponse(plan), http.StatusOK)
+}
+
+func (h *Plan) getPlan(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "plan")
+	if !ok {
+		return
+	}
+
+	plan, err := h.service.FindPlan(id)
+	if err != nil {
+		respondServiceError(w, err)
+		return
+	}
+
+	respondJSON(w, newPlanResponse(plan), http.StatusOK)
+}
+
+type createSubscriptionRequest struct {
+	PlanID     int        `json:"plan_id"`
+	CustomerID int        `json:"customer_id"`
+	CardID     string     `json:"card_id"`
+	StartAt    *time.Time `json:"start_at"`
+}
+
+type subscriptionResponse struct {
+	ID               int                 `json:"id"`
+	PlanID           int                 `json:"plan_id"`
+	CustomerID       int                 `json:"customer_id"`
+	CardID           string              `json:"card_id"`
+	Status           subscription.Status `json:"status"`
+	StartAt          time.Time           `json:"start_at"`
+	NextChargeAt     *time.Time          `json:"next_charge_at,omitempty"`
+	FailedAttempts   int                 `json:"failed_attempts"`
+	PendingPaymentID int                 `json:"pending_payment_id,omitempty"`
+	CanceledAt       *time.Time          `json:"canceled_at,omitempty"`
+	CreatedAt        time.Time           `json:"created_at"`
+	UpdatedAt        time.Time           `json:"updated_at"`
+}
+
+func newSubscriptionResponse(sub *subscription.Subscription) *subscriptionResponse {
+	res := &subscriptionResponse{
+		ID:               sub.ID,
+		PlanID:           sub.PlanID,
+		CustomerID:       sub.CustomerID,
+		CardID:           sub.CardID,
+		Status:           sub.Status,
+		StartAt:          sub.StartAt,
+		FailedAttempts:   sub.FailedAttempts,
+		PendingPaymentID: sub.PendingPaymentID,
+		CreatedAt:        sub.CreatedAt,
+		UpdatedAt:        sub.UpdatedAt,
+	}
+	// only subscriptions which are charged have a next charge.
+	if sub.Status == subscription.StatusActive || sub.Status == subscription.StatusPastDue {
+		res.NextChargeAt = &sub.NextChargeAt
+	}
+	if !sub.CanceledAt.IsZero() {
+		res.CanceledAt = &sub.CanceledAt
+	}
+	return res
+}
+
+type subscriptionChargeResponse struct {
+	ID             int            `json:"id"`
+	PaymentID      int            `json:"payment_id,omitempty"`
+	Period         int            `json:"period"`
+	Attempt        int            `json:"attempt"`
+	Amount         int64          `json:"amount"`
+	Currency       string         `json:"currency"`
+	Status         payment.Status `json:"status"`
+	FailureMessage string         `json:"failure_message,omitempty"`
+	DueAt          time.Time      `json:"due_at"`
+	CreatedAt      time.Time      `json:"created_at"`
+}
+
+type listSubscriptionChargesResponse struct {
+	Charges []*subscriptionChargeResponse `json:"charges"`
+}
+
+func (h *Subscription) createSubscription(w http.ResponseWriter, r *http.Request) {
+	req := &createSubscriptionRequest{}
+	if err := decodeJSON(r, req); err != nil {
+		respondDecodeError(w, err)
+		return
+	}
+
+	subReq := &subscription.Request{
+		PlanID:     req.PlanID,
+		CustomerID: req.CustomerID,
+		CardID:     req.CardID,
+	}
+	if req.StartAt != nil {
+		subReq.StartAt = *req.StartAt
+	}
+
+	sub, err := h.service.Create(subReq)
+	if err != nil {
+		respondServiceError(w, err)
+		return
+	}
+
+	respondJSON(w, newSubscriptionResponse(sub), http.StatusOK)
+}
+
+func (h *Subscription) getSubscription(w http.ResponseWriter, r *http.Request) {
+	h.respondSubscription(w, r, h.service.Find)
+}
+
+func (h *Subscription) pauseSubscription(w http.ResponseWriter, r *http.Request) {
+	h.respondSubscription(w, r, h.service.Pause)
+}
+
+func (h *Subscription) resumeSubscription(w http.ResponseWriter, r *http.Request) {
+	h.respondSubscription(w, r, h.service.Resume)
+}
+
+func (h *Subscription) cancelSubscription(w http.ResponseWriter, r *http.Request) {
+	h.respondSubscription(w, r, h.service.Cancel)
+}
+
+// respondSubscription responds the subscription returned by the service method for the subscription id in the path.
+func (h *Subscription) respondSubscription(w http.ResponseWriter, r *http.Request, fn func(id int) (*subscription.Subscription, error)) {
+	id, ok := pathID(w, r, "subscription")
+	if !ok {
+		return
+	}
+
+	sub, err := fn(id)
+	if err != nil {
+		respondServiceError(w, err)
+		return
+	}
+
+	respondJSON(w, newSubscriptionResponse(sub), http.StatusOK)
+}
+
+func (h *Subscription) listSubscriptionCharges(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "subscription")
+	if !ok {
+		return
+	}
+
+	charges, err := h.service.Charges(id)
+	if err != nil {
+		respondServiceError(w, err)
+		return
+	}
+
+	res := &listSubscriptionChargesResponse{
+		Charges: make([]*subscriptionChargeResponse, len(charges)),
+	}
+	for i, c := range charges {
+		res.Charges[i] = &subscriptionChargeResponse{
+			ID:             c.ID,
+			PaymentID:      c.PaymentID,
+			Period:         c.Period,
+			Attempt:        c.Attempt,
+			Amount:         c.Amount.Amount,
+			Currency:       c.Amount.Currency,
+			Status:         c.Status,
+			FailureMessage: c.FailureMessage,
+			DueAt:          c.DueAt,
+			CreatedAt:      c.CreatedAt,
+		}
+	}
+
+	respondJSON(w, res, http.StatusOK)
+}
@@ -0,0 +1,267 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/noppawitt/paymentsvc/payment"
+	"github.com/noppawitt/paymentsvc/subscription"
+)
+
+func TestPlan(t *testing.T) {
+	plan := &subscription.Plan{
+		ID:            1,
+		Name:          "Gold",
+		Amount:        payment.NewMoney(50000, "THB"),
+		Interval:      subscription.IntervalMonth,
+		IntervalCount: 1,
+		CreatedAt:     now,
+	}
+	planJSON := `{"id":1,"name":"Gold","amount":50000,"amount_decimal":"500.00","currency":"THB","interval":"month","interval_count":1,"created_at":` + string(nowJSON) + `}`
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		want       string
+		wantStatus int
+	}{
+		{
+			name:       "create plan",
+			method:     http.MethodPost,
+			path:       "/plans",
+			body:       `{"name":"Gold","amount":"500.00","currency":"thb","interval":"month"}`,
+			want:       planJSON,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "create plan with invalid amount",
+			method:     http.MethodPost,
+			path:       "/plans",
+			body:       `{"name":"Gold","amount":"abc","currency":"THB","interval":"month"}`,
+			want:       `{"code":"invalid_request","message":"invalid request","errors":[{"field":"amount","code":"invalid","message":"amount must be an integer in the smallest currency unit or a decimal string"}]}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "get plan",
+			method:     http.MethodGet,
+			path:       "/plans/1",
+			want:       planJSON,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "plan not found",
+			method:     http.MethodGet,
+			path:       "/plans/2",
+			want:       `{"code":"not_found","message":"plan not found"}`,
+			wantStatus: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &mockSubscriptionService{}
+			s.CreatePlanFn = func(req *subscription.PlanRequest) (*subscription.Plan, error) {
+				if req.Amount != plan.Amount || req.Interval != plan.Interval || req.IntervalCount != plan.IntervalCount {
+					t.Errorf("CreatePlan() called with %v", req)
+				}
+				return plan, nil
+			}
+			s.FindPlanFn = func(id int) (*subscription.Plan, error) {
+				if id != plan.ID {
+					return nil, subscription.ErrPlanNotFound
+				}
+				return plan, nil
+			}
+
+			r := mux.NewRouter().PathPrefix("/plans").Subrouter()
+			h := NewPlan(s)
+			h.Append(r)
+
+			req, err := http.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			if gotStatus := rr.Code; gotStatus != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", gotStatus, tt.wantStatus)
+			}
+
+			got := strings.TrimSpace(rr.Body.String())
+			if got != tt.want {
+				t.Errorf("handler returned unexpected body: got %v want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubscription(t *testing.T) {
+	active := &subscription.Subscription{
+		ID:           1,
+		PlanID:       1,
+		CustomerID:   1,
+		CardID:       "card_test_1",
+		Status:       subscription.StatusActive,
+		StartAt:      now,
+		NextChargeAt: now,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	paused := *active
+	paused.Status = subscription.StatusPaused
+	canceled := *active
+	canceled.Status = subscription.StatusCanceled
+	canceled.CanceledAt = now
+
+	fields := `"plan_id":1,"customer_id":1,"card_id":"card_test_1",`
+	times := `"start_at":` + string(nowJSON)
+	attempts := `"failed_attempts":0,`
+	created := `"created_at":` + string(nowJSON) + `,"updated_at":` + string(nowJSON) + `}`
+	activeJSON := `{"id":1,` + fields + `"status":"active",` + times + `,"next_charge_at":` + string(nowJSON) + `,` + attempts + created
+	pausedJSON := `{"id":1,` + fields + `"status":"paused",` + times + `,` + attempts + created
+	canceledJSON := `{"id":1,` + fields + `"status":"canceled",` + times + `,` + attempts + `"canceled_at":` + string(nowJSON) + `,` + created
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		want       string
+		wantStatus int
+	}{
+		{
+			name:       "create subscription",
+			method:     http.MethodPost,
+			path:       "/subscriptions",
+			body:       `{"plan_id":1,"customer_id":1,"card_id":"card_test_1"}`,
+			want:       activeJSON,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "create subscription with unknown card",
+			method:     http.MethodPost,
+			path:       "/subscriptions",
+			body:       `{"plan_id":1,"customer_id":1,"card_id":"card_test_2"}`,
+			want:       `{"code":"not_found","message":"card not found"}`,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "get subscription",
+			method:     http.MethodGet,
+			path:       "/subscriptions/1",
+			want:       activeJSON,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "pause subscription",
+			method:     http.MethodPost,
+			path:       "/subscriptions/1/pause",
+			want:       pausedJSON,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "resume active subscription",
+			method:     http.MethodPost,
+			path:       "/subscriptions/1/resume",
+			want:       `{"code":"conflict","message":"active subscription cannot be active"}`,
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "cancel subscription",
+			method:     http.MethodPost,
+			path:       "/subscriptions/1/cancel",
+			want:       canceledJSON,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "list charges",
+			method:     http.MethodGet,
+			path:       "/subscriptions/1/charges",
+			want:       `{"charges":[{"id":1,"payment_id":10,"period":0,"attempt":1,"amount":50000,"currency":"THB","status":"successful","due_at":` + string(nowJSON) + `,"created_at":` + string(nowJSON) + `}]}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "subscription not found",
+			method:     http.MethodGet,
+			path:       "/subscriptions/2/charges",
+			want:       `{"code":"not_found","message":"subscription not found"}`,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "invalid subscription id",
+			method:     http.MethodPost,
+			path:       "/subscriptions/abc/pause",
+			want:       `{"code":"invalid_request","message":"subscription id must be a number"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &mockSubscriptionService{}
+			find := func(id int) (*subscription.Subscription, error) {
+				if id != active.ID {
+					return nil, subscription.ErrSubscriptionNotFound
+				}
+				return active, nil
+			}
+			s.CreateFn = func(req *subscription.Request) (*subscription.Subscription, error) {
+				if req.CardID != active.CardID {
+					return nil, subscription.ErrCardNotFound
+				}
+				return active, nil
+			}
+			s.FindFn = find
+			s.PauseFn = func(id int) (*subscription.Subscription, error) {
+				return &paused, nil
+			}
+			s.ResumeFn = func(id int) (*subscription.Subscription, error) {
+				return nil, &payment.Error{Code: payment.ErrorCodeConflict, Message: "active subscription cannot be active"}
+			}
+			s.CancelFn = func(id int) (*subscription.Subscription, error) {
+				return &canceled, nil
+			}
+			s.ChargesFn = func(id int) ([]subscription.Charge, error) {
+				if _, err := find(id); err != nil {
+					return nil, err
+				}
+				return []subscription.Charge{{
+					ID:             1,
+					SubscriptionID: 1,
+					PaymentID:      10,
+					Attempt:        1,
+					Amount:         payment.NewMoney(50000, "THB"),
+					Status:         payment.StatusSuccessful,
+					DueAt:          now,
+					CreatedAt:      now,
+				}}, nil
+			}
+
+			r := mux.NewRouter().PathPrefix("/subscriptions").Subrouter()
+			h := NewSubscription(s)
+			h.Append(r)
+
+			req, err := http.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			if gotStatus := rr.Code; gotStatus != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", gotStatus, tt.wantStatus)
+			}
+
+			got := strings.TrimSpace(rr.Body.String())
+			if got != tt.want {
+				t.Errorf("handler returned unexpected body: got %v want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/noppawitt/paymentsvc/payment"
+	"github.com/noppawitt/paymentsvc/webhook"
+)
+
+// WebhookEndpoint represents a webhook endpoint handler for operations staff, it is appended to a router which
+// authenticates the operators since endpoints receive the payments of every merchant.
+type WebhookEndpoint struct {
+	service webhook.Service
+}
+
+// NewWebhookEndpoint returns a new webhook endpoint handler.
+func NewWebhookEndpoint(service webhook.Service) *WebhookEndpoint {
+	return &WebhookEndpoint{
+		service: service,
+	}
+}
+
+// Append appends routes to the router.
+func (h *WebhookEndpoint) Append(r *mux.Router) {
+	r.HandleFunc("", h.createWebhookEndpoint).Methods(http.MethodPost)
+	r.HandleFunc("", h.listWebhookEndpoints).Methods(http.MethodGet)
+	r.HandleFunc("/{id}", h.getWebhookEndpoint).Methods(http.MethodGet)
+	r.HandleFunc("/{id}", h.deleteWebhookEndpoint).Methods(http.MethodDelete)
+	r.HandleFunc("/{id}/deliveries", h.listWebhookDeliveries).Methods(http.MethodGet)
+}
+
+// WebhookEvent represents a webhook event handler for operations staff, it is appended to a router which
+// authenticates the operators.
+type WebhookEvent struct {
+	service webhook.Service
+}
+
+// NewWebhookEvent returns a new webhook event handler.
+func NewWebhookEvent(service webhook.Service) *WebhookEvent {
+	return &WebhookEvent{
+		service: service,
+	}
+}
+
+// Append appends routes to the router.
+func (h *WebhookEvent) Append(r *mux.Router) {
+	r.HandleFunc("/{id}/replay", h.replayWebhookEvent).Methods(http.MethodPost)
+}
+
+type createWebhookEndpointRequest struct {
+	URL    string              `json:"url"`
+	Events []webhook.EventType `json:"events"`
+}
+
+type webhookEndpointResponse struct {
+	ID        int                 `json:"id"`
+	URL       string              `json:"url"`
+	Events    []webhook.EventType `json:"events"`
+	Secret    string              `json:"secret,omitempty"`
+	CreatedAt time.Time           `json:"created_at"`
+}
+
+// newWebhookEndpointResponse returns the response of an endpoint, the secret is only given when it is created.
+func newWebhookEndpointResponse(endpoint *webhook.Endpoint, withSecret bool) *webhookEndpointResponse {
+	res := &webhookEndpointResponse{
+		ID:        endpoint.ID,
+		URL:       endpoint.URL,
+		Events:    endpoint.Events,
+		CreatedAt: endpoint.CreatedAt,
+	}
+	if withSecret {
+		res.Secret = endpoint.Secret
+	}
+	return res
+}
+
+type listWebhookEndpointsResponse struct {
+	Endpoints []*webhookEndpointResponse `json:"endpoints"`
+}
+
+type webhookDeliveryResponse struct {
+	ID             int                    `json:"id"`
+	EventID        int                    `json:"event_id"`
+	EndpointID     int                    `json:"endpoint_id"`
+	Status         webhook.DeliveryStatus `json:"status"`
+	Attempts       int                    `json:"attempts"`
+	NextAttemptAt  *time.Time             `json:"next_attempt_at,omitempty"`
+	ResponseStatus int                    `json:"response_status,omitempty"`
+	LastError      string                 `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time             `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time              `json:"created_at"`
+	UpdatedAt      time.Time              `json:"updated_at"`
+}
+
+func newWebhookDeliveryResponse(d *webhook.Delivery) *webhookDeliveryResponse {
+	res := &webhookDeliveryResponse{
+		ID:             d.ID,
+		EventID:        d.EventID,
+		EndpointID:     d.EndpointID,
+		Status:         d.Status,
+		Attempts:       d.Attempts,
+		ResponseStatus: d.ResponseStatus,
+		LastError:      d.LastError,
+		CreatedAt:      d.CreatedAt,
+		UpdatedAt:      d.UpdatedAt,
+	}
+	// only pending deliveries are attempted again.
+	if d.Status == webhook.DeliveryPending {
+		res.NextAttemptAt = &d.NextAttemptAt
+	}
+	if !d.DeliveredAt.IsZero() {
+		res.DeliveredAt = &d.DeliveredAt
+	}
+	return res
+}
+
+type listWebhookDeliveriesResponse struct {
+	Deliveries []*webhookDeliveryResponse `json:"deliveries"`
+}
+
+func newListWebhookDeliveriesResponse(deliveries []webhook.Delivery) *listWebhookDeliveriesResponse {
+	res := &listWebhookDeliveriesResponse{
+		Deliveries: make([]*webhookDeliveryResponse, len(deliveries)),
+	}
+	for i := range deliveries {
+		res.Deliveries[i] = newWebhookDeliveryResponse(&deliveries[i])
+	}
+	return res
+}
+
+// createWebhookEndpoint creates an endpoint, its secret is in the response and cannot be shown again.
+func (h *WebhookEndpoint) createWebhookEndpoint(w http.ResponseWriter, r *http.Request) {
+	req := &createWebhookEndpointRequest{}
+	if err := decodeJSON(r, req); err != nil {
+		respondDecodeError(w, err)
+		return
+	}
+
+	endpoint, err := h.service.CreateEndpoint(&webhook.EndpointRequest{
+		URL:    req.URL,
+		Events: req.Events,
+	})
+	if err != nil {
+		respondServiceError(w, err)
+		return
+	}
+
+	respondJSON(w, newWebhookEndpointResponse(endpoint, true), http.StatusOK)
+}
+
+func (h *WebhookEndpoint) listWebhookEndpoints(w http.ResponseWriter, r *http.Request) {
+	endpoints, err := h.service.Endpoints()
+	if err != nil {
+		respondServiceError(w, err)
+		return
+	}
+
+	res := &listWebhookEndpointsResponse{
+		Endpoints: make([]*webhookEndpointResponse, len(endpoints)),
+	}
+	for i := range endpoints {
+		res.Endpoints[i] = newWebhookEndpointResponse(&endpoints[i], false)
+	}
+
+	respondJSON(w, res, http.StatusOK)
+}
+
+func (h *WebhookEndpoint) getWebhookEndpoint(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "webhook endpoint")
+	if !ok {
+		return
+	}
+
+	endpoint, err := h.service.FindEndpoint(id)
+	if err != nil {
+		respondServiceError(w, err)
+		return
+	}
+
+	respondJSON(w, newWebhookEndpointResponse(endpoint, false), http.StatusOK)
+}
+
+func (h *WebhookEndpoint) deleteWebhookEndpoint(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "webhook endpoint")
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteEndpoint(id); err != nil {
+		respondServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listWebhookDeliveries lists the deliveries to an endpoint, the latest first.
+// The status query parameter filters the deliveries, e.g. status=dead lists the events to replay.
+func (h *WebhookEndpoint) listWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "webhook endpoint")
+	if !ok {
+		return
+	}
+
+	status := webhook.DeliveryStatus(r.URL.Query().Get("status"))
+	switch status {
+	case "", webhook.DeliveryPending, webhook.DeliverySucceeded, webhook.DeliveryDead:
+	default:
+		respondValidationError(w, []payment.FieldError{{Field: "status", Code: payment.CodeInvalid, Message: "status must be one of pending, succeeded, dead"}})
+		return
+	}
+
+	deliveries, err := h.service.Deliveries(id, status)
+	if err != nil {
+		respondServiceError(w, err)
+		return
+	}
+
+	respondJSON(w, newListWebhookDeliveriesResponse(deliveries), http.StatusOK)
+}
+
+// replayWebhookEvent delivers an event again, it responds the new deliveries.
+func (h *WebhookEvent) replayWebhookEvent(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "webhook event")
+	if !ok {
+		return
+	}
+
+	deliveries, err := h.service.Replay(id)
+	if err != nil {
+		respondServiceError(w, err)
+		return
+	}
+
+	respondJSON(w, newListWebhookDeliveriesResponse(deliveries), http.StatusOK)
+}
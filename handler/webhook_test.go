@@ -0,0 +1,186 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/noppawitt/paymentsvc/payment"
+	"github.com/noppawitt/paymentsvc/webhook"
+)
+
+func TestWebhook(t *testing.T) {
+	endpoint := &webhook.Endpoint{
+		ID:        1,
+		URL:       "https://example.com/webhook",
+		Events:    []webhook.EventType{webhook.EventPaymentSucceeded},
+		Secret:    "whsec_abc",
+		CreatedAt: now,
+	}
+	endpointJSON := `{"id":1,"url":"https://example.com/webhook","events":["payment.succeeded"],"created_at":` + string(nowJSON) + `}`
+	createdEndpointJSON := `{"id":1,"url":"https://example.com/webhook","events":["payment.succeeded"],"secret":"whsec_abc","created_at":` + string(nowJSON) + `}`
+	deliveries := []webhook.Delivery{
+		{ID: 2, EventID: 2, EndpointID: 1, Status: webhook.DeliveryDead, Attempts: 8, NextAttemptAt: now, ResponseStatus: 500, LastError: "webhook endpoint responded 500", CreatedAt: now, UpdatedAt: now},
+		{ID: 1, EventID: 1, EndpointID: 1, Status: webhook.DeliverySucceeded, Attempts: 1, NextAttemptAt: now, ResponseStatus: 200, DeliveredAt: now, CreatedAt: now, UpdatedAt: now},
+	}
+	deadJSON := `{"id":2,"event_id":2,"endpoint_id":1,"status":"dead","attempts":8,"response_status":500,"last_error":"webhook endpoint responded 500","created_at":` + string(nowJSON) + `,"updated_at":` + string(nowJSON) + `}`
+	succeededJSON := `{"id":1,"event_id":1,"endpoint_id":1,"status":"succeeded","attempts":1,"response_status":200,"delivered_at":` + string(nowJSON) + `,"created_at":` + string(nowJSON) + `,"updated_at":` + string(nowJSON) + `}`
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		want       string
+		wantStatus int
+	}{
+		{
+			name:       "create endpoint",
+			method:     http.MethodPost,
+			path:       "/webhook-endpoints",
+			body:       `{"url":"https://example.com/webhook","events":["payment.succeeded"]}`,
+			want:       createdEndpointJSON,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "create endpoint with unsupported event",
+			method:     http.MethodPost,
+			path:       "/webhook-endpoints",
+			body:       `{"url":"https://example.com/webhook","events":["payment.created"]}`,
+			want:       `{"code":"invalid_request","message":"invalid request","errors":[{"field":"events[0]","code":"unsupported","message":"event type payment.created is not supported"}]}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "list endpoints",
+			method:     http.MethodGet,
+			path:       "/webhook-endpoints",
+			want:       `{"endpoints":[` + endpointJSON + `]}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "get endpoint",
+			method:     http.MethodGet,
+			path:       "/webhook-endpoints/1",
+			want:       endpointJSON,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "endpoint not found",
+			method:     http.MethodGet,
+			path:       "/webhook-endpoints/2",
+			want:       `{"code":"not_found","message":"webhook endpoint not found"}`,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "delete endpoint",
+			method:     http.MethodDelete,
+			path:       "/webhook-endpoints/1",
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "list deliveries",
+			method:     http.MethodGet,
+			path:       "/webhook-endpoints/1/deliveries",
+			want:       `{"deliveries":[` + deadJSON + `,` + succeededJSON + `]}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "list dead deliveries",
+			method:     http.MethodGet,
+			path:       "/webhook-endpoints/1/deliveries?status=dead",
+			want:       `{"deliveries":[` + deadJSON + `]}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "list deliveries with invalid status",
+			method:     http.MethodGet,
+			path:       "/webhook-endpoints/1/deliveries?status=unknown",
+			want:       `{"code":"invalid_request","message":"invalid request","errors":[{"field":"status","code":"invalid","message":"status must be one of pending, succeeded, dead"}]}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "invalid endpoint id",
+			method:     http.MethodGet,
+			path:       "/webhook-endpoints/abc",
+			want:       `{"code":"invalid_request","message":"webhook endpoint id must be a number"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "replay event",
+			method:     http.MethodPost,
+			path:       "/webhook-events/2/replay",
+			want:       `{"deliveries":[{"id":3,"event_id":2,"endpoint_id":1,"status":"pending","attempts":0,"next_attempt_at":` + string(nowJSON) + `,"created_at":` + string(nowJSON) + `,"updated_at":` + string(nowJSON) + `}]}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "replay event not found",
+			method:     http.MethodPost,
+			path:       "/webhook-events/3/replay",
+			want:       `{"code":"not_found","message":"webhook event not found"}`,
+			wantStatus: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &mockWebhookService{}
+			s.CreateEndpointFn = func(req *webhook.EndpointRequest) (*webhook.Endpoint, error) {
+				if req.Events[0] == "payment.created" {
+					return nil, &payment.ValidationError{Errors: []payment.FieldError{
+						{Field: "events[0]", Code: payment.CodeUnsupported, Message: "event type payment.created is not supported"},
+					}}
+				}
+				if req.URL != endpoint.URL {
+					t.Errorf("CreateEndpoint() called with %v", req)
+				}
+				return endpoint, nil
+			}
+			s.EndpointsFn = func() ([]webhook.Endpoint, error) {
+				return []webhook.Endpoint{*endpoint}, nil
+			}
+			s.FindEndpointFn = func(id int) (*webhook.Endpoint, error) {
+				if id != endpoint.ID {
+					return nil, webhook.ErrEndpointNotFound
+				}
+				return endpoint, nil
+			}
+			s.DeleteEndpointFn = func(id int) error {
+				return nil
+			}
+			s.DeliveriesFn = func(endpointID int, status webhook.DeliveryStatus) ([]webhook.Delivery, error) {
+				if status == webhook.DeliveryDead {
+					return deliveries[:1], nil
+				}
+				return deliveries, nil
+			}
+			s.ReplayFn = func(eventID int) ([]webhook.Delivery, error) {
+				if eventID != 2 {
+					return nil, webhook.ErrEventNotFound
+				}
+				return []webhook.Delivery{{ID: 3, EventID: 2, EndpointID: 1, Status: webhook.DeliveryPending, NextAttemptAt: now, CreatedAt: now, UpdatedAt: now}}, nil
+			}
+
+			r := mux.NewRouter()
+			NewWebhookEndpoint(s).Append(r.PathPrefix("/webhook-endpoints").Subrouter())
+			NewWebhookEvent(s).Append(r.PathPrefix("/webhook-events").Subrouter())
+
+			req, err := http.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			if gotStatus := rr.Code; gotStatus != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", gotStatus, tt.wantStatus)
+			}
+
+			got := strings.TrimSpace(rr.Body.String())
+			if got != tt.want {
+				t.Errorf("handler returned unexpected body: got %v want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package inmem
+
+import (
+	"sync"
+	"time"
+
+	"github.com/noppawitt/paymentsvc/apikey"
+)
+
+// APIKeyRepository provides access API keys in an in-memory data source.
+type APIKeyRepository struct {
+	currentID int
+	m         map[int]*apikey.Key
+	byHash    map[string]int
+	mu        sync.RWMutex
+}
+
+// NewAPIKeyRepository returns a new API key repository.
+func NewAPIKeyRepository() *APIKeyRepository {
+	return &APIKeyRepository{
+		m:      make(map[int]*apikey.Key),
+		byHash: make(map[string]int),
+	}
+}
+
+// Create creates an API key.
+func (r *APIKeyRepository) Create(k *apikey.Key) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.currentID = r.currentID + 1
+	k.ID = r.currentID
+	k.CreatedAt = time.Now()
+	copied := *k
+	r.m[k.ID] = &copied
+	r.byHash[k.Hash] = k.ID
+	return nil
+}
+
+// Find finds an API key with the given id.
+func (r *APIKeyRepository) Find(id int) (*apikey.Key, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	k, ok := r.m[id]
+	if !ok {
+		return nil, apikey.ErrKeyNotFound
+	}
+	copied := *k
+	return &copied, nil
+}
+
+// FindByHash finds an API key with the given hash of its secret.
+func (r *APIKeyRepository) FindByHash(hash string) (*apikey.Key, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	id, ok := r.byHash[hash]
+	if !ok {
+		return nil, apikey.ErrInvalidKey
+	}
+	copied := *r.m[id]
+	return &copied, nil
+}
+
+// FindAll returns the API keys sorted by id.
+func (r *APIKeyRepository) FindAll() ([]*apikey.Key, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	keys := make([]*apikey.Key, 0, len(r.m))
+	for id := 1; id <= r.currentID; id++ {
+		if k, ok := r.m[id]; ok {
+			copied := *k
+			keys = append(keys, &copied)
+		}
+	}
+	return keys, nil
+}
+
+// UpdateSecret replaces the secret of an API key with the given id, the previous secret stops working.
+func (r *APIKeyRepository) UpdateSecret(id int, prefix, hash string, rotatedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	k, ok := r.m[id]
+	if !ok {
+		return apikey.ErrKeyNotFound
+	}
+	delete(r.byHash, k.Hash)
+	k.Prefix = prefix
+	k.Hash = hash
+	k.RotatedAt = rotatedAt
+	r.byHash[hash] = id
+	return nil
+}
@@ -0,0 +1,46 @@
+package inmem
+
+import (
+	"sync"
+	"time"
+
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+// CustomerRepository provides access customers in an in-memory data source.
+type CustomerRepository struct {
+	currentID int
+	m         map[int]*payment.Customer
+	mu        sync.RWMutex
+}
+
+// NewCustomerRepository returns a new customer repository.
+func NewCustomerRepository() *CustomerRepository {
+	return &CustomerRepository{
+		m: make(map[int]*payment.Customer),
+	}
+}
+
+// Create creates a customer.
+func (r *CustomerRepository) Create(c *payment.Customer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.currentID = r.currentID + 1
+	c.ID = r.currentID
+	now := time.Now()
+	c.CreatedAt = now
+	c.UpdatedAt = now
+	r.m[r.currentID] = c
+	return nil
+}
+
+// Find finds a customer with the given id.
+func (r *CustomerRepository) Find(id int) (*payment.Customer, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c, ok := r.m[id]
+	if !ok {
+		return nil, payment.ErrCustomerNotFound
+	}
+	return c, nil
+}
@@ -0,0 +1,56 @@
+package inmem
+
+import (
+	"sync"
+	"time"
+
+	"github.com/noppawitt/paymentsvc/ledger"
+)
+
+// LedgerRepository provides access journal entries in an in-memory data source.
+// Entries are only appended, they are never changed.
+type LedgerRepository struct {
+	entries           []ledger.Entry
+	byDeduplicationID map[string]int
+	mu                sync.RWMutex
+}
+
+// NewLedgerRepository returns a new ledger repository.
+func NewLedgerRepository() *LedgerRepository {
+	return &LedgerRepository{
+		byDeduplicationID: make(map[string]int),
+	}
+}
+
+// CreateEntry appends an entry, it returns ledger.ErrDuplicateEntry if its deduplication id is taken.
+func (r *LedgerRepository) CreateEntry(e *ledger.Entry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if e.DeduplicationID != "" {
+		if _, ok := r.byDeduplicationID[e.DeduplicationID]; ok {
+			return ledger.ErrDuplicateEntry
+		}
+	}
+	e.ID = len(r.entries) + 1
+	e.CreatedAt = time.Now()
+	copied := *e
+	copied.Lines = append([]ledger.Line(nil), e.Lines...)
+	r.entries = append(r.entries, copied)
+	if e.DeduplicationID != "" {
+		r.byDeduplicationID[e.DeduplicationID] = e.ID
+	}
+	return nil
+}
+
+// FindEntries returns the entries of a payment, or every entry if the payment id is 0, in the order they were posted.
+func (r *LedgerRepository) FindEntries(paymentID int) ([]ledger.Entry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var entries []ledger.Entry
+	for _, e := range r.entries {
+		if paymentID == 0 || e.PaymentID == paymentID {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
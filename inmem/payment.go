@@ -1,40 +1,73 @@
 package inmem
 
 import (
-	"errors"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/noppawitt/paymentsvc/payment"
+	"github.com/noppawitt/paymentsvc/report"
 )
 
-// ErrPaymentNotFound occurs when a payment with given id is not exists.
-var ErrPaymentNotFound = errors.New("payment not found")
-
 // PaymentRepository provides access an in-memory data source.
+// It is also the outbox of the payment events, which are recorded under the same lock as the payment changes.
+// The position of every relay in the outbox is the id of the last event it published.
 type PaymentRepository struct {
-	currentID int
-	m         map[int]*payment.Payment
-	mu        sync.RWMutex
+	currentID      int
+	currentEventID int
+	m              map[int]*payment.Payment
+	byReference    map[string]int
+	byChargeID     map[string]int
+	events         []*payment.Event
+	relayCursors   map[string]int
+	overrides      []*payment.StatusOverride
+	mu             sync.RWMutex
 }
 
 // NewPaymentRepository returns a new payment repository.
 func NewPaymentRepository() *PaymentRepository {
 	return &PaymentRepository{
-		m: make(map[int]*payment.Payment),
+		m:            make(map[int]*payment.Payment),
+		byReference:  make(map[string]int),
+		byChargeID:   make(map[string]int),
+		relayCursors: make(map[string]int),
 	}
 }
 
-// Create creates a payment.
-func (r *PaymentRepository) Create(payment *payment.Payment) error {
+// NextID reserves a payment id.
+func (r *PaymentRepository) NextID() (int, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	r.currentID = r.currentID + 1
-	payment.ID = r.currentID
+	return r.currentID, nil
+}
+
+// Create creates a payment with its reserved id, or a new id if it has none.
+// It returns payment.ErrDuplicateReference if the payment reference is already taken.
+func (r *PaymentRepository) Create(p *payment.Payment, event *payment.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if p.Reference != "" {
+		if _, ok := r.byReference[p.Reference]; ok {
+			return payment.ErrDuplicateReference
+		}
+	}
+	if p.ID == 0 {
+		r.currentID = r.currentID + 1
+		p.ID = r.currentID
+	}
 	now := time.Now()
-	payment.CreatedAt = now
-	payment.UpdatedAt = now
-	r.m[r.currentID] = payment
+	p.CreatedAt = now
+	p.UpdatedAt = now
+	r.m[p.ID] = p
+	if p.Reference != "" {
+		r.byReference[p.Reference] = p.ID
+	}
+	// a blocked payment has no charge.
+	if p.OmiseCharge.ID != "" {
+		r.byChargeID[p.OmiseCharge.ID] = p.ID
+	}
+	r.recordEvent(p, event)
 	return nil
 }
 
@@ -42,23 +75,359 @@ func (r *PaymentRepository) Create(payment *payment.Payment) error {
 func (r *PaymentRepository) Find(id int) (*payment.Payment, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
-	payment, ok := r.m[id]
+	p, ok := r.m[id]
+	if !ok {
+		return nil, payment.ErrPaymentNotFound
+	}
+	return p, nil
+}
+
+// FindByReference finds a payment with the given merchant reference.
+func (r *PaymentRepository) FindByReference(reference string) (*payment.Payment, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	id, ok := r.byReference[reference]
 	if !ok {
-		return nil, ErrPaymentNotFound
+		return nil, payment.ErrPaymentNotFound
 	}
-	return payment, nil
+	return r.m[id], nil
 }
 
-// UpdateStatus updates a payment status of a payment with the given payment id.
-func (r *PaymentRepository) UpdateStatus(id int, status payment.Status) error {
+// FindByChargeID finds a payment with the given Omise charge id.
+func (r *PaymentRepository) FindByChargeID(chargeID string) (*payment.Payment, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
-	payment, ok := r.m[id]
+	id, ok := r.byChargeID[chargeID]
+	if !ok {
+		return nil, payment.ErrPaymentNotFound
+	}
+	return r.m[id], nil
+}
+
+// FindCreated returns the payments created in [from, to), sorted by id.
+func (r *PaymentRepository) FindCreated(from, to time.Time) ([]*payment.Payment, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var payments []*payment.Payment
+	for _, p := range r.m {
+		if !p.CreatedAt.Before(from) && p.CreatedAt.Before(to) {
+			payments = append(payments, p)
+		}
+	}
+	sort.Slice(payments, func(i, j int) bool {
+		return payments[i].ID < payments[j].ID
+	})
+	return payments, nil
+}
+
+// Search returns the payments matching the query sorted by id, at most q.Limit of them after q.AfterID.
+func (r *PaymentRepository) Search(q *payment.Query) ([]*payment.Payment, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var payments []*payment.Payment
+	// ids are sequential, a reserved id has no payment until it is created.
+	for id := q.AfterID + 1; id <= r.currentID && (q.Limit == 0 || len(payments) < q.Limit); id++ {
+		p, ok := r.m[id]
+		if ok && q.Matches(p) {
+			payments = append(payments, p)
+		}
+	}
+	return payments, nil
+}
+
+// AggregatePayments aggregates the payments created in [from, to) by the bucket of the period they were created in,
+// their currency, source type and status, sorted by bucket.
+func (r *PaymentRepository) AggregatePayments(from, to time.Time, period report.Period, loc *time.Location) ([]report.Aggregate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	type key struct {
+		start      int64
+		currency   string
+		sourceType string
+		status     payment.Status
+	}
+	aggregates := make(map[key]*report.Aggregate)
+	for _, p := range r.m {
+		if p.CreatedAt.Before(from) || !p.CreatedAt.Before(to) {
+			continue
+		}
+		start := period.Start(p.CreatedAt, loc)
+		k := key{start.Unix(), p.Amount.Currency, p.OmiseCharge.SourceType, p.Status}
+		a, ok := aggregates[k]
+		if !ok {
+			a = &report.Aggregate{
+				Start:      start,
+				Currency:   k.currency,
+				SourceType: k.sourceType,
+				Status:     k.status,
+				Amount:     payment.NewMoney(0, k.currency),
+			}
+			aggregates[k] = a
+		}
+		amount, err := a.Amount.Add(p.PaidAmount())
+		if err != nil {
+			return nil, err
+		}
+		a.Count++
+		a.Amount = amount
+	}
+
+	res := make([]report.Aggregate, 0, len(aggregates))
+	for _, a := range aggregates {
+		res = append(res, *a)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Start.Before(res[j].Start)
+	})
+	return res, nil
+}
+
+// AggregateRefunds aggregates the refunds made in [from, to) by the bucket of the period they were made in,
+// and the currency and source type of their payments, sorted by bucket.
+func (r *PaymentRepository) AggregateRefunds(from, to time.Time, period report.Period, loc *time.Location) ([]report.RefundAggregate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	type key struct {
+		start      int64
+		currency   string
+		sourceType string
+	}
+	aggregates := make(map[key]*report.RefundAggregate)
+	for _, p := range r.m {
+		for _, refund := range p.Refunds {
+			if refund.CreatedAt.Before(from) || !refund.CreatedAt.Before(to) {
+				continue
+			}
+			start := period.Start(refund.CreatedAt, loc)
+			k := key{start.Unix(), refund.Amount.Currency, p.OmiseCharge.SourceType}
+			a, ok := aggregates[k]
+			if !ok {
+				a = &report.RefundAggregate{
+					Start:      start,
+					Currency:   k.currency,
+					SourceType: k.sourceType,
+					Amount:     payment.NewMoney(0, k.currency),
+				}
+				aggregates[k] = a
+			}
+			amount, err := a.Amount.Add(refund.Amount)
+			if err != nil {
+				return nil, err
+			}
+			a.Count++
+			a.Amount = amount
+		}
+	}
+
+	res := make([]report.RefundAggregate, 0, len(aggregates))
+	for _, a := range aggregates {
+		res = append(res, *a)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Start.Before(res[j].Start)
+	})
+	return res, nil
+}
+
+// FindPaid returns the payments whose charge was paid in [from, to), sorted by the time they were paid.
+func (r *PaymentRepository) FindPaid(from, to time.Time) ([]*payment.Payment, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var payments []*payment.Payment
+	for _, p := range r.m {
+		paidAt := p.OmiseCharge.PaidAt
+		if !paidAt.IsZero() && !paidAt.Before(from) && paidAt.Before(to) {
+			payments = append(payments, p)
+		}
+	}
+	sort.Slice(payments, func(i, j int) bool {
+		return payments[i].OmiseCharge.PaidAt.Before(payments[j].OmiseCharge.PaidAt)
+	})
+	return payments, nil
+}
+
+// UpdateCharge replaces the charge of a payment with the given payment id and updates the payment status.
+func (r *PaymentRepository) UpdateCharge(id int, charge *payment.OmiseCharge, event *payment.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.m[id]
+	if !ok {
+		return payment.ErrPaymentNotFound
+	}
+	if p.Status != charge.Status {
+		p.StatusChanges++
+	}
+	p.Status = charge.Status
+	p.OmiseCharge = charge
+	p.UpdatedAt = time.Now()
+	r.recordEvent(p, event)
+	return nil
+}
+
+// OverrideStatus changes the status of the payment of the override and records the override in the audit log.
+func (r *PaymentRepository) OverrideStatus(override *payment.StatusOverride, event *payment.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.m[override.PaymentID]
 	if !ok {
-		return ErrPaymentNotFound
+		return payment.ErrPaymentNotFound
+	}
+	if p.Status != override.Status {
+		p.StatusChanges++
+	}
+	p.Status = override.Status
+	p.UpdatedAt = time.Now()
+	override.ID = len(r.overrides) + 1
+	override.CreatedAt = p.UpdatedAt
+	copied := *override
+	r.overrides = append(r.overrides, &copied)
+	r.recordEvent(p, event)
+	return nil
+}
+
+// CorrectCharge replaces the charge of the payment of the override, updates the payment status
+// and records the override in the audit log.
+func (r *PaymentRepository) CorrectCharge(override *payment.StatusOverride, charge *payment.OmiseCharge, event *payment.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.m[override.PaymentID]
+	if !ok {
+		return payment.ErrPaymentNotFound
+	}
+	if p.Status != charge.Status {
+		p.StatusChanges++
+	}
+	p.Status = charge.Status
+	p.OmiseCharge = charge
+	p.UpdatedAt = time.Now()
+	override.ID = len(r.overrides) + 1
+	override.CreatedAt = p.UpdatedAt
+	copied := *override
+	r.overrides = append(r.overrides, &copied)
+	r.recordEvent(p, event)
+	return nil
+}
+
+// Refund adds a refund to the payment with the given id.
+func (r *PaymentRepository) Refund(id int, refund *payment.Refund, event *payment.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.m[id]
+	if !ok {
+		return payment.ErrPaymentNotFound
+	}
+	// the refunds are copied so that the payment of a recorded event keeps the refunds it had.
+	copied := *refund
+	refunds := make([]*payment.Refund, len(p.Refunds), len(p.Refunds)+1)
+	copy(refunds, p.Refunds)
+	p.Refunds = append(refunds, &copied)
+	p.UpdatedAt = time.Now()
+	r.recordEvent(p, event)
+	return nil
+}
+
+// FindStatusOverrides returns the status overrides of a payment in the order they were made.
+func (r *PaymentRepository) FindStatusOverrides(paymentID int) ([]*payment.StatusOverride, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var overrides []*payment.StatusOverride
+	for _, o := range r.overrides {
+		if o.PaymentID == paymentID {
+			copied := *o
+			overrides = append(overrides, &copied)
+		}
+	}
+	return overrides, nil
+}
+
+// recordEvent records an event of the payment in the outbox, it must be called with the lock held.
+func (r *PaymentRepository) recordEvent(p *payment.Payment, event *payment.Event) {
+	if event == nil {
+		return
+	}
+	r.currentEventID = r.currentEventID + 1
+	event.ID = r.currentEventID
+	event.Payment = *p
+	event.CreatedAt = p.UpdatedAt
+	r.events = append(r.events, copyEvent(event))
+}
+
+// copyEvent copies an event with the times it was published and parked.
+func copyEvent(e *payment.Event) *payment.Event {
+	copied := *e
+	copied.Published = make(map[string]time.Time, len(e.Published))
+	for relay, t := range e.Published {
+		copied.Published[relay] = t
+	}
+	if e.Parked != nil {
+		copied.Parked = make(map[string]time.Time, len(e.Parked))
+		for relay, t := range e.Parked {
+			copied.Parked[relay] = t
+		}
+	}
+	return &copied
+}
+
+// FindEvents returns the events of a payment in the order they were recorded.
+func (r *PaymentRepository) FindEvents(paymentID int) ([]*payment.Event, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var events []*payment.Event
+	for _, e := range r.events {
+		if e.PaymentID == paymentID {
+			events = append(events, copyEvent(e))
+		}
+	}
+	return events, nil
+}
+
+// FindUnpublishedEvents returns at most limit events after the position of the relay, oldest first.
+func (r *PaymentRepository) FindUnpublishedEvents(relay string, limit int) ([]*payment.Event, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var events []*payment.Event
+	// event ids are the positions in the outbox starting from 1.
+	for _, e := range r.events[r.relayCursors[relay]:] {
+		if len(events) == limit {
+			break
+		}
+		events = append(events, copyEvent(e))
+	}
+	return events, nil
+}
+
+// MarkEventPublished marks an event as published by the relay and moves the position of the relay past it.
+func (r *PaymentRepository) MarkEventPublished(relay string, id int, publishedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if id < 1 || id > len(r.events) {
+		return payment.ErrEventNotFound
+	}
+	e := r.events[id-1]
+	if e.Published == nil {
+		e.Published = make(map[string]time.Time)
+	}
+	e.Published[relay] = publishedAt
+	if id > r.relayCursors[relay] {
+		r.relayCursors[relay] = id
+	}
+	return nil
+}
+
+// ParkEvent marks an event as parked by the relay and moves the position of the relay past it.
+func (r *PaymentRepository) ParkEvent(relay string, id int, parkedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if id < 1 || id > len(r.events) {
+		return payment.ErrEventNotFound
+	}
+	e := r.events[id-1]
+	if e.Parked == nil {
+		e.Parked = make(map[string]time.Time)
+	}
+	e.Parked[relay] = parkedAt
+	if id > r.relayCursors[relay] {
+		r.relayCursors[relay] = id
 	}
-	payment.Status = status
-	payment.OmiseCharge.Status = status
-	payment.UpdatedAt = time.Now()
 	return nil
 }
@@ -0,0 +1,152 @@
+package inmem
+
+import (
+	"sync"
+	"time"
+
+	"github.com/noppawitt/paymentsvc/paymentlink"
+)
+
+// PaymentLinkRepository provides access payment links and their payments in an in-memory data source.
+type PaymentLinkRepository struct {
+	currentID int
+	m         map[int]*paymentlink.Link
+	slugs     map[string]int
+	payments  map[int][]int
+	pending   map[int]map[int]bool
+	mu        sync.RWMutex
+}
+
+// NewPaymentLinkRepository returns a new payment link repository.
+func NewPaymentLinkRepository() *PaymentLinkRepository {
+	return &PaymentLinkRepository{
+		m:        make(map[int]*paymentlink.Link),
+		slugs:    make(map[string]int),
+		payments: make(map[int][]int),
+		pending:  make(map[int]map[int]bool),
+	}
+}
+
+// Create creates a payment link.
+func (r *PaymentLinkRepository) Create(l *paymentlink.Link) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.currentID = r.currentID + 1
+	l.ID = r.currentID
+	now := time.Now()
+	l.CreatedAt = now
+	l.UpdatedAt = now
+	r.m[l.ID] = l
+	r.slugs[l.Slug] = l.ID
+	return nil
+}
+
+// Find finds a payment link with the given id.
+func (r *PaymentLinkRepository) Find(id int) (*paymentlink.Link, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	l, ok := r.m[id]
+	if !ok {
+		return nil, paymentlink.ErrLinkNotFound
+	}
+	copied := *l
+	return &copied, nil
+}
+
+// FindBySlug finds a payment link with the given slug.
+func (r *PaymentLinkRepository) FindBySlug(slug string) (*paymentlink.Link, error) {
+	r.mu.RLock()
+	id, ok := r.slugs[slug]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, paymentlink.ErrLinkNotFound
+	}
+	return r.Find(id)
+}
+
+// Use counts a use of the payment link if it is active at the given time.
+func (r *PaymentLinkRepository) Use(id int, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	l, ok := r.m[id]
+	if !ok {
+		return paymentlink.ErrLinkNotFound
+	}
+	if err := l.Use(now); err != nil {
+		return err
+	}
+	l.UpdatedAt = time.Now()
+	return nil
+}
+
+// Release uncounts a use of the payment link.
+func (r *PaymentLinkRepository) Release(id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	l, ok := r.m[id]
+	if !ok {
+		return paymentlink.ErrLinkNotFound
+	}
+	if l.Uses > 0 {
+		l.Uses--
+	}
+	l.UpdatedAt = time.Now()
+	return nil
+}
+
+// AddPayment adds a payment made through the payment link, a pending payment is kept until it is settled.
+func (r *PaymentLinkRepository) AddPayment(id, paymentID int, pending bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.m[id]; !ok {
+		return paymentlink.ErrLinkNotFound
+	}
+	r.payments[id] = append(r.payments[id], paymentID)
+	if pending {
+		if r.pending[id] == nil {
+			r.pending[id] = make(map[int]bool)
+		}
+		r.pending[id][paymentID] = true
+	}
+	return nil
+}
+
+// SettlePayment marks a pending payment of the payment link as settled and uncounts its use if release is true.
+// A payment which is not pending is left as it is.
+func (r *PaymentLinkRepository) SettlePayment(id, paymentID int, release bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	l, ok := r.m[id]
+	if !ok {
+		return paymentlink.ErrLinkNotFound
+	}
+	if !r.pending[id][paymentID] {
+		return nil
+	}
+	delete(r.pending[id], paymentID)
+	if release && l.Uses > 0 {
+		l.Uses--
+		l.UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+// FindPayments returns the ids of the payments made through the payment link in the order they were made.
+func (r *PaymentLinkRepository) FindPayments(id int) ([]int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]int(nil), r.payments[id]...), nil
+}
+
+// FindPendingPayments returns the ids of the pending payments of the payment link in the order they were made.
+func (r *PaymentLinkRepository) FindPendingPayments(id int) ([]int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var ids []int
+	for _, paymentID := range r.payments[id] {
+		if r.pending[id][paymentID] {
+			ids = append(ids, paymentID)
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,147 @@
+package inmem
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/noppawitt/paymentsvc/subscription"
+)
+
+// SubscriptionRepository provides access plans, subscriptions and their charges in an in-memory data source.
+// Subscriptions are stored and returned as copies, so a subscription is only changed through Update.
+type SubscriptionRepository struct {
+	currentPlanID   int
+	currentID       int
+	currentChargeID int
+	plans           map[int]*subscription.Plan
+	m               map[int]*subscription.Subscription
+	charges         map[int][]subscription.Charge
+	mu              sync.RWMutex
+}
+
+// NewSubscriptionRepository returns a new subscription repository.
+func NewSubscriptionRepository() *SubscriptionRepository {
+	return &SubscriptionRepository{
+		plans:   make(map[int]*subscription.Plan),
+		m:       make(map[int]*subscription.Subscription),
+		charges: make(map[int][]subscription.Charge),
+	}
+}
+
+// CreatePlan creates a plan.
+func (r *SubscriptionRepository) CreatePlan(p *subscription.Plan) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.currentPlanID = r.currentPlanID + 1
+	p.ID = r.currentPlanID
+	p.CreatedAt = time.Now()
+	r.plans[p.ID] = p
+	return nil
+}
+
+// FindPlan finds a plan with the given id.
+func (r *SubscriptionRepository) FindPlan(id int) (*subscription.Plan, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	p, ok := r.plans[id]
+	if !ok {
+		return nil, subscription.ErrPlanNotFound
+	}
+	return p, nil
+}
+
+// Create creates a subscription.
+func (r *SubscriptionRepository) Create(s *subscription.Subscription) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.currentID = r.currentID + 1
+	s.ID = r.currentID
+	now := time.Now()
+	s.CreatedAt = now
+	s.UpdatedAt = now
+	s.Version = 1
+	stored := *s
+	r.m[s.ID] = &stored
+	return nil
+}
+
+// Find finds a subscription with the given id.
+func (r *SubscriptionRepository) Find(id int) (*subscription.Subscription, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	s, ok := r.m[id]
+	if !ok {
+		return nil, subscription.ErrSubscriptionNotFound
+	}
+	found := *s
+	return &found, nil
+}
+
+// Update replaces a subscription if it was not updated since it was found and increases its version.
+func (r *SubscriptionRepository) Update(s *subscription.Subscription) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.m[s.ID]
+	if !ok {
+		return subscription.ErrSubscriptionNotFound
+	}
+	if stored.Version != s.Version {
+		return subscription.ErrConcurrentUpdate
+	}
+	s.Version++
+	s.UpdatedAt = time.Now()
+	updated := *s
+	r.m[s.ID] = &updated
+	return nil
+}
+
+// FindDue finds active and past due subscriptions which are due at the given time, ordered by their due date.
+func (r *SubscriptionRepository) FindDue(now time.Time) ([]*subscription.Subscription, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var due []*subscription.Subscription
+	for _, s := range r.m {
+		if (s.Status == subscription.StatusActive || s.Status == subscription.StatusPastDue) && !s.NextChargeAt.After(now) {
+			found := *s
+			due = append(due, &found)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].NextChargeAt.Before(due[j].NextChargeAt)
+	})
+	return due, nil
+}
+
+// CreateCharge creates a charge of a subscription.
+func (r *SubscriptionRepository) CreateCharge(c *subscription.Charge) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.currentChargeID = r.currentChargeID + 1
+	c.ID = r.currentChargeID
+	c.CreatedAt = time.Now()
+	r.charges[c.SubscriptionID] = append(r.charges[c.SubscriptionID], *c)
+	return nil
+}
+
+// UpdateCharge replaces a charge of a subscription.
+func (r *SubscriptionRepository) UpdateCharge(c *subscription.Charge) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	charges := r.charges[c.SubscriptionID]
+	for i := range charges {
+		if charges[i].ID == c.ID {
+			charges[i] = *c
+			return nil
+		}
+	}
+	return fmt.Errorf("charge %d of subscription %d not found", c.ID, c.SubscriptionID)
+}
+
+// FindCharges finds the charges of a subscription in the order they were made.
+func (r *SubscriptionRepository) FindCharges(subscriptionID int) ([]subscription.Charge, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]subscription.Charge(nil), r.charges[subscriptionID]...), nil
+}
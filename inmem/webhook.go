@@ -0,0 +1,188 @@
+package inmem
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/noppawitt/paymentsvc/webhook"
+)
+
+// WebhookRepository provides access webhook endpoints, events and deliveries in an in-memory data source.
+type WebhookRepository struct {
+	currentEndpointID int
+	currentEventID    int
+	currentDeliveryID int
+	endpoints         map[int]*webhook.Endpoint
+	events            map[int]*webhook.Event
+	deliveries        map[int]*webhook.Delivery
+	byDeduplicationID map[string]int
+	mu                sync.RWMutex
+}
+
+// NewWebhookRepository returns a new webhook repository.
+func NewWebhookRepository() *WebhookRepository {
+	return &WebhookRepository{
+		endpoints:         make(map[int]*webhook.Endpoint),
+		events:            make(map[int]*webhook.Event),
+		deliveries:        make(map[int]*webhook.Delivery),
+		byDeduplicationID: make(map[string]int),
+	}
+}
+
+// CreateEndpoint creates a webhook endpoint.
+func (r *WebhookRepository) CreateEndpoint(e *webhook.Endpoint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.currentEndpointID = r.currentEndpointID + 1
+	e.ID = r.currentEndpointID
+	e.CreatedAt = time.Now()
+	r.endpoints[e.ID] = e
+	return nil
+}
+
+// FindEndpoint finds a webhook endpoint with the given id.
+func (r *WebhookRepository) FindEndpoint(id int) (*webhook.Endpoint, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	e, ok := r.endpoints[id]
+	if !ok {
+		return nil, webhook.ErrEndpointNotFound
+	}
+	return e, nil
+}
+
+// FindEndpoints returns every webhook endpoint sorted by id.
+func (r *WebhookRepository) FindEndpoints() ([]webhook.Endpoint, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	endpoints := make([]webhook.Endpoint, 0, len(r.endpoints))
+	for _, e := range r.endpoints {
+		endpoints = append(endpoints, *e)
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		return endpoints[i].ID < endpoints[j].ID
+	})
+	return endpoints, nil
+}
+
+// DeleteEndpoint deletes a webhook endpoint.
+func (r *WebhookRepository) DeleteEndpoint(id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.endpoints[id]; !ok {
+		return webhook.ErrEndpointNotFound
+	}
+	delete(r.endpoints, id)
+	return nil
+}
+
+// CreateEvent creates an event with its deliveries.
+func (r *WebhookRepository) CreateEvent(e *webhook.Event, deliveries []*webhook.Delivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.currentEventID = r.currentEventID + 1
+	e.ID = r.currentEventID
+	e.CreatedAt = time.Now()
+	r.events[e.ID] = e
+	if e.DeduplicationID != "" {
+		r.byDeduplicationID[e.DeduplicationID] = e.ID
+	}
+	for _, d := range deliveries {
+		d.EventID = e.ID
+		r.createDelivery(d)
+	}
+	return nil
+}
+
+// FindEvent finds an event with the given id.
+func (r *WebhookRepository) FindEvent(id int) (*webhook.Event, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	e, ok := r.events[id]
+	if !ok {
+		return nil, webhook.ErrEventNotFound
+	}
+	return e, nil
+}
+
+// FindEventByDeduplicationID finds an event with the given deduplication id.
+func (r *WebhookRepository) FindEventByDeduplicationID(deduplicationID string) (*webhook.Event, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	id, ok := r.byDeduplicationID[deduplicationID]
+	if !ok {
+		return nil, webhook.ErrEventNotFound
+	}
+	return r.events[id], nil
+}
+
+// CreateDeliveries creates deliveries.
+func (r *WebhookRepository) CreateDeliveries(deliveries []*webhook.Delivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, d := range deliveries {
+		r.createDelivery(d)
+	}
+	return nil
+}
+
+func (r *WebhookRepository) createDelivery(d *webhook.Delivery) {
+	r.currentDeliveryID = r.currentDeliveryID + 1
+	d.ID = r.currentDeliveryID
+	now := time.Now()
+	d.CreatedAt = now
+	d.UpdatedAt = now
+	copied := *d
+	r.deliveries[d.ID] = &copied
+}
+
+// UpdateDelivery replaces a delivery.
+func (r *WebhookRepository) UpdateDelivery(d *webhook.Delivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.deliveries[d.ID]; !ok {
+		return webhook.ErrDeliveryNotFound
+	}
+	d.UpdatedAt = time.Now()
+	copied := *d
+	r.deliveries[d.ID] = &copied
+	return nil
+}
+
+// FindDueDeliveries returns the pending deliveries which are due at the given time, the earliest first.
+func (r *WebhookRepository) FindDueDeliveries(now time.Time) ([]*webhook.Delivery, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var due []*webhook.Delivery
+	for _, d := range r.deliveries {
+		if d.Status == webhook.DeliveryPending && !d.NextAttemptAt.After(now) {
+			copied := *d
+			due = append(due, &copied)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].NextAttemptAt.Equal(due[j].NextAttemptAt) {
+			return due[i].NextAttemptAt.Before(due[j].NextAttemptAt)
+		}
+		return due[i].ID < due[j].ID
+	})
+	return due, nil
+}
+
+// FindDeliveries returns the deliveries to an endpoint with the given status, or any status if it is empty,
+// the latest first.
+func (r *WebhookRepository) FindDeliveries(endpointID int, status webhook.DeliveryStatus) ([]webhook.Delivery, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var deliveries []webhook.Delivery
+	for _, d := range r.deliveries {
+		if d.EndpointID == endpointID && (status == "" || d.Status == status) {
+			deliveries = append(deliveries, *d)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].ID > deliveries[j].ID
+	})
+	return deliveries, nil
+}
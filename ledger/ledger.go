@@ -0,0 +1,302 @@
+// Package ledger records the money of payments in a double-entry ledger.
+package ledger
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+// Service provides ledger service methods.
+// It implements payment.Publisher to post the entries of payment events.
+type Service interface {
+	Publish(event *payment.Event) error
+	Entries(paymentID int) ([]Entry, error)
+	Balances() ([]Balance, error)
+	Check() ([]payment.Money, error)
+}
+
+// Account is an account of the ledger.
+type Account string
+
+// Accounts
+const (
+	// AccountCustomerReceivable is the money payers owe for their payments, it is zero once they are paid.
+	AccountCustomerReceivable Account = "customer_receivable"
+	// AccountGatewayClearing is the money held by the payment gateway until it is settled to the merchant.
+	AccountGatewayClearing Account = "gateway_clearing"
+	// AccountMerchantBalance is the money earned by the merchant.
+	AccountMerchantBalance Account = "merchant_balance"
+	// AccountFees is the fees charged by the payment gateway.
+	AccountFees Account = "fees"
+	// AccountRefunds is the money refunded to payers.
+	AccountRefunds Account = "refunds"
+)
+
+// EntryType is the type of a journal entry.
+type EntryType string
+
+// Entry types
+const (
+	EntryPaymentSucceeded EntryType = "payment_succeeded"
+	EntryPaymentRefunded  EntryType = "payment_refunded"
+	EntryPaymentReversed  EntryType = "payment_reversed"
+	// EntryFeeCharged is the fee of a payment which became known after the payment succeeded.
+	EntryFeeCharged EntryType = "fee_charged"
+)
+
+// Entry represents a journal entry, it is immutable once posted.
+// The amounts of its lines sum to zero in every currency.
+// DeduplicationID is the deduplication id of the payment event, an event is posted once.
+type Entry struct {
+	ID              int
+	DeduplicationID string
+	Type            EntryType
+	PaymentID       int
+	Lines           []Line
+	CreatedAt       time.Time
+}
+
+// Line represents a line of a journal entry.
+// A positive amount debits the account and a negative amount credits it.
+type Line struct {
+	Account Account
+	Amount  payment.Money
+}
+
+// Balance represents the balance of an account in a currency, the sum of the amounts of its lines.
+// A positive balance is a debit balance.
+type Balance struct {
+	Account Account
+	Amount  payment.Money
+}
+
+// Repository provides access journal entries in a data source.
+// CreateEntry returns ErrDuplicateEntry if an entry with the same deduplication id exists.
+// FindEntries returns the entries of a payment, or every entry if the payment id is 0, in the order they were posted.
+type Repository interface {
+	CreateEntry(entry *Entry) error
+	FindEntries(paymentID int) ([]Entry, error)
+}
+
+// Errors
+var (
+	ErrDuplicateEntry = &payment.Error{Code: payment.ErrorCodeConflict, Message: "ledger entry already exists"}
+	ErrUnbalanced     = errors.New("ledger entry is not balanced")
+)
+
+type service struct {
+	repo Repository
+}
+
+// NewService returns a new ledger service.
+func NewService(repo Repository) Service {
+	return &service{
+		repo: repo,
+	}
+}
+
+// Publish posts the entry of a payment event if it moves money: a payment succeeds, is charged a fee, is refunded
+// or is reversed.
+// An event which is published again is ignored.
+func (s *service) Publish(e *payment.Event) error {
+	entry, err := s.newEntry(e)
+	if err != nil || entry == nil {
+		return err
+	}
+
+	if err := checkBalanced(entry.Lines); err != nil {
+		return err
+	}
+
+	err = s.repo.CreateEntry(entry)
+	if errors.Is(err, ErrDuplicateEntry) {
+		return nil
+	}
+	return err
+}
+
+// newEntry returns the entry of a payment event, or nil if the event does not move money.
+func (s *service) newEntry(e *payment.Event) (*Entry, error) {
+	entry := &Entry{
+		DeduplicationID: e.DeduplicationID,
+		PaymentID:       e.PaymentID,
+	}
+
+	switch {
+	case e.Type == payment.EventRefunded:
+		// the refunded money is paid back to the payer from the gateway.
+		entry.Type = EntryPaymentRefunded
+		entry.Lines = []Line{
+			{Account: AccountRefunds, Amount: e.Amount},
+			{Account: AccountGatewayClearing, Amount: negate(e.Amount)},
+		}
+	case e.Type == payment.EventFeeCharged:
+		lines, err := feeLines(e.Payment.OmiseCharge)
+		if err != nil || len(lines) == 0 {
+			return nil, err
+		}
+		entry.Type = EntryFeeCharged
+		entry.Lines = lines
+	case e.Payment.Status == payment.StatusSuccessful || e.Payment.Status == payment.StatusCaptured:
+		if e.Type != payment.EventCreated && e.Type != payment.EventStatusChanged {
+			return nil, nil
+		}
+		// the payer owes the merchant for the payment and pays it through the gateway.
+		amount := e.Payment.PaidAmount()
+		entry.Type = EntryPaymentSucceeded
+		entry.Lines = []Line{
+			{Account: AccountCustomerReceivable, Amount: amount},
+			{Account: AccountMerchantBalance, Amount: negate(amount)},
+			{Account: AccountGatewayClearing, Amount: amount},
+			{Account: AccountCustomerReceivable, Amount: negate(amount)},
+		}
+		fee, err := feeLines(e.Payment.OmiseCharge)
+		if err != nil {
+			return nil, err
+		}
+		entry.Lines = append(entry.Lines, fee...)
+	case e.Type == payment.EventStatusChanged && e.Payment.Status == payment.StatusReversed:
+		// a reversal cancels the entries of the succeeded payment and its fee,
+		// there is nothing to cancel if it never succeeded.
+		entries, err := s.repo.FindEntries(e.PaymentID)
+		if err != nil {
+			return nil, err
+		}
+		entry.Type = EntryPaymentReversed
+		for _, posted := range entries {
+			if posted.Type != EntryPaymentSucceeded && posted.Type != EntryFeeCharged {
+				continue
+			}
+			for _, l := range posted.Lines {
+				entry.Lines = append(entry.Lines, Line{Account: l.Account, Amount: negate(l.Amount)})
+			}
+		}
+		if len(entry.Lines) == 0 {
+			return nil, nil
+		}
+	default:
+		return nil, nil
+	}
+
+	return entry, nil
+}
+
+// feeLines returns the lines of the fee of a charge, or none if its fee is not known.
+// The gateway keeps its fee and the VAT on it out of the money it settles.
+func feeLines(charge *payment.OmiseCharge) ([]Line, error) {
+	if charge == nil || charge.Fee.IsZero() {
+		return nil, nil
+	}
+	fee, err := charge.Fee.Add(charge.FeeVAT)
+	if err != nil {
+		return nil, err
+	}
+	return []Line{
+		{Account: AccountFees, Amount: fee},
+		{Account: AccountGatewayClearing, Amount: negate(fee)},
+	}, nil
+}
+
+func negate(m payment.Money) payment.Money {
+	return payment.NewMoney(-m.Amount, m.Currency)
+}
+
+// Entries returns the entries of a payment, or every entry if the payment id is 0.
+func (s *service) Entries(paymentID int) ([]Entry, error) {
+	return s.repo.FindEntries(paymentID)
+}
+
+// Balances returns the balance of every account in every currency with an entry, sorted by account and currency.
+func (s *service) Balances() ([]Balance, error) {
+	entries, err := s.repo.FindEntries(0)
+	if err != nil {
+		return nil, err
+	}
+
+	type key struct {
+		account  Account
+		currency string
+	}
+	sums := make(map[key]payment.Money)
+	for _, e := range entries {
+		for _, l := range e.Lines {
+			k := key{l.Account, l.Amount.Currency}
+			sum, ok := sums[k]
+			if !ok {
+				sum = payment.NewMoney(0, l.Amount.Currency)
+			}
+			if sums[k], err = sum.Add(l.Amount); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	balances := make([]Balance, 0, len(sums))
+	for k, sum := range sums {
+		balances = append(balances, Balance{Account: k.account, Amount: sum})
+	}
+	sort.Slice(balances, func(i, j int) bool {
+		if balances[i].Account != balances[j].Account {
+			return balances[i].Account < balances[j].Account
+		}
+		return balances[i].Amount.Currency < balances[j].Amount.Currency
+	})
+	return balances, nil
+}
+
+// Check checks that every entry sums to zero in every currency, so that the ledger is balanced.
+// It returns the sum of every currency which is not zero, sorted by currency.
+func (s *service) Check() ([]payment.Money, error) {
+	entries, err := s.repo.FindEntries(0)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []Line
+	for _, e := range entries {
+		lines = append(lines, e.Lines...)
+	}
+	return sumByCurrency(lines)
+}
+
+// checkBalanced returns ErrUnbalanced if the lines do not sum to zero in every currency.
+func checkBalanced(lines []Line) error {
+	sums, err := sumByCurrency(lines)
+	if err != nil {
+		return err
+	}
+	if len(sums) > 0 {
+		return ErrUnbalanced
+	}
+	return nil
+}
+
+// sumByCurrency returns the sum of the lines in every currency which is not zero, sorted by currency.
+func sumByCurrency(lines []Line) ([]payment.Money, error) {
+	sums := make(map[string]payment.Money)
+	for _, l := range lines {
+		sum, ok := sums[l.Amount.Currency]
+		if !ok {
+			sum = payment.NewMoney(0, l.Amount.Currency)
+		}
+		sum, err := sum.Add(l.Amount)
+		if err != nil {
+			return nil, err
+		}
+		sums[l.Amount.Currency] = sum
+	}
+
+	var nonZero []payment.Money
+	for _, sum := range sums {
+		if !sum.IsZero() {
+			nonZero = append(nonZero, sum)
+		}
+	}
+	sort.Slice(nonZero, func(i, j int) bool {
+		return nonZero[i].Currency < nonZero[j].Currency
+	})
+	return nonZero, nil
+}
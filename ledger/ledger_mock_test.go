@@ -0,0 +1,26 @@
+package ledger
+
+type mockRepository struct {
+	Entries []Entry
+}
+
+func (m *mockRepository) CreateEntry(entry *Entry) error {
+	for _, e := range m.Entries {
+		if e.DeduplicationID == entry.DeduplicationID {
+			return ErrDuplicateEntry
+		}
+	}
+	entry.ID = len(m.Entries) + 1
+	m.Entries = append(m.Entries, *entry)
+	return nil
+}
+
+func (m *mockRepository) FindEntries(paymentID int) ([]Entry, error) {
+	var entries []Entry
+	for _, e := range m.Entries {
+		if paymentID == 0 || e.PaymentID == paymentID {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,213 @@
+package ledger
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+func thb(amount int64) payment.Money {
+	return payment.NewMoney(amount, "THB")
+}
+
+func newEvent(id string, t payment.EventType, status payment.Status, amount, captured int64) *payment.Event {
+	return &payment.Event{
+		DeduplicationID: id,
+		Type:            t,
+		PaymentID:       1,
+		Payment: payment.Payment{
+			ID:          1,
+			Status:      status,
+			Amount:      thb(amount),
+			OmiseCharge: &payment.OmiseCharge{Status: status, Amount: thb(amount), CapturedAmount: thb(captured)},
+		},
+	}
+}
+
+func newPaidEvent(id string, amount, fee, vat int64) *payment.Event {
+	e := newEvent(id, payment.EventStatusChanged, payment.StatusSuccessful, amount, amount)
+	e.Payment.OmiseCharge.Fee = thb(fee)
+	e.Payment.OmiseCharge.FeeVAT = thb(vat)
+	e.Payment.OmiseCharge.Net = thb(amount - fee - vat)
+	return e
+}
+
+func newFeeChargedEvent(id string, amount, fee, vat int64) *payment.Event {
+	e := newPaidEvent(id, amount, fee, vat)
+	e.Type = payment.EventFeeCharged
+	return e
+}
+
+func TestService_Publish(t *testing.T) {
+	succeeded := []Line{
+		{Account: AccountCustomerReceivable, Amount: thb(2000)},
+		{Account: AccountMerchantBalance, Amount: thb(-2000)},
+		{Account: AccountGatewayClearing, Amount: thb(2000)},
+		{Account: AccountCustomerReceivable, Amount: thb(-2000)},
+	}
+
+	tests := []struct {
+		name   string
+		events []*payment.Event
+		want   []Entry
+	}{
+		{
+			name:   "succeeded",
+			events: []*payment.Event{newEvent("a", payment.EventStatusChanged, payment.StatusSuccessful, 2000, 2000)},
+			want:   []Entry{{ID: 1, DeduplicationID: "a", Type: EntryPaymentSucceeded, PaymentID: 1, Lines: succeeded}},
+		},
+		{
+			name:   "succeeded on create",
+			events: []*payment.Event{newEvent("a", payment.EventCreated, payment.StatusSuccessful, 2000, 2000)},
+			want:   []Entry{{ID: 1, DeduplicationID: "a", Type: EntryPaymentSucceeded, PaymentID: 1, Lines: succeeded}},
+		},
+		{
+			name:   "partially captured",
+			events: []*payment.Event{newEvent("a", payment.EventStatusChanged, payment.StatusCaptured, 3000, 2000)},
+			want:   []Entry{{ID: 1, DeduplicationID: "a", Type: EntryPaymentSucceeded, PaymentID: 1, Lines: succeeded}},
+		},
+		{
+			name:   "succeeded with fees",
+			events: []*payment.Event{newPaidEvent("a", 2000, 73, 5)},
+			want: []Entry{{ID: 1, DeduplicationID: "a", Type: EntryPaymentSucceeded, PaymentID: 1, Lines: append(succeeded[:len(succeeded):len(succeeded)],
+				Line{Account: AccountFees, Amount: thb(78)},
+				Line{Account: AccountGatewayClearing, Amount: thb(-78)},
+			)}},
+		},
+		{
+			name: "published again",
+			events: []*payment.Event{
+				newEvent("a", payment.EventStatusChanged, payment.StatusSuccessful, 2000, 2000),
+				newEvent("a", payment.EventStatusChanged, payment.StatusSuccessful, 2000, 2000),
+			},
+			want: []Entry{{ID: 1, DeduplicationID: "a", Type: EntryPaymentSucceeded, PaymentID: 1, Lines: succeeded}},
+		},
+		{
+			name:   "pending",
+			events: []*payment.Event{newEvent("a", payment.EventCreated, payment.StatusPending, 2000, 0)},
+		},
+		{
+			name: "reversed",
+			events: []*payment.Event{
+				newEvent("a", payment.EventStatusChanged, payment.StatusSuccessful, 2000, 2000),
+				newEvent("b", payment.EventStatusChanged, payment.StatusReversed, 2000, 2000),
+			},
+			want: []Entry{
+				{ID: 1, DeduplicationID: "a", Type: EntryPaymentSucceeded, PaymentID: 1, Lines: succeeded},
+				{ID: 2, DeduplicationID: "b", Type: EntryPaymentReversed, PaymentID: 1, Lines: []Line{
+					{Account: AccountCustomerReceivable, Amount: thb(-2000)},
+					{Account: AccountMerchantBalance, Amount: thb(2000)},
+					{Account: AccountGatewayClearing, Amount: thb(-2000)},
+					{Account: AccountCustomerReceivable, Amount: thb(2000)},
+				}},
+			},
+		},
+		{
+			name: "fee charged after success, then reversed",
+			events: []*payment.Event{
+				newEvent("a", payment.EventStatusChanged, payment.StatusSuccessful, 2000, 2000),
+				newFeeChargedEvent("f", 2000, 73, 5),
+				newEvent("b", payment.EventStatusChanged, payment.StatusReversed, 2000, 2000),
+			},
+			want: []Entry{
+				{ID: 1, DeduplicationID: "a", Type: EntryPaymentSucceeded, PaymentID: 1, Lines: succeeded},
+				{ID: 2, DeduplicationID: "f", Type: EntryFeeCharged, PaymentID: 1, Lines: []Line{
+					{Account: AccountFees, Amount: thb(78)},
+					{Account: AccountGatewayClearing, Amount: thb(-78)},
+				}},
+				{ID: 3, DeduplicationID: "b", Type: EntryPaymentReversed, PaymentID: 1, Lines: []Line{
+					{Account: AccountCustomerReceivable, Amount: thb(-2000)},
+					{Account: AccountMerchantBalance, Amount: thb(2000)},
+					{Account: AccountGatewayClearing, Amount: thb(-2000)},
+					{Account: AccountCustomerReceivable, Amount: thb(2000)},
+					{Account: AccountFees, Amount: thb(-78)},
+					{Account: AccountGatewayClearing, Amount: thb(78)},
+				}},
+			},
+		},
+		{
+			name:   "reversed without success",
+			events: []*payment.Event{newEvent("b", payment.EventStatusChanged, payment.StatusReversed, 2000, 0)},
+		},
+		{
+			name: "refunded",
+			events: []*payment.Event{
+				{DeduplicationID: "c", Type: payment.EventRefunded, PaymentID: 1, Amount: thb(500)},
+			},
+			want: []Entry{
+				{ID: 1, DeduplicationID: "c", Type: EntryPaymentRefunded, PaymentID: 1, Lines: []Line{
+					{Account: AccountRefunds, Amount: thb(500)},
+					{Account: AccountGatewayClearing, Amount: thb(-500)},
+				}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &mockRepository{}
+			s := NewService(repo)
+			for _, e := range tt.events {
+				if err := s.Publish(e); err != nil {
+					t.Fatalf("service.Publish() error = %v", err)
+				}
+			}
+			if !reflect.DeepEqual(repo.Entries, tt.want) {
+				t.Errorf("service.Publish() entries = %+v, want %+v", repo.Entries, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_Balances(t *testing.T) {
+	repo := &mockRepository{}
+	s := NewService(repo)
+	for _, e := range []*payment.Event{
+		newPaidEvent("a", 2000, 73, 5),
+		{DeduplicationID: "b", Type: payment.EventRefunded, PaymentID: 1, Amount: thb(500)},
+	} {
+		if err := s.Publish(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := s.Balances()
+	if err != nil {
+		t.Fatalf("service.Balances() error = %v", err)
+	}
+	want := []Balance{
+		{Account: AccountCustomerReceivable, Amount: thb(0)},
+		{Account: AccountFees, Amount: thb(78)},
+		{Account: AccountGatewayClearing, Amount: thb(1422)},
+		{Account: AccountMerchantBalance, Amount: thb(-2000)},
+		{Account: AccountRefunds, Amount: thb(500)},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("service.Balances() = %v, want %v", got, want)
+	}
+}
+
+func TestService_Check(t *testing.T) {
+	repo := &mockRepository{Entries: []Entry{
+		{ID: 1, Lines: []Line{{Account: AccountGatewayClearing, Amount: thb(100)}, {Account: AccountMerchantBalance, Amount: thb(-100)}}},
+		{ID: 2, Lines: []Line{{Account: AccountGatewayClearing, Amount: payment.NewMoney(100, "USD")}}},
+	}}
+	s := NewService(repo)
+
+	got, err := s.Check()
+	if err != nil {
+		t.Fatalf("service.Check() error = %v", err)
+	}
+	if want := []payment.Money{payment.NewMoney(100, "USD")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("service.Check() = %v, want %v", got, want)
+	}
+}
+
+func TestCheckBalanced(t *testing.T) {
+	if err := checkBalanced([]Line{{Account: AccountFees, Amount: thb(1)}}); err != ErrUnbalanced {
+		t.Errorf("checkBalanced() error = %v, want %v", err, ErrUnbalanced)
+	}
+	if err := checkBalanced([]Line{{Account: AccountFees, Amount: thb(1)}, {Account: AccountGatewayClearing, Amount: thb(-1)}}); err != nil {
+		t.Errorf("checkBalanced() error = %v", err)
+	}
+}
@@ -1,31 +1,145 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+	// the time zone database is embedded since the docker image has none.
+	_ "time/tzdata"
 
 	"github.com/gorilla/mux"
+	"github.com/noppawitt/paymentsvc/apikey"
+	"github.com/noppawitt/paymentsvc/broker"
 	"github.com/noppawitt/paymentsvc/client"
 	"github.com/noppawitt/paymentsvc/handler"
 	"github.com/noppawitt/paymentsvc/inmem"
+	"github.com/noppawitt/paymentsvc/ledger"
 	"github.com/noppawitt/paymentsvc/payment"
+	"github.com/noppawitt/paymentsvc/paymentlink"
+	"github.com/noppawitt/paymentsvc/reconcile"
+	"github.com/noppawitt/paymentsvc/report"
+	"github.com/noppawitt/paymentsvc/subscription"
+	"github.com/noppawitt/paymentsvc/webhook"
 )
 
-const defaultPort = "8080"
+const (
+	defaultPort                          = "8080"
+	defaultReturnURISchemes              = "https"
+	defaultSubscriptionMaxAttempts       = "3"
+	defaultSubscriptionRetryInterval     = "24h"
+	defaultSubscriptionSchedulerInterval = "1m"
+	defaultWebhookMaxAttempts            = "8"
+	defaultWebhookRetryInterval          = "1m"
+	defaultWebhookMaxRetryInterval       = "6h"
+	defaultWebhookTimeout                = "10s"
+	defaultWebhookDispatcherInterval     = "10s"
+	defaultEventRelayInterval            = "1s"
+	defaultEventRelayBatchSize           = "100"
+	defaultEventRelayMaxAttempts         = "10"
+	defaultKafkaTopic                    = "payment-events"
+	defaultNATSSubject                   = "payments"
+	defaultBrokerTimeout                 = "10s"
+	defaultReportTimezone                = "Asia/Bangkok"
+)
 
 func main() {
 	omisePublicKey := mustGetEnv("OMISE_PUBLIC_KEY")
 	omiseSecretKey := mustGetEnv("OMISE_SECRET_KEY")
 	port := getEnv("PORT", defaultPort)
+	publicURL := getEnv("PUBLIC_URL", "http://localhost:"+port)
+	returnSignatureSecret := getEnv("RETURN_SIGNATURE_SECRET", "")
+	returnURISchemes := splitList(getEnv("RETURN_URI_SCHEMES", defaultReturnURISchemes))
+	returnURIHosts := splitList(getEnv("RETURN_URI_HOSTS", ""))
+	subscriptionReturnURI := getEnv("SUBSCRIPTION_RETURN_URI", "")
+	subscriptionMaxAttempts := mustAtoi("SUBSCRIPTION_MAX_ATTEMPTS", getEnv("SUBSCRIPTION_MAX_ATTEMPTS", defaultSubscriptionMaxAttempts))
+	subscriptionRetryInterval := mustParseDuration("SUBSCRIPTION_RETRY_INTERVAL", getEnv("SUBSCRIPTION_RETRY_INTERVAL", defaultSubscriptionRetryInterval))
+	subscriptionSchedulerInterval := mustParseDuration("SUBSCRIPTION_SCHEDULER_INTERVAL", getEnv("SUBSCRIPTION_SCHEDULER_INTERVAL", defaultSubscriptionSchedulerInterval))
+	webhookMaxAttempts := mustAtoi("WEBHOOK_MAX_ATTEMPTS", getEnv("WEBHOOK_MAX_ATTEMPTS", defaultWebhookMaxAttempts))
+	webhookRetryInterval := mustParseDuration("WEBHOOK_RETRY_INTERVAL", getEnv("WEBHOOK_RETRY_INTERVAL", defaultWebhookRetryInterval))
+	webhookMaxRetryInterval := mustParseDuration("WEBHOOK_MAX_RETRY_INTERVAL", getEnv("WEBHOOK_MAX_RETRY_INTERVAL", defaultWebhookMaxRetryInterval))
+	webhookTimeout := mustParseDuration("WEBHOOK_TIMEOUT", getEnv("WEBHOOK_TIMEOUT", defaultWebhookTimeout))
+	webhookDispatcherInterval := mustParseDuration("WEBHOOK_DISPATCHER_INTERVAL", getEnv("WEBHOOK_DISPATCHER_INTERVAL", defaultWebhookDispatcherInterval))
+	eventRelayInterval := mustParseDuration("EVENT_RELAY_INTERVAL", getEnv("EVENT_RELAY_INTERVAL", defaultEventRelayInterval))
+	eventRelayBatchSize := mustAtoi("EVENT_RELAY_BATCH_SIZE", getEnv("EVENT_RELAY_BATCH_SIZE", defaultEventRelayBatchSize))
+	eventRelayMaxAttempts := mustAtoi("EVENT_RELAY_MAX_ATTEMPTS", getEnv("EVENT_RELAY_MAX_ATTEMPTS", defaultEventRelayMaxAttempts))
+	kafkaBrokers := splitList(getEnv("KAFKA_BROKERS", ""))
+	kafkaTopic := getEnv("KAFKA_TOPIC", defaultKafkaTopic)
+	natsURL := getEnv("NATS_URL", "")
+	natsSubject := getEnv("NATS_SUBJECT", defaultNATSSubject)
+	natsJetStream := mustParseBool("NATS_JETSTREAM", getEnv("NATS_JETSTREAM", "false"))
+	brokerTimeout := mustParseDuration("BROKER_TIMEOUT", getEnv("BROKER_TIMEOUT", defaultBrokerTimeout))
+	reportLocation := mustLoadLocation("REPORT_TIMEZONE", getEnv("REPORT_TIMEZONE", defaultReportTimezone))
+	adminOperators := mustParseOperators("ADMIN_TOKENS", getEnv("ADMIN_TOKENS", ""))
+	requireAPIKeys := mustParseBool("REQUIRE_API_KEYS", getEnv("REQUIRE_API_KEYS", "false"))
+	riskVelocityRules := mustParseVelocityRules("RISK_VELOCITY_LIMITS", getEnv("RISK_VELOCITY_LIMITS", ""))
+	riskAmountCeilingRules := mustParseAmountCeilingRules("RISK_AMOUNT_CEILINGS", getEnv("RISK_AMOUNT_CEILINGS", ""))
+	riskBlockedReturnURIDomains := splitList(getEnv("RISK_BLOCKED_RETURN_URI_DOMAINS", ""))
+	riskBlockedCountries := splitList(strings.ToUpper(getEnv("RISK_BLOCKED_COUNTRIES", "")))
+	riskReviewCountries := splitList(strings.ToUpper(getEnv("RISK_REVIEW_COUNTRIES", "")))
+	installmentRates := mustParseInstallmentRates("INSTALLMENT_RATES", getEnv("INSTALLMENT_RATES", ""))
 
-	client := client.NewOmise(omisePublicKey, omiseSecretKey)
+	// without a secret the payment result is not signed, so the payer returns to the merchant's return URI directly
+	// as before the return page existed.
+	returnURL := ""
+	if returnSignatureSecret != "" {
+		returnURL = publicURL + "/return"
+	}
+	client := client.NewOmise(omisePublicKey, omiseSecretKey, returnURL)
 
 	paymentRepo := inmem.NewPaymentRepository()
+	customerRepo := inmem.NewCustomerRepository()
+	paymentLinkRepo := inmem.NewPaymentLinkRepository()
+	webhookRepo := inmem.NewWebhookRepository()
+	ledgerRepo := inmem.NewLedgerRepository()
+	apiKeyRepo := inmem.NewAPIKeyRepository()
+
+	paymentValidator := payment.NewValidator(returnURISchemes, returnURIHosts, installmentRates)
+
+	// the risk of payment requests is only evaluated if there are rules, since card payments are looked up for it.
+	riskRules := append(riskVelocityRules, riskAmountCeilingRules...)
+	if len(riskBlockedReturnURIDomains) > 0 {
+		riskRules = append(riskRules, &payment.ReturnURIDomainRule{Domains: riskBlockedReturnURIDomains, Decision: payment.RiskBlock})
+	}
+	if len(riskBlockedCountries) > 0 {
+		riskRules = append(riskRules, &payment.CardCountryRule{Countries: riskBlockedCountries, Decision: payment.RiskBlock})
+	}
+	if len(riskReviewCountries) > 0 {
+		riskRules = append(riskRules, &payment.CardCountryRule{Countries: riskReviewCountries, Decision: payment.RiskReview})
+	}
+	var riskEvaluator payment.RiskEvaluator
+	if len(riskRules) > 0 {
+		riskEvaluator = payment.NewRiskEngine(riskRules)
+	}
 
-	paymentSvc := payment.NewService(client, paymentRepo)
+	webhookSvc := webhook.NewService(webhookRepo, webhook.Config{
+		MaxAttempts:      webhookMaxAttempts,
+		RetryInterval:    webhookRetryInterval,
+		MaxRetryInterval: webhookMaxRetryInterval,
+		Timeout:          webhookTimeout,
+	})
+	ledgerSvc := ledger.NewService(ledgerRepo)
+	paymentSvc := payment.NewService(client, paymentRepo, customerRepo, paymentValidator, riskEvaluator)
+	customerSvc := payment.NewCustomerService(client, customerRepo)
+	paymentLinkSvc := paymentlink.NewService(paymentSvc, paymentLinkRepo, paymentValidator)
+	reconcileSvc := reconcile.NewService(paymentSvc, client, paymentRepo)
+	reportSvc := report.NewService(paymentRepo)
+	apiKeySvc := apikey.NewService(apiKeyRepo)
 
 	paymentHandler := handler.NewPayment(paymentSvc)
+	paymentMethodHandler := handler.NewPaymentMethod(paymentSvc)
+	customerHandler := handler.NewCustomer(customerSvc)
+	paymentLinkHandler := handler.NewPaymentLink(paymentLinkSvc, publicURL)
+	checkoutHandler := handler.NewCheckout(paymentLinkSvc, omisePublicKey)
+	returnHandler := handler.NewReturn(paymentSvc, []byte(returnSignatureSecret))
+	webhookEndpointHandler := handler.NewWebhookEndpoint(webhookSvc)
+	webhookEventHandler := handler.NewWebhookEvent(webhookSvc)
+	ledgerHandler := handler.NewLedger(ledgerSvc)
+	reconciliationHandler := handler.NewReconciliation(reconcileSvc)
+	reportHandler := handler.NewReport(reportSvc, reportLocation)
 
 	router := mux.NewRouter()
 	router.HandleFunc("/", func(w http.ResponseWriter, _ *http.Request) {
@@ -35,6 +149,110 @@ func main() {
 	paymentRouter := router.PathPrefix("/payments").Subrouter()
 	paymentHandler.Append(paymentRouter)
 
+	paymentMethodRouter := router.PathPrefix("/payment-methods").Subrouter()
+	paymentMethodHandler.Append(paymentMethodRouter)
+
+	customerRouter := router.PathPrefix("/customers").Subrouter()
+	customerHandler.Append(customerRouter)
+
+	paymentLinkRouter := router.PathPrefix("/payment-links").Subrouter()
+	paymentLinkHandler.Append(paymentLinkRouter)
+
+	checkoutRouter := router.PathPrefix("/l").Subrouter()
+	checkoutHandler.Append(checkoutRouter)
+
+	returnRouter := router.PathPrefix("/return").Subrouter()
+	returnHandler.Append(returnRouter)
+
+	// webhook endpoints receive the payments of every merchant, so they are managed by operators only
+	// and cannot be used without operator tokens.
+	webhookEndpointRouter := router.PathPrefix("/webhook-endpoints").Subrouter()
+	webhookEndpointRouter.Use(handler.Authenticate(adminOperators))
+	webhookEndpointHandler.Append(webhookEndpointRouter)
+
+	webhookEventRouter := router.PathPrefix("/webhook-events").Subrouter()
+	webhookEventRouter.Use(handler.Authenticate(adminOperators))
+	webhookEventHandler.Append(webhookEventRouter)
+
+	ledgerRouter := router.PathPrefix("/ledger").Subrouter()
+	ledgerHandler.Append(ledgerRouter)
+
+	reportRouter := router.PathPrefix("/reports").Subrouter()
+	reportHandler.Append(reportRouter)
+
+	// the admin API changes payments without the payment gateway, so it is only enabled with operator tokens.
+	if len(adminOperators) > 0 {
+		adminRouter := router.PathPrefix("/admin").Subrouter()
+		adminRouter.Use(handler.Authenticate(adminOperators))
+		handler.NewAdmin(paymentSvc).Append(adminRouter)
+		handler.NewAPIKey(apiKeySvc).Append(adminRouter.PathPrefix("/api-keys").Subrouter())
+		reconciliationHandler.Append(adminRouter.PathPrefix("/reconciliations").Subrouter())
+	}
+
+	// the routes which move money or serve operators, the captures, voids, refunds and refreshes of payments,
+	// the ledger and the reports, require an API key or an operator token even if API keys are not required,
+	// so that they are closed rather than open in a deployment which sets up neither.
+	ledgerRouter.Use(handler.RequireCredential(apiKeySvc, adminOperators, true))
+	reportRouter.Use(handler.RequireCredential(apiKeySvc, adminOperators, true))
+
+	// API keys are created through the admin API, so they can only be required with operator tokens.
+	if requireAPIKeys {
+		if len(adminOperators) == 0 {
+			log.Fatal("REQUIRE_API_KEYS requires ADMIN_TOKENS to create the API keys")
+		}
+		for _, r := range []*mux.Router{paymentRouter, paymentMethodRouter, customerRouter, paymentLinkRouter} {
+			r.Use(handler.RequireAPIKey(apiKeySvc))
+		}
+	} else {
+		paymentRouter.Use(handler.RequireCredential(apiKeySvc, adminOperators, false))
+	}
+
+	dispatcher := webhook.NewDispatcher(webhookSvc, webhookDispatcherInterval)
+	go dispatcher.Run(context.Background())
+
+	// the payment repository is the outbox of the payment events, they are posted to the ledger
+	// and published to webhooks and to the message brokers which are configured.
+	// Every publisher has its own relay, so that a publisher which is down does not hold back the others.
+	publishers := map[string]payment.Publisher{"ledger": ledgerSvc, "webhook": webhookSvc}
+	if len(kafkaBrokers) > 0 {
+		publishers["kafka"] = broker.NewKafka(kafkaBrokers, kafkaTopic, brokerTimeout)
+	}
+	if natsURL != "" {
+		nats, err := broker.NewNATS(natsURL, natsSubject, natsJetStream, brokerTimeout)
+		if err != nil {
+			log.Fatal("connect to NATS: ", err)
+		}
+		publishers["nats"] = nats
+	}
+	for name, publisher := range publishers {
+		relay := payment.NewRelay(name, paymentRepo, publisher, eventRelayInterval, eventRelayBatchSize, eventRelayMaxAttempts)
+		go relay.Run(context.Background())
+	}
+
+	// subscriptions are charged without the payer, so they are only enabled with a return URI for their charges.
+	if subscriptionReturnURI != "" {
+		subscriptionRepo := inmem.NewSubscriptionRepository()
+		subscriptionSvc := subscription.NewService(paymentSvc, customerSvc, subscriptionRepo, subscription.Config{
+			ReturnURI:     subscriptionReturnURI,
+			MaxAttempts:   subscriptionMaxAttempts,
+			RetryInterval: subscriptionRetryInterval,
+		})
+
+		planRouter := router.PathPrefix("/plans").Subrouter()
+		handler.NewPlan(subscriptionSvc).Append(planRouter)
+
+		subscriptionRouter := router.PathPrefix("/subscriptions").Subrouter()
+		handler.NewSubscription(subscriptionSvc).Append(subscriptionRouter)
+
+		if requireAPIKeys {
+			planRouter.Use(handler.RequireAPIKey(apiKeySvc))
+			subscriptionRouter.Use(handler.RequireAPIKey(apiKeySvc))
+		}
+
+		scheduler := subscription.NewScheduler(subscriptionSvc, subscriptionSchedulerInterval)
+		go scheduler.Run(context.Background())
+	}
+
 	log.Println("Server is running on http://localhost:" + port)
 	log.Fatal(http.ListenAndServe(":"+port, router))
 }
@@ -54,3 +272,145 @@ func mustGetEnv(key string) string {
 	}
 	return val
 }
+
+// splitList splits a comma-separated list, ignoring empty items.
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func mustAtoi(key, s string) int {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		log.Fatal(key + " must be a number")
+	}
+	return n
+}
+
+func mustParseBool(key, s string) bool {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		log.Fatal(key + " must be true or false")
+	}
+	return b
+}
+
+func mustLoadLocation(key, s string) *time.Location {
+	loc, err := time.LoadLocation(s)
+	if err != nil {
+		log.Fatal(key + " must be a time zone such as Asia/Bangkok")
+	}
+	return loc
+}
+
+// mustParseOperators parses a comma-separated list of operators with their tokens, such as alice:token1,bob:token2.
+func mustParseOperators(key, s string) []handler.Operator {
+	var operators []handler.Operator
+	for _, item := range splitList(s) {
+		i := strings.Index(item, ":")
+		if i <= 0 || i == len(item)-1 {
+			log.Fatal(key + " must be a list of operator:token")
+		}
+		operators = append(operators, handler.Operator{Name: item[:i], Token: item[i+1:]})
+	}
+	return operators
+}
+
+// mustParseVelocityRules parses a comma-separated list of velocity limits as key:limit:window:decision,
+// such as ip:10:1h:block for at most 10 payments an hour from an IP address.
+func mustParseVelocityRules(key, s string) []payment.RiskRule {
+	var rules []payment.RiskRule
+	for _, item := range splitList(s) {
+		parts := strings.Split(item, ":")
+		if len(parts) != 4 {
+			log.Fatal(key + " must be a list of key:limit:window:decision")
+		}
+		velocityKey := payment.VelocityKey(parts[0])
+		if velocityKey != payment.VelocityCustomer && velocityKey != payment.VelocityIP && velocityKey != payment.VelocityCard {
+			log.Fatal(key + " keys must be customer, ip or card")
+		}
+		limit := mustAtoi(key, parts[1])
+		if limit < 1 {
+			log.Fatal(key + " limits must be positive")
+		}
+		rules = append(rules, &payment.VelocityRule{
+			Key:      velocityKey,
+			Limit:    limit,
+			Window:   mustParseDuration(key, parts[2]),
+			Decision: mustParseRiskDecision(key, parts[3]),
+		})
+	}
+	return rules
+}
+
+// mustParseAmountCeilingRules parses a comma-separated list of amount ceilings as source_type:currency:amount:decision,
+// such as card:THB:50000.00:review.
+func mustParseAmountCeilingRules(key, s string) []payment.RiskRule {
+	var rules []payment.RiskRule
+	for _, item := range splitList(s) {
+		parts := strings.Split(item, ":")
+		if len(parts) != 4 {
+			log.Fatal(key + " must be a list of source_type:currency:amount:decision")
+		}
+		ceiling, err := payment.ParseMoney(parts[2], strings.ToUpper(parts[1]))
+		if err != nil {
+			log.Fatal(key + " amounts must be decimals in a supported currency such as THB:50000.00")
+		}
+		rules = append(rules, &payment.AmountCeilingRule{
+			SourceType: parts[0],
+			Ceiling:    ceiling,
+			Decision:   mustParseRiskDecision(key, parts[3]),
+		})
+	}
+	return rules
+}
+
+// mustParseInstallmentRates parses a comma-separated list of installment rates as
+// source_type:interest_rate:min_monthly_amount, such as installment_kbank:65:3000.00 for 0.65% interest a month
+// and at least 3,000.00 THB a month.
+func mustParseInstallmentRates(key, s string) map[string]payment.InstallmentRate {
+	rates := make(map[string]payment.InstallmentRate)
+	for _, item := range splitList(s) {
+		parts := strings.Split(item, ":")
+		if len(parts) != 3 {
+			log.Fatal(key + " must be a list of source_type:interest_rate:min_monthly_amount")
+		}
+		if !payment.IsInstallmentSourceType(parts[0]) {
+			log.Fatal(key + " source types must be installment source types such as installment_kbank")
+		}
+		interestRate := mustAtoi(key, parts[1])
+		if interestRate < 0 {
+			log.Fatal(key + " interest rates must not be negative")
+		}
+		minMonthlyAmount, err := payment.ParseMoney(parts[2], "THB")
+		if err != nil {
+			log.Fatal(key + " minimum monthly amounts must be decimals in THB such as 3000.00")
+		}
+		rates[parts[0]] = payment.InstallmentRate{
+			InterestRate:     int64(interestRate),
+			MinMonthlyAmount: minMonthlyAmount.Amount,
+		}
+	}
+	return rates
+}
+
+func mustParseRiskDecision(key, s string) payment.RiskDecision {
+	decision := payment.RiskDecision(s)
+	if decision != payment.RiskReview && decision != payment.RiskBlock {
+		log.Fatal(key + " decisions must be review or block")
+	}
+	return decision
+}
+
+func mustParseDuration(key, s string) time.Duration {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		log.Fatal(key + " must be a duration such as 1h30m")
+	}
+	return d
+}
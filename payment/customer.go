@@ -0,0 +1,154 @@
+package payment
+
+import (
+	"fmt"
+	"time"
+)
+
+// CustomerService provides customer service methods.
+type CustomerService interface {
+	CreateCustomer(req *CustomerRequest) (*Customer, error)
+	FindCustomer(id int) (*Customer, error)
+	AttachCard(customerID int, cardToken string) (*SavedCard, error)
+	Cards(customerID int) ([]SavedCard, error)
+	DeleteCard(customerID int, cardID string) error
+}
+
+// Customer represents a returning payer whose cards are saved for later payments.
+// The cards are saved by the payment gateway under OmiseCustomerID, the service never stores them.
+type Customer struct {
+	ID              int
+	Email           string
+	Description     string
+	OmiseCustomerID string
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// SavedCard represents a card saved to a customer.
+// ID is the Omise card id, which is given as the card id to charge the card.
+type SavedCard struct {
+	ID string
+	Card
+	CreatedAt time.Time
+}
+
+// CustomerRequest contains details for creating a customer.
+type CustomerRequest struct {
+	Email       string
+	Description string
+}
+
+// CustomerRepository provides access to customers in a data source.
+type CustomerRepository interface {
+	Create(customer *Customer) error
+	Find(id int) (*Customer, error)
+}
+
+// CustomerClient provides methods for a payment gateway client to save cards of customers.
+type CustomerClient interface {
+	CreateCustomer(customer *Customer) (string, error)
+	AttachCard(omiseCustomerID, cardToken string) (*SavedCard, error)
+	Cards(omiseCustomerID string) ([]SavedCard, error)
+	DeleteCard(omiseCustomerID, cardID string) error
+}
+
+type customerService struct {
+	client CustomerClient
+	repo   CustomerRepository
+}
+
+// NewCustomerService returns a new customer service.
+func NewCustomerService(client CustomerClient, repo CustomerRepository) CustomerService {
+	return &customerService{
+		client: client,
+		repo:   repo,
+	}
+}
+
+// CreateCustomer creates a customer and its Omise customer.
+func (s *customerService) CreateCustomer(req *CustomerRequest) (*Customer, error) {
+	if err := validateCustomerRequest(req); err != nil {
+		return nil, err
+	}
+
+	customer := &Customer{
+		Email:       req.Email,
+		Description: req.Description,
+	}
+
+	omiseCustomerID, err := s.client.CreateCustomer(customer)
+	if err != nil {
+		return nil, err
+	}
+	customer.OmiseCustomerID = omiseCustomerID
+
+	if err := s.repo.Create(customer); err != nil {
+		return nil, err
+	}
+
+	return customer, nil
+}
+
+// FindCustomer finds a customer with the given customer id.
+func (s *customerService) FindCustomer(id int) (*Customer, error) {
+	return s.repo.Find(id)
+}
+
+// AttachCard saves the card of the card token to the customer.
+func (s *customerService) AttachCard(customerID int, cardToken string) (*SavedCard, error) {
+	verr := &ValidationError{}
+	if cardToken == "" {
+		verr.add(FieldCardToken, CodeRequired, "card_token is required")
+	} else if msg := invalidSourceField(FieldCardToken, cardToken); msg != "" {
+		verr.add(FieldCardToken, CodeInvalid, msg)
+	}
+	if len(verr.Errors) > 0 {
+		return nil, verr
+	}
+
+	customer, err := s.repo.Find(customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.client.AttachCard(customer.OmiseCustomerID, cardToken)
+}
+
+// Cards returns the cards saved to the customer.
+func (s *customerService) Cards(customerID int) ([]SavedCard, error) {
+	customer, err := s.repo.Find(customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.client.Cards(customer.OmiseCustomerID)
+}
+
+// DeleteCard deletes a card saved to the customer.
+func (s *customerService) DeleteCard(customerID int, cardID string) error {
+	customer, err := s.repo.Find(customerID)
+	if err != nil {
+		return err
+	}
+
+	return s.client.DeleteCard(customer.OmiseCustomerID, cardID)
+}
+
+func validateCustomerRequest(req *CustomerRequest) error {
+	verr := &ValidationError{}
+	if req.Email == "" {
+		verr.add(FieldEmail, CodeRequired, "email is required")
+	} else if msg := invalidSourceField(FieldEmail, req.Email); msg != "" {
+		verr.add(FieldEmail, CodeInvalid, msg)
+	}
+	if len(req.Description) > MaxDescriptionLength {
+		verr.add("description", CodeTooLong, fmt.Sprintf("description must not exceed %d characters", MaxDescriptionLength))
+	}
+
+	if len(verr.Errors) > 0 {
+		return verr
+	}
+	return nil
+}
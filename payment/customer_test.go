@@ -0,0 +1,152 @@
+package payment
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCustomerService_CreateCustomer(t *testing.T) {
+	tests := []struct {
+		name       string
+		req        *CustomerRequest
+		clientErr  error
+		want       *Customer
+		wantErr    error
+		wantCreate bool
+	}{
+		{
+			name: "success",
+			req:  &CustomerRequest{Email: "john@example.com", Description: "John"},
+			want: &Customer{
+				ID:              1,
+				Email:           "john@example.com",
+				Description:     "John",
+				OmiseCustomerID: "cust_test_1",
+				CreatedAt:       now,
+				UpdatedAt:       now,
+			},
+			wantCreate: true,
+		},
+		{
+			name:    "invalid email",
+			req:     &CustomerRequest{Email: "john"},
+			wantErr: ErrInvalidRequest,
+		},
+		{
+			name:      "client error",
+			req:       &CustomerRequest{Email: "john@example.com"},
+			clientErr: ErrGatewayUnavailable,
+			wantErr:   ErrGatewayUnavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockCustomerClient{}
+			repo := &mockCustomerRepository{}
+
+			client.CreateCustomerFn = func(customer *Customer) (string, error) {
+				return "cust_test_1", tt.clientErr
+			}
+			created := false
+			repo.CreateFn = func(customer *Customer) error {
+				created = true
+				customer.ID = 1
+				customer.CreatedAt = now
+				customer.UpdatedAt = now
+				return nil
+			}
+
+			s := NewCustomerService(client, repo)
+			got, err := s.CreateCustomer(tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("CustomerService.CreateCustomer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CustomerService.CreateCustomer() = %v, want %v", got, tt.want)
+			}
+			if created != tt.wantCreate {
+				t.Errorf("CustomerService.CreateCustomer() created = %v, want %v", created, tt.wantCreate)
+			}
+		})
+	}
+}
+
+func TestCustomerService_AttachCard(t *testing.T) {
+	savedCard := &SavedCard{ID: "card_test_1", Card: Card{Brand: "Visa", LastDigits: "4242"}}
+	tests := []struct {
+		name       string
+		customerID int
+		cardToken  string
+		want       *SavedCard
+		wantErr    error
+	}{
+		{
+			name:       "success",
+			customerID: 1,
+			cardToken:  "tokn_test_1",
+			want:       savedCard,
+		},
+		{
+			name:       "missing card token",
+			customerID: 1,
+			wantErr:    ErrInvalidRequest,
+		},
+		{
+			name:       "customer not found",
+			customerID: 2,
+			cardToken:  "tokn_test_1",
+			wantErr:    ErrCustomerNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockCustomerClient{}
+			repo := &mockCustomerRepository{}
+
+			repo.FindFn = func(id int) (*Customer, error) {
+				if id != 1 {
+					return nil, ErrCustomerNotFound
+				}
+				return &Customer{ID: 1, OmiseCustomerID: "cust_test_1"}, nil
+			}
+			client.AttachCardFn = func(omiseCustomerID, cardToken string) (*SavedCard, error) {
+				if omiseCustomerID != "cust_test_1" || cardToken != tt.cardToken {
+					t.Errorf("AttachCard() called with %v, %v", omiseCustomerID, cardToken)
+				}
+				return savedCard, nil
+			}
+
+			s := NewCustomerService(client, repo)
+			got, err := s.AttachCard(tt.customerID, tt.cardToken)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("CustomerService.AttachCard() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CustomerService.AttachCard() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCustomerService_DeleteCard(t *testing.T) {
+	client := &mockCustomerClient{}
+	repo := &mockCustomerRepository{}
+
+	repo.FindFn = func(id int) (*Customer, error) {
+		return &Customer{ID: id, OmiseCustomerID: "cust_test_1"}, nil
+	}
+	var deleted []string
+	client.DeleteCardFn = func(omiseCustomerID, cardID string) error {
+		deleted = append(deleted, omiseCustomerID+"/"+cardID)
+		return nil
+	}
+
+	s := NewCustomerService(client, repo)
+	if err := s.DeleteCard(1, "card_test_1"); err != nil {
+		t.Fatalf("CustomerService.DeleteCard() error = %v", err)
+	}
+	if want := []string{"cust_test_1/card_test_1"}; !reflect.DeepEqual(deleted, want) {
+		t.Errorf("CustomerService.DeleteCard() deleted %v, want %v", deleted, want)
+	}
+}
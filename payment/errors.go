@@ -0,0 +1,65 @@
+package payment
+
+// ErrorCode is a stable machine-readable code of an error.
+type ErrorCode string
+
+// Error codes
+const (
+	ErrorCodeNotFound           ErrorCode = "not_found"
+	ErrorCodeInvalidRequest     ErrorCode = "invalid_request"
+	ErrorCodeGatewayDeclined    ErrorCode = "gateway_declined"
+	ErrorCodeGatewayUnavailable ErrorCode = "gateway_unavailable"
+	ErrorCodeConflict           ErrorCode = "conflict"
+	ErrorCodeRiskBlocked        ErrorCode = "risk_blocked"
+	ErrorCodeUnauthorized       ErrorCode = "unauthorized"
+)
+
+// Error represents a domain error.
+// Err is the underlying error, e.g. the error returned by the payment gateway.
+type Error struct {
+	Code    ErrorCode
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return string(e.Code)
+	}
+	return e.Message
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the error has the same code as the target error kind.
+// A kind is an error without message such as ErrNotFound,
+// so errors.Is(ErrPaymentNotFound, ErrNotFound) is true.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Message == "" && t.Code == e.Code
+}
+
+// Error kinds
+var (
+	ErrNotFound           = &Error{Code: ErrorCodeNotFound}
+	ErrInvalidRequest     = &Error{Code: ErrorCodeInvalidRequest}
+	ErrGatewayDeclined    = &Error{Code: ErrorCodeGatewayDeclined}
+	ErrGatewayUnavailable = &Error{Code: ErrorCodeGatewayUnavailable}
+	ErrConflict           = &Error{Code: ErrorCodeConflict}
+	ErrRiskBlocked        = &Error{Code: ErrorCodeRiskBlocked}
+	ErrUnauthorized       = &Error{Code: ErrorCodeUnauthorized}
+)
+
+// Errors
+var (
+	ErrPaymentNotFound    = &Error{Code: ErrorCodeNotFound, Message: "payment not found"}
+	ErrDuplicateReference = &Error{Code: ErrorCodeConflict, Message: "payment with the given reference already exists"}
+	ErrNotAuthorized      = &Error{Code: ErrorCodeConflict, Message: "payment is not authorized"}
+	ErrNotPaid            = &Error{Code: ErrorCodeConflict, Message: "payment is not paid"}
+	ErrFullyRefunded      = &Error{Code: ErrorCodeConflict, Message: "payment is fully refunded"}
+	ErrCustomerNotFound   = &Error{Code: ErrorCodeNotFound, Message: "customer not found"}
+	ErrEventNotFound      = &Error{Code: ErrorCodeNotFound, Message: "payment event not found"}
+)
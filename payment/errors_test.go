@@ -0,0 +1,60 @@
+package payment
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestError_Is(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		target error
+		want   bool
+	}{
+		{
+			name:   "same error",
+			err:    ErrPaymentNotFound,
+			target: ErrPaymentNotFound,
+			want:   true,
+		},
+		{
+			name:   "error of kind",
+			err:    ErrPaymentNotFound,
+			target: ErrNotFound,
+			want:   true,
+		},
+		{
+			name:   "wrapped error of kind",
+			err:    fmt.Errorf("find payment: %w", ErrDuplicateReference),
+			target: ErrConflict,
+			want:   true,
+		},
+		{
+			name:   "error of another kind",
+			err:    ErrPaymentNotFound,
+			target: ErrConflict,
+			want:   false,
+		},
+		{
+			name:   "errors of the same kind",
+			err:    &Error{Code: ErrorCodeNotFound, Message: "customer not found"},
+			target: ErrPaymentNotFound,
+			want:   false,
+		},
+		{
+			name:   "validation error",
+			err:    &ValidationError{},
+			target: ErrInvalidRequest,
+			want:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errors.Is(tt.err, tt.target); got != tt.want {
+				t.Errorf("errors.Is() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
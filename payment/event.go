@@ -0,0 +1,104 @@
+package payment
+
+import (
+	"fmt"
+	"time"
+)
+
+// EventType is the type of a payment domain event.
+type EventType string
+
+// Event types
+const (
+	EventCreated       EventType = "payment.created"
+	EventStatusChanged EventType = "payment.status_changed"
+	EventRefunded      EventType = "payment.refunded"
+	// EventFeeCharged is recorded when the fee of a paid payment becomes known after the payment succeeded,
+	// the fee of a payment which succeeds with its fee known is in its status changed event.
+	EventFeeCharged EventType = "payment.fee_charged"
+)
+
+// Event represents a change of a payment. The repository records it in its outbox in the same write as the change,
+// so that an event is never lost nor recorded for a change which was not stored.
+// Payment is the payment after the change and PreviousStatus is its status before a status change.
+// RefundID and Amount are the Omise refund id and the refunded amount of a refunded event.
+// Events are published at least once, DeduplicationID is the same for every publication of an event
+// and for the same change recorded twice, consumers ignore the events with a deduplication id they have seen.
+// The deduplication id of a status change has the number of status changes before it, since a payment may change
+// to a status it had before, e.g. when an operator corrects an override.
+// Published is the time the event was published by each relay, by the name of the relay.
+// Parked is the time each relay gave up publishing the event, by the name of the relay.
+type Event struct {
+	ID              int
+	DeduplicationID string
+	Type            EventType
+	PaymentID       int
+	PreviousStatus  Status
+	RefundID        string
+	Amount          Money
+	Payment         Payment
+	CreatedAt       time.Time
+	Published       map[string]time.Time
+	Parked          map[string]time.Time
+}
+
+// Outbox provides access the events recorded by the repository. Every relay keeps its own position in the outbox,
+// so that a relay whose publisher fails does not hold back the other relays.
+// FindUnpublishedEvents returns the events which the relay with the given name has not published yet
+// in the order they were recorded.
+// MarkEventPublished moves the position of the relay past the event.
+// ParkEvent moves the position of the relay past an event which it could not publish, the event is kept as parked.
+type Outbox interface {
+	FindUnpublishedEvents(relay string, limit int) ([]*Event, error)
+	MarkEventPublished(relay string, id int, publishedAt time.Time) error
+	ParkEvent(relay string, id int, parkedAt time.Time) error
+}
+
+// Publisher publishes payment events to other systems, e.g. a message broker.
+type Publisher interface {
+	Publish(event *Event) error
+}
+
+func newCreatedEvent(paymentID int) *Event {
+	return &Event{
+		DeduplicationID: fmt.Sprintf("%s:%d", EventCreated, paymentID),
+		Type:            EventCreated,
+		PaymentID:       paymentID,
+	}
+}
+
+func newRefundedEvent(paymentID int, refund *Refund) *Event {
+	return &Event{
+		DeduplicationID: fmt.Sprintf("%s:%d:%s", EventRefunded, paymentID, refund.ID),
+		Type:            EventRefunded,
+		PaymentID:       paymentID,
+		RefundID:        refund.ID,
+		Amount:          refund.Amount,
+	}
+}
+
+// newFeeChargedEvent returns the event of the fee of a paid payment which was not known before, or nil.
+func newFeeChargedEvent(paymentID int, previous, charge *OmiseCharge) *Event {
+	paid := charge.Status == StatusSuccessful || charge.Status == StatusCaptured
+	if !paid || charge.Fee.IsZero() || !previous.Fee.IsZero() {
+		return nil
+	}
+	return &Event{
+		DeduplicationID: fmt.Sprintf("%s:%d", EventFeeCharged, paymentID),
+		Type:            EventFeeCharged,
+		PaymentID:       paymentID,
+	}
+}
+
+// newStatusChangedEvent returns the event of a change of the status of the payment, or nil if the status did not change.
+func newStatusChangedEvent(payment *Payment, status Status) *Event {
+	if status == payment.Status {
+		return nil
+	}
+	return &Event{
+		DeduplicationID: fmt.Sprintf("%s:%d:%s->%s:%d", EventStatusChanged, payment.ID, payment.Status, status, payment.StatusChanges+1),
+		Type:            EventStatusChanged,
+		PaymentID:       payment.ID,
+		PreviousStatus:  payment.Status,
+	}
+}
@@ -0,0 +1,27 @@
+package payment
+
+import "time"
+
+// exportPageSize is the number of payments read from the data source at a time by Export.
+const exportPageSize = 500
+
+// Export calls fn with every payment created in [from, to) in the order of their ids, stopping at the first error.
+// The payments are read a page at a time, so they are never all in memory however many there are.
+func (s *service) Export(from, to time.Time, fn func(payment *Payment) error) error {
+	afterID := 0
+	for {
+		payments, err := s.repo.Search(&Query{From: from, To: to, AfterID: afterID, Limit: exportPageSize})
+		if err != nil {
+			return err
+		}
+		for _, p := range payments {
+			if err := fn(p); err != nil {
+				return err
+			}
+		}
+		if len(payments) < exportPageSize {
+			return nil
+		}
+		afterID = payments[len(payments)-1].ID
+	}
+}
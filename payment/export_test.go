@@ -0,0 +1,54 @@
+package payment
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestService_Export(t *testing.T) {
+	from := time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 7)
+	// two full pages and a partial one.
+	count := 2*exportPageSize + 1
+
+	repo := &mockRepository{}
+	repo.SearchFn = func(q *Query) ([]*Payment, error) {
+		if !q.From.Equal(from) || !q.To.Equal(to) || q.Limit != exportPageSize {
+			t.Errorf("Search() called with %+v", q)
+		}
+		var payments []*Payment
+		for id := q.AfterID + 1; id <= count && len(payments) < q.Limit; id++ {
+			payments = append(payments, &Payment{ID: id})
+		}
+		return payments, nil
+	}
+
+	s := NewService(nil, repo, nil, testValidator, nil)
+	var got []int
+	err := s.Export(from, to, func(p *Payment) error {
+		got = append(got, p.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Service.Export() error = %v", err)
+	}
+	want := make([]int, count)
+	for i := range want {
+		want[i] = i + 1
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Service.Export() exported %v payments, want %v", len(got), len(want))
+	}
+
+	errWrite := errors.New("write error")
+	calls := 0
+	err = s.Export(from, to, func(p *Payment) error {
+		calls++
+		return errWrite
+	})
+	if err != errWrite || calls != 1 {
+		t.Errorf("Service.Export() error = %v after %v calls, want %v after 1 call", err, calls, errWrite)
+	}
+}
@@ -0,0 +1,88 @@
+package payment
+
+import (
+	"sort"
+	"time"
+)
+
+// FeeSummary represents the fees of the payments paid on a day in a currency with a source type.
+// Date is the day in the YYYY-MM-DD format.
+type FeeSummary struct {
+	Date       string
+	Currency   string
+	SourceType string
+	Count      int
+	Amount     Money
+	Fee        Money
+	FeeVAT     Money
+	Net        Money
+}
+
+// FeeSummaries returns the fees of the payments paid in [from, to) summed by day, currency and source type,
+// sorted in the same order. The days are in the given location.
+func (s *service) FeeSummaries(from, to time.Time, loc *time.Location) ([]FeeSummary, error) {
+	payments, err := s.repo.FindPaid(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	type key struct {
+		date       string
+		currency   string
+		sourceType string
+	}
+	summaries := make(map[key]*FeeSummary)
+	for _, p := range payments {
+		charge := p.OmiseCharge
+		k := key{charge.PaidAt.In(loc).Format("2006-01-02"), p.Amount.Currency, charge.SourceType}
+		summary, ok := summaries[k]
+		if !ok {
+			zero := NewMoney(0, k.currency)
+			summary = &FeeSummary{
+				Date:       k.date,
+				Currency:   k.currency,
+				SourceType: k.sourceType,
+				Amount:     zero,
+				Fee:        zero,
+				FeeVAT:     zero,
+				Net:        zero,
+			}
+			summaries[k] = summary
+		}
+
+		summary.Count++
+		for _, sum := range []struct {
+			total *Money
+			m     Money
+		}{
+			{&summary.Amount, p.PaidAmount()},
+			{&summary.Fee, charge.Fee},
+			{&summary.FeeVAT, charge.FeeVAT},
+			{&summary.Net, charge.Net},
+		} {
+			// the fees of a charge which is not paid yet are zero without a currency.
+			if sum.m.IsZero() {
+				continue
+			}
+			if *sum.total, err = sum.total.Add(sum.m); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	res := make([]FeeSummary, 0, len(summaries))
+	for _, summary := range summaries {
+		res = append(res, *summary)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		a, b := res[i], res[j]
+		if a.Date != b.Date {
+			return a.Date < b.Date
+		}
+		if a.Currency != b.Currency {
+			return a.Currency < b.Currency
+		}
+		return a.SourceType < b.SourceType
+	})
+	return res, nil
+}
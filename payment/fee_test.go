@@ -0,0 +1,58 @@
+package payment
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestService_FeeSummaries(t *testing.T) {
+	bangkok := time.FixedZone("Asia/Bangkok", 7*60*60)
+	paid := func(id int, sourceType string, amount, captured, fee, vat int64, paidAt time.Time) *Payment {
+		return &Payment{
+			ID:     id,
+			Status: StatusSuccessful,
+			Amount: NewMoney(amount, "THB"),
+			OmiseCharge: &OmiseCharge{
+				SourceType:     sourceType,
+				CapturedAmount: NewMoney(captured, "THB"),
+				Fee:            NewMoney(fee, "THB"),
+				FeeVAT:         NewMoney(vat, "THB"),
+				Net:            NewMoney(captured-fee-vat, "THB"),
+				PaidAt:         paidAt,
+			},
+		}
+	}
+	day := time.Date(2021, 2, 1, 0, 0, 0, 0, bangkok)
+	from, to := day, day.AddDate(0, 0, 2)
+
+	repo := &mockRepository{}
+	repo.FindPaidFn = func(gotFrom, gotTo time.Time) ([]*Payment, error) {
+		if !gotFrom.Equal(from) || !gotTo.Equal(to) {
+			t.Errorf("FindPaid() called with %v, %v", gotFrom, gotTo)
+		}
+		return []*Payment{
+			paid(1, "card", 10000, 10000, 365, 26, day.Add(time.Hour)),
+			paid(2, "card", 20000, 15000, 548, 38, day.Add(23*time.Hour)),
+			paid(3, "promptpay", 10000, 10000, 165, 12, day.Add(2*time.Hour)),
+			// paid after midnight in Bangkok, before it in UTC.
+			paid(4, "card", 10000, 10000, 365, 26, day.Add(25*time.Hour)),
+		}, nil
+	}
+
+	s := NewService(nil, repo, nil, testValidator, nil)
+	got, err := s.FeeSummaries(from, to, bangkok)
+	if err != nil {
+		t.Fatalf("Service.FeeSummaries() error = %v", err)
+	}
+
+	thb := func(amount int64) Money { return NewMoney(amount, "THB") }
+	want := []FeeSummary{
+		{Date: "2021-02-01", Currency: "THB", SourceType: "card", Count: 2, Amount: thb(25000), Fee: thb(913), FeeVAT: thb(64), Net: thb(24023)},
+		{Date: "2021-02-01", Currency: "THB", SourceType: "promptpay", Count: 1, Amount: thb(10000), Fee: thb(165), FeeVAT: thb(12), Net: thb(9823)},
+		{Date: "2021-02-02", Currency: "THB", SourceType: "card", Count: 1, Amount: thb(10000), Fee: thb(365), FeeVAT: thb(26), Net: thb(9609)},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Service.FeeSummaries() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,205 @@
+package payment
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// installmentPlan contains the terms a bank offers for installment payments.
+// InterestRate is the monthly interest rate charged to the payer in basis points, e.g. 80 is 0.8% per month.
+// MinMonthlyAmount is the minimum amount the payer pays each month excluding interest, zero if it is not known.
+// Estimated reports whether the interest rate is a built-in estimate instead of a configured rate.
+type installmentPlan struct {
+	Terms            []int
+	InterestRate     int64
+	MinMonthlyAmount int64
+	Estimated        bool
+}
+
+// InstallmentRate contains the monthly interest rate in basis points and the minimum monthly amount in satang
+// of the installments of a bank, as agreed between the merchant and the payment gateway.
+type InstallmentRate struct {
+	InterestRate     int64
+	MinMonthlyAmount int64
+}
+
+// installmentPlans contains the installment plans of the installment source types.
+// Omise lists the terms enabled for the account in its capability API, but not the interest rates nor the minimum
+// monthly amounts, which depend on the merchant's contract and the bank's promotions. The interest rates here are
+// rough estimates until the rates are configured, and there is no minimum monthly amount; Omise rejects a payment
+// below the bank's minimum when it is created.
+var installmentPlans = map[string]installmentPlan{
+	"installment_bay":          {Terms: []int{3, 4, 6, 9, 10}, InterestRate: 80, Estimated: true},
+	"installment_bbl":          {Terms: []int{4, 6, 8, 9, 10}, InterestRate: 80, Estimated: true},
+	"installment_first_choice": {Terms: []int{3, 4, 6, 9, 10, 12, 18, 24, 30, 36}, InterestRate: 130, Estimated: true},
+	"installment_kbank":        {Terms: []int{3, 4, 6, 10}, InterestRate: 65, Estimated: true},
+	"installment_ktc":          {Terms: []int{3, 4, 5, 6, 7, 8, 9, 10}, InterestRate: 80, Estimated: true},
+	"installment_scb":          {Terms: []int{3, 4, 6, 9, 10}, InterestRate: 74, Estimated: true},
+	"installment_uob":          {Terms: []int{3, 4, 6, 10}, InterestRate: 64, Estimated: true},
+}
+
+// IsInstallmentSourceType reports whether the source type is paid in installments.
+func IsInstallmentSourceType(sourceType string) bool {
+	_, ok := installmentPlans[sourceType]
+	return ok
+}
+
+// installmentPlan returns the installment plan of the source type with its configured rate, if any.
+func (v *Validator) installmentPlan(sourceType string) (installmentPlan, bool) {
+	plan, ok := installmentPlans[sourceType]
+	if !ok {
+		return installmentPlan{}, false
+	}
+	if rate, ok := v.installmentRates[sourceType]; ok {
+		plan.InterestRate = rate.InterestRate
+		plan.MinMonthlyAmount = rate.MinMonthlyAmount
+		plan.Estimated = false
+	}
+	return plan, true
+}
+
+// allowsTerm reports whether the plan offers the term.
+func (p installmentPlan) allowsTerm(term int) bool {
+	return containsInt(p.Terms, term)
+}
+
+// allowsAmount reports whether the amount paid over the term is at least the minimum monthly amount, if it is known.
+func (p installmentPlan) allowsAmount(amount int64, term int) bool {
+	return amount >= p.MinMonthlyAmount*int64(term)
+}
+
+// Installment represents the installment terms of a bank available for an amount.
+type Installment struct {
+	SourceType string
+	Terms      []InstallmentTerm
+}
+
+// InstallmentTerm represents the payments of an amount paid in installments over Term months.
+// Interest is the total interest charged to the payer, it is zero if the merchant absorbs the interest.
+// Estimated reports whether the interest is computed from an estimated interest rate, so the bank may charge
+// the payer a different amount.
+type InstallmentTerm struct {
+	Term          int
+	MonthlyAmount Money
+	Interest      Money
+	TotalAmount   Money
+	Estimated     bool
+}
+
+// newInstallmentTerm computes the payments of the amount paid over the term.
+// The interest is a flat rate of the amount for each month.
+func newInstallmentTerm(amount Money, term int, plan installmentPlan, zeroInterest bool) (InstallmentTerm, error) {
+	interest := NewMoney(0, amount.Currency)
+	if !zeroInterest {
+		var err error
+		if interest, err = amount.MulRatio(plan.InterestRate*int64(term), 10000); err != nil {
+			return InstallmentTerm{}, err
+		}
+	}
+
+	total, err := amount.Add(interest)
+	if err != nil {
+		return InstallmentTerm{}, err
+	}
+	monthly, err := total.MulRatio(1, int64(term))
+	if err != nil {
+		return InstallmentTerm{}, err
+	}
+
+	return InstallmentTerm{
+		Term:          term,
+		MonthlyAmount: monthly,
+		Interest:      interest,
+		TotalAmount:   total,
+		Estimated:     plan.Estimated && !zeroInterest,
+	}, nil
+}
+
+// installments returns the installment terms available for the amount from the enabled installment payment methods,
+// sorted by source type name. Banks without any available term are left out.
+func (v *Validator) installments(enabled []PaymentMethod, amount Money, zeroInterest bool) ([]Installment, error) {
+	var result []Installment
+	for _, m := range enabled {
+		plan, ok := v.installmentPlan(m.Name)
+		if !ok {
+			continue
+		}
+		source := sourceTypes[m.Name]
+		if !contains(m.Currencies, amount.Currency) || !contains(source.Currencies, amount.Currency) || !source.limit().contains(amount.Amount) {
+			continue
+		}
+
+		var terms []InstallmentTerm
+		for _, term := range plan.Terms {
+			if len(m.InstallmentTerms) > 0 && !containsInt(m.InstallmentTerms, term) {
+				continue
+			}
+			if !plan.allowsAmount(amount.Amount, term) {
+				continue
+			}
+			t, err := newInstallmentTerm(amount, term, plan, zeroInterest)
+			if err != nil {
+				return nil, err
+			}
+			terms = append(terms, t)
+		}
+		if len(terms) == 0 {
+			continue
+		}
+
+		result = append(result, Installment{SourceType: m.Name, Terms: terms})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].SourceType < result[j].SourceType
+	})
+
+	return result, nil
+}
+
+// validateInstallment validates the installment term against the plan of the installment source type.
+func (v *Validator) validateInstallment(verr *ValidationError, req *Request) {
+	plan, ok := v.installmentPlan(req.SourceType)
+	if !ok || req.InstallmentTerm <= 0 {
+		return
+	}
+
+	if !plan.allowsTerm(req.InstallmentTerm) {
+		terms := make([]string, len(plan.Terms))
+		for i, t := range plan.Terms {
+			terms[i] = strconv.Itoa(t)
+		}
+		verr.add(FieldInstallmentTerm, CodeUnsupported, fmt.Sprintf("installment_term for %s must be one of %s", req.SourceType, strings.Join(terms, ", ")))
+		return
+	}
+
+	if req.Amount.Currency == "THB" && req.Amount.Amount > 0 && !plan.allowsAmount(req.Amount.Amount, req.InstallmentTerm) {
+		min := NewMoney(plan.MinMonthlyAmount*int64(req.InstallmentTerm), req.Amount.Currency)
+		verr.add("amount", CodeOutOfRange, fmt.Sprintf("amount for %s over %d months must be at least %s", req.SourceType, req.InstallmentTerm, min))
+	}
+}
+
+// validateInstallmentAmount validates the amount to list the installment terms for.
+func validateInstallmentAmount(amount Money) error {
+	verr := &ValidationError{}
+	switch {
+	case amount.Currency != "THB":
+		verr.add("currency", CodeUnsupported, "installments are only available in THB")
+	case amount.Amount <= 0:
+		verr.add("amount", CodeInvalid, "amount must be positive")
+	default:
+		return nil
+	}
+	return verr
+}
+
+func containsInt(list []int, n int) bool {
+	for _, v := range list {
+		if v == n {
+			return true
+		}
+	}
+	return false
+}
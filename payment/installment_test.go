@@ -0,0 +1,140 @@
+package payment
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_newInstallmentTerm(t *testing.T) {
+	plan := installmentPlans["installment_kbank"]
+	tests := []struct {
+		name         string
+		amount       Money
+		term         int
+		zeroInterest bool
+		want         InstallmentTerm
+	}{
+		{
+			name:   "payer pays interest",
+			amount: NewMoney(300000, "THB"),
+			term:   3,
+			want: InstallmentTerm{
+				Term:          3,
+				MonthlyAmount: NewMoney(101950, "THB"),
+				Interest:      NewMoney(5850, "THB"),
+				TotalAmount:   NewMoney(305850, "THB"),
+				Estimated:     true,
+			},
+		},
+		{
+			name:         "merchant absorbs interest",
+			amount:       NewMoney(300000, "THB"),
+			term:         3,
+			zeroInterest: true,
+			want: InstallmentTerm{
+				Term:          3,
+				MonthlyAmount: NewMoney(100000, "THB"),
+				Interest:      NewMoney(0, "THB"),
+				TotalAmount:   NewMoney(300000, "THB"),
+			},
+		},
+		{
+			name:         "monthly amount is rounded",
+			amount:       NewMoney(1000000, "THB"),
+			term:         6,
+			zeroInterest: true,
+			want: InstallmentTerm{
+				Term:          6,
+				MonthlyAmount: NewMoney(166667, "THB"),
+				Interest:      NewMoney(0, "THB"),
+				TotalAmount:   NewMoney(1000000, "THB"),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newInstallmentTerm(tt.amount, tt.term, plan, tt.zeroInterest)
+			if err != nil {
+				t.Fatalf("newInstallmentTerm() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("newInstallmentTerm() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_installments(t *testing.T) {
+	enabled := []PaymentMethod{
+		{SourceType: SourceType{Name: "installment_kbank", Currencies: []string{"THB"}}, InstallmentTerms: []int{3, 4, 6, 10}},
+		{SourceType: SourceType{Name: "installment_bay", Currencies: []string{"THB"}}, InstallmentTerms: []int{3, 4, 6, 9, 10}},
+		{SourceType: SourceType{Name: "installment_uob", Currencies: []string{"THB"}}, InstallmentTerms: []int{3}},
+		{SourceType: SourceType{Name: "promptpay", Currencies: []string{"THB"}}},
+	}
+
+	rates := map[string]InstallmentRate{
+		"installment_kbank": {InterestRate: 65, MinMonthlyAmount: 30000},
+		"installment_bay":   {InterestRate: 80, MinMonthlyAmount: 50000},
+		"installment_uob":   {InterestRate: 64, MinMonthlyAmount: 50000},
+	}
+
+	tests := []struct {
+		name   string
+		rates  map[string]InstallmentRate
+		amount Money
+		want   map[string][]int
+	}{
+		{
+			name:   "estimated rates without minimum monthly amounts",
+			amount: NewMoney(300000, "THB"),
+			want: map[string][]int{
+				"installment_bay":   {3, 4, 6, 9, 10},
+				"installment_kbank": {3, 4, 6, 10},
+				"installment_uob":   {3},
+			},
+		},
+		{
+			name:   "terms limited by the minimum monthly amount",
+			rates:  rates,
+			amount: NewMoney(300000, "THB"),
+			want: map[string][]int{
+				"installment_bay":   {3, 4, 6},
+				"installment_kbank": {3, 4, 6, 10},
+				"installment_uob":   {3},
+			},
+		},
+		{
+			name:   "amount below the minimum of every term",
+			rates:  rates,
+			amount: NewMoney(100000, "THB"),
+			want:   map[string][]int{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewValidator(nil, nil, tt.rates)
+			got, err := v.installments(enabled, tt.amount, false)
+			if err != nil {
+				t.Fatalf("installments() error = %v", err)
+			}
+
+			gotTerms := map[string][]int{}
+			for i, inst := range got {
+				if i > 0 && got[i-1].SourceType > inst.SourceType {
+					t.Errorf("installments() are not sorted by source type")
+				}
+				terms := []int{}
+				for _, term := range inst.Terms {
+					terms = append(terms, term.Term)
+					if term.Estimated != (tt.rates == nil) {
+						t.Errorf("installments() %s term %d estimated = %v", inst.SourceType, term.Term, term.Estimated)
+					}
+				}
+				gotTerms[inst.SourceType] = terms
+			}
+			if !reflect.DeepEqual(gotTerms, tt.want) {
+				t.Errorf("installments() terms = %v, want %v", gotTerms, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package payment
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Money errors
+var (
+	ErrUnknownCurrency  = errors.New("unknown currency")
+	ErrCurrencyMismatch = errors.New("currencies do not match")
+	ErrAmountOverflow   = errors.New("amount overflows")
+	ErrInvalidAmount    = errors.New("invalid amount")
+)
+
+// currencyExponents contains the number of digits after the decimal separator of ISO-4217 currencies,
+// e.g. 2000 in THB is 20.00 Baht while 2000 in JPY is 2000 Yen.
+var currencyExponents = map[string]int{
+	"AED": 2, "AUD": 2, "BDT": 2, "BHD": 3, "BND": 2, "BRL": 2, "CAD": 2, "CHF": 2,
+	"CLP": 0, "CNY": 2, "CZK": 2, "DKK": 2, "EUR": 2, "GBP": 2, "HKD": 2, "HUF": 2,
+	"IDR": 2, "ILS": 2, "INR": 2, "ISK": 0, "JOD": 3, "JPY": 0, "KHR": 2, "KRW": 0,
+	"KWD": 3, "LAK": 2, "LKR": 2, "MMK": 2, "MXN": 2, "MYR": 2, "NOK": 2, "NZD": 2,
+	"OMR": 3, "PHP": 2, "PKR": 2, "PLN": 2, "QAR": 2, "RUB": 2, "SAR": 2, "SEK": 2,
+	"SGD": 2, "THB": 2, "TND": 3, "TRY": 2, "TWD": 2, "USD": 2, "VND": 0, "ZAR": 2,
+}
+
+// CurrencyExponent returns the number of digits after the decimal separator of the currency.
+func CurrencyExponent(currency string) (int, error) {
+	exp, ok := currencyExponents[currency]
+	if !ok {
+		return 0, ErrUnknownCurrency
+	}
+	return exp, nil
+}
+
+// Money represents an amount of money in the smallest unit of its currency, e.g. Satang for THB.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+// NewMoney returns money of the given amount in the smallest currency unit.
+func NewMoney(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// ParseMoney parses a decimal string such as "20.00" in the given currency.
+// The string must not have more fractional digits than the currency has.
+func ParseMoney(s, currency string) (Money, error) {
+	exp, err := CurrencyExponent(currency)
+	if err != nil {
+		return Money{}, err
+	}
+
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	whole, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, frac = s[:i], s[i+1:]
+	}
+	if whole == "" || len(frac) > exp || (frac == "" && strings.HasSuffix(s, ".")) {
+		return Money{}, ErrInvalidAmount
+	}
+	frac += strings.Repeat("0", exp-len(frac))
+
+	for _, c := range whole + frac {
+		if c < '0' || c > '9' {
+			return Money{}, ErrInvalidAmount
+		}
+	}
+
+	amount, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil {
+		return Money{}, ErrAmountOverflow
+	}
+	if neg {
+		amount = -amount
+	}
+
+	return NewMoney(amount, currency), nil
+}
+
+// ParseJSONAmount parses a JSON amount in the given currency.
+// The amount is either an integer in the smallest currency unit or a decimal string.
+func ParseJSONAmount(data json.RawMessage, currency string) (Money, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		return NewMoney(0, currency), nil
+	}
+
+	if data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return Money{}, ErrInvalidAmount
+		}
+		return ParseMoney(s, currency)
+	}
+
+	var amount int64
+	if err := json.Unmarshal(data, &amount); err != nil {
+		return Money{}, ErrInvalidAmount
+	}
+	return NewMoney(amount, currency), nil
+}
+
+// Format formats the amount as a decimal string in the major currency unit, e.g. "20.00".
+func (m Money) Format() string {
+	exp, ok := currencyExponents[m.Currency]
+	if !ok || exp == 0 {
+		return strconv.FormatInt(m.Amount, 10)
+	}
+
+	sign := ""
+	amount := uint64(m.Amount)
+	if m.Amount < 0 {
+		sign = "-"
+		amount = uint64(-(m.Amount + 1)) + 1
+	}
+	s := strconv.FormatUint(amount, 10)
+	if len(s) <= exp {
+		s = strings.Repeat("0", exp-len(s)+1) + s
+	}
+	return sign + s[:len(s)-exp] + "." + s[len(s)-exp:]
+}
+
+// String returns the formatted amount with its currency, e.g. "20.00 THB".
+func (m Money) String() string {
+	return m.Format() + " " + m.Currency
+}
+
+// IsZero reports whether the amount is zero.
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+// IsNegative reports whether the amount is less than zero.
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+// Add returns the sum of m and o.
+func (m Money) Add(o Money) (Money, error) {
+	if m.Currency != o.Currency {
+		return Money{}, ErrCurrencyMismatch
+	}
+	if (o.Amount > 0 && m.Amount > math.MaxInt64-o.Amount) || (o.Amount < 0 && m.Amount < math.MinInt64-o.Amount) {
+		return Money{}, ErrAmountOverflow
+	}
+	return NewMoney(m.Amount+o.Amount, m.Currency), nil
+}
+
+// Sub returns the difference of m and o.
+func (m Money) Sub(o Money) (Money, error) {
+	if o.Amount == math.MinInt64 {
+		return Money{}, ErrAmountOverflow
+	}
+	return m.Add(NewMoney(-o.Amount, o.Currency))
+}
+
+// Cmp compares m and o, it returns -1 if m < o, 0 if m == o and 1 if m > o.
+func (m Money) Cmp(o Money) (int, error) {
+	if m.Currency != o.Currency {
+		return 0, ErrCurrencyMismatch
+	}
+	switch {
+	case m.Amount < o.Amount:
+		return -1, nil
+	case m.Amount > o.Amount:
+		return 1, nil
+	default:
+		return 0, nil
+	}
+}
+
+// MulRatio returns m multiplied by num/den, rounded half away from zero to the smallest currency unit.
+// It is used to compute fees, e.g. m.MulRatio(365, 10000) is 3.65% of m.
+func (m Money) MulRatio(num, den int64) (Money, error) {
+	if den == 0 {
+		return Money{}, ErrInvalidAmount
+	}
+	r := new(big.Rat).SetFrac(new(big.Int).Mul(big.NewInt(m.Amount), big.NewInt(num)), big.NewInt(den))
+
+	// round half away from zero
+	q, rem := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+	if new(big.Int).Mul(new(big.Int).Abs(rem), big.NewInt(2)).Cmp(r.Denom()) >= 0 {
+		q.Add(q, big.NewInt(int64(r.Num().Sign())))
+	}
+	if !q.IsInt64() {
+		return Money{}, ErrAmountOverflow
+	}
+	return NewMoney(q.Int64(), m.Currency), nil
+}
+
+type moneyJSON struct {
+	Amount   json.RawMessage `json:"amount"`
+	Currency string          `json:"currency"`
+}
+
+// MarshalJSON encodes the money as an object of the amount in the smallest currency unit and the currency.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&moneyJSON{
+		Amount:   json.RawMessage(strconv.FormatInt(m.Amount, 10)),
+		Currency: m.Currency,
+	})
+}
+
+// UnmarshalJSON decodes the money from an object of the amount and the currency.
+// The amount is either an integer in the smallest currency unit or a decimal string.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	v := &moneyJSON{}
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+	money, err := ParseJSONAmount(v.Amount, strings.ToUpper(v.Currency))
+	if err != nil {
+		return fmt.Errorf("parse money: %w", err)
+	}
+	*m = money
+	return nil
+}
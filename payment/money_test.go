@@ -0,0 +1,113 @@
+package payment
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		s        string
+		currency string
+		want     Money
+		wantErr  error
+	}{
+		{s: "20.00", currency: "THB", want: NewMoney(2000, "THB")},
+		{s: "20.5", currency: "THB", want: NewMoney(2050, "THB")},
+		{s: "20", currency: "THB", want: NewMoney(2000, "THB")},
+		{s: "-1.25", currency: "USD", want: NewMoney(-125, "USD")},
+		{s: "2000", currency: "JPY", want: NewMoney(2000, "JPY")},
+		{s: "1.234", currency: "KWD", want: NewMoney(1234, "KWD")},
+		{s: "20.001", currency: "THB", wantErr: ErrInvalidAmount},
+		{s: "20.5", currency: "JPY", wantErr: ErrInvalidAmount},
+		{s: "20.", currency: "THB", wantErr: ErrInvalidAmount},
+		{s: ".5", currency: "THB", wantErr: ErrInvalidAmount},
+		{s: "1e3", currency: "THB", wantErr: ErrInvalidAmount},
+		{s: "20.00", currency: "XXX", wantErr: ErrUnknownCurrency},
+		{s: "99999999999999999999", currency: "THB", wantErr: ErrAmountOverflow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s+" "+tt.currency, func(t *testing.T) {
+			got, err := ParseMoney(tt.s, tt.currency)
+			if err != tt.wantErr {
+				t.Fatalf("ParseMoney() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseMoney() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoney_Format(t *testing.T) {
+	tests := []struct {
+		m    Money
+		want string
+	}{
+		{m: NewMoney(2000, "THB"), want: "20.00"},
+		{m: NewMoney(5, "THB"), want: "0.05"},
+		{m: NewMoney(-5, "THB"), want: "-0.05"},
+		{m: NewMoney(2000, "JPY"), want: "2000"},
+		{m: NewMoney(1234, "KWD"), want: "1.234"},
+		{m: NewMoney(math.MinInt64, "THB"), want: "-92233720368547758.08"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := tt.m.Format(); got != tt.want {
+				t.Errorf("Money.Format() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoney_Arithmetic(t *testing.T) {
+	thb := NewMoney(2000, "THB")
+
+	if got, err := thb.Add(NewMoney(50, "THB")); err != nil || got != NewMoney(2050, "THB") {
+		t.Errorf("Money.Add() = %v, %v", got, err)
+	}
+	if _, err := thb.Add(NewMoney(50, "JPY")); err != ErrCurrencyMismatch {
+		t.Errorf("Money.Add() error = %v, want %v", err, ErrCurrencyMismatch)
+	}
+	if _, err := NewMoney(math.MaxInt64, "THB").Add(NewMoney(1, "THB")); err != ErrAmountOverflow {
+		t.Errorf("Money.Add() error = %v, want %v", err, ErrAmountOverflow)
+	}
+	if got, err := thb.Sub(NewMoney(2500, "THB")); err != nil || got != NewMoney(-500, "THB") {
+		t.Errorf("Money.Sub() = %v, %v", got, err)
+	}
+	if got, err := thb.MulRatio(365, 10000); err != nil || got != NewMoney(73, "THB") {
+		t.Errorf("Money.MulRatio() = %v, %v", got, err)
+	}
+	if got, err := NewMoney(-15, "THB").MulRatio(1, 10); err != nil || got != NewMoney(-2, "THB") {
+		t.Errorf("Money.MulRatio() = %v, %v", got, err)
+	}
+	if c, err := thb.Cmp(NewMoney(1999, "THB")); err != nil || c != 1 {
+		t.Errorf("Money.Cmp() = %v, %v", c, err)
+	}
+}
+
+func TestMoney_JSON(t *testing.T) {
+	b, err := json.Marshal(NewMoney(2000, "THB"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(b), `{"amount":2000,"currency":"THB"}`; got != want {
+		t.Errorf("json.Marshal() = %v, want %v", got, want)
+	}
+
+	for _, data := range []string{`{"amount":2000,"currency":"THB"}`, `{"amount":"20.00","currency":"thb"}`} {
+		var m Money
+		if err := json.Unmarshal([]byte(data), &m); err != nil {
+			t.Fatal(err)
+		}
+		if m != NewMoney(2000, "THB") {
+			t.Errorf("json.Unmarshal(%s) = %v, want %v", data, m, NewMoney(2000, "THB"))
+		}
+	}
+
+	var m Money
+	if err := json.Unmarshal([]byte(`{"amount":"20.001","currency":"THB"}`), &m); err == nil {
+		t.Errorf("json.Unmarshal() error = nil, want error")
+	}
+}
@@ -0,0 +1,145 @@
+package payment
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MaxOverrideReasonLength is the maximum length of the reason of a status override.
+const MaxOverrideReasonLength = 1000
+
+// StatusOverride represents a change of the status of a payment by an operator, such as after the payment gateway
+// support confirmed the outcome of a charge. Overrides are kept in an audit log apart from the status changes
+// the service makes from the charge, Operator is the identity of the operator who made it.
+type StatusOverride struct {
+	ID             int
+	PaymentID      int
+	PreviousStatus Status
+	Status         Status
+	Reason         string
+	Operator       string
+	CreatedAt      time.Time
+}
+
+// statusTransitions are the statuses a payment status can be overridden to, following the lifecycle of a charge.
+// An offline payment paid before it expired may be reported after it, so an expired payment may still be successful.
+var statusTransitions = map[Status][]Status{
+	StatusPending:    {StatusAuthorized, StatusSuccessful, StatusFailed, StatusExpired},
+	StatusAuthorized: {StatusCaptured, StatusVoided, StatusFailed, StatusExpired},
+	StatusExpired:    {StatusSuccessful},
+}
+
+func canTransition(from, to Status) bool {
+	for _, status := range statusTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// OverrideStatus changes the status of a payment with the given id on behalf of an operator, for the given reason.
+// The change is recorded in the audit log and as a status changed event, the charge is kept as the payment gateway
+// reported it. Refreshing the payment from its charge replaces the status if the payment gateway reports another,
+// and a reconciliation reports it as a status mismatch.
+func (s *service) OverrideStatus(id int, status Status, reason, operator string) (*Payment, error) {
+	verr := &ValidationError{}
+	if status == "" {
+		verr.add("status", CodeRequired, "status is required")
+	}
+	reason = strings.TrimSpace(reason)
+	validateOperator(verr, reason, operator)
+	if len(verr.Errors) > 0 {
+		return nil, verr
+	}
+
+	payment, err := s.repo.Find(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !canTransition(payment.Status, status) {
+		return nil, &Error{
+			Code:    ErrorCodeConflict,
+			Message: fmt.Sprintf("%s payment cannot be changed to %s", payment.Status, status),
+		}
+	}
+
+	override := &StatusOverride{
+		PaymentID:      id,
+		PreviousStatus: payment.Status,
+		Status:         status,
+		Reason:         reason,
+		Operator:       operator,
+	}
+	if err := s.repo.OverrideStatus(override, newStatusChangedEvent(payment, status)); err != nil {
+		return nil, err
+	}
+
+	return s.repo.Find(id)
+}
+
+// CorrectStatus refreshes a payment with the given id from its charge on behalf of an operator, for the given reason,
+// such as to correct a status mismatch found by a reconciliation. Unlike Refresh, a change of the status is recorded
+// in the audit log of the status overrides, in the same write as the charge.
+func (s *service) CorrectStatus(id int, reason, operator string) (*Payment, error) {
+	verr := &ValidationError{}
+	reason = strings.TrimSpace(reason)
+	validateOperator(verr, reason, operator)
+	if len(verr.Errors) > 0 {
+		return nil, verr
+	}
+
+	payment, err := s.repo.Find(id)
+	if err != nil {
+		return nil, err
+	}
+	// a blocked payment was never charged, there is nothing to refresh it from.
+	if payment.OmiseCharge.ID == "" {
+		return payment, nil
+	}
+
+	charge, err := s.client.GetCharge(payment.OmiseCharge.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	event := newStatusChangedEvent(payment, charge.Status)
+	if event == nil {
+		return s.updateCharge(payment, charge)
+	}
+
+	override := &StatusOverride{
+		PaymentID:      id,
+		PreviousStatus: payment.Status,
+		Status:         charge.Status,
+		Reason:         reason,
+		Operator:       operator,
+	}
+	if err := s.repo.CorrectCharge(override, charge, event); err != nil {
+		return nil, err
+	}
+
+	return s.repo.Find(id)
+}
+
+func validateOperator(verr *ValidationError, reason, operator string) {
+	switch {
+	case reason == "":
+		verr.add("reason", CodeRequired, "reason is required")
+	case len(reason) > MaxOverrideReasonLength:
+		verr.add("reason", CodeTooLong, fmt.Sprintf("reason must not exceed %d characters", MaxOverrideReasonLength))
+	}
+	if operator == "" {
+		verr.add("operator", CodeRequired, "operator is required")
+	}
+}
+
+// StatusOverrides returns the status overrides of a payment with the given id, oldest first.
+func (s *service) StatusOverrides(id int) ([]*StatusOverride, error) {
+	if _, err := s.repo.Find(id); err != nil {
+		return nil, err
+	}
+	return s.repo.FindStatusOverrides(id)
+}
@@ -0,0 +1,210 @@
+package payment
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestService_OverrideStatus(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       Status
+		paymentState Status
+		reason       string
+		operator     string
+		wantOverride *StatusOverride
+		wantEvent    *Event
+		wantErr      error
+	}{
+		{
+			name:         "expired paid at the counter",
+			status:       StatusSuccessful,
+			paymentState: StatusExpired,
+			reason:       "  paid at the counter before it expired  ",
+			operator:     "alice",
+			wantOverride: &StatusOverride{PaymentID: 1, PreviousStatus: StatusExpired, Status: StatusSuccessful, Reason: "paid at the counter before it expired", Operator: "alice"},
+			wantEvent:    &Event{DeduplicationID: "payment.status_changed:1:expired->successful:1", Type: EventStatusChanged, PaymentID: 1, PreviousStatus: StatusExpired},
+		},
+		{
+			name:         "authorized voided",
+			status:       StatusVoided,
+			paymentState: StatusAuthorized,
+			reason:       "voided on the Omise dashboard",
+			operator:     "alice",
+			wantOverride: &StatusOverride{PaymentID: 1, PreviousStatus: StatusAuthorized, Status: StatusVoided, Reason: "voided on the Omise dashboard", Operator: "alice"},
+			wantEvent:    &Event{DeduplicationID: "payment.status_changed:1:authorized->voided:1", Type: EventStatusChanged, PaymentID: 1, PreviousStatus: StatusAuthorized},
+		},
+		{
+			name:         "successful cannot fail",
+			status:       StatusFailed,
+			paymentState: StatusSuccessful,
+			reason:       "confirmed",
+			operator:     "alice",
+			wantErr:      &Error{Code: ErrorCodeConflict, Message: "successful payment cannot be changed to failed"},
+		},
+		{
+			name:         "same status",
+			status:       StatusPending,
+			paymentState: StatusPending,
+			reason:       "confirmed",
+			operator:     "alice",
+			wantErr:      &Error{Code: ErrorCodeConflict, Message: "pending payment cannot be changed to pending"},
+		},
+		{
+			name:         "missing fields",
+			paymentState: StatusPending,
+			reason:       " ",
+			wantErr: &ValidationError{Errors: []FieldError{
+				{Field: "status", Code: CodeRequired, Message: "status is required"},
+				{Field: "reason", Code: CodeRequired, Message: "reason is required"},
+				{Field: "operator", Code: CodeRequired, Message: "operator is required"},
+			}},
+		},
+		{
+			name:         "reason too long",
+			status:       StatusFailed,
+			paymentState: StatusPending,
+			reason:       strings.Repeat("a", MaxOverrideReasonLength+1),
+			operator:     "alice",
+			wantErr: &ValidationError{Errors: []FieldError{
+				{Field: "reason", Code: CodeTooLong, Message: "reason must not exceed 1000 characters"},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Payment{ID: 1, Status: tt.paymentState, OmiseCharge: &OmiseCharge{Status: tt.paymentState}}
+			repo := &mockRepository{}
+			repo.FindFn = func(id int) (*Payment, error) {
+				return p, nil
+			}
+			var gotOverride *StatusOverride
+			var gotEvent *Event
+			repo.OverrideStatusFn = func(override *StatusOverride, event *Event) error {
+				gotOverride, gotEvent = override, event
+				p.Status = override.Status
+				return nil
+			}
+
+			s := NewService(nil, repo, nil, testValidator, nil)
+			got, err := s.OverrideStatus(1, tt.status, tt.reason, tt.operator)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Fatalf("Service.OverrideStatus() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(gotOverride, tt.wantOverride) {
+				t.Errorf("Service.OverrideStatus() override = %+v, want %+v", gotOverride, tt.wantOverride)
+			}
+			if !reflect.DeepEqual(gotEvent, tt.wantEvent) {
+				t.Errorf("Service.OverrideStatus() event = %+v, want %+v", gotEvent, tt.wantEvent)
+			}
+			if err != nil {
+				return
+			}
+			if got.Status != tt.status {
+				t.Errorf("Service.OverrideStatus() status = %v, want %v", got.Status, tt.status)
+			}
+			if got.OmiseCharge.Status != tt.paymentState {
+				t.Errorf("Service.OverrideStatus() charge status = %v, want %v", got.OmiseCharge.Status, tt.paymentState)
+			}
+		})
+	}
+}
+
+func TestService_Find_keepsOverriddenStatus(t *testing.T) {
+	repo := &mockRepository{}
+	repo.FindFn = func(id int) (*Payment, error) {
+		// the charge is still pending at the payment gateway, the operator overrode the payment status.
+		return &Payment{ID: id, Status: StatusSuccessful, OmiseCharge: &OmiseCharge{ID: "chrg_1", Status: StatusPending}}, nil
+	}
+	client := &mockClient{}
+	client.GetChargeFn = func(id string) (*OmiseCharge, error) {
+		t.Fatal("Service.Find() refreshed a payment with an overridden status")
+		return nil, nil
+	}
+
+	s := NewService(client, repo, nil, testValidator, nil)
+	got, err := s.Find(1)
+	if err != nil {
+		t.Fatalf("Service.Find() error = %v", err)
+	}
+	if got.Status != StatusSuccessful {
+		t.Errorf("Service.Find() status = %v, want %v", got.Status, StatusSuccessful)
+	}
+}
+
+func TestService_CorrectStatus(t *testing.T) {
+	tests := []struct {
+		name         string
+		chargeStatus Status
+		operator     string
+		wantOverride *StatusOverride
+		wantEvent    *Event
+		wantErr      error
+	}{
+		{
+			name:         "status changed",
+			chargeStatus: StatusSuccessful,
+			operator:     "alice",
+			wantOverride: &StatusOverride{PaymentID: 1, PreviousStatus: StatusPending, Status: StatusSuccessful, Reason: "reconciliation", Operator: "alice"},
+			wantEvent:    &Event{DeduplicationID: "payment.status_changed:1:pending->successful:1", Type: EventStatusChanged, PaymentID: 1, PreviousStatus: StatusPending},
+		},
+		{
+			name:         "status unchanged",
+			chargeStatus: StatusPending,
+			operator:     "alice",
+		},
+		{
+			name:         "missing operator",
+			chargeStatus: StatusSuccessful,
+			wantErr: &ValidationError{Errors: []FieldError{
+				{Field: "operator", Code: CodeRequired, Message: "operator is required"},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &mockRepository{}
+			repo.FindFn = func(id int) (*Payment, error) {
+				return &Payment{ID: 1, Status: StatusPending, OmiseCharge: &OmiseCharge{ID: "charge-1", Status: StatusPending}}, nil
+			}
+			var gotOverride *StatusOverride
+			var gotEvent *Event
+			repo.CorrectChargeFn = func(override *StatusOverride, charge *OmiseCharge, event *Event) error {
+				gotOverride, gotEvent = override, event
+				return nil
+			}
+			repo.UpdateChargeFn = func(id int, charge *OmiseCharge, event *Event) error {
+				gotEvent = event
+				return nil
+			}
+			client := &mockClient{}
+			client.GetChargeFn = func(id string) (*OmiseCharge, error) {
+				return &OmiseCharge{ID: id, Status: tt.chargeStatus}, nil
+			}
+
+			s := NewService(client, repo, nil, testValidator, nil)
+			_, err := s.CorrectStatus(1, " reconciliation ", tt.operator)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Fatalf("Service.CorrectStatus() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(gotOverride, tt.wantOverride) {
+				t.Errorf("Service.CorrectStatus() override = %+v, want %+v", gotOverride, tt.wantOverride)
+			}
+			if !reflect.DeepEqual(gotEvent, tt.wantEvent) {
+				t.Errorf("Service.CorrectStatus() event = %+v, want %+v", gotEvent, tt.wantEvent)
+			}
+		})
+	}
+}
+
+func Test_newStatusChangedEvent_repeated(t *testing.T) {
+	first := newStatusChangedEvent(&Payment{ID: 1, Status: StatusPending}, StatusSuccessful)
+	again := newStatusChangedEvent(&Payment{ID: 1, Status: StatusPending, StatusChanges: 2}, StatusSuccessful)
+	if first.DeduplicationID == again.DeduplicationID {
+		t.Errorf("newStatusChangedEvent() deduplication id = %v for both changes to %v", first.DeduplicationID, StatusSuccessful)
+	}
+	if want := "payment.status_changed:1:pending->successful:3"; again.DeduplicationID != want {
+		t.Errorf("newStatusChangedEvent() deduplication id = %v, want %v", again.DeduplicationID, want)
+	}
+}
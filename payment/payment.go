@@ -1,6 +1,11 @@
 package payment
 
 import (
+	"errors"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -8,14 +13,50 @@ import (
 type Service interface {
 	CreatePaymentRequest(req *Request) (*Payment, error)
 	Find(id int) (*Payment, error)
+	Refresh(id int) (*Payment, error)
+	FindByReference(reference string) (*Payment, error)
+	Capture(id int, amount Money) (*Payment, error)
+	Void(id int) (*Payment, error)
+	Refund(id int, amount Money) (*Payment, error)
+	PaymentMethods() ([]PaymentMethod, error)
+	Installments(amount Money, zeroInterest bool) ([]Installment, error)
+	FeeSummaries(from, to time.Time, loc *time.Location) ([]FeeSummary, error)
+	Export(from, to time.Time, fn func(payment *Payment) error) error
+	Search(q *Query) ([]*Payment, error)
+	Events(id int) ([]*Event, error)
+	OverrideStatus(id int, status Status, reason, operator string) (*Payment, error)
+	CorrectStatus(id int, reason, operator string) (*Payment, error)
+	StatusOverrides(id int) ([]*StatusOverride, error)
 }
 
 // Payment represents a payment.
 type Payment struct {
-	ID       int
-	Status   Status
-	Amount   int64
-	Currency string
+	ID int
+	// CustomerID is set for payments charging a card saved to a customer.
+	CustomerID  int
+	Reference   string
+	Description string
+	Metadata    map[string]string
+	Status      Status
+	Amount      Money
+	// ReturnURI is the merchant's return URI, the payer is redirected to it through the service's return page
+	// with the signed payment result.
+	ReturnURI string
+	// IPAddress is the IP address of the payer, if it was given.
+	IPAddress string
+	// Risk is the risk evaluation of the payment request, it is nil if the risk was not evaluated.
+	Risk *Risk
+	// Refunds are the refunds of the payment, oldest first.
+	Refunds []*Refund
+	// StatusChanges is the number of times the status of the payment changed, it sequences its status changed events.
+	StatusChanges int
+
+	// QRCode is set for payments which are paid by scanning a QR code, e.g. PromptPay.
+	QRCode *QRCode
+	// Card is set for card payments.
+	Card *Card
+	// BillPayment is set for payments which are paid over the counter, e.g. at Tesco Lotus.
+	BillPayment *BillPayment
 
 	OmiseCharge *OmiseCharge
 
@@ -29,11 +70,92 @@ type Payment struct {
 type OmiseCharge struct {
 	ID           string
 	Status       Status
-	Amount       int64
-	Currency     string
+	Amount       Money
 	AuthorizeURI string
 	SourceType   string
 	ReturnURI    string
+	QRCode       *QRCode
+	Card         *Card
+	BillPayment  *BillPayment
+
+	// CapturedAmount is the amount captured from an authorized charge, it may be less than the amount.
+	CapturedAmount Money
+
+	// Fee and FeeVAT are charged by Omise when the charge is paid, Net is the amount the merchant receives after them.
+	Fee    Money
+	FeeVAT Money
+	Net    Money
+	// PaidAt is the time the charge was paid. TransactionID is the Omise balance transaction of the charge,
+	// which is settled to the merchant's bank account in an Omise transfer.
+	PaidAt        time.Time
+	TransactionID string
+
+	FailureCode    string
+	FailureMessage string
+}
+
+// QRCode represents a QR code to be scanned by the payer.
+// Payload is the data encoded in the QR code, it is used to render the QR code locally.
+// ImageURI is the Omise document of the rendered QR code.
+type QRCode struct {
+	Payload   string
+	ImageURI  string
+	ExpiresAt time.Time
+}
+
+// BillPayment represents the references of a bill payment, the payer pays it over the counter with the barcode.
+// TaxID is the tax ID of the biller with its suffix.
+// BarcodeImageURI is the Omise document of the rendered barcode.
+type BillPayment struct {
+	TaxID           string
+	Reference1      string
+	Reference2      string
+	BarcodeImageURI string
+	ExpiresAt       time.Time
+}
+
+// Barcode returns the data encoded in the barcode of the bill payment for the amount,
+// in the format of the Thai cross-bank bill payment barcode.
+func (b *BillPayment) Barcode(amount Money) string {
+	return "|" + b.TaxID + "\r" + b.Reference1 + "\r" + b.Reference2 + "\r" + strconv.FormatInt(amount.Amount, 10)
+}
+
+// Card represents the card of a card payment.
+// Fingerprint identifies the card number across tokens without revealing it.
+type Card struct {
+	Brand           string
+	LastDigits      string
+	ExpirationMonth int
+	ExpirationYear  int
+	Fingerprint     string
+	Country         string
+}
+
+// ExpiresAt returns the time the payer can no longer pay the payment offline, e.g. by scanning the QR code
+// or at the counter. It is zero if the payment does not expire.
+func (p *Payment) ExpiresAt() time.Time {
+	switch {
+	case p.BillPayment != nil:
+		return p.BillPayment.ExpiresAt
+	case p.QRCode != nil:
+		return p.QRCode.ExpiresAt
+	default:
+		return time.Time{}
+	}
+}
+
+// PaidAmount returns the amount paid by the payer, which is the captured amount of a partially captured payment.
+func (p *Payment) PaidAmount() Money {
+	if p.OmiseCharge != nil && !p.OmiseCharge.CapturedAmount.IsZero() {
+		return p.OmiseCharge.CapturedAmount
+	}
+	return p.Amount
+}
+
+// Payable reports whether the payer can still pay the pending payment at the given time.
+func (p *Payment) Payable(now time.Time) bool {
+	expiresAt := p.ExpiresAt()
+	return p.Status == StatusPending && (expiresAt.IsZero() || now.Before(expiresAt))
 }
 
 // Status represents a payment status.
@@ -46,76 +168,274 @@ const (
 	StatusPending    = "pending"
 	StatusReversed   = "reversed"
 	StatusSuccessful = "successful"
+	// StatusAuthorized is the status of a card payment which is authorized but not captured yet.
+	StatusAuthorized = "authorized"
+	// StatusCaptured is the status of an authorized card payment after it is captured.
+	StatusCaptured = "captured"
+	// StatusVoided is the status of an authorized card payment after it is voided.
+	StatusVoided = "voided"
+	// StatusBlocked is the status of a payment request blocked by the risk evaluation, it has no charge.
+	StatusBlocked = "blocked"
 )
 
 // Repository provides access a data source.
+// NextID reserves the id of a payment before it is created, so that the payment gateway can be given
+// the URI of the service's return page of the payment.
+// The write methods record the given event in the outbox in the same write as the change, if it is not nil,
+// and set its ID, Payment and CreatedAt.
+// FindPaid returns the payments whose charge was paid in [from, to).
+// FindEvents returns the events of a payment in the order they were recorded.
+// OverrideStatus changes the status of the payment of the override and records the override in the audit log,
+// setting its ID and CreatedAt. CorrectCharge replaces the charge of the payment of the override like UpdateCharge
+// and records the override in the audit log. FindStatusOverrides returns the overrides of a payment in the order they were made.
+// Refund adds a refund to the payment with the given id.
 type Repository interface {
-	Create(payment *Payment) error
+	NextID() (int, error)
+	Create(payment *Payment, event *Event) error
 	Find(id int) (*Payment, error)
-	UpdateStatus(id int, status Status) error
+	FindByReference(reference string) (*Payment, error)
+	FindPaid(from, to time.Time) ([]*Payment, error)
+	Search(q *Query) ([]*Payment, error)
+	FindEvents(paymentID int) ([]*Event, error)
+	UpdateCharge(id int, charge *OmiseCharge, event *Event) error
+	OverrideStatus(override *StatusOverride, event *Event) error
+	CorrectCharge(override *StatusOverride, charge *OmiseCharge, event *Event) error
+	FindStatusOverrides(paymentID int) ([]*StatusOverride, error)
+	Refund(id int, refund *Refund, event *Event) error
 }
 
+// SourceTypeCard is the source type of card payments.
+// The card is charged by its token, which is created on the client side with the Omise public key.
+const SourceTypeCard = "card"
+
 // Request contains details for making a payment.
+// Capture captures the payment when it is charged, a card payment which is not captured is only authorized
+// so it can be captured or voided later. Payments of the other source types are always captured.
+// CustomerID and CardID charge a card saved to the customer instead of a card token.
+// Reference is supplied by the merchant to correlate the payment with its own records, e.g. an order number,
+// and must be unique. Since the service charges through a single Omise account, there is only one merchant.
+// IPAddress is the IP address of the payer, which the risk rules count payments by.
 type Request struct {
-	Amount     int64
-	Currency   string
+	Amount     Money
 	ReturnURI  string
 	SourceType string
+	SourceDetails
+	CustomerID  int
+	Capture     bool
+	Reference   string
+	Description string
+	Metadata    map[string]string
+	IPAddress   string
 }
 
 // Client provides methods for a payment gateway client to be implemented.
 // This might be too coupled to Omise payment gateway.
 // But for ease of development and not too over-engineering at the first,
 // we can stay with it until a new payment gateway has to be implemented then refactor.
+// Card returns the card a card payment request charges, the card of its token or the card saved to the customer.
+// Refund refunds the given amount of a paid charge.
 type Client interface {
-	Charge(req *Request) (*OmiseCharge, error)
+	Charge(id int, req *Request, customer *Customer) (*OmiseCharge, error)
 	GetCharge(id string) (*OmiseCharge, error)
+	Capture(id string, amount Money) (*OmiseCharge, error)
+	Void(id string) (*OmiseCharge, error)
+	Refund(chargeID string, amount Money) (*Refund, error)
+	PaymentMethods() ([]PaymentMethod, error)
+	Card(req *Request, customer *Customer) (*Card, error)
 }
 
 type service struct {
-	client Client
-	repo   Repository
+	client    Client
+	repo      Repository
+	customers CustomerRepository
+	validator *Validator
+	risk      RiskEvaluator
 }
 
 // NewService returns a new payment serivce.
-func NewService(client Client, repo Repository) Service {
+// Payment requests are evaluated by the risk evaluator before they are charged, unless it is nil.
+func NewService(client Client, repo Repository, customers CustomerRepository, validator *Validator, risk RiskEvaluator) Service {
 	return &service{
-		client: client,
-		repo:   repo,
+		client:    client,
+		repo:      repo,
+		customers: customers,
+		validator: validator,
+		risk:      risk,
 	}
 }
 
 // CreatePaymentRequest creates a new payment request.
+// The reference is checked before charging so that a duplicated request does not leave an orphan charge,
+// the repository still enforces the uniqueness on create.
+// A request blocked by the risk evaluation is not charged, it is saved as a blocked payment with the risk decision
+// so that it counts toward the velocity rules and can be audited, and an error with the matched rules is returned.
 func (s *service) CreatePaymentRequest(req *Request) (*Payment, error) {
-	charge, err := s.client.Charge(req)
+	if err := s.validator.Validate(req); err != nil {
+		return nil, err
+	}
+	if req.IPAddress != "" {
+		// the same address is written in many ways in IPv6, payments are counted by its canonical form.
+		// the request is copied so that the caller's request is left as it was given.
+		normalized := *req
+		normalized.IPAddress = net.ParseIP(req.IPAddress).String()
+		req = &normalized
+	}
+
+	if req.Reference != "" {
+		_, err := s.repo.FindByReference(req.Reference)
+		if err == nil {
+			return nil, ErrDuplicateReference
+		}
+		if !errors.Is(err, ErrNotFound) {
+			return nil, err
+		}
+	}
+
+	var customer *Customer
+	if req.CustomerID != 0 {
+		c, err := s.customers.Find(req.CustomerID)
+		if err != nil {
+			return nil, err
+		}
+		customer = c
+	}
+
+	risk, card, err := s.evaluateRisk(req, customer)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := s.repo.NextID()
+	if err != nil {
+		return nil, err
+	}
+
+	if risk != nil && risk.Decision == RiskBlock {
+		return nil, s.block(id, req, risk, card)
+	}
+
+	charge, err := s.client.Charge(id, req, customer)
 	if err != nil {
 		return nil, err
 	}
 
 	payment := &Payment{
+		ID:          id,
+		CustomerID:  req.CustomerID,
+		Reference:   req.Reference,
+		Description: req.Description,
+		Metadata:    req.Metadata,
 		Status:      charge.Status,
 		Amount:      charge.Amount,
-		Currency:    charge.Currency,
+		ReturnURI:   req.ReturnURI,
+		IPAddress:   req.IPAddress,
+		Risk:        risk,
+		QRCode:      charge.QRCode,
+		Card:        charge.Card,
+		BillPayment: charge.BillPayment,
 		OmiseCharge: charge,
 	}
 
-	if err = s.repo.Create(payment); err != nil {
+	if err = s.repo.Create(payment, newCreatedEvent(id)); err != nil {
 		return nil, err
 	}
 
 	return payment, nil
 }
 
+// block saves a payment request blocked by the risk evaluation as a blocked payment without a charge,
+// and returns the error of the blocked request. No event is recorded since nothing happened at the payment gateway.
+// The reference is left out, so that the merchant can still pay the order another way under its reference.
+func (s *service) block(id int, req *Request, risk *Risk, card *Card) error {
+	payment := &Payment{
+		ID:          id,
+		CustomerID:  req.CustomerID,
+		Description: req.Description,
+		Metadata:    req.Metadata,
+		Status:      StatusBlocked,
+		Amount:      req.Amount,
+		ReturnURI:   req.ReturnURI,
+		IPAddress:   req.IPAddress,
+		Risk:        risk,
+		Card:        card,
+		OmiseCharge: &OmiseCharge{
+			Status:     StatusBlocked,
+			Amount:     req.Amount,
+			SourceType: req.SourceType,
+			ReturnURI:  req.ReturnURI,
+			Card:       card,
+		},
+	}
+	if err := s.repo.Create(payment, nil); err != nil {
+		return err
+	}
+
+	return &Error{
+		Code:    ErrorCodeRiskBlocked,
+		Message: "payment request is blocked by risk rules: " + strings.Join(risk.MatchedRules, ", "),
+	}
+}
+
+// evaluateRisk evaluates the risk of a payment request with the card it charges, if there is a risk evaluator.
+// The card is nil for the other source types.
+func (s *service) evaluateRisk(req *Request, customer *Customer) (*Risk, *Card, error) {
+	if s.risk == nil {
+		return nil, nil, nil
+	}
+
+	check := &RiskCheck{
+		Request: req,
+		Now:     time.Now(),
+		Search:  s.repo.Search,
+	}
+	if req.SourceType == SourceTypeCard {
+		card, err := s.client.Card(req, customer)
+		if err != nil {
+			return nil, nil, err
+		}
+		check.Card = card
+	}
+
+	risk, err := s.risk.Evaluate(check)
+	if err != nil {
+		return nil, nil, err
+	}
+	return risk, check.Card, nil
+}
+
 // Find finds a payment with the given payment id in the data source.
-// If payment status is pending, it will fetch for the updated payment through the payment client
-// and store it in the data source.
+// If payment status is pending or authorized, it will fetch for the updated charge through the payment client
+// and store it in the data source, with its fees once it is paid.
+// Offline payments such as bill payments stay pending for days, and a payment made before the expiry may be
+// reported after it, so a pending payment is never expired locally; only the payment gateway expires it.
 func (s *service) Find(id int) (*Payment, error) {
 	payment, err := s.repo.Find(id)
 	if err != nil {
 		return nil, err
 	}
 
-	if payment.OmiseCharge.Status != StatusPending {
+	// the payment status rather than the charge status, so that an operator's status override is kept.
+	if payment.Status != StatusPending && payment.Status != StatusAuthorized {
+		return payment, nil
+	}
+
+	return s.refresh(payment)
+}
+
+// Refresh refreshes a payment with the given id from its charge whatever its status,
+// so that a payment which went out of sync with the payment gateway can be corrected.
+func (s *service) Refresh(id int) (*Payment, error) {
+	payment, err := s.repo.Find(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.refresh(payment)
+}
+
+func (s *service) refresh(payment *Payment) (*Payment, error) {
+	// a blocked payment was never charged, there is nothing to refresh it from.
+	if payment.OmiseCharge.ID == "" {
 		return payment, nil
 	}
 
@@ -124,14 +444,137 @@ func (s *service) Find(id int) (*Payment, error) {
 		return nil, err
 	}
 
-	if err = s.repo.UpdateStatus(id, charge.Status); err != nil {
+	return s.updateCharge(payment, charge)
+}
+
+// FindByReference finds a payment with the given merchant reference.
+// The payment status is refreshed the same way as Find.
+func (s *service) FindByReference(reference string) (*Payment, error) {
+	payment, err := s.repo.FindByReference(reference)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Find(payment.ID)
+}
+
+// Capture captures the given amount of an authorized payment.
+// A zero amount captures the whole authorized amount, a smaller amount partially captures the payment.
+// The amount currency defaults to the payment currency.
+func (s *service) Capture(id int, amount Money) (*Payment, error) {
+	payment, err := s.repo.Find(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if payment.Status != StatusAuthorized {
+		return nil, ErrNotAuthorized
+	}
+
+	if amount.Currency == "" {
+		amount.Currency = payment.Amount.Currency
+	}
+	if err := validateCaptureAmount(amount, payment.Amount); err != nil {
+		return nil, err
+	}
+
+	charge, err := s.client.Capture(payment.OmiseCharge.ID, amount)
+	if err != nil {
 		return nil, err
 	}
 
-	payment, err = s.repo.Find(id)
+	return s.updateCharge(payment, charge)
+}
+
+// Void voids an authorized payment, the authorized amount is released to the payer.
+func (s *service) Void(id int) (*Payment, error) {
+	payment, err := s.repo.Find(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if payment.Status != StatusAuthorized {
+		return nil, ErrNotAuthorized
+	}
+
+	charge, err := s.client.Void(payment.OmiseCharge.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.updateCharge(payment, charge)
+}
+
+// updateCharge stores the charge of a payment with the event of its status change,
+// or of its fee if the fee became known after the payment succeeded.
+func (s *service) updateCharge(payment *Payment, charge *OmiseCharge) (*Payment, error) {
+	event := newStatusChangedEvent(payment, charge.Status)
+	if event == nil {
+		event = newFeeChargedEvent(payment.ID, payment.OmiseCharge, charge)
+	}
+	if err := s.repo.UpdateCharge(payment.ID, charge, event); err != nil {
+		return nil, err
+	}
+
+	payment, err := s.repo.Find(payment.ID)
 	if err != nil {
 		return nil, err
 	}
 
 	return payment, nil
 }
+
+// PaymentMethods returns the payment methods enabled for the payment gateway account which the service supports,
+// sorted by source type name. The currencies are limited to those supported by both.
+func (s *service) PaymentMethods() ([]PaymentMethod, error) {
+	enabled, err := s.client.PaymentMethods()
+	if err != nil {
+		return nil, err
+	}
+
+	var methods []PaymentMethod
+	for _, m := range enabled {
+		t, ok := sourceTypes[m.Name]
+		if !ok {
+			continue
+		}
+
+		var currencies []string
+		for _, c := range t.Currencies {
+			if contains(m.Currencies, c) {
+				currencies = append(currencies, c)
+			}
+		}
+		if len(currencies) == 0 {
+			continue
+		}
+		t.Currencies = currencies
+
+		methods = append(methods, PaymentMethod{
+			SourceType:       t,
+			CardBrands:       m.CardBrands,
+			InstallmentTerms: m.InstallmentTerms,
+		})
+	}
+
+	sort.Slice(methods, func(i, j int) bool {
+		return methods[i].Name < methods[j].Name
+	})
+
+	return methods, nil
+}
+
+// Installments returns the installment terms of the enabled installment payment methods available for the amount,
+// with the monthly payments the payer makes. If zeroInterest is true, the merchant absorbs the interest.
+func (s *service) Installments(amount Money, zeroInterest bool) ([]Installment, error) {
+	if err := validateInstallmentAmount(amount); err != nil {
+		return nil, err
+	}
+
+	enabled, err := s.client.PaymentMethods()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.validator.installments(enabled, amount, zeroInterest)
+}
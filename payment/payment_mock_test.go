@@ -1,27 +1,67 @@
 package payment
 
+import "time"
+
 type mockClient struct {
-	ChargeFn    func(req *Request) (*OmiseCharge, error)
-	GetChargeFn func(id string) (*OmiseCharge, error)
+	ChargeFn         func(id int, req *Request, customer *Customer) (*OmiseCharge, error)
+	GetChargeFn      func(id string) (*OmiseCharge, error)
+	CaptureFn        func(id string, amount Money) (*OmiseCharge, error)
+	VoidFn           func(id string) (*OmiseCharge, error)
+	RefundFn         func(chargeID string, amount Money) (*Refund, error)
+	PaymentMethodsFn func() ([]PaymentMethod, error)
+	CardFn           func(req *Request, customer *Customer) (*Card, error)
 }
 
-func (m *mockClient) Charge(req *Request) (*OmiseCharge, error) {
-	return m.ChargeFn(req)
+func (m *mockClient) Charge(id int, req *Request, customer *Customer) (*OmiseCharge, error) {
+	return m.ChargeFn(id, req, customer)
 }
 
 func (m *mockClient) GetCharge(id string) (*OmiseCharge, error) {
 	return m.GetChargeFn(id)
 }
 
+func (m *mockClient) Capture(id string, amount Money) (*OmiseCharge, error) {
+	return m.CaptureFn(id, amount)
+}
+
+func (m *mockClient) Void(id string) (*OmiseCharge, error) {
+	return m.VoidFn(id)
+}
+
+func (m *mockClient) Refund(chargeID string, amount Money) (*Refund, error) {
+	return m.RefundFn(chargeID, amount)
+}
+
+func (m *mockClient) PaymentMethods() ([]PaymentMethod, error) {
+	return m.PaymentMethodsFn()
+}
+
+func (m *mockClient) Card(req *Request, customer *Customer) (*Card, error) {
+	return m.CardFn(req, customer)
+}
+
 type mockRepository struct {
-	CreateFn        func(payment *Payment) error
-	FindFn          func(id int) (*Payment, error)
-	FindCalledTimes int
-	UpdateStatusFn  func(id int, status Status) error
+	NextIDFn              func() (int, error)
+	CreateFn              func(payment *Payment, event *Event) error
+	FindFn                func(id int) (*Payment, error)
+	FindCalledTimes       int
+	FindByReferenceFn     func(reference string) (*Payment, error)
+	FindPaidFn            func(from, to time.Time) ([]*Payment, error)
+	SearchFn              func(q *Query) ([]*Payment, error)
+	FindEventsFn          func(paymentID int) ([]*Event, error)
+	UpdateChargeFn        func(id int, charge *OmiseCharge, event *Event) error
+	OverrideStatusFn      func(override *StatusOverride, event *Event) error
+	CorrectChargeFn       func(override *StatusOverride, charge *OmiseCharge, event *Event) error
+	FindStatusOverridesFn func(paymentID int) ([]*StatusOverride, error)
+	RefundFn              func(id int, refund *Refund, event *Event) error
 }
 
-func (m *mockRepository) Create(payment *Payment) error {
-	return m.CreateFn(payment)
+func (m *mockRepository) NextID() (int, error) {
+	return m.NextIDFn()
+}
+
+func (m *mockRepository) Create(payment *Payment, event *Event) error {
+	return m.CreateFn(payment, event)
 }
 
 func (m *mockRepository) Find(id int) (*Payment, error) {
@@ -29,6 +69,132 @@ func (m *mockRepository) Find(id int) (*Payment, error) {
 	return m.FindFn(id)
 }
 
-func (m *mockRepository) UpdateStatus(id int, status Status) error {
-	return m.UpdateStatusFn(id, status)
+func (m *mockRepository) FindByReference(reference string) (*Payment, error) {
+	return m.FindByReferenceFn(reference)
+}
+
+func (m *mockRepository) FindPaid(from, to time.Time) ([]*Payment, error) {
+	return m.FindPaidFn(from, to)
+}
+
+func (m *mockRepository) Search(q *Query) ([]*Payment, error) {
+	return m.SearchFn(q)
+}
+
+func (m *mockRepository) FindEvents(paymentID int) ([]*Event, error) {
+	return m.FindEventsFn(paymentID)
+}
+
+func (m *mockRepository) UpdateCharge(id int, charge *OmiseCharge, event *Event) error {
+	return m.UpdateChargeFn(id, charge, event)
+}
+
+func (m *mockRepository) OverrideStatus(override *StatusOverride, event *Event) error {
+	return m.OverrideStatusFn(override, event)
+}
+
+func (m *mockRepository) CorrectCharge(override *StatusOverride, charge *OmiseCharge, event *Event) error {
+	return m.CorrectChargeFn(override, charge, event)
+}
+
+func (m *mockRepository) FindStatusOverrides(paymentID int) ([]*StatusOverride, error) {
+	return m.FindStatusOverridesFn(paymentID)
+}
+
+func (m *mockRepository) Refund(id int, refund *Refund, event *Event) error {
+	return m.RefundFn(id, refund, event)
+}
+
+type mockCustomerClient struct {
+	CreateCustomerFn func(customer *Customer) (string, error)
+	AttachCardFn     func(omiseCustomerID, cardToken string) (*SavedCard, error)
+	CardsFn          func(omiseCustomerID string) ([]SavedCard, error)
+	DeleteCardFn     func(omiseCustomerID, cardID string) error
+}
+
+func (m *mockCustomerClient) CreateCustomer(customer *Customer) (string, error) {
+	return m.CreateCustomerFn(customer)
+}
+
+func (m *mockCustomerClient) AttachCard(omiseCustomerID, cardToken string) (*SavedCard, error) {
+	return m.AttachCardFn(omiseCustomerID, cardToken)
+}
+
+func (m *mockCustomerClient) Cards(omiseCustomerID string) ([]SavedCard, error) {
+	return m.CardsFn(omiseCustomerID)
+}
+
+func (m *mockCustomerClient) DeleteCard(omiseCustomerID, cardID string) error {
+	return m.DeleteCardFn(omiseCustomerID, cardID)
+}
+
+type mockCustomerRepository struct {
+	CreateFn func(customer *Customer) error
+	FindFn   func(id int) (*Customer, error)
+}
+
+func (m *mockCustomerRepository) Create(customer *Customer) error {
+	return m.CreateFn(customer)
+}
+
+func (m *mockCustomerRepository) Find(id int) (*Customer, error) {
+	return m.FindFn(id)
+}
+
+type mockOutbox struct {
+	Events    []*Event
+	Published map[string][]int
+	Parked    map[string][]int
+}
+
+func (m *mockOutbox) FindUnpublishedEvents(relay string, limit int) ([]*Event, error) {
+	var events []*Event
+	for _, e := range m.Events {
+		_, published := e.Published[relay]
+		_, parked := e.Parked[relay]
+		if !published && !parked && len(events) < limit {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (m *mockOutbox) MarkEventPublished(relay string, id int, publishedAt time.Time) error {
+	for _, e := range m.Events {
+		if e.ID == id {
+			if e.Published == nil {
+				e.Published = make(map[string]time.Time)
+			}
+			e.Published[relay] = publishedAt
+		}
+	}
+	if m.Published == nil {
+		m.Published = make(map[string][]int)
+	}
+	m.Published[relay] = append(m.Published[relay], id)
+	return nil
+}
+
+func (m *mockOutbox) ParkEvent(relay string, id int, parkedAt time.Time) error {
+	for _, e := range m.Events {
+		if e.ID == id {
+			if e.Parked == nil {
+				e.Parked = make(map[string]time.Time)
+			}
+			e.Parked[relay] = parkedAt
+		}
+	}
+	if m.Parked == nil {
+		m.Parked = make(map[string][]int)
+	}
+	m.Parked[relay] = append(m.Parked[relay], id)
+	return nil
+}
+
+type mockPublisher struct {
+	PublishFn func(event *Event) error
+}
+
+func (m *mockPublisher) Publish(event *Event) error {
+	return m.PublishFn(event)
 }
@@ -3,13 +3,16 @@ package payment
 import (
 	"errors"
 	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
 
 var (
-	now          = time.Now()
-	errSomeError = errors.New("some error")
+	now           = time.Now()
+	errSomeError  = errors.New("some error")
+	testValidator = NewValidator([]string{"http", "https"}, nil, nil)
 )
 
 func TestService_CreatePaymentRequest(t *testing.T) {
@@ -20,6 +23,7 @@ func TestService_CreatePaymentRequest(t *testing.T) {
 		repoReturnErr   error
 		omiseChargeID   string
 		authorizeURI    string
+		referenceTaken  bool
 	}
 	type args struct {
 		req *Request
@@ -43,22 +47,21 @@ func TestService_CreatePaymentRequest(t *testing.T) {
 			},
 			args: args{
 				req: &Request{
-					Amount:     20000,
-					Currency:   "THB",
+					Amount:     NewMoney(20000, "THB"),
 					ReturnURI:  "http://returnuri.com",
 					SourceType: "internet_banking_scb",
+					Capture:    true,
 				},
 			},
 			want: &Payment{
-				ID:       1,
-				Status:   "pending",
-				Amount:   20000,
-				Currency: "THB",
+				ID:        1,
+				Status:    "pending",
+				Amount:    NewMoney(20000, "THB"),
+				ReturnURI: "http://returnuri.com",
 				OmiseCharge: &OmiseCharge{
 					ID:           "charge-1",
 					Status:       StatusPending,
-					Amount:       20000,
-					Currency:     "THB",
+					Amount:       NewMoney(20000, "THB"),
 					AuthorizeURI: "http://authuri.com",
 					SourceType:   "internet_banking_scb",
 					ReturnURI:    "http://returnuri.com",
@@ -80,10 +83,10 @@ func TestService_CreatePaymentRequest(t *testing.T) {
 			},
 			args: args{
 				req: &Request{
-					Amount:     20000,
-					Currency:   "THB",
+					Amount:     NewMoney(20000, "THB"),
 					ReturnURI:  "http://returnuri.com",
 					SourceType: "internet_banking_scb",
+					Capture:    true,
 				},
 			},
 			want:    nil,
@@ -101,10 +104,100 @@ func TestService_CreatePaymentRequest(t *testing.T) {
 			},
 			args: args{
 				req: &Request{
-					Amount:     20000,
-					Currency:   "THB",
+					Amount:     NewMoney(20000, "THB"),
 					ReturnURI:  "http://returnuri.com",
 					SourceType: "internet_banking_scb",
+					Capture:    true,
+				},
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "success with reference",
+			mocks: mocks{
+				paymentStatus:   StatusPending,
+				clientReturnErr: nil,
+				paymentID:       1,
+				repoReturnErr:   nil,
+				omiseChargeID:   "charge-1",
+				authorizeURI:    "http://authuri.com",
+				referenceTaken:  false,
+			},
+			args: args{
+				req: &Request{
+					Amount:      NewMoney(20000, "THB"),
+					ReturnURI:   "http://returnuri.com",
+					SourceType:  "internet_banking_scb",
+					Capture:     true,
+					Reference:   "order-1",
+					Description: "Order #1",
+					Metadata:    map[string]string{"customer": "c-1"},
+				},
+			},
+			want: &Payment{
+				ID:          1,
+				Reference:   "order-1",
+				Description: "Order #1",
+				Metadata:    map[string]string{"customer": "c-1"},
+				Status:      "pending",
+				Amount:      NewMoney(20000, "THB"),
+				ReturnURI:   "http://returnuri.com",
+				OmiseCharge: &OmiseCharge{
+					ID:           "charge-1",
+					Status:       StatusPending,
+					Amount:       NewMoney(20000, "THB"),
+					AuthorizeURI: "http://authuri.com",
+					SourceType:   "internet_banking_scb",
+					ReturnURI:    "http://returnuri.com",
+				},
+				CreatedAt: now,
+				UpdatedAt: now,
+			},
+			wantErr: false,
+		},
+		{
+			name: "duplicate reference",
+			mocks: mocks{
+				referenceTaken: true,
+			},
+			args: args{
+				req: &Request{
+					Amount:     NewMoney(20000, "THB"),
+					ReturnURI:  "http://returnuri.com",
+					SourceType: "internet_banking_scb",
+					Capture:    true,
+					Reference:  "order-1",
+				},
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:  "too many metadata keys",
+			mocks: mocks{},
+			args: args{
+				req: &Request{
+					Amount:     NewMoney(20000, "THB"),
+					ReturnURI:  "http://returnuri.com",
+					SourceType: "internet_banking_scb",
+					Capture:    true,
+					Metadata:   metadataOfSize(MaxMetadataKeys + 1),
+				},
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:  "metadata value too long",
+			mocks: mocks{},
+			args: args{
+				req: &Request{
+					Amount:     NewMoney(20000, "THB"),
+					ReturnURI:  "http://returnuri.com",
+					SourceType: "internet_banking_scb",
+					Capture:    true,
+					Metadata:   map[string]string{"note": strings.Repeat("x", MaxMetadataValueLength+1)},
 				},
 			},
 			want:    nil,
@@ -116,12 +209,25 @@ func TestService_CreatePaymentRequest(t *testing.T) {
 			client := &mockClient{}
 			repo := &mockRepository{}
 
-			client.ChargeFn = func(req *Request) (*OmiseCharge, error) {
+			repo.FindByReferenceFn = func(reference string) (*Payment, error) {
+				if tt.mocks.referenceTaken {
+					return &Payment{ID: 1, Reference: reference}, nil
+				}
+				return nil, ErrPaymentNotFound
+			}
+
+			repo.NextIDFn = func() (int, error) {
+				return tt.mocks.paymentID, nil
+			}
+
+			client.ChargeFn = func(id int, req *Request, customer *Customer) (*OmiseCharge, error) {
+				if id != tt.mocks.paymentID {
+					t.Errorf("Client.Charge() id = %v, want %v", id, tt.mocks.paymentID)
+				}
 				charge := &OmiseCharge{
 					ID:           tt.mocks.omiseChargeID,
 					Status:       tt.mocks.paymentStatus,
 					Amount:       tt.args.req.Amount,
-					Currency:     tt.args.req.Currency,
 					AuthorizeURI: tt.mocks.authorizeURI,
 					SourceType:   tt.args.req.SourceType,
 					ReturnURI:    tt.args.req.ReturnURI,
@@ -129,14 +235,16 @@ func TestService_CreatePaymentRequest(t *testing.T) {
 				return charge, tt.mocks.clientReturnErr
 			}
 
-			repo.CreateFn = func(payment *Payment) error {
-				payment.ID = tt.mocks.paymentID
+			repo.CreateFn = func(payment *Payment, event *Event) error {
+				if event == nil || event.Type != EventCreated || event.PaymentID != payment.ID {
+					t.Errorf("Create() called with event %v", event)
+				}
 				payment.CreatedAt = now
 				payment.UpdatedAt = now
 				return tt.mocks.repoReturnErr
 			}
 
-			s := NewService(client, repo)
+			s := NewService(client, repo, nil, testValidator, nil)
 			got, err := s.CreatePaymentRequest(tt.args.req)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Service.CreatePaymentRequest() error = %v, wantErr %v", err, tt.wantErr)
@@ -155,7 +263,7 @@ func TestService_Find(t *testing.T) {
 		findErrs        [2]error
 		getChargeReturn *OmiseCharge
 		getChargeErr    error
-		updateStatusErr error
+		updateChargeErr error
 	}
 	type args struct {
 		id int
@@ -172,15 +280,13 @@ func TestService_Find(t *testing.T) {
 			mocks: mocks{
 				findReturns: [2]*Payment{
 					{
-						ID:       1,
-						Status:   StatusSuccessful,
-						Amount:   20000,
-						Currency: "THB",
+						ID:     1,
+						Status: StatusSuccessful,
+						Amount: NewMoney(20000, "THB"),
 						OmiseCharge: &OmiseCharge{
 							ID:           "charge-1",
 							Status:       StatusSuccessful,
-							Amount:       20000,
-							Currency:     "THB",
+							Amount:       NewMoney(20000, "THB"),
 							AuthorizeURI: "http://authuri.com",
 							SourceType:   "internet_banking_scb",
 							ReturnURI:    "http://returnuri.com",
@@ -194,21 +300,19 @@ func TestService_Find(t *testing.T) {
 				},
 				getChargeReturn: nil,
 				getChargeErr:    nil,
-				updateStatusErr: nil,
+				updateChargeErr: nil,
 			},
 			args: args{
 				id: 1,
 			},
 			want: &Payment{
-				ID:       1,
-				Status:   StatusSuccessful,
-				Amount:   20000,
-				Currency: "THB",
+				ID:     1,
+				Status: StatusSuccessful,
+				Amount: NewMoney(20000, "THB"),
 				OmiseCharge: &OmiseCharge{
 					ID:           "charge-1",
 					Status:       StatusSuccessful,
-					Amount:       20000,
-					Currency:     "THB",
+					Amount:       NewMoney(20000, "THB"),
 					AuthorizeURI: "http://authuri.com",
 					SourceType:   "internet_banking_scb",
 					ReturnURI:    "http://returnuri.com",
@@ -223,15 +327,13 @@ func TestService_Find(t *testing.T) {
 			mocks: mocks{
 				findReturns: [2]*Payment{
 					{
-						ID:       1,
-						Status:   StatusPending,
-						Amount:   20000,
-						Currency: "THB",
+						ID:     1,
+						Status: StatusPending,
+						Amount: NewMoney(20000, "THB"),
 						OmiseCharge: &OmiseCharge{
 							ID:           "charge-1",
 							Status:       StatusPending,
-							Amount:       20000,
-							Currency:     "THB",
+							Amount:       NewMoney(20000, "THB"),
 							AuthorizeURI: "http://authuri.com",
 							SourceType:   "internet_banking_scb",
 							ReturnURI:    "http://returnuri.com",
@@ -240,15 +342,13 @@ func TestService_Find(t *testing.T) {
 						UpdatedAt: now,
 					},
 					{
-						ID:       1,
-						Status:   StatusSuccessful,
-						Amount:   20000,
-						Currency: "THB",
+						ID:     1,
+						Status: StatusSuccessful,
+						Amount: NewMoney(20000, "THB"),
 						OmiseCharge: &OmiseCharge{
 							ID:           "charge-1",
 							Status:       StatusSuccessful,
-							Amount:       20000,
-							Currency:     "THB",
+							Amount:       NewMoney(20000, "THB"),
 							AuthorizeURI: "http://authuri.com",
 							SourceType:   "internet_banking_scb",
 							ReturnURI:    "http://returnuri.com",
@@ -264,28 +364,25 @@ func TestService_Find(t *testing.T) {
 				getChargeReturn: &OmiseCharge{
 					ID:           "charge-1",
 					Status:       StatusSuccessful,
-					Amount:       20000,
-					Currency:     "THB",
+					Amount:       NewMoney(20000, "THB"),
 					AuthorizeURI: "http://authuri.com",
 					SourceType:   "internet_banking_scb",
 					ReturnURI:    "http://returnuri.com",
 				},
 				getChargeErr:    nil,
-				updateStatusErr: nil,
+				updateChargeErr: nil,
 			},
 			args: args{
 				id: 1,
 			},
 			want: &Payment{
-				ID:       1,
-				Status:   StatusSuccessful,
-				Amount:   20000,
-				Currency: "THB",
+				ID:     1,
+				Status: StatusSuccessful,
+				Amount: NewMoney(20000, "THB"),
 				OmiseCharge: &OmiseCharge{
 					ID:           "charge-1",
 					Status:       StatusSuccessful,
-					Amount:       20000,
-					Currency:     "THB",
+					Amount:       NewMoney(20000, "THB"),
 					AuthorizeURI: "http://authuri.com",
 					SourceType:   "internet_banking_scb",
 					ReturnURI:    "http://returnuri.com",
@@ -300,15 +397,13 @@ func TestService_Find(t *testing.T) {
 			mocks: mocks{
 				findReturns: [2]*Payment{
 					{
-						ID:       1,
-						Status:   StatusPending,
-						Amount:   20000,
-						Currency: "THB",
+						ID:     1,
+						Status: StatusPending,
+						Amount: NewMoney(20000, "THB"),
 						OmiseCharge: &OmiseCharge{
 							ID:           "charge-1",
 							Status:       StatusPending,
-							Amount:       20000,
-							Currency:     "THB",
+							Amount:       NewMoney(20000, "THB"),
 							AuthorizeURI: "http://authuri.com",
 							SourceType:   "internet_banking_scb",
 							ReturnURI:    "http://returnuri.com",
@@ -317,15 +412,13 @@ func TestService_Find(t *testing.T) {
 						UpdatedAt: now,
 					},
 					{
-						ID:       1,
-						Status:   StatusSuccessful,
-						Amount:   20000,
-						Currency: "THB",
+						ID:     1,
+						Status: StatusSuccessful,
+						Amount: NewMoney(20000, "THB"),
 						OmiseCharge: &OmiseCharge{
 							ID:           "charge-1",
 							Status:       StatusSuccessful,
-							Amount:       20000,
-							Currency:     "THB",
+							Amount:       NewMoney(20000, "THB"),
 							AuthorizeURI: "http://authuri.com",
 							SourceType:   "internet_banking_scb",
 							ReturnURI:    "http://returnuri.com",
@@ -341,14 +434,13 @@ func TestService_Find(t *testing.T) {
 				getChargeReturn: &OmiseCharge{
 					ID:           "charge-1",
 					Status:       StatusSuccessful,
-					Amount:       20000,
-					Currency:     "THB",
+					Amount:       NewMoney(20000, "THB"),
 					AuthorizeURI: "http://authuri.com",
 					SourceType:   "internet_banking_scb",
 					ReturnURI:    "http://returnuri.com",
 				},
 				getChargeErr:    nil,
-				updateStatusErr: nil,
+				updateChargeErr: nil,
 			},
 			args: args{
 				id: 1,
@@ -361,15 +453,13 @@ func TestService_Find(t *testing.T) {
 			mocks: mocks{
 				findReturns: [2]*Payment{
 					{
-						ID:       1,
-						Status:   StatusPending,
-						Amount:   20000,
-						Currency: "THB",
+						ID:     1,
+						Status: StatusPending,
+						Amount: NewMoney(20000, "THB"),
 						OmiseCharge: &OmiseCharge{
 							ID:           "charge-1",
 							Status:       StatusPending,
-							Amount:       20000,
-							Currency:     "THB",
+							Amount:       NewMoney(20000, "THB"),
 							AuthorizeURI: "http://authuri.com",
 							SourceType:   "internet_banking_scb",
 							ReturnURI:    "http://returnuri.com",
@@ -378,15 +468,13 @@ func TestService_Find(t *testing.T) {
 						UpdatedAt: now,
 					},
 					{
-						ID:       1,
-						Status:   StatusSuccessful,
-						Amount:   20000,
-						Currency: "THB",
+						ID:     1,
+						Status: StatusSuccessful,
+						Amount: NewMoney(20000, "THB"),
 						OmiseCharge: &OmiseCharge{
 							ID:           "charge-1",
 							Status:       StatusSuccessful,
-							Amount:       20000,
-							Currency:     "THB",
+							Amount:       NewMoney(20000, "THB"),
 							AuthorizeURI: "http://authuri.com",
 							SourceType:   "internet_banking_scb",
 							ReturnURI:    "http://returnuri.com",
@@ -402,14 +490,13 @@ func TestService_Find(t *testing.T) {
 				getChargeReturn: &OmiseCharge{
 					ID:           "charge-1",
 					Status:       StatusSuccessful,
-					Amount:       20000,
-					Currency:     "THB",
+					Amount:       NewMoney(20000, "THB"),
 					AuthorizeURI: "http://authuri.com",
 					SourceType:   "internet_banking_scb",
 					ReturnURI:    "http://returnuri.com",
 				},
 				getChargeErr:    nil,
-				updateStatusErr: nil,
+				updateChargeErr: nil,
 			},
 			args: args{
 				id: 1,
@@ -422,15 +509,13 @@ func TestService_Find(t *testing.T) {
 			mocks: mocks{
 				findReturns: [2]*Payment{
 					{
-						ID:       1,
-						Status:   StatusPending,
-						Amount:   20000,
-						Currency: "THB",
+						ID:     1,
+						Status: StatusPending,
+						Amount: NewMoney(20000, "THB"),
 						OmiseCharge: &OmiseCharge{
 							ID:           "charge-1",
 							Status:       StatusPending,
-							Amount:       20000,
-							Currency:     "THB",
+							Amount:       NewMoney(20000, "THB"),
 							AuthorizeURI: "http://authuri.com",
 							SourceType:   "internet_banking_scb",
 							ReturnURI:    "http://returnuri.com",
@@ -444,7 +529,7 @@ func TestService_Find(t *testing.T) {
 				},
 				getChargeReturn: nil,
 				getChargeErr:    errSomeError,
-				updateStatusErr: nil,
+				updateChargeErr: nil,
 			},
 			args: args{
 				id: 1,
@@ -453,19 +538,17 @@ func TestService_Find(t *testing.T) {
 			wantErr: errSomeError,
 		},
 		{
-			name: "UpdateStatus error",
+			name: "UpdateCharge error",
 			mocks: mocks{
 				findReturns: [2]*Payment{
 					{
-						ID:       1,
-						Status:   StatusPending,
-						Amount:   20000,
-						Currency: "THB",
+						ID:     1,
+						Status: StatusPending,
+						Amount: NewMoney(20000, "THB"),
 						OmiseCharge: &OmiseCharge{
 							ID:           "charge-1",
 							Status:       StatusPending,
-							Amount:       20000,
-							Currency:     "THB",
+							Amount:       NewMoney(20000, "THB"),
 							AuthorizeURI: "http://authuri.com",
 							SourceType:   "internet_banking_scb",
 							ReturnURI:    "http://returnuri.com",
@@ -480,14 +563,13 @@ func TestService_Find(t *testing.T) {
 				getChargeReturn: &OmiseCharge{
 					ID:           "charge-1",
 					Status:       StatusSuccessful,
-					Amount:       20000,
-					Currency:     "THB",
+					Amount:       NewMoney(20000, "THB"),
 					AuthorizeURI: "http://authuri.com",
 					SourceType:   "internet_banking_scb",
 					ReturnURI:    "http://returnuri.com",
 				},
 				getChargeErr:    nil,
-				updateStatusErr: errSomeError,
+				updateChargeErr: errSomeError,
 			},
 			args: args{
 				id: 1,
@@ -509,11 +591,11 @@ func TestService_Find(t *testing.T) {
 				return tt.mocks.findReturns[repo.FindCalledTimes-1], tt.mocks.findErrs[repo.FindCalledTimes-1]
 			}
 
-			repo.UpdateStatusFn = func(id int, status Status) error {
-				return tt.mocks.updateStatusErr
+			repo.UpdateChargeFn = func(id int, charge *OmiseCharge, event *Event) error {
+				return tt.mocks.updateChargeErr
 			}
 
-			s := NewService(client, repo)
+			s := NewService(client, repo, nil, testValidator, nil)
 			got, err := s.Find(tt.args.id)
 			if err != tt.wantErr {
 				t.Errorf("Service.Find() error = %v, wantErr %v", err, tt.wantErr)
@@ -525,3 +607,554 @@ func TestService_Find(t *testing.T) {
 		})
 	}
 }
+
+func TestService_FindByReference(t *testing.T) {
+	tests := []struct {
+		name               string
+		findByReferenceErr error
+		want               *Payment
+		wantErr            error
+	}{
+		{
+			name:               "success",
+			findByReferenceErr: nil,
+			want: &Payment{
+				ID:        1,
+				Reference: "order-1",
+				Status:    StatusSuccessful,
+				OmiseCharge: &OmiseCharge{
+					ID:     "charge-1",
+					Status: StatusSuccessful,
+				},
+			},
+			wantErr: nil,
+		},
+		{
+			name:               "not found",
+			findByReferenceErr: errSomeError,
+			want:               nil,
+			wantErr:            errSomeError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockClient{}
+			repo := &mockRepository{}
+
+			p := &Payment{
+				ID:        1,
+				Reference: "order-1",
+				Status:    StatusSuccessful,
+				OmiseCharge: &OmiseCharge{
+					ID:     "charge-1",
+					Status: StatusSuccessful,
+				},
+			}
+
+			repo.FindByReferenceFn = func(reference string) (*Payment, error) {
+				if tt.findByReferenceErr != nil {
+					return nil, tt.findByReferenceErr
+				}
+				return p, nil
+			}
+
+			repo.FindFn = func(id int) (*Payment, error) {
+				return p, nil
+			}
+
+			s := NewService(client, repo, nil, testValidator, nil)
+			got, err := s.FindByReference("order-1")
+			if err != tt.wantErr {
+				t.Errorf("Service.FindByReference() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Service.FindByReference() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func metadataOfSize(n int) map[string]string {
+	m := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		m["key"+strconv.Itoa(i)] = "value"
+	}
+	return m
+}
+
+func TestService_Capture(t *testing.T) {
+	authorized := func() *Payment {
+		return &Payment{
+			ID:     1,
+			Status: StatusAuthorized,
+			Amount: NewMoney(20000, "THB"),
+			OmiseCharge: &OmiseCharge{
+				ID:         "charge-1",
+				Status:     StatusAuthorized,
+				Amount:     NewMoney(20000, "THB"),
+				SourceType: SourceTypeCard,
+			},
+		}
+	}
+	tests := []struct {
+		name        string
+		payment     *Payment
+		amount      Money
+		wantCapture Money
+		wantStatus  Status
+		wantErr     error
+	}{
+		{
+			name:        "full capture",
+			payment:     authorized(),
+			amount:      Money{},
+			wantCapture: NewMoney(0, "THB"),
+			wantStatus:  StatusCaptured,
+		},
+		{
+			name:        "partial capture",
+			payment:     authorized(),
+			amount:      NewMoney(15000, ""),
+			wantCapture: NewMoney(15000, "THB"),
+			wantStatus:  StatusCaptured,
+		},
+		{
+			name:    "capture more than authorized",
+			payment: authorized(),
+			amount:  NewMoney(20001, "THB"),
+			wantErr: ErrInvalidRequest,
+		},
+		{
+			name:    "capture in another currency",
+			payment: authorized(),
+			amount:  NewMoney(100, "USD"),
+			wantErr: ErrInvalidRequest,
+		},
+		{
+			name: "not authorized",
+			payment: &Payment{
+				ID:          1,
+				Status:      StatusSuccessful,
+				Amount:      NewMoney(20000, "THB"),
+				OmiseCharge: &OmiseCharge{ID: "charge-1", Status: StatusSuccessful},
+			},
+			amount:  Money{},
+			wantErr: ErrNotAuthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockClient{}
+			repo := &mockRepository{}
+
+			repo.FindFn = func(id int) (*Payment, error) {
+				return tt.payment, nil
+			}
+			client.CaptureFn = func(id string, amount Money) (*OmiseCharge, error) {
+				if amount != tt.wantCapture {
+					t.Errorf("Client.Capture() amount = %v, want %v", amount, tt.wantCapture)
+				}
+				charge := *tt.payment.OmiseCharge
+				charge.Status = StatusCaptured
+				return &charge, nil
+			}
+			repo.UpdateChargeFn = func(id int, charge *OmiseCharge, event *Event) error {
+				tt.payment.Status = charge.Status
+				tt.payment.OmiseCharge = charge
+				return nil
+			}
+
+			s := NewService(client, repo, nil, testValidator, nil)
+			got, err := s.Capture(1, tt.amount)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Service.Capture() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.Status != tt.wantStatus {
+				t.Errorf("Service.Capture() status = %v, want %v", got.Status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestService_Void(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     Status
+		voidErr    error
+		wantStatus Status
+		wantErr    error
+	}{
+		{
+			name:       "success",
+			status:     StatusAuthorized,
+			wantStatus: StatusVoided,
+		},
+		{
+			name:    "not authorized",
+			status:  StatusCaptured,
+			wantErr: ErrNotAuthorized,
+		},
+		{
+			name:    "client error",
+			status:  StatusAuthorized,
+			voidErr: errSomeError,
+			wantErr: errSomeError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockClient{}
+			repo := &mockRepository{}
+
+			p := &Payment{
+				ID:          1,
+				Status:      tt.status,
+				Amount:      NewMoney(20000, "THB"),
+				OmiseCharge: &OmiseCharge{ID: "charge-1", Status: tt.status},
+			}
+			repo.FindFn = func(id int) (*Payment, error) {
+				return p, nil
+			}
+			client.VoidFn = func(id string) (*OmiseCharge, error) {
+				if tt.voidErr != nil {
+					return nil, tt.voidErr
+				}
+				return &OmiseCharge{ID: id, Status: StatusVoided}, nil
+			}
+			repo.UpdateChargeFn = func(id int, charge *OmiseCharge, event *Event) error {
+				p.Status = charge.Status
+				p.OmiseCharge = charge
+				return nil
+			}
+
+			s := NewService(client, repo, nil, testValidator, nil)
+			got, err := s.Void(1)
+			if err != tt.wantErr {
+				t.Fatalf("Service.Void() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.Status != tt.wantStatus {
+				t.Errorf("Service.Void() status = %v, want %v", got.Status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestService_PaymentMethods(t *testing.T) {
+	client := &mockClient{}
+	repo := &mockRepository{}
+
+	client.PaymentMethodsFn = func() ([]PaymentMethod, error) {
+		return []PaymentMethod{
+			{SourceType: SourceType{Name: "promptpay", Currencies: []string{"THB"}}},
+			{SourceType: SourceType{Name: "card", Currencies: []string{"THB", "USD", "XXX"}}, CardBrands: []string{"Visa"}},
+			{SourceType: SourceType{Name: "unknown_source", Currencies: []string{"THB"}}},
+			{SourceType: SourceType{Name: "econtext", Currencies: []string{"THB"}}},
+		}, nil
+	}
+
+	s := NewService(client, repo, nil, testValidator, nil)
+	got, err := s.PaymentMethods()
+	if err != nil {
+		t.Fatalf("Service.PaymentMethods() error = %v", err)
+	}
+
+	card, _ := LookupSourceType("card")
+	card.Currencies = []string{"THB", "USD"}
+	promptpay, _ := LookupSourceType("promptpay")
+	want := []PaymentMethod{
+		{SourceType: card, CardBrands: []string{"Visa"}},
+		{SourceType: promptpay},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Service.PaymentMethods() = %v, want %v", got, want)
+	}
+}
+
+func TestService_Installments(t *testing.T) {
+	client := &mockClient{}
+	repo := &mockRepository{}
+
+	client.PaymentMethodsFn = func() ([]PaymentMethod, error) {
+		return []PaymentMethod{
+			{SourceType: SourceType{Name: "installment_kbank", Currencies: []string{"THB"}}, InstallmentTerms: []int{3}},
+			{SourceType: SourceType{Name: "card", Currencies: []string{"THB"}}},
+		}, nil
+	}
+
+	s := NewService(client, repo, nil, testValidator, nil)
+
+	got, err := s.Installments(NewMoney(300000, "THB"), true)
+	if err != nil {
+		t.Fatalf("Service.Installments() error = %v", err)
+	}
+	want := []Installment{
+		{
+			SourceType: "installment_kbank",
+			Terms: []InstallmentTerm{
+				{Term: 3, MonthlyAmount: NewMoney(100000, "THB"), Interest: NewMoney(0, "THB"), TotalAmount: NewMoney(300000, "THB")},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Service.Installments() = %v, want %v", got, want)
+	}
+
+	_, err = s.Installments(NewMoney(300000, "USD"), false)
+	if !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("Service.Installments() error = %v, want %v", err, ErrInvalidRequest)
+	}
+}
+
+func TestBillPayment_Barcode(t *testing.T) {
+	b := &BillPayment{TaxID: "010554013654301", Reference1: "1234567890", Reference2: "0001"}
+	want := "|010554013654301\r1234567890\r0001\r150000"
+	if got := b.Barcode(NewMoney(150000, "THB")); got != want {
+		t.Errorf("BillPayment.Barcode() = %q, want %q", got, want)
+	}
+}
+
+func TestPayment_Payable(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		payment *Payment
+		want    bool
+	}{
+		{
+			name:    "pending without expiry",
+			payment: &Payment{Status: StatusPending},
+			want:    true,
+		},
+		{
+			name:    "pending bill payment",
+			payment: &Payment{Status: StatusPending, BillPayment: &BillPayment{ExpiresAt: now.Add(72 * time.Hour)}},
+			want:    true,
+		},
+		{
+			name:    "expired bill payment",
+			payment: &Payment{Status: StatusPending, BillPayment: &BillPayment{ExpiresAt: now.Add(-time.Second)}},
+			want:    false,
+		},
+		{
+			name:    "expired QR code",
+			payment: &Payment{Status: StatusPending, QRCode: &QRCode{ExpiresAt: now}},
+			want:    false,
+		},
+		{
+			name:    "successful",
+			payment: &Payment{Status: StatusSuccessful, BillPayment: &BillPayment{ExpiresAt: now.Add(time.Hour)}},
+			want:    false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.payment.Payable(now); got != tt.want {
+				t.Errorf("Payment.Payable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_CreatePaymentRequest_savedCard(t *testing.T) {
+	customer := &Customer{ID: 1, OmiseCustomerID: "cust_test_1"}
+	req := func(customerID int) *Request {
+		return &Request{
+			Amount:        NewMoney(20000, "THB"),
+			ReturnURI:     "http://returnuri.com",
+			SourceType:    SourceTypeCard,
+			SourceDetails: SourceDetails{CardID: "card_test_1"},
+			CustomerID:    customerID,
+		}
+	}
+
+	client := &mockClient{}
+	repo := &mockRepository{}
+	customers := &mockCustomerRepository{}
+
+	customers.FindFn = func(id int) (*Customer, error) {
+		if id != customer.ID {
+			return nil, ErrCustomerNotFound
+		}
+		return customer, nil
+	}
+	repo.NextIDFn = func() (int, error) {
+		return 1, nil
+	}
+	client.ChargeFn = func(id int, req *Request, c *Customer) (*OmiseCharge, error) {
+		if c != customer {
+			t.Errorf("Client.Charge() customer = %v, want %v", c, customer)
+		}
+		return &OmiseCharge{ID: "charge-1", Status: StatusSuccessful, Amount: req.Amount, SourceType: SourceTypeCard}, nil
+	}
+	repo.CreateFn = func(payment *Payment, event *Event) error {
+		return nil
+	}
+
+	s := NewService(client, repo, customers, testValidator, nil)
+
+	got, err := s.CreatePaymentRequest(req(1))
+	if err != nil {
+		t.Fatalf("Service.CreatePaymentRequest() error = %v", err)
+	}
+	if got.CustomerID != 1 {
+		t.Errorf("Service.CreatePaymentRequest() customer id = %v, want %v", got.CustomerID, 1)
+	}
+
+	if _, err := s.CreatePaymentRequest(req(2)); err != ErrCustomerNotFound {
+		t.Errorf("Service.CreatePaymentRequest() error = %v, want %v", err, ErrCustomerNotFound)
+	}
+}
+
+func TestService_Find_event(t *testing.T) {
+	tests := []struct {
+		name         string
+		chargeStatus Status
+		want         *Event
+	}{
+		{
+			name:         "status changed",
+			chargeStatus: StatusSuccessful,
+			want: &Event{
+				DeduplicationID: "payment.status_changed:1:pending->successful:1",
+				Type:            EventStatusChanged,
+				PaymentID:       1,
+				PreviousStatus:  StatusPending,
+			},
+		},
+		{name: "status unchanged", chargeStatus: StatusPending},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockClient{}
+			repo := &mockRepository{}
+
+			client.GetChargeFn = func(id string) (*OmiseCharge, error) {
+				return &OmiseCharge{ID: id, Status: tt.chargeStatus}, nil
+			}
+			repo.FindFn = func(id int) (*Payment, error) {
+				return &Payment{ID: id, Status: StatusPending, OmiseCharge: &OmiseCharge{ID: "charge-1", Status: StatusPending}}, nil
+			}
+			var got *Event
+			repo.UpdateChargeFn = func(id int, charge *OmiseCharge, event *Event) error {
+				got = event
+				return nil
+			}
+
+			s := NewService(client, repo, nil, testValidator, nil)
+			if _, err := s.Find(1); err != nil {
+				t.Fatalf("Service.Find() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Service.Find() event = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_Refresh(t *testing.T) {
+	client := &mockClient{}
+	repo := &mockRepository{}
+
+	stored := &Payment{ID: 1, Status: StatusFailed, OmiseCharge: &OmiseCharge{ID: "charge-1", Status: StatusFailed}}
+	client.GetChargeFn = func(id string) (*OmiseCharge, error) {
+		if id != "charge-1" {
+			t.Errorf("GetCharge() called with %v", id)
+		}
+		return &OmiseCharge{ID: id, Status: StatusSuccessful}, nil
+	}
+	repo.FindFn = func(id int) (*Payment, error) {
+		return stored, nil
+	}
+	var got *Event
+	repo.UpdateChargeFn = func(id int, charge *OmiseCharge, event *Event) error {
+		stored = &Payment{ID: id, Status: charge.Status, OmiseCharge: charge}
+		got = event
+		return nil
+	}
+
+	s := NewService(client, repo, nil, testValidator, nil)
+	payment, err := s.Refresh(1)
+	if err != nil {
+		t.Fatalf("Service.Refresh() error = %v", err)
+	}
+	if payment.Status != StatusSuccessful {
+		t.Errorf("Service.Refresh() status = %v, want %v", payment.Status, StatusSuccessful)
+	}
+	want := &Event{
+		DeduplicationID: "payment.status_changed:1:failed->successful:1",
+		Type:            EventStatusChanged,
+		PaymentID:       1,
+		PreviousStatus:  StatusFailed,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Service.Refresh() event = %v, want %v", got, want)
+	}
+}
+
+func TestService_Refresh_fee(t *testing.T) {
+	fee := func(c *OmiseCharge) *OmiseCharge {
+		c.Fee = NewMoney(730, "THB")
+		c.FeeVAT = NewMoney(51, "THB")
+		return c
+	}
+	tests := []struct {
+		name     string
+		status   Status
+		previous *OmiseCharge
+		charge   *OmiseCharge
+		want     *Event
+	}{
+		{
+			name:     "fee known after the payment succeeded",
+			status:   StatusSuccessful,
+			previous: &OmiseCharge{ID: "charge-1", Status: StatusSuccessful},
+			charge:   fee(&OmiseCharge{ID: "charge-1", Status: StatusSuccessful}),
+			want:     &Event{DeduplicationID: "payment.fee_charged:1", Type: EventFeeCharged, PaymentID: 1},
+		},
+		{
+			name:     "fee known before",
+			status:   StatusSuccessful,
+			previous: fee(&OmiseCharge{ID: "charge-1", Status: StatusSuccessful}),
+			charge:   fee(&OmiseCharge{ID: "charge-1", Status: StatusSuccessful}),
+		},
+		{
+			name:     "fee known when the payment succeeds",
+			status:   StatusPending,
+			previous: &OmiseCharge{ID: "charge-1", Status: StatusPending},
+			charge:   fee(&OmiseCharge{ID: "charge-1", Status: StatusSuccessful}),
+			want:     &Event{DeduplicationID: "payment.status_changed:1:pending->successful:1", Type: EventStatusChanged, PaymentID: 1, PreviousStatus: StatusPending},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockClient{}
+			client.GetChargeFn = func(id string) (*OmiseCharge, error) {
+				return tt.charge, nil
+			}
+			repo := &mockRepository{}
+			repo.FindFn = func(id int) (*Payment, error) {
+				return &Payment{ID: id, Status: tt.status, OmiseCharge: tt.previous}, nil
+			}
+			var got *Event
+			repo.UpdateChargeFn = func(id int, charge *OmiseCharge, event *Event) error {
+				got = event
+				return nil
+			}
+
+			s := NewService(client, repo, nil, testValidator, nil)
+			if _, err := s.Refresh(1); err != nil {
+				t.Fatalf("Service.Refresh() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Service.Refresh() event = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package payment
+
+import (
+	"fmt"
+	"time"
+)
+
+// Refund represents a refund of a paid payment, the refunded amount is paid back to the payer.
+// ID is the id of the Omise refund. A payment may be refunded many times until its paid amount is refunded.
+type Refund struct {
+	ID        string
+	Amount    Money
+	CreatedAt time.Time
+}
+
+// RefundedAmount returns the total amount refunded from the payment.
+func (p *Payment) RefundedAmount() Money {
+	refunded := NewMoney(0, p.Amount.Currency)
+	for _, r := range p.Refunds {
+		refunded.Amount += r.Amount.Amount
+	}
+	return refunded
+}
+
+// Refundable reports whether the payment is paid, so that it can be refunded.
+func (p *Payment) Refundable() bool {
+	return p.Status == StatusSuccessful || p.Status == StatusCaptured
+}
+
+// Refund refunds the given amount of a paid payment. A zero amount refunds the amount which is not refunded yet,
+// the amount currency defaults to the payment currency.
+// The refund is stored with a refunded event in the same write, the payment status does not change.
+func (s *service) Refund(id int, amount Money) (*Payment, error) {
+	payment, err := s.repo.Find(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !payment.Refundable() {
+		return nil, ErrNotPaid
+	}
+
+	refundable := NewMoney(payment.PaidAmount().Amount-payment.RefundedAmount().Amount, payment.Amount.Currency)
+	if refundable.Amount <= 0 {
+		return nil, ErrFullyRefunded
+	}
+	if amount.Currency == "" {
+		amount.Currency = payment.Amount.Currency
+	}
+	if err := validateRefundAmount(amount, refundable); err != nil {
+		return nil, err
+	}
+	if amount.IsZero() {
+		amount = refundable
+	}
+
+	refund, err := s.client.Refund(payment.OmiseCharge.ID, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.Refund(id, refund, newRefundedEvent(id, refund)); err != nil {
+		return nil, err
+	}
+
+	return s.repo.Find(id)
+}
+
+func validateRefundAmount(amount, refundable Money) error {
+	verr := &ValidationError{}
+	c, err := amount.Cmp(refundable)
+	switch {
+	case err != nil:
+		verr.add("currency", CodeInvalid, fmt.Sprintf("currency must be %s", refundable.Currency))
+	case amount.IsNegative():
+		verr.add("amount", CodeInvalid, "amount must be positive")
+	case c > 0:
+		verr.add("amount", CodeOutOfRange, fmt.Sprintf("amount must not exceed the refundable amount %s", refundable))
+	default:
+		return nil
+	}
+	return verr
+}
@@ -0,0 +1,117 @@
+package payment
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestService_Refund(t *testing.T) {
+	partiallyRefunded := []*Refund{{ID: "rfnd_1", Amount: NewMoney(5000, "THB")}}
+	tests := []struct {
+		name       string
+		status     Status
+		captured   Money
+		refunds    []*Refund
+		amount     Money
+		wantRefund Money
+		wantEvent  *Event
+		wantErr    error
+	}{
+		{
+			name:       "whole amount",
+			status:     StatusSuccessful,
+			amount:     NewMoney(0, ""),
+			wantRefund: NewMoney(20000, "THB"),
+			wantEvent:  &Event{DeduplicationID: "payment.refunded:1:rfnd_2", Type: EventRefunded, PaymentID: 1, RefundID: "rfnd_2", Amount: NewMoney(20000, "THB")},
+		},
+		{
+			name:       "rest of a partially refunded payment",
+			status:     StatusSuccessful,
+			refunds:    partiallyRefunded,
+			amount:     NewMoney(0, ""),
+			wantRefund: NewMoney(15000, "THB"),
+			wantEvent:  &Event{DeduplicationID: "payment.refunded:1:rfnd_2", Type: EventRefunded, PaymentID: 1, RefundID: "rfnd_2", Amount: NewMoney(15000, "THB")},
+		},
+		{
+			name:       "part of a partially captured payment",
+			status:     StatusCaptured,
+			captured:   NewMoney(12000, "THB"),
+			amount:     NewMoney(12000, "THB"),
+			wantRefund: NewMoney(12000, "THB"),
+			wantEvent:  &Event{DeduplicationID: "payment.refunded:1:rfnd_2", Type: EventRefunded, PaymentID: 1, RefundID: "rfnd_2", Amount: NewMoney(12000, "THB")},
+		},
+		{
+			name:     "more than the captured amount",
+			status:   StatusCaptured,
+			captured: NewMoney(12000, "THB"),
+			amount:   NewMoney(12001, "THB"),
+			wantErr: &ValidationError{Errors: []FieldError{
+				{Field: "amount", Code: CodeOutOfRange, Message: "amount must not exceed the refundable amount 120.00 THB"},
+			}},
+		},
+		{
+			name:   "another currency",
+			status: StatusSuccessful,
+			amount: NewMoney(100, "USD"),
+			wantErr: &ValidationError{Errors: []FieldError{
+				{Field: "currency", Code: CodeInvalid, Message: "currency must be THB"},
+			}},
+		},
+		{
+			name:    "fully refunded",
+			status:  StatusSuccessful,
+			refunds: []*Refund{{ID: "rfnd_1", Amount: NewMoney(20000, "THB")}},
+			wantErr: ErrFullyRefunded,
+		},
+		{
+			name:    "pending",
+			status:  StatusPending,
+			wantErr: ErrNotPaid,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Payment{
+				ID:          1,
+				Status:      tt.status,
+				Amount:      NewMoney(20000, "THB"),
+				Refunds:     tt.refunds,
+				OmiseCharge: &OmiseCharge{ID: "chrg_1", Status: tt.status, CapturedAmount: tt.captured},
+			}
+			repo := &mockRepository{}
+			repo.FindFn = func(id int) (*Payment, error) {
+				return p, nil
+			}
+			var gotEvent *Event
+			repo.RefundFn = func(id int, refund *Refund, event *Event) error {
+				gotEvent = event
+				p.Refunds = append(p.Refunds, refund)
+				return nil
+			}
+			client := &mockClient{}
+			var gotRefund Money
+			client.RefundFn = func(chargeID string, amount Money) (*Refund, error) {
+				gotRefund = amount
+				return &Refund{ID: "rfnd_2", Amount: amount}, nil
+			}
+
+			s := NewService(client, repo, nil, testValidator, nil)
+			got, err := s.Refund(1, tt.amount)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Fatalf("Service.Refund() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(gotEvent, tt.wantEvent) {
+				t.Errorf("Service.Refund() event = %+v, want %+v", gotEvent, tt.wantEvent)
+			}
+			if err != nil {
+				return
+			}
+			if gotRefund != tt.wantRefund {
+				t.Errorf("Service.Refund() refunded %v, want %v", gotRefund, tt.wantRefund)
+			}
+			if got.Status != tt.status {
+				t.Errorf("Service.Refund() status = %v, want %v", got.Status, tt.status)
+			}
+		})
+	}
+}
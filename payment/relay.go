@@ -0,0 +1,115 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Relay publishes the events recorded in the outbox to a publisher periodically.
+// Every publisher has its own relay, which is named after it.
+type Relay struct {
+	name        string
+	outbox      Outbox
+	publisher   Publisher
+	interval    time.Duration
+	batchSize   int
+	maxAttempts int
+	now         func() time.Time
+
+	// failedID is the event which failed to publish last and failures is the number of times it failed in a row.
+	failedID int
+	failures int
+}
+
+// NewRelay returns a new relay with the given name which checks for unpublished events every interval,
+// reading at most batchSize events from the outbox at a time. An event which failed to publish maxAttempts times
+// in a row is parked once the events after it are published.
+func NewRelay(name string, outbox Outbox, publisher Publisher, interval time.Duration, batchSize, maxAttempts int) *Relay {
+	return &Relay{
+		name:        name,
+		outbox:      outbox,
+		publisher:   publisher,
+		interval:    interval,
+		batchSize:   batchSize,
+		maxAttempts: maxAttempts,
+		now:         time.Now,
+	}
+}
+
+// Run publishes unpublished events every interval until the context is done.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.PublishPending(); err != nil {
+				log.Printf("publish payment events to %s: %v", r.name, err)
+			}
+		}
+	}
+}
+
+// PublishPending publishes the events the relay has not published yet in order until none is left.
+// It stops at the first event which fails to publish so that the events of a payment are not published
+// out of order, the event is published again on the next call. The other relays are not affected.
+// An event published but not marked as published is published again, hence at least once.
+// An event which failed maxAttempts times, e.g. one the publisher rejects, would hold back every event after it,
+// so it is parked if the next event is published. If the next one fails as well, the publisher is rather down
+// and both are published again on the next call.
+func (r *Relay) PublishPending() error {
+	for {
+		events, err := r.outbox.FindUnpublishedEvents(r.name, r.batchSize)
+		if err != nil {
+			return err
+		}
+
+		var stuck *Event
+		var stuckErr error
+		for _, event := range events {
+			if err := r.publisher.Publish(event); err != nil {
+				if stuck == nil && r.failed(event) {
+					stuck, stuckErr = event, err
+					continue
+				}
+				if stuck != nil {
+					event, err = stuck, stuckErr
+				}
+				return fmt.Errorf("publish event %d: %w", event.ID, err)
+			}
+
+			if stuck != nil {
+				if err := r.outbox.ParkEvent(r.name, stuck.ID, r.now()); err != nil {
+					return err
+				}
+				log.Printf("park payment event %d on %s after %d failed attempts: %v", stuck.ID, r.name, r.failures, stuckErr)
+				stuck = nil
+			}
+			if err := r.outbox.MarkEventPublished(r.name, event.ID, r.now()); err != nil {
+				return err
+			}
+		}
+
+		if stuck != nil {
+			return fmt.Errorf("publish event %d: %w", stuck.ID, stuckErr)
+		}
+		if len(events) < r.batchSize {
+			return nil
+		}
+	}
+}
+
+// failed counts a failed publication of the event and reports whether it failed maxAttempts times in a row.
+func (r *Relay) failed(event *Event) bool {
+	if event.ID != r.failedID {
+		r.failedID = event.ID
+		r.failures = 0
+	}
+	r.failures++
+	return r.failures >= r.maxAttempts
+}
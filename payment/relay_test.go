@@ -0,0 +1,105 @@
+package payment
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRelay_PublishPending(t *testing.T) {
+	outbox := &mockOutbox{}
+	for id := 1; id <= 5; id++ {
+		outbox.Events = append(outbox.Events, &Event{ID: id, Type: EventCreated, PaymentID: id})
+	}
+	failID := 3
+	newRelay := func(name string, fail bool) *Relay {
+		publisher := &mockPublisher{}
+		publisher.PublishFn = func(event *Event) error {
+			if fail && event.ID == failID {
+				return errSomeError
+			}
+			return nil
+		}
+		r := NewRelay(name, outbox, publisher, time.Minute, 2, 3)
+		r.now = func() time.Time { return now }
+		return r
+	}
+
+	// a relay whose publisher fails stops at the failed event without holding back the other relays.
+	if err := newRelay("kafka", true).PublishPending(); !errors.Is(err, errSomeError) {
+		t.Fatalf("Relay.PublishPending() error = %v, wantErr %v", err, errSomeError)
+	}
+	if err := newRelay("ledger", false).PublishPending(); err != nil {
+		t.Fatalf("Relay.PublishPending() error = %v", err)
+	}
+	want := map[string][]int{"kafka": {1, 2}, "ledger": {1, 2, 3, 4, 5}}
+	if !reflect.DeepEqual(outbox.Published, want) {
+		t.Errorf("Relay.PublishPending() published = %v, want %v", outbox.Published, want)
+	}
+	if got := outbox.Events[2].Published; !reflect.DeepEqual(got, map[string]time.Time{"ledger": now}) {
+		t.Errorf("event 3 published = %v, want by ledger at %v", got, now)
+	}
+
+	// the failed relay continues from the failed event.
+	if err := newRelay("kafka", false).PublishPending(); err != nil {
+		t.Fatalf("Relay.PublishPending() error = %v", err)
+	}
+	if got, want := outbox.Published["kafka"], []int{1, 2, 3, 4, 5}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Relay.PublishPending() published = %v, want %v", got, want)
+	}
+}
+
+func TestRelay_PublishPending_park(t *testing.T) {
+	tests := []struct {
+		name          string
+		rejected      func(event *Event) bool
+		wantPublished []int
+		wantParked    []int
+	}{
+		{
+			name:          "rejected event",
+			rejected:      func(event *Event) bool { return event.ID == 2 },
+			wantPublished: []int{1, 3, 4},
+			wantParked:    []int{2},
+		},
+		{
+			name:          "publisher down",
+			rejected:      func(event *Event) bool { return event.ID >= 2 },
+			wantPublished: []int{1},
+		},
+		{
+			name:          "last event rejected",
+			rejected:      func(event *Event) bool { return event.ID == 4 },
+			wantPublished: []int{1, 2, 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outbox := &mockOutbox{}
+			for id := 1; id <= 4; id++ {
+				outbox.Events = append(outbox.Events, &Event{ID: id, Type: EventCreated, PaymentID: id})
+			}
+			publisher := &mockPublisher{}
+			publisher.PublishFn = func(event *Event) error {
+				if tt.rejected(event) {
+					return errSomeError
+				}
+				return nil
+			}
+			r := NewRelay("kafka", outbox, publisher, time.Minute, 10, 3)
+			r.now = func() time.Time { return now }
+
+			for i := 0; i < 5; i++ {
+				r.PublishPending()
+			}
+
+			if got := outbox.Published["kafka"]; !reflect.DeepEqual(got, tt.wantPublished) {
+				t.Errorf("Relay.PublishPending() published = %v, want %v", got, tt.wantPublished)
+			}
+			if got := outbox.Parked["kafka"]; !reflect.DeepEqual(got, tt.wantParked) {
+				t.Errorf("Relay.PublishPending() parked = %v, want %v", got, tt.wantParked)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package payment
+
+import (
+	"net/url"
+	"strings"
+	"time"
+)
+
+// RiskDecision is the decision of a risk evaluation of a payment request.
+type RiskDecision string
+
+// Risk decisions, from the least to the most strict.
+const (
+	RiskAllow RiskDecision = "allow"
+	// RiskReview charges the payment, which operations staff should review before fulfilling it.
+	RiskReview RiskDecision = "review"
+	// RiskBlock rejects the payment request before it is charged.
+	RiskBlock RiskDecision = "block"
+)
+
+func (d RiskDecision) strictness() int {
+	switch d {
+	case RiskReview:
+		return 1
+	case RiskBlock:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// Risk represents the risk evaluation of a payment: the decision and the names of the rules which matched it.
+type Risk struct {
+	Decision     RiskDecision
+	MatchedRules []string
+}
+
+// RiskCheck contains a payment request to evaluate before it is charged.
+// Card is the card a card payment charges, it is nil for the other source types.
+// Search searches the payments made before, such as to count the recent payments of the payer.
+type RiskCheck struct {
+	Request *Request
+	Card    *Card
+	Now     time.Time
+	Search  func(q *Query) ([]*Payment, error)
+}
+
+// RiskEvaluator evaluates the risk of payment requests before they are charged.
+type RiskEvaluator interface {
+	Evaluate(check *RiskCheck) (*Risk, error)
+}
+
+// RiskRule is a rule of a risk engine.
+// Evaluate returns the decision of the rule for a payment request it matches, or RiskAllow if it does not match.
+type RiskRule interface {
+	Name() string
+	Evaluate(check *RiskCheck) (RiskDecision, error)
+}
+
+// RiskEngine evaluates payment requests with rules,
+// the decision is the most strict decision of the rules which match a request.
+type RiskEngine struct {
+	rules []RiskRule
+}
+
+// NewRiskEngine returns a new risk engine with the given rules.
+func NewRiskEngine(rules []RiskRule) *RiskEngine {
+	return &RiskEngine{
+		rules: rules,
+	}
+}
+
+// Evaluate evaluates a payment request with every rule, in order.
+func (e *RiskEngine) Evaluate(check *RiskCheck) (*Risk, error) {
+	risk := &Risk{Decision: RiskAllow, MatchedRules: []string{}}
+	for _, rule := range e.rules {
+		decision, err := rule.Evaluate(check)
+		if err != nil {
+			return nil, err
+		}
+		if decision == RiskAllow {
+			continue
+		}
+		risk.MatchedRules = append(risk.MatchedRules, rule.Name())
+		if decision.strictness() > risk.Decision.strictness() {
+			risk.Decision = decision
+		}
+	}
+	return risk, nil
+}
+
+// VelocityKey is what the payments counted by a velocity rule have in common with the payment request.
+type VelocityKey string
+
+// Velocity keys
+const (
+	VelocityCustomer VelocityKey = "customer"
+	VelocityIP       VelocityKey = "ip"
+	// VelocityCard counts the payments of the same card number by its fingerprint, whatever the token.
+	VelocityCard VelocityKey = "card"
+)
+
+// VelocityRule matches a payment request when Limit payments or more were created in the last Window
+// by the same customer, IP address or card as the request. A request without the key never matches.
+// Blocked payment requests are counted too, so that retrying a blocked request does not get around the limit.
+type VelocityRule struct {
+	Key      VelocityKey
+	Limit    int
+	Window   time.Duration
+	Decision RiskDecision
+}
+
+// Name returns the name of the rule, such as velocity_ip.
+func (r *VelocityRule) Name() string {
+	return "velocity_" + string(r.Key)
+}
+
+// Evaluate counts the recent payments with the same key as the payment request.
+func (r *VelocityRule) Evaluate(check *RiskCheck) (RiskDecision, error) {
+	q := &Query{From: check.Now.Add(-r.Window), Limit: r.Limit}
+	switch r.Key {
+	case VelocityCustomer:
+		q.CustomerID = check.Request.CustomerID
+	case VelocityIP:
+		q.IPAddress = check.Request.IPAddress
+	case VelocityCard:
+		if check.Card != nil {
+			q.CardFingerprint = check.Card.Fingerprint
+		}
+	}
+	if q.CustomerID == 0 && q.IPAddress == "" && q.CardFingerprint == "" {
+		return RiskAllow, nil
+	}
+
+	payments, err := check.Search(q)
+	if err != nil {
+		return "", err
+	}
+	if len(payments) < r.Limit {
+		return RiskAllow, nil
+	}
+	return r.Decision, nil
+}
+
+// AmountCeilingRule matches a payment request of the source type whose amount exceeds the ceiling,
+// requests in another currency than the ceiling never match.
+type AmountCeilingRule struct {
+	SourceType string
+	Ceiling    Money
+	Decision   RiskDecision
+}
+
+// Name returns the name of the rule, such as amount_ceiling_card.
+func (r *AmountCeilingRule) Name() string {
+	return "amount_ceiling_" + r.SourceType
+}
+
+// Evaluate compares the amount of the payment request with the ceiling.
+func (r *AmountCeilingRule) Evaluate(check *RiskCheck) (RiskDecision, error) {
+	if check.Request.SourceType != r.SourceType {
+		return RiskAllow, nil
+	}
+	if c, err := check.Request.Amount.Cmp(r.Ceiling); err != nil || c <= 0 {
+		return RiskAllow, nil
+	}
+	return r.Decision, nil
+}
+
+// ReturnURIDomainRule matches a payment request whose return URI is on one of the domains,
+// *.example.com matches the subdomains of example.com but not example.com itself.
+type ReturnURIDomainRule struct {
+	Domains  []string
+	Decision RiskDecision
+}
+
+// Name returns the name of the rule.
+func (r *ReturnURIDomainRule) Name() string {
+	return "return_uri_domain"
+}
+
+// Evaluate matches the host of the return URI with the domains.
+func (r *ReturnURIDomainRule) Evaluate(check *RiskCheck) (RiskDecision, error) {
+	u, err := url.Parse(check.Request.ReturnURI)
+	if err != nil || u.Hostname() == "" || !matchHost(r.Domains, u.Hostname()) {
+		return RiskAllow, nil
+	}
+	return r.Decision, nil
+}
+
+// CardCountryRule matches a card payment request whose card was issued in one of the countries,
+// which are ISO 3166-1 alpha-2 codes such as TH.
+type CardCountryRule struct {
+	Countries []string
+	Decision  RiskDecision
+}
+
+// Name returns the name of the rule.
+func (r *CardCountryRule) Name() string {
+	return "card_country"
+}
+
+// Evaluate matches the issuing country of the card with the countries.
+func (r *CardCountryRule) Evaluate(check *RiskCheck) (RiskDecision, error) {
+	if check.Card == nil || !contains(r.Countries, strings.ToUpper(check.Card.Country)) {
+		return RiskAllow, nil
+	}
+	return r.Decision, nil
+}
@@ -0,0 +1,286 @@
+package payment
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type staticRule struct {
+	name     string
+	decision RiskDecision
+	err      error
+}
+
+func (r *staticRule) Name() string {
+	return r.name
+}
+
+func (r *staticRule) Evaluate(check *RiskCheck) (RiskDecision, error) {
+	return r.decision, r.err
+}
+
+func TestRiskEngine_Evaluate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []RiskRule
+		want    *Risk
+		wantErr error
+	}{
+		{
+			name:  "no rules",
+			rules: nil,
+			want:  &Risk{Decision: RiskAllow, MatchedRules: []string{}},
+		},
+		{
+			name: "no rule matches",
+			rules: []RiskRule{
+				&staticRule{name: "a", decision: RiskAllow},
+			},
+			want: &Risk{Decision: RiskAllow, MatchedRules: []string{}},
+		},
+		{
+			name: "most strict decision",
+			rules: []RiskRule{
+				&staticRule{name: "a", decision: RiskReview},
+				&staticRule{name: "b", decision: RiskAllow},
+				&staticRule{name: "c", decision: RiskBlock},
+				&staticRule{name: "d", decision: RiskReview},
+			},
+			want: &Risk{Decision: RiskBlock, MatchedRules: []string{"a", "c", "d"}},
+		},
+		{
+			name: "rule error",
+			rules: []RiskRule{
+				&staticRule{name: "a", err: errSomeError},
+			},
+			wantErr: errSomeError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewRiskEngine(tt.rules).Evaluate(&RiskCheck{Request: &Request{}})
+			if err != tt.wantErr {
+				t.Fatalf("RiskEngine.Evaluate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RiskEngine.Evaluate() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVelocityRule_Evaluate(t *testing.T) {
+	checkedAt := time.Date(2021, 2, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		key       VelocityKey
+		req       *Request
+		card      *Card
+		found     int
+		wantQuery *Query
+		want      RiskDecision
+	}{
+		{
+			name:      "customer under the limit",
+			key:       VelocityCustomer,
+			req:       &Request{CustomerID: 7},
+			found:     2,
+			wantQuery: &Query{CustomerID: 7, From: checkedAt.Add(-time.Hour), Limit: 3},
+			want:      RiskAllow,
+		},
+		{
+			name:      "ip at the limit",
+			key:       VelocityIP,
+			req:       &Request{IPAddress: "203.0.113.7"},
+			found:     3,
+			wantQuery: &Query{IPAddress: "203.0.113.7", From: checkedAt.Add(-time.Hour), Limit: 3},
+			want:      RiskReview,
+		},
+		{
+			name:      "card at the limit",
+			key:       VelocityCard,
+			req:       &Request{SourceType: SourceTypeCard},
+			card:      &Card{Fingerprint: "fp"},
+			found:     3,
+			wantQuery: &Query{CardFingerprint: "fp", From: checkedAt.Add(-time.Hour), Limit: 3},
+			want:      RiskReview,
+		},
+		{
+			name: "no ip",
+			key:  VelocityIP,
+			req:  &Request{CustomerID: 7},
+			want: RiskAllow,
+		},
+		{
+			name: "no card",
+			key:  VelocityCard,
+			req:  &Request{SourceType: "promptpay"},
+			want: RiskAllow,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotQuery *Query
+			check := &RiskCheck{
+				Request: tt.req,
+				Card:    tt.card,
+				Now:     checkedAt,
+				Search: func(q *Query) ([]*Payment, error) {
+					gotQuery = q
+					return make([]*Payment, tt.found), nil
+				},
+			}
+
+			rule := &VelocityRule{Key: tt.key, Limit: 3, Window: time.Hour, Decision: RiskReview}
+			got, err := rule.Evaluate(check)
+			if err != nil {
+				t.Fatalf("VelocityRule.Evaluate() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("VelocityRule.Evaluate() = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(gotQuery, tt.wantQuery) {
+				t.Errorf("VelocityRule.Evaluate() searched %+v, want %+v", gotQuery, tt.wantQuery)
+			}
+		})
+	}
+}
+
+func TestRiskRules_Evaluate(t *testing.T) {
+	ceiling := &AmountCeilingRule{SourceType: SourceTypeCard, Ceiling: NewMoney(5000000, "THB"), Decision: RiskReview}
+	domains := &ReturnURIDomainRule{Domains: []string{"bad.example", "*.worse.example"}, Decision: RiskBlock}
+	countries := &CardCountryRule{Countries: []string{"XX"}, Decision: RiskBlock}
+
+	tests := []struct {
+		name string
+		rule RiskRule
+		req  *Request
+		card *Card
+		want RiskDecision
+	}{
+		{name: "amount under the ceiling", rule: ceiling, req: &Request{SourceType: SourceTypeCard, Amount: NewMoney(5000000, "THB")}, want: RiskAllow},
+		{name: "amount over the ceiling", rule: ceiling, req: &Request{SourceType: SourceTypeCard, Amount: NewMoney(5000001, "THB")}, want: RiskReview},
+		{name: "amount of another source type", rule: ceiling, req: &Request{SourceType: "promptpay", Amount: NewMoney(9000000, "THB")}, want: RiskAllow},
+		{name: "amount in another currency", rule: ceiling, req: &Request{SourceType: SourceTypeCard, Amount: NewMoney(9000000, "JPY")}, want: RiskAllow},
+		{name: "blocked domain", rule: domains, req: &Request{ReturnURI: "https://BAD.example/return"}, want: RiskBlock},
+		{name: "blocked subdomain", rule: domains, req: &Request{ReturnURI: "https://shop.worse.example/return"}, want: RiskBlock},
+		{name: "subdomain of an exact domain", rule: domains, req: &Request{ReturnURI: "https://shop.bad.example/return"}, want: RiskAllow},
+		{name: "no return uri", rule: domains, req: &Request{}, want: RiskAllow},
+		{name: "blocked country", rule: countries, req: &Request{}, card: &Card{Country: "xx"}, want: RiskBlock},
+		{name: "other country", rule: countries, req: &Request{}, card: &Card{Country: "TH"}, want: RiskAllow},
+		{name: "no card", rule: countries, req: &Request{}, want: RiskAllow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.rule.Evaluate(&RiskCheck{Request: tt.req, Card: tt.card})
+			if err != nil {
+				t.Fatalf("%s.Evaluate() error = %v", tt.rule.Name(), err)
+			}
+			if got != tt.want {
+				t.Errorf("%s.Evaluate() = %v, want %v", tt.rule.Name(), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_CreatePaymentRequest_risk(t *testing.T) {
+	card := &Card{Brand: "Visa", Fingerprint: "fp", Country: "XX"}
+	tests := []struct {
+		name        string
+		rules       []RiskRule
+		want        *Risk
+		wantErr     error
+		wantCreated *Payment
+	}{
+		{
+			name:  "review",
+			rules: []RiskRule{&CardCountryRule{Countries: []string{"XX"}, Decision: RiskReview}},
+			want:  &Risk{Decision: RiskReview, MatchedRules: []string{"card_country"}},
+		},
+		{
+			name: "block",
+			rules: []RiskRule{
+				&CardCountryRule{Countries: []string{"XX"}, Decision: RiskReview},
+				&AmountCeilingRule{SourceType: SourceTypeCard, Ceiling: NewMoney(10000, "THB"), Decision: RiskBlock},
+			},
+			wantErr: &Error{Code: ErrorCodeRiskBlocked, Message: "payment request is blocked by risk rules: card_country, amount_ceiling_card"},
+			wantCreated: &Payment{
+				ID:        1,
+				Status:    StatusBlocked,
+				Amount:    NewMoney(20000, "THB"),
+				ReturnURI: "https://shop.example/return",
+				IPAddress: "2001:db8::1",
+				Risk:      &Risk{Decision: RiskBlock, MatchedRules: []string{"card_country", "amount_ceiling_card"}},
+				Card:      card,
+				OmiseCharge: &OmiseCharge{
+					Status:     StatusBlocked,
+					Amount:     NewMoney(20000, "THB"),
+					SourceType: SourceTypeCard,
+					ReturnURI:  "https://shop.example/return",
+					Card:       card,
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockClient{}
+			client.CardFn = func(req *Request, customer *Customer) (*Card, error) {
+				return card, nil
+			}
+			charged := false
+			client.ChargeFn = func(id int, req *Request, customer *Customer) (*OmiseCharge, error) {
+				charged = true
+				return &OmiseCharge{ID: "chrg_1", Status: StatusSuccessful, Amount: req.Amount, Card: card}, nil
+			}
+			repo := &mockRepository{}
+			repo.NextIDFn = func() (int, error) {
+				return 1, nil
+			}
+			var created *Payment
+			repo.CreateFn = func(payment *Payment, event *Event) error {
+				created = payment
+				if payment.Status == StatusBlocked && event != nil {
+					t.Errorf("Service.CreatePaymentRequest() recorded %v for a blocked payment", event.Type)
+				}
+				return nil
+			}
+
+			s := NewService(client, repo, nil, testValidator, NewRiskEngine(tt.rules))
+			req := &Request{
+				Amount:        NewMoney(20000, "THB"),
+				ReturnURI:     "https://shop.example/return",
+				SourceType:    SourceTypeCard,
+				SourceDetails: SourceDetails{CardToken: "tokn_1"},
+				IPAddress:     "2001:DB8::0:1",
+			}
+			got, err := s.CreatePaymentRequest(req)
+			if req.IPAddress != "2001:DB8::0:1" {
+				t.Errorf("Service.CreatePaymentRequest() changed the request ip address to %v", req.IPAddress)
+			}
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Fatalf("Service.CreatePaymentRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if charged != (tt.wantErr == nil) {
+				t.Errorf("Service.CreatePaymentRequest() charged = %v, want %v", charged, tt.wantErr == nil)
+			}
+			if err != nil {
+				if !errors.Is(err, ErrRiskBlocked) {
+					t.Errorf("Service.CreatePaymentRequest() error is not ErrRiskBlocked")
+				}
+				if !reflect.DeepEqual(created, tt.wantCreated) {
+					t.Errorf("Service.CreatePaymentRequest() created %+v, want %+v", created, tt.wantCreated)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got.Risk, tt.want) {
+				t.Errorf("Service.CreatePaymentRequest() risk = %+v, want %+v", got.Risk, tt.want)
+			}
+			if got.IPAddress != "2001:db8::1" {
+				t.Errorf("Service.CreatePaymentRequest() ip address = %v, want %v", got.IPAddress, "2001:db8::1")
+			}
+		})
+	}
+}
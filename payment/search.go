@@ -0,0 +1,44 @@
+package payment
+
+import "time"
+
+// Query represents a search of payments, its empty fields match every payment.
+// From and To limit the payments to those created in [From, To), either may be zero for an open range.
+// The payments are sorted by id starting after AfterID, at most Limit of them, or all if Limit is 0.
+type Query struct {
+	Status          Status
+	SourceType      string
+	CustomerID      int
+	IPAddress       string
+	CardFingerprint string
+	RiskDecision    RiskDecision
+	From            time.Time
+	To              time.Time
+	AfterID         int
+	Limit           int
+}
+
+// Matches reports whether the payment matches the query, regardless of AfterID and Limit.
+func (q *Query) Matches(p *Payment) bool {
+	return (q.Status == "" || p.Status == q.Status) &&
+		(q.SourceType == "" || p.OmiseCharge.SourceType == q.SourceType) &&
+		(q.CustomerID == 0 || p.CustomerID == q.CustomerID) &&
+		(q.IPAddress == "" || p.IPAddress == q.IPAddress) &&
+		(q.CardFingerprint == "" || p.Card != nil && p.Card.Fingerprint == q.CardFingerprint) &&
+		(q.RiskDecision == "" || p.Risk != nil && p.Risk.Decision == q.RiskDecision) &&
+		(q.From.IsZero() || !p.CreatedAt.Before(q.From)) &&
+		(q.To.IsZero() || p.CreatedAt.Before(q.To))
+}
+
+// Search returns the payments matching the query as they are stored, without refreshing them.
+func (s *service) Search(q *Query) ([]*Payment, error) {
+	return s.repo.Search(q)
+}
+
+// Events returns the events of a payment with the given id, oldest first.
+func (s *service) Events(id int) ([]*Event, error) {
+	if _, err := s.repo.Find(id); err != nil {
+		return nil, err
+	}
+	return s.repo.FindEvents(id)
+}
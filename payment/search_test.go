@@ -0,0 +1,69 @@
+package payment
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestQuery_Matches(t *testing.T) {
+	createdAt := time.Date(2021, 2, 1, 10, 0, 0, 0, time.UTC)
+	p := &Payment{
+		ID:          1,
+		CustomerID:  7,
+		Status:      StatusSuccessful,
+		OmiseCharge: &OmiseCharge{SourceType: "card"},
+		CreatedAt:   createdAt,
+	}
+
+	tests := []struct {
+		name  string
+		query Query
+		want  bool
+	}{
+		{name: "empty", query: Query{}, want: true},
+		{name: "all fields", query: Query{Status: StatusSuccessful, SourceType: "card", CustomerID: 7, From: createdAt, To: createdAt.Add(time.Second)}, want: true},
+		{name: "status", query: Query{Status: StatusPending}, want: false},
+		{name: "source type", query: Query{SourceType: "promptpay"}, want: false},
+		{name: "customer", query: Query{CustomerID: 8}, want: false},
+		{name: "created before from", query: Query{From: createdAt.Add(time.Second)}, want: false},
+		{name: "created at to", query: Query{To: createdAt}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.query.Matches(p); got != tt.want {
+				t.Errorf("Query.Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_Events(t *testing.T) {
+	events := []*Event{
+		{ID: 1, Type: EventCreated, PaymentID: 1},
+		{ID: 3, Type: EventStatusChanged, PaymentID: 1, PreviousStatus: StatusPending},
+	}
+	repo := &mockRepository{}
+	repo.FindFn = func(id int) (*Payment, error) {
+		if id != 1 {
+			return nil, ErrPaymentNotFound
+		}
+		return &Payment{ID: id}, nil
+	}
+	repo.FindEventsFn = func(paymentID int) ([]*Event, error) {
+		return events, nil
+	}
+
+	s := NewService(nil, repo, nil, testValidator, nil)
+	got, err := s.Events(1)
+	if err != nil {
+		t.Fatalf("Service.Events() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, events) {
+		t.Errorf("Service.Events() = %v, want %v", got, events)
+	}
+
+	if _, err := s.Events(2); err != ErrPaymentNotFound {
+		t.Errorf("Service.Events() error = %v, want %v", err, ErrPaymentNotFound)
+	}
+}
@@ -0,0 +1,21 @@
+package payment
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+)
+
+// SignResult returns the signature of a payment result which the payer is redirected back to the merchant with.
+// It is the hex-encoded HMAC-SHA256 of "payment_id=<id>&status=<status>" with the secret shared with the merchant.
+func SignResult(secret []byte, id int, status Status) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("payment_id=" + strconv.Itoa(id) + "&status=" + string(status)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyResult reports whether the signature of a payment result is valid.
+func VerifyResult(secret []byte, id int, status Status, signature string) bool {
+	return hmac.Equal([]byte(SignResult(secret, id, status)), []byte(signature))
+}
@@ -0,0 +1,38 @@
+package payment
+
+import "testing"
+
+func TestSignResult(t *testing.T) {
+	// echo -n "payment_id=1&status=successful" | openssl dgst -sha256 -hmac secret
+	want := "5eb7b20154a88fa1f612ff5e77071f23d65a3f1d3336c0b18bff15e61156ca74"
+	if got := SignResult([]byte("secret"), 1, StatusSuccessful); got != want {
+		t.Errorf("SignResult() = %v, want %v", got, want)
+	}
+}
+
+func TestVerifyResult(t *testing.T) {
+	secret := []byte("secret")
+	signature := SignResult(secret, 1, StatusSuccessful)
+
+	tests := []struct {
+		name      string
+		secret    []byte
+		id        int
+		status    Status
+		signature string
+		want      bool
+	}{
+		{name: "valid", secret: secret, id: 1, status: StatusSuccessful, signature: signature, want: true},
+		{name: "other payment", secret: secret, id: 2, status: StatusSuccessful, signature: signature},
+		{name: "other status", secret: secret, id: 1, status: StatusFailed, signature: signature},
+		{name: "other secret", secret: []byte("other"), id: 1, status: StatusSuccessful, signature: signature},
+		{name: "empty signature", secret: secret, id: 1, status: StatusSuccessful},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyResult(tt.secret, tt.id, tt.status, tt.signature); got != tt.want {
+				t.Errorf("VerifyResult() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package payment
+
+import (
+	"sort"
+	"strconv"
+)
+
+// Source flows
+const (
+	// FlowRedirect sources are paid by redirecting the payer to the authorize URI, then back to the return URI.
+	FlowRedirect = "redirect"
+	// FlowAppRedirect sources are paid by opening the authorize URI in a banking app, then back to the return URI.
+	FlowAppRedirect = "app_redirect"
+	// FlowOffline sources are paid outside the browser, e.g. by scanning a QR code.
+	FlowOffline = "offline"
+)
+
+// Source fields are the request fields some source types require, named as in the API.
+const (
+	FieldCardToken = "card_token"
+	// FieldCardID is the id of a card saved to the customer, it is charged instead of a card token.
+	FieldCardID          = "card_id"
+	FieldPhoneNumber     = "phone_number"
+	FieldEmail           = "email"
+	FieldName            = "name"
+	FieldPlatformType    = "platform_type"
+	FieldInstallmentTerm = "installment_term"
+	// FieldZeroInterestInstallments makes the merchant absorb the installment interest instead of the payer.
+	FieldZeroInterestInstallments = "zero_interest_installments"
+)
+
+// sourceFields contains every source field.
+var sourceFields = []string{FieldCardToken, FieldCardID, FieldPhoneNumber, FieldEmail, FieldName, FieldPlatformType, FieldInstallmentTerm, FieldZeroInterestInstallments}
+
+// Platform types of mobile banking sources
+var platformTypes = []string{"IOS", "ANDROID", "WEB"}
+
+// SourceDetails contains the attributes of a payment source, which of them are used depends on the source type.
+type SourceDetails struct {
+	CardToken       string
+	CardID          string
+	PhoneNumber     string
+	Email           string
+	Name            string
+	PlatformType    string
+	InstallmentTerm int
+
+	ZeroInterestInstallments bool
+}
+
+// field returns the value of the source field, or an empty string if it is not set.
+func (d *SourceDetails) field(name string) string {
+	switch name {
+	case FieldCardToken:
+		return d.CardToken
+	case FieldCardID:
+		return d.CardID
+	case FieldPhoneNumber:
+		return d.PhoneNumber
+	case FieldEmail:
+		return d.Email
+	case FieldName:
+		return d.Name
+	case FieldPlatformType:
+		return d.PlatformType
+	case FieldInstallmentTerm:
+		if d.InstallmentTerm == 0 {
+			return ""
+		}
+		return strconv.Itoa(d.InstallmentTerm)
+	case FieldZeroInterestInstallments:
+		if !d.ZeroInterestInstallments {
+			return ""
+		}
+		return "true"
+	}
+	return ""
+}
+
+// SourceType describes a payment source type.
+// MinAmount and MaxAmount are in the smallest unit of the source currency,
+// they are zero if the amount is only limited by the currency.
+type SourceType struct {
+	Name           string
+	Flow           string
+	Currencies     []string
+	MinAmount      int64
+	MaxAmount      int64
+	RequiredFields []string
+	OptionalFields []string
+}
+
+func (t SourceType) limit() amountLimit {
+	return amountLimit{min: t.MinAmount, max: t.MaxAmount}
+}
+
+// allowsField reports whether the field is used by the source type.
+func (t SourceType) allowsField(field string) bool {
+	return contains(t.RequiredFields, field) || contains(t.OptionalFields, field)
+}
+
+// needsReturnURI reports whether the payer is redirected back to the return URI.
+func (t SourceType) needsReturnURI() bool {
+	return t.Flow == FlowRedirect || t.Flow == FlowAppRedirect
+}
+
+var thb = []string{"THB"}
+
+var installmentOptionalFields = []string{FieldZeroInterestInstallments}
+
+// sourceTypes is the catalogue of source types the service supports.
+var sourceTypes = map[string]SourceType{}
+
+func init() {
+	for _, t := range []SourceType{
+		{Name: "internet_banking_scb", Flow: FlowRedirect, Currencies: thb, MinAmount: 2000, MaxAmount: 10000000},
+		{Name: "internet_banking_bay", Flow: FlowRedirect, Currencies: thb, MinAmount: 2000, MaxAmount: 10000000},
+		{Name: "internet_banking_bbl", Flow: FlowRedirect, Currencies: thb, MinAmount: 2000, MaxAmount: 10000000},
+		{Name: "internet_banking_ktb", Flow: FlowRedirect, Currencies: thb, MinAmount: 2000, MaxAmount: 10000000},
+		{Name: "mobile_banking_scb", Flow: FlowAppRedirect, Currencies: thb, MinAmount: 2000, MaxAmount: 15000000, OptionalFields: []string{FieldPlatformType}},
+		{Name: "mobile_banking_kbank", Flow: FlowAppRedirect, Currencies: thb, MinAmount: 2000, MaxAmount: 15000000, OptionalFields: []string{FieldPlatformType}},
+		{Name: "mobile_banking_bay", Flow: FlowAppRedirect, Currencies: thb, MinAmount: 2000, MaxAmount: 15000000, OptionalFields: []string{FieldPlatformType}},
+		{Name: "mobile_banking_bbl", Flow: FlowAppRedirect, Currencies: thb, MinAmount: 2000, MaxAmount: 15000000, OptionalFields: []string{FieldPlatformType}},
+		{Name: "mobile_banking_ktb", Flow: FlowAppRedirect, Currencies: thb, MinAmount: 2000, MaxAmount: 15000000, OptionalFields: []string{FieldPlatformType}},
+		{Name: "truemoney", Flow: FlowRedirect, Currencies: thb, MinAmount: 2000, MaxAmount: 10000000, RequiredFields: []string{FieldPhoneNumber}},
+		{Name: "rabbit_linepay", Flow: FlowRedirect, Currencies: thb, MinAmount: 2000, MaxAmount: 15000000},
+		{Name: "alipay", Flow: FlowRedirect, Currencies: thb, MinAmount: 2000, MaxAmount: 15000000},
+		{Name: "bill_payment_tesco_lotus", Flow: FlowOffline, Currencies: thb, MinAmount: 2000, MaxAmount: 5000000},
+		{Name: "installment_kbank", Flow: FlowRedirect, Currencies: thb, MinAmount: 300000, MaxAmount: 100000000, RequiredFields: []string{FieldInstallmentTerm}, OptionalFields: installmentOptionalFields},
+		{Name: "installment_bay", Flow: FlowRedirect, Currencies: thb, MinAmount: 300000, MaxAmount: 100000000, RequiredFields: []string{FieldInstallmentTerm}, OptionalFields: installmentOptionalFields},
+		{Name: "installment_bbl", Flow: FlowRedirect, Currencies: thb, MinAmount: 200000, MaxAmount: 100000000, RequiredFields: []string{FieldInstallmentTerm}, OptionalFields: installmentOptionalFields},
+		{Name: "installment_ktc", Flow: FlowRedirect, Currencies: thb, MinAmount: 300000, MaxAmount: 100000000, RequiredFields: []string{FieldInstallmentTerm}, OptionalFields: installmentOptionalFields},
+		{Name: "installment_first_choice", Flow: FlowRedirect, Currencies: thb, MinAmount: 300000, MaxAmount: 100000000, RequiredFields: []string{FieldInstallmentTerm}, OptionalFields: installmentOptionalFields},
+		{Name: "installment_scb", Flow: FlowRedirect, Currencies: thb, MinAmount: 50000, MaxAmount: 100000000, RequiredFields: []string{FieldInstallmentTerm}, OptionalFields: installmentOptionalFields},
+		{Name: "installment_uob", Flow: FlowRedirect, Currencies: thb, MinAmount: 50000, MaxAmount: 100000000, RequiredFields: []string{FieldInstallmentTerm}, OptionalFields: installmentOptionalFields},
+		{Name: "econtext", Flow: FlowRedirect, Currencies: []string{"JPY"}, MinAmount: 150, MaxAmount: 300000, RequiredFields: []string{FieldName, FieldEmail, FieldPhoneNumber}},
+		{Name: "promptpay", Flow: FlowOffline, Currencies: thb, MinAmount: 2000, MaxAmount: 15000000},
+		// card charges may redirect the payer to 3-D Secure authentication.
+		{Name: SourceTypeCard, Flow: FlowRedirect, Currencies: []string{"THB", "JPY", "SGD", "MYR", "USD", "EUR", "GBP", "AUD", "CAD", "CHF", "CNY", "DKK", "HKD"}, RequiredFields: []string{FieldCardToken}, OptionalFields: []string{FieldCardID}},
+	} {
+		sourceTypes[t.Name] = t
+	}
+}
+
+// LookupSourceType returns the source type with the given name from the catalogue.
+func LookupSourceType(name string) (SourceType, bool) {
+	t, ok := sourceTypes[name]
+	return t, ok
+}
+
+// SourceTypes returns the catalogue of source types sorted by name.
+func SourceTypes() []SourceType {
+	types := make([]SourceType, 0, len(sourceTypes))
+	for _, t := range sourceTypes {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		return types[i].Name < types[j].Name
+	})
+	return types
+}
+
+// PaymentMethod represents a source type enabled for the Omise account.
+// The payment client only sets Name, Currencies, CardBrands and InstallmentTerms,
+// the service completes it with the source type from the catalogue.
+type PaymentMethod struct {
+	SourceType
+	CardBrands       []string
+	InstallmentTerms []int
+}
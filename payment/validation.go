@@ -0,0 +1,367 @@
+package payment
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Limits of the merchant-supplied attributes.
+const (
+	MaxReferenceLength     = 64
+	MaxDescriptionLength   = 255
+	MaxMetadataKeys        = 20
+	MaxMetadataKeyLength   = 40
+	MaxMetadataValueLength = 500
+)
+
+// Validation error codes
+const (
+	CodeRequired     = "required"
+	CodeInvalid      = "invalid"
+	CodeUnsupported  = "unsupported"
+	CodeOutOfRange   = "out_of_range"
+	CodeTooLong      = "too_long"
+	CodeTooMany      = "too_many"
+	CodeNotAllowed   = "not_allowed"
+	CodeUnknownField = "unknown_field"
+)
+
+// FieldError describes why a field of a request is invalid.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationError occurs when a request contains one or more invalid fields.
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		msgs[i] = fe.Field + ": " + fe.Message
+	}
+	return "invalid request: " + strings.Join(msgs, ", ")
+}
+
+// Is reports whether the target is ErrInvalidRequest.
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrInvalidRequest
+}
+
+func (e *ValidationError) add(field, code, message string) {
+	e.Errors = append(e.Errors, FieldError{Field: field, Code: code, Message: message})
+}
+
+// amountLimit is an inclusive range of amounts in the smallest currency unit.
+type amountLimit struct {
+	min int64
+	max int64
+}
+
+// currencies contains ISO-4217 currencies supported by the payment gateway and their charge limits.
+var currencies = map[string]amountLimit{
+	"THB": {min: 2000, max: 15000000000},
+	"JPY": {min: 100, max: 999999999},
+	"SGD": {min: 100, max: 99999999},
+	"MYR": {min: 200, max: 99999999},
+	"USD": {min: 100, max: 99999999},
+	"EUR": {min: 100, max: 99999999},
+	"GBP": {min: 100, max: 99999999},
+	"AUD": {min: 100, max: 99999999},
+	"CAD": {min: 100, max: 99999999},
+	"CHF": {min: 100, max: 99999999},
+	"CNY": {min: 100, max: 99999999},
+	"DKK": {min: 100, max: 99999999},
+	"HKD": {min: 100, max: 99999999},
+}
+
+// SupportedCurrency reports whether the payment gateway supports the currency.
+// It validates the currency of amounts which are charged later, e.g. of a subscription plan.
+func SupportedCurrency(currency string) bool {
+	_, ok := currencies[currency]
+	return ok
+}
+
+// Validator validates payment requests before they are sent to the payment gateway.
+type Validator struct {
+	returnURISchemes []string
+	returnURIHosts   []string
+	installmentRates map[string]InstallmentRate
+}
+
+// NewValidator returns a new payment request validator.
+// The return URI must use one of the given schemes and, if any hosts are given, one of the hosts.
+// A host starting with "*." allows the subdomains of the rest of the host but not the rest itself,
+// e.g. *.example.com allows shop.example.com but not example.com.
+// The installment rates of the installment source types replace their estimated rates.
+func NewValidator(returnURISchemes, returnURIHosts []string, installmentRates map[string]InstallmentRate) *Validator {
+	return &Validator{
+		returnURISchemes: returnURISchemes,
+		returnURIHosts:   returnURIHosts,
+		installmentRates: installmentRates,
+	}
+}
+
+// Validate validates the payment request.
+// It returns a *ValidationError listing every invalid field.
+func (v *Validator) Validate(req *Request) error {
+	verr := &ValidationError{}
+
+	v.validateAmount(verr, req)
+	if source, ok := sourceTypes[req.SourceType]; !ok || source.needsReturnURI() || req.ReturnURI != "" {
+		v.validateReturnURI(verr, req.ReturnURI)
+	}
+	v.validateSourceDetails(verr, req)
+	v.validateSavedCard(verr, req)
+	v.validateInstallment(verr, req)
+	if !req.Capture && req.SourceType != "" && req.SourceType != SourceTypeCard {
+		verr.add("capture", CodeNotAllowed, "only card payments can be authorized without capture")
+	}
+	v.validateAttributes(verr, req)
+
+	if len(verr.Errors) > 0 {
+		return verr
+	}
+	return nil
+}
+
+func (v *Validator) validateAmount(verr *ValidationError, req *Request) {
+	currency := req.Amount.Currency
+	currencyLimit, currencyOK := currencies[currency]
+	switch {
+	case currency == "":
+		verr.add("currency", CodeRequired, "currency is required")
+	case !isCurrencyCode(currency):
+		verr.add("currency", CodeInvalid, "currency must be an ISO-4217 currency code")
+	case !currencyOK:
+		verr.add("currency", CodeUnsupported, fmt.Sprintf("currency %s is not supported", currency))
+	}
+
+	source, sourceOK := sourceTypes[req.SourceType]
+	switch {
+	case req.SourceType == "":
+		verr.add("source_type", CodeRequired, "source_type is required")
+	case !sourceOK:
+		verr.add("source_type", CodeUnsupported, fmt.Sprintf("source type %s is not supported", req.SourceType))
+	case currencyOK && !contains(source.Currencies, currency):
+		verr.add("currency", CodeUnsupported, fmt.Sprintf("currency %s is not supported by %s", currency, req.SourceType))
+		sourceOK = false
+	}
+
+	if req.Amount.Amount <= 0 {
+		verr.add("amount", CodeInvalid, "amount must be positive")
+		return
+	}
+	if currencyOK && !currencyLimit.contains(req.Amount.Amount) {
+		verr.add("amount", CodeOutOfRange, currencyLimit.message(currency, currency))
+		return
+	}
+	if currencyOK && sourceOK && source.limit() != (amountLimit{}) && !source.limit().contains(req.Amount.Amount) {
+		verr.add("amount", CodeOutOfRange, source.limit().message(req.SourceType, currency))
+	}
+}
+
+// ValidateReturnURI validates a return URI against the allowed schemes and hosts.
+// It is used to validate return URIs which are stored before the payment is made, e.g. of a payment link.
+func (v *Validator) ValidateReturnURI(returnURI string) error {
+	verr := &ValidationError{}
+	v.validateReturnURI(verr, returnURI)
+	if len(verr.Errors) > 0 {
+		return verr
+	}
+	return nil
+}
+
+func (v *Validator) validateReturnURI(verr *ValidationError, returnURI string) {
+	if returnURI == "" {
+		verr.add("return_uri", CodeRequired, "return_uri is required")
+		return
+	}
+
+	u, err := url.Parse(returnURI)
+	if err != nil || !u.IsAbs() || u.Hostname() == "" {
+		verr.add("return_uri", CodeInvalid, "return_uri must be an absolute URI")
+		return
+	}
+
+	if !contains(v.returnURISchemes, strings.ToLower(u.Scheme)) {
+		verr.add("return_uri", CodeNotAllowed, fmt.Sprintf("return_uri scheme must be one of %s", strings.Join(v.returnURISchemes, ", ")))
+		return
+	}
+
+	if len(v.returnURIHosts) > 0 && !matchHost(v.returnURIHosts, u.Hostname()) {
+		verr.add("return_uri", CodeNotAllowed, fmt.Sprintf("return_uri host %s is not allowed", u.Hostname()))
+	}
+}
+
+// validateSourceDetails validates that the fields required by the source type are given and valid,
+// and that fields which are not used by the source type are not given.
+func (v *Validator) validateSourceDetails(verr *ValidationError, req *Request) {
+	source, ok := sourceTypes[req.SourceType]
+	if !ok {
+		return
+	}
+
+	for _, field := range source.RequiredFields {
+		// a saved card is charged instead of a card token.
+		if field == FieldCardToken && req.CardID != "" {
+			continue
+		}
+		if req.SourceDetails.field(field) == "" {
+			verr.add(field, CodeRequired, fmt.Sprintf("%s is required for %s", field, req.SourceType))
+		}
+	}
+
+	for _, field := range sourceFields {
+		value := req.SourceDetails.field(field)
+		if value == "" {
+			continue
+		}
+		if !source.allowsField(field) {
+			verr.add(field, CodeNotAllowed, fmt.Sprintf("%s is not used by %s", field, req.SourceType))
+			continue
+		}
+		if msg := invalidSourceField(field, value); msg != "" {
+			verr.add(field, CodeInvalid, msg)
+		}
+	}
+}
+
+// validateSavedCard validates that a saved card is charged with its customer, and that the customer is only given
+// to charge a saved card.
+func (v *Validator) validateSavedCard(verr *ValidationError, req *Request) {
+	switch {
+	case req.CardID != "" && req.CardToken != "":
+		verr.add(FieldCardID, CodeNotAllowed, "card_id must not be given with card_token")
+	case req.CardID != "" && req.CustomerID == 0:
+		verr.add("customer_id", CodeRequired, "customer_id is required to charge a saved card")
+	case req.CardID == "" && req.CustomerID != 0:
+		verr.add(FieldCardID, CodeRequired, "card_id is required to charge a customer")
+	}
+}
+
+// invalidSourceField returns why the value of the source field is invalid, or an empty string if it is valid.
+func invalidSourceField(field, value string) string {
+	switch field {
+	case FieldCardToken:
+		if !strings.HasPrefix(value, "tokn_") {
+			return "card_token must be an Omise token"
+		}
+	case FieldPhoneNumber:
+		if len(value) < 9 || len(value) > 15 || strings.Trim(value, "+0123456789") != "" {
+			return "phone_number must be a phone number"
+		}
+	case FieldEmail:
+		if i := strings.IndexByte(value, '@'); i <= 0 || i == len(value)-1 {
+			return "email must be an email address"
+		}
+	case FieldPlatformType:
+		if !contains(platformTypes, value) {
+			return fmt.Sprintf("platform_type must be one of %s", strings.Join(platformTypes, ", "))
+		}
+	case FieldInstallmentTerm:
+		if n, _ := strconv.Atoi(value); n <= 0 {
+			return "installment_term must be positive"
+		}
+	}
+	return ""
+}
+
+// validateCaptureAmount validates the amount to capture from the authorized amount.
+func validateCaptureAmount(amount, authorized Money) error {
+	verr := &ValidationError{}
+	c, err := amount.Cmp(authorized)
+	switch {
+	case err != nil:
+		verr.add("currency", CodeInvalid, fmt.Sprintf("currency must be %s", authorized.Currency))
+	case amount.IsNegative():
+		verr.add("amount", CodeInvalid, "amount must be positive")
+	case c > 0:
+		verr.add("amount", CodeOutOfRange, fmt.Sprintf("amount must not exceed the authorized amount %s", authorized))
+	default:
+		return nil
+	}
+	return verr
+}
+
+func (v *Validator) validateAttributes(verr *ValidationError, req *Request) {
+	if len(req.Reference) > MaxReferenceLength {
+		verr.add("reference", CodeTooLong, fmt.Sprintf("reference must not exceed %d characters", MaxReferenceLength))
+	}
+	if len(req.Description) > MaxDescriptionLength {
+		verr.add("description", CodeTooLong, fmt.Sprintf("description must not exceed %d characters", MaxDescriptionLength))
+	}
+	if req.IPAddress != "" && net.ParseIP(req.IPAddress) == nil {
+		verr.add("ip_address", CodeInvalid, "ip_address must be an IPv4 or IPv6 address")
+	}
+	if len(req.Metadata) > MaxMetadataKeys {
+		verr.add("metadata", CodeTooMany, fmt.Sprintf("metadata must not have more than %d keys", MaxMetadataKeys))
+		return
+	}
+	// the keys are sorted so that the errors are reported in the same order for the same request.
+	keys := make([]string, 0, len(req.Metadata))
+	for k := range req.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		switch {
+		case len(k) > MaxMetadataKeyLength:
+			verr.add("metadata", CodeTooLong, fmt.Sprintf("metadata key %.*s... must not exceed %d characters", MaxMetadataKeyLength, k, MaxMetadataKeyLength))
+		case len(req.Metadata[k]) > MaxMetadataValueLength:
+			verr.add("metadata."+k, CodeTooLong, fmt.Sprintf("metadata value must not exceed %d characters", MaxMetadataValueLength))
+		}
+	}
+}
+
+func (l amountLimit) contains(amount int64) bool {
+	return amount >= l.min && amount <= l.max
+}
+
+func (l amountLimit) message(of, currency string) string {
+	return fmt.Sprintf("amount for %s must be between %s and %s", of, NewMoney(l.min, currency), NewMoney(l.max, currency))
+}
+
+func isCurrencyCode(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// matchHost reports whether the host is one of the allowed hosts, case-insensitively.
+// An allowed host *.example.com matches the subdomains of example.com but not example.com itself.
+func matchHost(allowed []string, host string) bool {
+	host = strings.ToLower(host)
+	for _, h := range allowed {
+		h = strings.ToLower(h)
+		if h == host {
+			return true
+		}
+		if strings.HasPrefix(h, "*.") && strings.HasSuffix(host, h[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
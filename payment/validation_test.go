@@ -0,0 +1,403 @@
+package payment
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidator_Validate(t *testing.T) {
+	validRequest := func() *Request {
+		return &Request{
+			Amount:     NewMoney(20000, "THB"),
+			ReturnURI:  "https://shop.example.com/return",
+			SourceType: "internet_banking_scb",
+			Capture:    true,
+		}
+	}
+	tests := []struct {
+		name   string
+		modify func(req *Request)
+		want   []FieldError
+	}{
+		{
+			name:   "valid",
+			modify: func(req *Request) {},
+			want:   nil,
+		},
+		{
+			name: "missing fields",
+			modify: func(req *Request) {
+				*req = Request{}
+			},
+			want: []FieldError{
+				{Field: "currency", Code: CodeRequired, Message: "currency is required"},
+				{Field: "source_type", Code: CodeRequired, Message: "source_type is required"},
+				{Field: "amount", Code: CodeInvalid, Message: "amount must be positive"},
+				{Field: "return_uri", Code: CodeRequired, Message: "return_uri is required"},
+			},
+		},
+		{
+			name: "invalid currency code",
+			modify: func(req *Request) {
+				req.Amount.Currency = "BAHT"
+			},
+			want: []FieldError{
+				{Field: "currency", Code: CodeInvalid, Message: "currency must be an ISO-4217 currency code"},
+			},
+		},
+		{
+			name: "unsupported currency",
+			modify: func(req *Request) {
+				req.Amount.Currency = "XXX"
+			},
+			want: []FieldError{
+				{Field: "currency", Code: CodeUnsupported, Message: "currency XXX is not supported"},
+			},
+		},
+		{
+			name: "currency not supported by source type",
+			modify: func(req *Request) {
+				req.Amount.Currency = "JPY"
+			},
+			want: []FieldError{
+				{Field: "currency", Code: CodeUnsupported, Message: "currency JPY is not supported by internet_banking_scb"},
+			},
+		},
+		{
+			name: "unsupported source type",
+			modify: func(req *Request) {
+				req.SourceType = "bitcoin"
+			},
+			want: []FieldError{
+				{Field: "source_type", Code: CodeUnsupported, Message: "source type bitcoin is not supported"},
+			},
+		},
+		{
+			name: "amount below currency minimum",
+			modify: func(req *Request) {
+				req.Amount.Amount = 100
+			},
+			want: []FieldError{
+				{Field: "amount", Code: CodeOutOfRange, Message: "amount for THB must be between 20.00 THB and 150000000.00 THB"},
+			},
+		},
+		{
+			name: "amount above source type maximum",
+			modify: func(req *Request) {
+				req.Amount.Amount = 10000001
+			},
+			want: []FieldError{
+				{Field: "amount", Code: CodeOutOfRange, Message: "amount for internet_banking_scb must be between 20.00 THB and 100000.00 THB"},
+			},
+		},
+		{
+			name: "non-https return uri",
+			modify: func(req *Request) {
+				req.ReturnURI = "http://shop.example.com/return"
+			},
+			want: []FieldError{
+				{Field: "return_uri", Code: CodeNotAllowed, Message: "return_uri scheme must be one of https"},
+			},
+		},
+		{
+			name: "relative return uri",
+			modify: func(req *Request) {
+				req.ReturnURI = "/return"
+			},
+			want: []FieldError{
+				{Field: "return_uri", Code: CodeInvalid, Message: "return_uri must be an absolute URI"},
+			},
+		},
+		{
+			name: "return uri host not allowed",
+			modify: func(req *Request) {
+				req.ReturnURI = "https://evil.com/return"
+			},
+			want: []FieldError{
+				{Field: "return_uri", Code: CodeNotAllowed, Message: "return_uri host evil.com is not allowed"},
+			},
+		},
+		{
+			name: "promptpay without return uri",
+			modify: func(req *Request) {
+				req.SourceType = "promptpay"
+				req.ReturnURI = ""
+			},
+			want: nil,
+		},
+		{
+			name: "card",
+			modify: func(req *Request) {
+				req.SourceType = SourceTypeCard
+				req.CardToken = "tokn_test_1"
+				req.Amount = NewMoney(100, "USD")
+			},
+			want: nil,
+		},
+		{
+			name: "card without token",
+			modify: func(req *Request) {
+				req.SourceType = SourceTypeCard
+			},
+			want: []FieldError{
+				{Field: "card_token", Code: CodeRequired, Message: "card_token is required for card"},
+			},
+		},
+		{
+			name: "card token for another source type",
+			modify: func(req *Request) {
+				req.CardToken = "tokn_test_1"
+			},
+			want: []FieldError{
+				{Field: "card_token", Code: CodeNotAllowed, Message: "card_token is not used by internet_banking_scb"},
+			},
+		},
+		{
+			name: "authorize only a non-card payment",
+			modify: func(req *Request) {
+				req.Capture = false
+			},
+			want: []FieldError{
+				{Field: "capture", Code: CodeNotAllowed, Message: "only card payments can be authorized without capture"},
+			},
+		},
+		{
+			name: "truemoney without phone number",
+			modify: func(req *Request) {
+				req.SourceType = "truemoney"
+			},
+			want: []FieldError{
+				{Field: "phone_number", Code: CodeRequired, Message: "phone_number is required for truemoney"},
+			},
+		},
+		{
+			name: "truemoney",
+			modify: func(req *Request) {
+				req.SourceType = "truemoney"
+				req.PhoneNumber = "0812345678"
+			},
+			want: nil,
+		},
+		{
+			name: "econtext with invalid email",
+			modify: func(req *Request) {
+				req.SourceType = "econtext"
+				req.Amount = NewMoney(1000, "JPY")
+				req.Name = "Taro"
+				req.Email = "taro"
+				req.PhoneNumber = "0312345678"
+			},
+			want: []FieldError{
+				{Field: "email", Code: CodeInvalid, Message: "email must be an email address"},
+			},
+		},
+		{
+			name: "mobile banking with invalid platform type",
+			modify: func(req *Request) {
+				req.SourceType = "mobile_banking_scb"
+				req.PlatformType = "WINDOWS"
+			},
+			want: []FieldError{
+				{Field: "platform_type", Code: CodeInvalid, Message: "platform_type must be one of IOS, ANDROID, WEB"},
+			},
+		},
+		{
+			name: "installment",
+			modify: func(req *Request) {
+				req.SourceType = "installment_kbank"
+				req.Amount = NewMoney(300000, "THB")
+				req.InstallmentTerm = 10
+				req.ZeroInterestInstallments = true
+			},
+			want: nil,
+		},
+		{
+			name: "installment term not offered by the bank",
+			modify: func(req *Request) {
+				req.SourceType = "installment_kbank"
+				req.Amount = NewMoney(300000, "THB")
+				req.InstallmentTerm = 9
+			},
+			want: []FieldError{
+				{Field: "installment_term", Code: CodeUnsupported, Message: "installment_term for installment_kbank must be one of 3, 4, 6, 10"},
+			},
+		},
+		{
+			name: "installment monthly amount below minimum",
+			modify: func(req *Request) {
+				req.SourceType = "installment_bay"
+				req.Amount = NewMoney(300000, "THB")
+				req.InstallmentTerm = 10
+			},
+			want: []FieldError{
+				{Field: "amount", Code: CodeOutOfRange, Message: "amount for installment_bay over 10 months must be at least 5000.00 THB"},
+			},
+		},
+		{
+			name: "zero interest installments for another source type",
+			modify: func(req *Request) {
+				req.ZeroInterestInstallments = true
+			},
+			want: []FieldError{
+				{Field: "zero_interest_installments", Code: CodeNotAllowed, Message: "zero_interest_installments is not used by internet_banking_scb"},
+			},
+		},
+		{
+			name: "saved card",
+			modify: func(req *Request) {
+				req.SourceType = SourceTypeCard
+				req.CardID = "card_test_1"
+				req.CustomerID = 1
+			},
+			want: nil,
+		},
+		{
+			name: "saved card without customer",
+			modify: func(req *Request) {
+				req.SourceType = SourceTypeCard
+				req.CardID = "card_test_1"
+			},
+			want: []FieldError{
+				{Field: "customer_id", Code: CodeRequired, Message: "customer_id is required to charge a saved card"},
+			},
+		},
+		{
+			name: "saved card with card token",
+			modify: func(req *Request) {
+				req.SourceType = SourceTypeCard
+				req.CardToken = "tokn_test_1"
+				req.CardID = "card_test_1"
+				req.CustomerID = 1
+			},
+			want: []FieldError{
+				{Field: "card_id", Code: CodeNotAllowed, Message: "card_id must not be given with card_token"},
+			},
+		},
+		{
+			name: "customer without saved card",
+			modify: func(req *Request) {
+				req.SourceType = SourceTypeCard
+				req.CardToken = "tokn_test_1"
+				req.CustomerID = 1
+			},
+			want: []FieldError{
+				{Field: "card_id", Code: CodeRequired, Message: "card_id is required to charge a customer"},
+			},
+		},
+		{
+			name: "description too long",
+			modify: func(req *Request) {
+				req.Description = strings.Repeat("x", MaxDescriptionLength+1)
+			},
+			want: []FieldError{
+				{Field: "description", Code: CodeTooLong, Message: "description must not exceed 255 characters"},
+			},
+		},
+		{
+			name: "metadata errors in key order",
+			modify: func(req *Request) {
+				req.Metadata = map[string]string{
+					"note":                  strings.Repeat("x", MaxMetadataValueLength+1),
+					strings.Repeat("k", 41): "value",
+					"address":               strings.Repeat("x", MaxMetadataValueLength+1),
+					"customer":              "c-1",
+				}
+			},
+			want: []FieldError{
+				{Field: "metadata.address", Code: CodeTooLong, Message: "metadata value must not exceed 500 characters"},
+				{Field: "metadata", Code: CodeTooLong, Message: "metadata key " + strings.Repeat("k", 40) + "... must not exceed 40 characters"},
+				{Field: "metadata.note", Code: CodeTooLong, Message: "metadata value must not exceed 500 characters"},
+			},
+		},
+		{
+			name: "ipv6 address",
+			modify: func(req *Request) {
+				req.IPAddress = "2001:db8::1"
+			},
+		},
+		{
+			name: "invalid ip address",
+			modify: func(req *Request) {
+				req.IPAddress = "203.0.113"
+			},
+			want: []FieldError{
+				{Field: "ip_address", Code: CodeInvalid, Message: "ip_address must be an IPv4 or IPv6 address"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewValidator([]string{"https"}, []string{"*.example.com"}, map[string]InstallmentRate{
+				"installment_bay": {InterestRate: 80, MinMonthlyAmount: 50000},
+			})
+			req := validRequest()
+			tt.modify(req)
+
+			err := v.Validate(req)
+			if tt.want == nil {
+				if err != nil {
+					t.Errorf("Validator.Validate() error = %v, want nil", err)
+				}
+				return
+			}
+
+			verr, ok := err.(*ValidationError)
+			if !ok {
+				t.Fatalf("Validator.Validate() error = %v, want *ValidationError", err)
+			}
+			if !reflect.DeepEqual(verr.Errors, tt.want) {
+				t.Errorf("Validator.Validate() errors = %v, want %v", verr.Errors, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidator_ValidateReturnURI(t *testing.T) {
+	v := NewValidator([]string{"https"}, []string{"example.com"}, nil)
+	tests := []struct {
+		name      string
+		returnURI string
+		wantErr   bool
+	}{
+		{name: "valid", returnURI: "https://example.com/thanks"},
+		{name: "missing", returnURI: "", wantErr: true},
+		{name: "scheme not allowed", returnURI: "http://example.com/thanks", wantErr: true},
+		{name: "host not allowed", returnURI: "https://evil.com/thanks", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := v.ValidateReturnURI(tt.returnURI)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validator.ValidateReturnURI() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidRequest) {
+				t.Errorf("Validator.ValidateReturnURI() error = %v, want a validation error", err)
+			}
+		})
+	}
+}
+
+func Test_matchHost(t *testing.T) {
+	allowed := []string{"shop.example.org", "*.example.com"}
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{host: "shop.example.org", want: true},
+		{host: "SHOP.Example.org", want: true},
+		{host: "example.org", want: false},
+		{host: "pay.example.com", want: true},
+		{host: "a.b.example.com", want: true},
+		{host: "example.com", want: false},
+		{host: "evilexample.com", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			if got := matchHost(allowed, tt.host); got != tt.want {
+				t.Errorf("matchHost(%v, %q) = %v, want %v", allowed, tt.host, got, tt.want)
+			}
+		})
+	}
+}
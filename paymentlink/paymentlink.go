@@ -0,0 +1,378 @@
+package paymentlink
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+// Service provides payment link service methods.
+type Service interface {
+	Create(req *Request) (*Link, error)
+	Find(id int) (*Link, error)
+	FindBySlug(slug string) (*Link, error)
+	Pay(slug string, req *PayRequest) (*payment.Payment, error)
+	Payments(id int) ([]*payment.Payment, error)
+}
+
+// Link represents a payment link, a URL which is sent to payers so that they pay without the merchant
+// integrating the API. The payer chooses one of SourceTypes on the hosted page of the link.
+// ExpiresAt is zero if the link never expires, MaxUses is zero if the link can be used any number of times.
+// Uses is the number of payments made through the link which are paid or still pending, the use of a pending
+// payment is released once it fails or expires, so that the link can be paid again.
+type Link struct {
+	ID          int
+	Slug        string
+	Amount      payment.Money
+	Description string
+	SourceTypes []string
+	ReturnURI   string
+	ExpiresAt   time.Time
+	MaxUses     int
+	Uses        int
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// Status represents a payment link status.
+type Status string
+
+// Payment link statuses
+const (
+	StatusActive  Status = "active"
+	StatusExpired Status = "expired"
+	// StatusUsedUp is the status of a link which was used MaxUses times.
+	StatusUsedUp Status = "used_up"
+)
+
+// Status returns the status of the link at the given time.
+func (l *Link) Status(now time.Time) Status {
+	switch {
+	case !l.ExpiresAt.IsZero() && !now.Before(l.ExpiresAt):
+		return StatusExpired
+	case l.MaxUses > 0 && l.Uses >= l.MaxUses:
+		return StatusUsedUp
+	default:
+		return StatusActive
+	}
+}
+
+// Use counts a use of the link, it returns an error if the link is not active at the given time.
+func (l *Link) Use(now time.Time) error {
+	switch l.Status(now) {
+	case StatusExpired:
+		return ErrLinkExpired
+	case StatusUsedUp:
+		return ErrLinkUsedUp
+	}
+	l.Uses++
+	return nil
+}
+
+// Request contains details for creating a payment link.
+type Request struct {
+	Amount      payment.Money
+	Description string
+	SourceTypes []string
+	ReturnURI   string
+	ExpiresAt   time.Time
+	MaxUses     int
+}
+
+// PayRequest contains the payment source chosen by the payer on the hosted page, and the IP address of the payer.
+type PayRequest struct {
+	SourceType string
+	payment.SourceDetails
+	IPAddress string
+}
+
+// Repository provides access payment links and their payments in a data source.
+// Use and Release count the uses of a link atomically, so a link is not used more than its max uses
+// by concurrent payers.
+// AddPayment adds a payment of a link, a pending one is returned by FindPendingPayments until it is settled.
+// SettlePayment marks a pending payment as no longer pending and releases its use if release is true, in the same
+// write, so that a payment settled by concurrent requests is released once; it does nothing to a settled payment.
+type Repository interface {
+	Create(link *Link) error
+	Find(id int) (*Link, error)
+	FindBySlug(slug string) (*Link, error)
+	Use(id int, now time.Time) error
+	Release(id int) error
+	AddPayment(id, paymentID int, pending bool) error
+	FindPayments(id int) ([]int, error)
+	FindPendingPayments(id int) ([]int, error)
+	SettlePayment(id, paymentID int, release bool) error
+}
+
+// Payments makes the payments of payment links, it is implemented by payment.Service.
+type Payments interface {
+	CreatePaymentRequest(req *payment.Request) (*payment.Payment, error)
+	Find(id int) (*payment.Payment, error)
+}
+
+// Errors
+var (
+	ErrLinkNotFound = &payment.Error{Code: payment.ErrorCodeNotFound, Message: "payment link not found"}
+	ErrLinkExpired  = &payment.Error{Code: payment.ErrorCodeConflict, Message: "payment link is expired"}
+	ErrLinkUsedUp   = &payment.Error{Code: payment.ErrorCodeConflict, Message: "payment link is used up"}
+)
+
+// slugSize is the number of random bytes of a slug, it makes the links unguessable.
+const slugSize = 12
+
+type service struct {
+	payments  Payments
+	repo      Repository
+	validator *payment.Validator
+	now       func() time.Time
+}
+
+// NewService returns a new payment link service which makes the payments through the payment service.
+func NewService(payments Payments, repo Repository, validator *payment.Validator) Service {
+	return &service{
+		payments:  payments,
+		repo:      repo,
+		validator: validator,
+		now:       time.Now,
+	}
+}
+
+// Create creates a payment link with a random slug.
+func (s *service) Create(req *Request) (*Link, error) {
+	if err := s.validate(req); err != nil {
+		return nil, err
+	}
+
+	slug, err := newSlug()
+	if err != nil {
+		return nil, err
+	}
+
+	link := &Link{
+		Slug:        slug,
+		Amount:      req.Amount,
+		Description: req.Description,
+		SourceTypes: req.SourceTypes,
+		ReturnURI:   req.ReturnURI,
+		ExpiresAt:   req.ExpiresAt,
+		MaxUses:     req.MaxUses,
+	}
+	if err := s.repo.Create(link); err != nil {
+		return nil, err
+	}
+
+	return link, nil
+}
+
+// Find finds a payment link with the given id, its pending payments are settled first so that its uses are current.
+func (s *service) Find(id int) (*Link, error) {
+	link, err := s.repo.Find(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.settle(link)
+}
+
+// FindBySlug finds a payment link with the given slug, its pending payments are settled first
+// so that its uses are current.
+func (s *service) FindBySlug(slug string) (*Link, error) {
+	link, err := s.repo.FindBySlug(slug)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.settle(link)
+}
+
+// Pay makes a payment of the link with the source chosen by the payer.
+// The use is counted before the payment is made and released if the payment cannot be made or fails right away.
+// A pending payment, e.g. waiting for 3-D Secure, keeps its use until it is settled, see settle.
+func (s *service) Pay(slug string, req *PayRequest) (*payment.Payment, error) {
+	link, err := s.FindBySlug(slug)
+	if err != nil {
+		return nil, err
+	}
+
+	if !contains(link.SourceTypes, req.SourceType) {
+		return nil, &payment.ValidationError{Errors: []payment.FieldError{
+			{Field: "source_type", Code: payment.CodeNotAllowed, Message: fmt.Sprintf("source type %s is not allowed by the payment link", req.SourceType)},
+		}}
+	}
+
+	if err := s.repo.Use(link.ID, s.now()); err != nil {
+		return nil, err
+	}
+
+	p, err := s.payments.CreatePaymentRequest(&payment.Request{
+		Amount:        link.Amount,
+		ReturnURI:     link.ReturnURI,
+		SourceType:    req.SourceType,
+		SourceDetails: req.SourceDetails,
+		Capture:       true,
+		Description:   link.Description,
+		Metadata:      map[string]string{"payment_link_id": strconv.Itoa(link.ID)},
+		IPAddress:     req.IPAddress,
+	})
+	if err != nil {
+		if rerr := s.repo.Release(link.ID); rerr != nil {
+			return nil, rerr
+		}
+		return nil, err
+	}
+
+	if released(p.Status) {
+		if err := s.repo.Release(link.ID); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.repo.AddPayment(link.ID, p.ID, pending(p.Status)); err != nil {
+		// A pending payment which is not added is never settled, so its use is released rather than kept forever.
+		// The use of a paid payment is kept, the link was used.
+		if pending(p.Status) {
+			if rerr := s.repo.Release(link.ID); rerr != nil {
+				return nil, rerr
+			}
+		}
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// settle refreshes the pending payments of the link and settles the ones which are no longer pending,
+// the use of a payment which failed or expired is released. A payment which cannot be refreshed, e.g. because
+// the payment gateway is unavailable, stays pending until the link is found again.
+func (s *service) settle(link *Link) (*Link, error) {
+	ids, err := s.repo.FindPendingPayments(link.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return link, nil
+	}
+
+	for _, id := range ids {
+		p, err := s.payments.Find(id)
+		if err != nil || pending(p.Status) {
+			continue
+		}
+		if err := s.repo.SettlePayment(link.ID, id, released(p.Status)); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.repo.Find(link.ID)
+}
+
+// pending reports whether a payment with the status may still be paid or fail.
+func pending(status payment.Status) bool {
+	return status == payment.StatusPending || status == payment.StatusAuthorized
+}
+
+// released reports whether a payment with the status was never paid, so it does not use the link.
+func released(status payment.Status) bool {
+	return status == payment.StatusFailed || status == payment.StatusExpired
+}
+
+// Payments returns the payments made through the payment link with their current status.
+func (s *service) Payments(id int) ([]*payment.Payment, error) {
+	if _, err := s.repo.Find(id); err != nil {
+		return nil, err
+	}
+
+	ids, err := s.repo.FindPayments(id)
+	if err != nil {
+		return nil, err
+	}
+
+	payments := make([]*payment.Payment, len(ids))
+	for i, paymentID := range ids {
+		p, err := s.payments.Find(paymentID)
+		if err != nil {
+			return nil, err
+		}
+		payments[i] = p
+	}
+
+	return payments, nil
+}
+
+// validate validates that every source type of the link can pay its amount.
+func (s *service) validate(req *Request) error {
+	verr := &payment.ValidationError{}
+	add := func(field, code, message string) {
+		verr.Errors = append(verr.Errors, payment.FieldError{Field: field, Code: code, Message: message})
+	}
+
+	currency := req.Amount.Currency
+	currencyOK := payment.SupportedCurrency(currency)
+	switch {
+	case currency == "":
+		add("currency", payment.CodeRequired, "currency is required")
+	case !currencyOK:
+		add("currency", payment.CodeUnsupported, fmt.Sprintf("currency %s is not supported", currency))
+	}
+	if req.Amount.Amount <= 0 {
+		add("amount", payment.CodeInvalid, "amount must be positive")
+	}
+
+	if len(req.SourceTypes) == 0 {
+		add("source_types", payment.CodeRequired, "source_types is required")
+	}
+	for i, name := range req.SourceTypes {
+		field := fmt.Sprintf("source_types[%d]", i)
+		source, ok := payment.LookupSourceType(name)
+		switch {
+		case !ok:
+			add(field, payment.CodeUnsupported, fmt.Sprintf("source type %s is not supported", name))
+		case contains(req.SourceTypes[:i], name):
+			add(field, payment.CodeInvalid, fmt.Sprintf("source type %s is given more than once", name))
+		case currencyOK && !contains(source.Currencies, currency):
+			add(field, payment.CodeUnsupported, fmt.Sprintf("currency %s is not supported by %s", currency, name))
+		case req.Amount.Amount > 0 && (source.MinAmount > 0 && req.Amount.Amount < source.MinAmount || source.MaxAmount > 0 && req.Amount.Amount > source.MaxAmount):
+			add(field, payment.CodeOutOfRange, fmt.Sprintf("amount for %s must be between %s and %s", name, payment.NewMoney(source.MinAmount, currency), payment.NewMoney(source.MaxAmount, currency)))
+		}
+	}
+
+	var rerr *payment.ValidationError
+	if err := s.validator.ValidateReturnURI(req.ReturnURI); errors.As(err, &rerr) {
+		verr.Errors = append(verr.Errors, rerr.Errors...)
+	}
+	if !req.ExpiresAt.IsZero() && !req.ExpiresAt.After(s.now()) {
+		add("expires_at", payment.CodeInvalid, "expires_at must be in the future")
+	}
+	if req.MaxUses < 0 {
+		add("max_uses", payment.CodeInvalid, "max_uses must not be negative")
+	}
+	if len(req.Description) > payment.MaxDescriptionLength {
+		add("description", payment.CodeTooLong, fmt.Sprintf("description must not exceed %d characters", payment.MaxDescriptionLength))
+	}
+
+	if len(verr.Errors) > 0 {
+		return verr
+	}
+	return nil
+}
+
+func newSlug() (string, error) {
+	b := make([]byte, slugSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
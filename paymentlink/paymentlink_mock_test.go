@@ -0,0 +1,68 @@
+package paymentlink
+
+import (
+	"time"
+
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+type mockPaymentService struct {
+	CreatePaymentRequestFn func(req *payment.Request) (*payment.Payment, error)
+	FindFn                 func(id int) (*payment.Payment, error)
+}
+
+func (m *mockPaymentService) CreatePaymentRequest(req *payment.Request) (*payment.Payment, error) {
+	return m.CreatePaymentRequestFn(req)
+}
+
+func (m *mockPaymentService) Find(id int) (*payment.Payment, error) {
+	return m.FindFn(id)
+}
+
+type mockRepository struct {
+	CreateFn              func(link *Link) error
+	FindFn                func(id int) (*Link, error)
+	FindBySlugFn          func(slug string) (*Link, error)
+	UseFn                 func(id int, now time.Time) error
+	ReleaseFn             func(id int) error
+	AddPaymentFn          func(id, paymentID int, pending bool) error
+	FindPaymentsFn        func(id int) ([]int, error)
+	FindPendingPaymentsFn func(id int) ([]int, error)
+	SettlePaymentFn       func(id, paymentID int, release bool) error
+}
+
+func (m *mockRepository) Create(link *Link) error {
+	return m.CreateFn(link)
+}
+
+func (m *mockRepository) Find(id int) (*Link, error) {
+	return m.FindFn(id)
+}
+
+func (m *mockRepository) FindBySlug(slug string) (*Link, error) {
+	return m.FindBySlugFn(slug)
+}
+
+func (m *mockRepository) Use(id int, now time.Time) error {
+	return m.UseFn(id, now)
+}
+
+func (m *mockRepository) Release(id int) error {
+	return m.ReleaseFn(id)
+}
+
+func (m *mockRepository) AddPayment(id, paymentID int, pending bool) error {
+	return m.AddPaymentFn(id, paymentID, pending)
+}
+
+func (m *mockRepository) FindPayments(id int) ([]int, error) {
+	return m.FindPaymentsFn(id)
+}
+
+func (m *mockRepository) FindPendingPayments(id int) ([]int, error) {
+	return m.FindPendingPaymentsFn(id)
+}
+
+func (m *mockRepository) SettlePayment(id, paymentID int, release bool) error {
+	return m.SettlePaymentFn(id, paymentID, release)
+}
@@ -0,0 +1,361 @@
+package paymentlink
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+var now = time.Date(2021, 1, 31, 9, 0, 0, 0, time.UTC)
+
+func newTestService(payments Payments, repo Repository) *service {
+	s := NewService(payments, repo, payment.NewValidator([]string{"https"}, nil, nil)).(*service)
+	s.now = func() time.Time { return now }
+	return s
+}
+
+func TestLink_Status(t *testing.T) {
+	tests := []struct {
+		name string
+		link Link
+		want Status
+	}{
+		{
+			name: "unlimited",
+			link: Link{Uses: 100},
+			want: StatusActive,
+		},
+		{
+			name: "before expiry",
+			link: Link{ExpiresAt: now.Add(time.Second), MaxUses: 2, Uses: 1},
+			want: StatusActive,
+		},
+		{
+			name: "expired",
+			link: Link{ExpiresAt: now},
+			want: StatusExpired,
+		},
+		{
+			name: "used up",
+			link: Link{MaxUses: 2, Uses: 2},
+			want: StatusUsedUp,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.link.Status(now); got != tt.want {
+				t.Errorf("Link.Status() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_Create(t *testing.T) {
+	valid := Request{
+		Amount:      payment.NewMoney(150000, "THB"),
+		Description: "Invoice #1",
+		SourceTypes: []string{"card", "promptpay"},
+		ReturnURI:   "https://example.com/thanks",
+		ExpiresAt:   now.Add(24 * time.Hour),
+		MaxUses:     1,
+	}
+
+	tests := []struct {
+		name       string
+		req        func(req *Request)
+		wantFields []string
+	}{
+		{
+			name: "valid",
+			req:  func(req *Request) {},
+		},
+		{
+			name: "no source types",
+			req: func(req *Request) {
+				req.SourceTypes = nil
+			},
+			wantFields: []string{"source_types"},
+		},
+		{
+			name: "invalid source types",
+			req: func(req *Request) {
+				req.SourceTypes = []string{"card", "unknown", "card", "econtext", "alipay"}
+				req.Amount = payment.NewMoney(100000000, "THB")
+			},
+			wantFields: []string{"source_types[1]", "source_types[2]", "source_types[3]", "source_types[4]"},
+		},
+		{
+			name: "currency not supported by the gateway",
+			req: func(req *Request) {
+				req.Amount = payment.NewMoney(50000, "VND")
+			},
+			wantFields: []string{"currency"},
+		},
+		{
+			name: "invalid attributes",
+			req: func(req *Request) {
+				req.Amount = payment.NewMoney(0, "XXX")
+				req.ReturnURI = ""
+				req.ExpiresAt = now
+				req.MaxUses = -1
+			},
+			wantFields: []string{"currency", "amount", "return_uri", "expires_at", "max_uses"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &mockRepository{}
+			repo.CreateFn = func(link *Link) error {
+				link.ID = 1
+				return nil
+			}
+
+			req := valid
+			tt.req(&req)
+
+			s := newTestService(&mockPaymentService{}, repo)
+			got, err := s.Create(&req)
+
+			var gotFields []string
+			var verr *payment.ValidationError
+			if errors.As(err, &verr) {
+				for _, fe := range verr.Errors {
+					gotFields = append(gotFields, fe.Field)
+				}
+			} else if err != nil {
+				t.Fatalf("Service.Create() error = %v", err)
+			}
+			if !reflect.DeepEqual(gotFields, tt.wantFields) {
+				t.Errorf("Service.Create() error fields = %v, want %v", gotFields, tt.wantFields)
+			}
+			if err == nil && (got.ID != 1 || len(got.Slug) != 16 || got.Amount != req.Amount) {
+				t.Errorf("Service.Create() = %v", got)
+			}
+		})
+	}
+}
+
+func TestService_Pay(t *testing.T) {
+	link := &Link{
+		ID:          1,
+		Slug:        "abc",
+		Amount:      payment.NewMoney(150000, "THB"),
+		Description: "Invoice #1",
+		SourceTypes: []string{"card", "truemoney"},
+		ReturnURI:   "https://example.com/thanks",
+	}
+	pending := &payment.Payment{ID: 10, Status: payment.StatusPending}
+	failed := &payment.Payment{ID: 10, Status: payment.StatusFailed}
+	errAdd := errors.New("connection reset")
+
+	tests := []struct {
+		name        string
+		req         *PayRequest
+		useErr      error
+		payment     *payment.Payment
+		paymentErr  error
+		addErr      error
+		want        *payment.Payment
+		wantErr     error
+		wantRelease bool
+		wantAdded   bool
+		wantPending bool
+	}{
+		{
+			name:        "success",
+			req:         &PayRequest{SourceType: "truemoney", SourceDetails: payment.SourceDetails{PhoneNumber: "0812345678"}},
+			payment:     pending,
+			want:        pending,
+			wantAdded:   true,
+			wantPending: true,
+		},
+		{
+			name:    "source type not allowed",
+			req:     &PayRequest{SourceType: "promptpay"},
+			wantErr: payment.ErrInvalidRequest,
+		},
+		{
+			name:    "used up",
+			req:     &PayRequest{SourceType: "card", SourceDetails: payment.SourceDetails{CardToken: "tokn_test_1"}},
+			useErr:  ErrLinkUsedUp,
+			wantErr: ErrLinkUsedUp,
+		},
+		{
+			name:        "payment error",
+			req:         &PayRequest{SourceType: "card", SourceDetails: payment.SourceDetails{CardToken: "tokn_test_1"}},
+			paymentErr:  payment.ErrGatewayDeclined,
+			wantErr:     payment.ErrGatewayDeclined,
+			wantRelease: true,
+		},
+		{
+			name:        "failed payment",
+			req:         &PayRequest{SourceType: "card", SourceDetails: payment.SourceDetails{CardToken: "tokn_test_1"}},
+			payment:     failed,
+			want:        failed,
+			wantRelease: true,
+			wantAdded:   true,
+		},
+		{
+			name:        "pending payment not added",
+			req:         &PayRequest{SourceType: "truemoney", SourceDetails: payment.SourceDetails{PhoneNumber: "0812345678"}},
+			payment:     pending,
+			addErr:      errAdd,
+			wantErr:     errAdd,
+			wantRelease: true,
+			wantAdded:   true,
+			wantPending: true,
+		},
+		{
+			name:      "paid payment not added",
+			req:       &PayRequest{SourceType: "card", SourceDetails: payment.SourceDetails{CardToken: "tokn_test_1"}},
+			payment:   &payment.Payment{ID: 10, Status: payment.StatusSuccessful},
+			addErr:    errAdd,
+			wantErr:   errAdd,
+			wantAdded: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payments := &mockPaymentService{}
+			repo := &mockRepository{}
+
+			var released, added, addedPending bool
+			repo.FindBySlugFn = func(slug string) (*Link, error) {
+				if slug != link.Slug {
+					return nil, ErrLinkNotFound
+				}
+				return link, nil
+			}
+			repo.FindPendingPaymentsFn = func(id int) ([]int, error) {
+				return nil, nil
+			}
+			repo.UseFn = func(id int, now time.Time) error {
+				return tt.useErr
+			}
+			repo.ReleaseFn = func(id int) error {
+				released = true
+				return nil
+			}
+			repo.AddPaymentFn = func(id, paymentID int, pending bool) error {
+				added = id == link.ID && paymentID == tt.payment.ID
+				addedPending = pending
+				return tt.addErr
+			}
+			payments.CreatePaymentRequestFn = func(req *payment.Request) (*payment.Payment, error) {
+				want := &payment.Request{
+					Amount:        link.Amount,
+					ReturnURI:     link.ReturnURI,
+					SourceType:    tt.req.SourceType,
+					SourceDetails: tt.req.SourceDetails,
+					Capture:       true,
+					Description:   link.Description,
+					Metadata:      map[string]string{"payment_link_id": "1"},
+				}
+				if !reflect.DeepEqual(req, want) {
+					t.Errorf("CreatePaymentRequest() called with %v, want %v", req, want)
+				}
+				return tt.payment, tt.paymentErr
+			}
+
+			s := newTestService(payments, repo)
+			got, err := s.Pay("abc", tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Service.Pay() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Service.Pay() = %v, want %v", got, tt.want)
+			}
+			if released != tt.wantRelease {
+				t.Errorf("Service.Pay() released = %v, want %v", released, tt.wantRelease)
+			}
+			if added != tt.wantAdded {
+				t.Errorf("Service.Pay() added payment = %v, want %v", added, tt.wantAdded)
+			}
+			if addedPending != tt.wantPending {
+				t.Errorf("Service.Pay() added pending payment = %v, want %v", addedPending, tt.wantPending)
+			}
+		})
+	}
+}
+
+func TestService_Find_settle(t *testing.T) {
+	payments := &mockPaymentService{}
+	repo := &mockRepository{}
+
+	link := &Link{ID: 1, MaxUses: 3, Uses: 3}
+	repo.FindFn = func(id int) (*Link, error) {
+		return link, nil
+	}
+	repo.FindPendingPaymentsFn = func(id int) ([]int, error) {
+		return []int{10, 11, 12, 13, 14}, nil
+	}
+	statuses := map[int]payment.Status{
+		10: payment.StatusSuccessful,
+		11: payment.StatusFailed,
+		12: payment.StatusExpired,
+		13: payment.StatusPending,
+	}
+	payments.FindFn = func(id int) (*payment.Payment, error) {
+		status, ok := statuses[id]
+		if !ok {
+			return nil, payment.ErrGatewayUnavailable
+		}
+		return &payment.Payment{ID: id, Status: status}, nil
+	}
+	settled := make(map[int]bool)
+	repo.SettlePaymentFn = func(id, paymentID int, release bool) error {
+		settled[paymentID] = release
+		if release {
+			link.Uses--
+		}
+		return nil
+	}
+
+	s := newTestService(payments, repo)
+	got, err := s.Find(1)
+	if err != nil {
+		t.Fatalf("Service.Find() error = %v", err)
+	}
+	// the pending payment and the one which cannot be refreshed keep their uses.
+	if want := map[int]bool{10: false, 11: true, 12: true}; !reflect.DeepEqual(settled, want) {
+		t.Errorf("Service.Find() settled = %v, want %v", settled, want)
+	}
+	if got.Uses != 1 || got.Status(time.Now()) != StatusActive {
+		t.Errorf("Service.Find() uses = %v, status %v, want 1, %v", got.Uses, got.Status(time.Now()), StatusActive)
+	}
+}
+
+func TestService_Payments(t *testing.T) {
+	payments := &mockPaymentService{}
+	repo := &mockRepository{}
+
+	repo.FindFn = func(id int) (*Link, error) {
+		if id != 1 {
+			return nil, ErrLinkNotFound
+		}
+		return &Link{ID: 1}, nil
+	}
+	repo.FindPaymentsFn = func(id int) ([]int, error) {
+		return []int{10, 11}, nil
+	}
+	payments.FindFn = func(id int) (*payment.Payment, error) {
+		return &payment.Payment{ID: id, Status: payment.StatusSuccessful}, nil
+	}
+
+	s := newTestService(payments, repo)
+	got, err := s.Payments(1)
+	if err != nil {
+		t.Fatalf("Service.Payments() error = %v", err)
+	}
+	want := []*payment.Payment{{ID: 10, Status: payment.StatusSuccessful}, {ID: 11, Status: payment.StatusSuccessful}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Service.Payments() = %v, want %v", got, want)
+	}
+
+	if _, err := s.Payments(2); !errors.Is(err, ErrLinkNotFound) {
+		t.Errorf("Service.Payments() error = %v, wantErr %v", err, ErrLinkNotFound)
+	}
+}
@@ -0,0 +1,118 @@
+package reconcile
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+// csvColumns maps the columns of a charge export to the header names they may have.
+// Header names are matched case-insensitively, the other columns are ignored.
+var csvColumns = map[string][]string{
+	"charge_id": {"charge_id", "charge id", "id"},
+	"status":    {"status"},
+	"amount":    {"amount"},
+	"currency":  {"currency"},
+}
+
+// ReadCSV reads the records of a charge export, such as one downloaded from the Omise dashboard.
+// The export has a header row and the charge id, status, amount and currency columns,
+// the amount is a decimal in the currency such as 200.00.
+// Invalid records are returned as a *payment.ValidationError, where records[0] is the first row after the header.
+func ReadCSV(r io.Reader) ([]Record, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, &payment.ValidationError{Errors: []payment.FieldError{
+			{Field: "header", Code: payment.CodeRequired, Message: "header row is required"},
+		}}
+	}
+	if err != nil {
+		return nil, csvError(err)
+	}
+
+	index := make(map[string]int, len(csvColumns))
+	var errs []payment.FieldError
+	for _, column := range []string{"charge_id", "status", "amount", "currency"} {
+		i := findColumn(header, csvColumns[column])
+		if i < 0 {
+			errs = append(errs, payment.FieldError{Field: "header", Code: payment.CodeRequired, Message: "column " + column + " is required"})
+			continue
+		}
+		index[column] = i
+	}
+	if len(errs) > 0 {
+		return nil, &payment.ValidationError{Errors: errs}
+	}
+
+	var records []Record
+	for row := 0; ; row++ {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, csvError(err)
+		}
+
+		field := func(column string) string {
+			return strings.TrimSpace(fields[index[column]])
+		}
+		prefix := fmt.Sprintf("records[%d].", row)
+		record := Record{
+			ChargeID: field("charge_id"),
+			Status:   payment.Status(strings.ToLower(field("status"))),
+		}
+		if record.ChargeID == "" {
+			errs = append(errs, payment.FieldError{Field: prefix + "charge_id", Code: payment.CodeRequired, Message: "charge_id is required"})
+		}
+		if record.Status == "" {
+			errs = append(errs, payment.FieldError{Field: prefix + "status", Code: payment.CodeRequired, Message: "status is required"})
+		}
+		// exports format large amounts with thousands separators.
+		amount, err := payment.ParseMoney(strings.ReplaceAll(field("amount"), ",", ""), strings.ToUpper(field("currency")))
+		switch {
+		case errors.Is(err, payment.ErrUnknownCurrency):
+			errs = append(errs, payment.FieldError{Field: prefix + "currency", Code: payment.CodeUnsupported, Message: "currency is not supported"})
+		case err != nil:
+			errs = append(errs, payment.FieldError{Field: prefix + "amount", Code: payment.CodeInvalid, Message: "amount must be a decimal string"})
+		}
+		record.Amount = amount
+		records = append(records, record)
+	}
+	if len(errs) > 0 {
+		return nil, &payment.ValidationError{Errors: errs}
+	}
+
+	return records, nil
+}
+
+func findColumn(header []string, names []string) int {
+	for i, h := range header {
+		// spreadsheet applications start the file with a byte order mark.
+		h = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+		for _, name := range names {
+			if h == name {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// csvError returns a malformed row as a validation error of the row.
+func csvError(err error) error {
+	var perr *csv.ParseError
+	if errors.As(err, &perr) {
+		return &payment.ValidationError{Errors: []payment.FieldError{
+			{Field: fmt.Sprintf("line %d", perr.Line), Code: payment.CodeInvalid, Message: perr.Err.Error()},
+		}}
+	}
+	return err
+}
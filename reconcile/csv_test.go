@@ -0,0 +1,77 @@
+package reconcile
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+func TestReadCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		csv     string
+		want    []Record
+		wantErr []payment.FieldError
+	}{
+		{
+			name: "omise export",
+			csv: "\ufeffCharge ID,Created,Amount,Currency,Status\n" +
+				"chrg_test_1,2021-02-01 10:00,200.00,thb,Successful\n" +
+				"chrg_test_2,2021-02-01 11:00,\"1,500.50\",THB,failed\n",
+			want: []Record{
+				{ChargeID: "chrg_test_1", Status: payment.StatusSuccessful, Amount: thb(20000)},
+				{ChargeID: "chrg_test_2", Status: payment.StatusFailed, Amount: thb(150050)},
+			},
+		},
+		{
+			name: "missing columns",
+			csv:  "id,amount\n",
+			wantErr: []payment.FieldError{
+				{Field: "header", Code: payment.CodeRequired, Message: "column status is required"},
+				{Field: "header", Code: payment.CodeRequired, Message: "column currency is required"},
+			},
+		},
+		{
+			name:    "empty",
+			csv:     "",
+			wantErr: []payment.FieldError{{Field: "header", Code: payment.CodeRequired, Message: "header row is required"}},
+		},
+		{
+			name: "invalid records",
+			csv:  "id,status,amount,currency\n,successful,20.00,THB\nchrg_test_2,failed,abc,THB\nchrg_test_3,failed,1.00,XYZ\n",
+			wantErr: []payment.FieldError{
+				{Field: "records[0].charge_id", Code: payment.CodeRequired, Message: "charge_id is required"},
+				{Field: "records[1].amount", Code: payment.CodeInvalid, Message: "amount must be a decimal string"},
+				{Field: "records[2].currency", Code: payment.CodeUnsupported, Message: "currency is not supported"},
+			},
+		},
+		{
+			name:    "malformed row",
+			csv:     "id,status,amount,currency\nchrg_test_1,successful\n",
+			wantErr: []payment.FieldError{{Field: "line 2", Code: payment.CodeInvalid, Message: "wrong number of fields"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadCSV(strings.NewReader(tt.csv))
+			if tt.wantErr != nil {
+				verr, ok := err.(*payment.ValidationError)
+				if !ok {
+					t.Fatalf("ReadCSV() error = %v, want a validation error", err)
+				}
+				if !reflect.DeepEqual(verr.Errors, tt.wantErr) {
+					t.Errorf("ReadCSV() errors = %v, want %v", verr.Errors, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadCSV() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadCSV() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+// Package reconcile reconciles the payments with the charges the payment gateway reports.
+package reconcile
+
+import (
+	"errors"
+	"time"
+
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+// Service provides reconciliation service methods.
+// Reconcile reconciles the payments created in [from, to) with the given records, such as those of a charge export.
+// ReconcileGateway reconciles them with the charges listed from the payment gateway.
+// If operator is not empty, a payment with a status mismatch is refreshed from its charge on behalf of the operator,
+// the change of its status is recorded in the audit log of the status overrides.
+type Service interface {
+	Reconcile(records []Record, from, to time.Time, operator string) (*Report, error)
+	ReconcileGateway(from, to time.Time, operator string) (*Report, error)
+}
+
+// Record represents a charge as the payment gateway reports it.
+// The status is either an Omise charge status or a payment status.
+type Record struct {
+	ChargeID string
+	Status   payment.Status
+	Amount   payment.Money
+}
+
+// MismatchType is the type of a mismatch between a payment and its charge.
+type MismatchType string
+
+// Mismatch types
+const (
+	// MismatchMissingLocally is a charge without a payment.
+	MismatchMissingLocally MismatchType = "missing_locally"
+	// MismatchMissingAtGateway is a payment whose charge is not in the records.
+	MismatchMissingAtGateway MismatchType = "missing_at_gateway"
+	MismatchStatus           MismatchType = "status_mismatch"
+	MismatchAmount           MismatchType = "amount_mismatch"
+)
+
+// Mismatch represents a mismatch between a payment and its charge.
+// The local fields are empty if the payment is missing, and the gateway fields if the charge is missing.
+// Corrected reports whether the payment status matches the charge after it was refreshed,
+// Error is the reason it could not be refreshed.
+type Mismatch struct {
+	Type          MismatchType
+	ChargeID      string
+	PaymentID     int
+	LocalStatus   payment.Status
+	GatewayStatus payment.Status
+	LocalAmount   payment.Money
+	GatewayAmount payment.Money
+	Corrected     bool
+	Error         string
+}
+
+// Report represents the result of a reconciliation.
+// Records is the number of records reconciled, Matched is the number of them matching their payment.
+type Report struct {
+	From       time.Time
+	To         time.Time
+	Records    int
+	Matched    int
+	Mismatches []Mismatch
+}
+
+// Gateway lists the charges of the payment gateway created in [from, to).
+type Gateway interface {
+	ListCharges(from, to time.Time) ([]*payment.OmiseCharge, error)
+}
+
+// Repository provides access payments in a data source.
+// FindByChargeID returns payment.ErrPaymentNotFound if no payment has the charge.
+// FindCreated returns the payments created in [from, to).
+type Repository interface {
+	FindByChargeID(chargeID string) (*payment.Payment, error)
+	FindCreated(from, to time.Time) ([]*payment.Payment, error)
+}
+
+// Payments corrects payments from their charge on behalf of an operator, it is implemented by payment.Service.
+type Payments interface {
+	CorrectStatus(id int, reason, operator string) (*payment.Payment, error)
+}
+
+// correctionReason is the reason of the status overrides of the corrections.
+const correctionReason = "corrected by a reconciliation with the payment gateway"
+
+type service struct {
+	payments Payments
+	gateway  Gateway
+	repo     Repository
+}
+
+// NewService returns a new reconciliation service.
+func NewService(payments Payments, gateway Gateway, repo Repository) Service {
+	return &service{
+		payments: payments,
+		gateway:  gateway,
+		repo:     repo,
+	}
+}
+
+// Reconcile matches every record to a payment by its charge id, then reports the payments created in [from, to)
+// which no record matched. A payment is created a moment after its charge, so one created at the edge of the range
+// may be reported missing at the gateway while its charge is outside the range.
+func (s *service) Reconcile(records []Record, from, to time.Time, operator string) (*Report, error) {
+	report := &Report{
+		From:    from,
+		To:      to,
+		Records: len(records),
+	}
+
+	seen := make(map[string]bool, len(records))
+	for _, record := range records {
+		seen[record.ChargeID] = true
+
+		p, err := s.repo.FindByChargeID(record.ChargeID)
+		if errors.Is(err, payment.ErrPaymentNotFound) {
+			report.Mismatches = append(report.Mismatches, Mismatch{
+				Type:          MismatchMissingLocally,
+				ChargeID:      record.ChargeID,
+				GatewayStatus: record.Status,
+				GatewayAmount: record.Amount,
+			})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		mismatches := compare(p, record)
+		if len(mismatches) == 0 {
+			report.Matched++
+			continue
+		}
+		for _, m := range mismatches {
+			if m.Type == MismatchStatus && operator != "" {
+				s.correct(&m, operator)
+			}
+			report.Mismatches = append(report.Mismatches, m)
+		}
+	}
+
+	payments, err := s.repo.FindCreated(from, to)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range payments {
+		// a blocked payment was never charged.
+		if p.OmiseCharge.ID == "" || seen[p.OmiseCharge.ID] {
+			continue
+		}
+		report.Mismatches = append(report.Mismatches, Mismatch{
+			Type:        MismatchMissingAtGateway,
+			ChargeID:    p.OmiseCharge.ID,
+			PaymentID:   p.ID,
+			LocalStatus: p.Status,
+			LocalAmount: p.Amount,
+		})
+	}
+
+	return report, nil
+}
+
+// ReconcileGateway reconciles the payments with the charges created in [from, to) listed from the payment gateway.
+func (s *service) ReconcileGateway(from, to time.Time, operator string) (*Report, error) {
+	charges, err := s.gateway.ListCharges(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]Record, len(charges))
+	for i, charge := range charges {
+		records[i] = Record{
+			ChargeID: charge.ID,
+			Status:   charge.Status,
+			Amount:   charge.Amount,
+		}
+	}
+	return s.Reconcile(records, from, to, operator)
+}
+
+// compare returns the mismatches between a payment and the record of its charge.
+func compare(p *payment.Payment, record Record) []Mismatch {
+	mismatch := func(t MismatchType) Mismatch {
+		return Mismatch{
+			Type:          t,
+			ChargeID:      record.ChargeID,
+			PaymentID:     p.ID,
+			LocalStatus:   p.Status,
+			GatewayStatus: record.Status,
+			LocalAmount:   p.Amount,
+			GatewayAmount: record.Amount,
+		}
+	}
+
+	var mismatches []Mismatch
+	if chargeStatus(p.Status) != chargeStatus(record.Status) {
+		mismatches = append(mismatches, mismatch(MismatchStatus))
+	}
+	if p.Amount != record.Amount {
+		mismatches = append(mismatches, mismatch(MismatchAmount))
+	}
+	return mismatches
+}
+
+// correct refreshes the payment of a status mismatch from its charge on behalf of the operator.
+func (s *service) correct(m *Mismatch, operator string) {
+	p, err := s.payments.CorrectStatus(m.PaymentID, correctionReason, operator)
+	if err != nil {
+		m.Error = err.Error()
+		return
+	}
+	m.Corrected = chargeStatus(p.Status) == chargeStatus(m.GatewayStatus)
+	if !m.Corrected {
+		m.Error = "payment status " + string(p.Status) + " does not match the charge after it was refreshed"
+	}
+}
+
+// chargeStatus returns the Omise charge status of a payment status,
+// the statuses of authorized charges are the statuses of charges which are not captured yet.
+func chargeStatus(status payment.Status) payment.Status {
+	switch status {
+	case payment.StatusAuthorized:
+		return payment.StatusPending
+	case payment.StatusCaptured:
+		return payment.StatusSuccessful
+	case payment.StatusVoided:
+		return payment.StatusReversed
+	default:
+		return status
+	}
+}
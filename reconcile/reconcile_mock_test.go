@@ -0,0 +1,46 @@
+package reconcile
+
+import (
+	"time"
+
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+type mockPaymentService struct {
+	CorrectStatusFn func(id int, reason, operator string) (*payment.Payment, error)
+}
+
+func (m *mockPaymentService) CorrectStatus(id int, reason, operator string) (*payment.Payment, error) {
+	return m.CorrectStatusFn(id, reason, operator)
+}
+
+type mockGateway struct {
+	ListChargesFn func(from, to time.Time) ([]*payment.OmiseCharge, error)
+}
+
+func (m *mockGateway) ListCharges(from, to time.Time) ([]*payment.OmiseCharge, error) {
+	return m.ListChargesFn(from, to)
+}
+
+type mockRepository struct {
+	Payments []*payment.Payment
+}
+
+func (m *mockRepository) FindByChargeID(chargeID string) (*payment.Payment, error) {
+	for _, p := range m.Payments {
+		if p.OmiseCharge.ID == chargeID {
+			return p, nil
+		}
+	}
+	return nil, payment.ErrPaymentNotFound
+}
+
+func (m *mockRepository) FindCreated(from, to time.Time) ([]*payment.Payment, error) {
+	var payments []*payment.Payment
+	for _, p := range m.Payments {
+		if !p.CreatedAt.Before(from) && p.CreatedAt.Before(to) {
+			payments = append(payments, p)
+		}
+	}
+	return payments, nil
+}
@@ -0,0 +1,148 @@
+package reconcile
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+var (
+	from = time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC)
+	to   = from.AddDate(0, 0, 1)
+)
+
+func thb(amount int64) payment.Money {
+	return payment.NewMoney(amount, "THB")
+}
+
+func newPayment(id int, chargeID string, status payment.Status, amount int64) *payment.Payment {
+	return &payment.Payment{
+		ID:          id,
+		Status:      status,
+		Amount:      thb(amount),
+		OmiseCharge: &payment.OmiseCharge{ID: chargeID, Status: status, Amount: thb(amount)},
+		CreatedAt:   from.Add(time.Duration(id) * time.Hour),
+	}
+}
+
+func TestService_Reconcile(t *testing.T) {
+	tests := []struct {
+		name       string
+		records    []Record
+		operator   string
+		refreshErr error
+		want       *Report
+	}{
+		{
+			name: "matched",
+			records: []Record{
+				{ChargeID: "chrg_1", Status: payment.StatusSuccessful, Amount: thb(2000)},
+				{ChargeID: "chrg_2", Status: payment.StatusPending, Amount: thb(3000)},
+				{ChargeID: "chrg_3", Status: payment.StatusSuccessful, Amount: thb(4000)},
+			},
+			want: &Report{From: from, To: to, Records: 3, Matched: 3},
+		},
+		{
+			name: "mismatches",
+			records: []Record{
+				{ChargeID: "chrg_1", Status: payment.StatusSuccessful, Amount: thb(2000)},
+				{ChargeID: "chrg_2", Status: payment.StatusReversed, Amount: thb(3500)},
+				{ChargeID: "chrg_9", Status: payment.StatusFailed, Amount: thb(100)},
+			},
+			want: &Report{From: from, To: to, Records: 3, Matched: 1, Mismatches: []Mismatch{
+				{Type: MismatchStatus, ChargeID: "chrg_2", PaymentID: 2, LocalStatus: payment.StatusAuthorized, GatewayStatus: payment.StatusReversed, LocalAmount: thb(3000), GatewayAmount: thb(3500)},
+				{Type: MismatchAmount, ChargeID: "chrg_2", PaymentID: 2, LocalStatus: payment.StatusAuthorized, GatewayStatus: payment.StatusReversed, LocalAmount: thb(3000), GatewayAmount: thb(3500)},
+				{Type: MismatchMissingLocally, ChargeID: "chrg_9", GatewayStatus: payment.StatusFailed, GatewayAmount: thb(100)},
+				{Type: MismatchMissingAtGateway, ChargeID: "chrg_3", PaymentID: 3, LocalStatus: payment.StatusCaptured, LocalAmount: thb(4000)},
+			}},
+		},
+		{
+			name: "corrected",
+			records: []Record{
+				{ChargeID: "chrg_1", Status: payment.StatusSuccessful, Amount: thb(2000)},
+				{ChargeID: "chrg_2", Status: payment.StatusReversed, Amount: thb(3000)},
+				{ChargeID: "chrg_3", Status: payment.StatusSuccessful, Amount: thb(4000)},
+			},
+			operator: "alice",
+			want: &Report{From: from, To: to, Records: 3, Matched: 2, Mismatches: []Mismatch{
+				{Type: MismatchStatus, ChargeID: "chrg_2", PaymentID: 2, LocalStatus: payment.StatusAuthorized, GatewayStatus: payment.StatusReversed, LocalAmount: thb(3000), GatewayAmount: thb(3000), Corrected: true},
+			}},
+		},
+		{
+			name: "correction failed",
+			records: []Record{
+				{ChargeID: "chrg_1", Status: payment.StatusSuccessful, Amount: thb(2000)},
+				{ChargeID: "chrg_2", Status: payment.StatusReversed, Amount: thb(3000)},
+				{ChargeID: "chrg_3", Status: payment.StatusSuccessful, Amount: thb(4000)},
+			},
+			operator:   "alice",
+			refreshErr: errors.New("timeout"),
+			want: &Report{From: from, To: to, Records: 3, Matched: 2, Mismatches: []Mismatch{
+				{Type: MismatchStatus, ChargeID: "chrg_2", PaymentID: 2, LocalStatus: payment.StatusAuthorized, GatewayStatus: payment.StatusReversed, LocalAmount: thb(3000), GatewayAmount: thb(3000), Error: "timeout"},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &mockRepository{Payments: []*payment.Payment{
+				newPayment(1, "chrg_1", payment.StatusSuccessful, 2000),
+				newPayment(2, "chrg_2", payment.StatusAuthorized, 3000),
+				newPayment(3, "chrg_3", payment.StatusCaptured, 4000),
+				// created after the range.
+				newPayment(30, "chrg_30", payment.StatusPending, 1000),
+			}}
+			payments := &mockPaymentService{}
+			payments.CorrectStatusFn = func(id int, reason, operator string) (*payment.Payment, error) {
+				if reason != correctionReason || operator != tt.operator {
+					t.Errorf("CorrectStatus() called with %q, %q", reason, operator)
+				}
+				if tt.refreshErr != nil {
+					return nil, tt.refreshErr
+				}
+				return newPayment(id, "chrg_2", payment.StatusVoided, 3000), nil
+			}
+
+			s := NewService(payments, nil, repo)
+			got, err := s.Reconcile(tt.records, from, to, tt.operator)
+			if err != nil {
+				t.Fatalf("Service.Reconcile() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Service.Reconcile() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_ReconcileGateway(t *testing.T) {
+	repo := &mockRepository{Payments: []*payment.Payment{newPayment(1, "chrg_1", payment.StatusPending, 2000)}}
+	gateway := &mockGateway{}
+	gateway.ListChargesFn = func(gotFrom, gotTo time.Time) ([]*payment.OmiseCharge, error) {
+		if !gotFrom.Equal(from) || !gotTo.Equal(to) {
+			t.Errorf("ListCharges() called with %v, %v", gotFrom, gotTo)
+		}
+		return []*payment.OmiseCharge{{ID: "chrg_1", Status: payment.StatusExpired, Amount: thb(2000)}}, nil
+	}
+
+	s := NewService(&mockPaymentService{}, gateway, repo)
+	got, err := s.ReconcileGateway(from, to, "")
+	if err != nil {
+		t.Fatalf("Service.ReconcileGateway() error = %v", err)
+	}
+	want := &Report{From: from, To: to, Records: 1, Mismatches: []Mismatch{
+		{Type: MismatchStatus, ChargeID: "chrg_1", PaymentID: 1, LocalStatus: payment.StatusPending, GatewayStatus: payment.StatusExpired, LocalAmount: thb(2000), GatewayAmount: thb(2000)},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Service.ReconcileGateway() = %+v, want %+v", got, want)
+	}
+
+	gateway.ListChargesFn = func(from, to time.Time) ([]*payment.OmiseCharge, error) {
+		return nil, payment.ErrGatewayUnavailable
+	}
+	if _, err := s.ReconcileGateway(from, to, ""); err != payment.ErrGatewayUnavailable {
+		t.Errorf("Service.ReconcileGateway() error = %v, want %v", err, payment.ErrGatewayUnavailable)
+	}
+}
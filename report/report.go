@@ -0,0 +1,197 @@
+// Package report reports aggregated figures of payments for dashboards.
+package report
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+// Service provides reporting service methods.
+type Service interface {
+	Sales(from, to time.Time, period Period, loc *time.Location) ([]Sales, error)
+}
+
+// Period is the length of the buckets of a report.
+type Period string
+
+// Periods
+const (
+	PeriodDay   Period = "day"
+	PeriodWeek  Period = "week"
+	PeriodMonth Period = "month"
+)
+
+// ErrInvalidPeriod is returned for a period which is not one of the periods.
+var ErrInvalidPeriod = errors.New("invalid report period")
+
+// Start returns the start of the bucket of t in the given location.
+// Weeks start on Monday.
+func (p Period) Start(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	year, month, day := t.Date()
+	switch p {
+	case PeriodWeek:
+		// days since Monday, Sunday is the last day of a week.
+		day -= (int(t.Weekday()) + 6) % 7
+	case PeriodMonth:
+		day = 1
+	}
+	return time.Date(year, month, day, 0, 0, 0, 0, loc)
+}
+
+func (p Period) valid() bool {
+	return p == PeriodDay || p == PeriodWeek || p == PeriodMonth
+}
+
+// Total represents the number of payments and the sum of their amounts.
+type Total struct {
+	Count  int
+	Amount payment.Money
+}
+
+// Sales represents the payments of a source type in a currency created in a bucket, by outcome.
+// Successful includes the captured payments and sums the amount captured.
+// Refunded counts and sums the refunds made in the bucket, whenever their payments were created.
+// Start is the start of the bucket.
+type Sales struct {
+	Start      time.Time
+	Currency   string
+	SourceType string
+	Successful Total
+	Failed     Total
+	Expired    Total
+	Refunded   Total
+}
+
+// Aggregate represents the payments with a status of a source type in a currency created in a bucket.
+// The amount is the sum of the amounts paid, see payment.Payment.PaidAmount.
+type Aggregate struct {
+	Start      time.Time
+	Currency   string
+	SourceType string
+	Status     payment.Status
+	Count      int
+	Amount     payment.Money
+}
+
+// RefundAggregate represents the refunds made in a bucket of the payments of a source type in a currency.
+// The amount is the sum of the amounts refunded.
+type RefundAggregate struct {
+	Start      time.Time
+	Currency   string
+	SourceType string
+	Count      int
+	Amount     payment.Money
+}
+
+// Repository provides access payments in a data source.
+// AggregatePayments aggregates the payments created in [from, to) by the bucket of the period they were created in,
+// their currency, source type and status, such as with a GROUP BY query.
+// AggregateRefunds aggregates the refunds made in [from, to) by the bucket of the period they were made in,
+// and the currency and source type of their payments.
+type Repository interface {
+	AggregatePayments(from, to time.Time, period Period, loc *time.Location) ([]Aggregate, error)
+	AggregateRefunds(from, to time.Time, period Period, loc *time.Location) ([]RefundAggregate, error)
+}
+
+type service struct {
+	repo Repository
+}
+
+// NewService returns a new reporting service.
+func NewService(repo Repository) Service {
+	return &service{
+		repo: repo,
+	}
+}
+
+// Sales returns the successful, failed and expired payments created in [from, to) by the bucket of the period
+// they were created in, currency and source type, sorted in the same order. The buckets are in the given location,
+// the first and last may be partial if the range does not start and end with them.
+// Payments with other statuses, such as pending ones, are not reported. The refunds made in [from, to) are reported
+// by the bucket they were made in, so that a refund of a payment made before the range is still reported.
+func (s *service) Sales(from, to time.Time, period Period, loc *time.Location) ([]Sales, error) {
+	if !period.valid() {
+		return nil, ErrInvalidPeriod
+	}
+
+	aggregates, err := s.repo.AggregatePayments(from, to, period, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	refunds, err := s.repo.AggregateRefunds(from, to, period, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	type key struct {
+		start      int64
+		currency   string
+		sourceType string
+	}
+	sales := make(map[key]*Sales)
+	bucket := func(start time.Time, currency, sourceType string) *Sales {
+		k := key{start.Unix(), currency, sourceType}
+		if s, ok := sales[k]; ok {
+			return s
+		}
+		zero := Total{Amount: payment.NewMoney(0, currency)}
+		return &Sales{
+			Start:      start,
+			Currency:   currency,
+			SourceType: sourceType,
+			Successful: zero,
+			Failed:     zero,
+			Expired:    zero,
+			Refunded:   zero,
+		}
+	}
+	for _, a := range aggregates {
+		sale := bucket(a.Start, a.Currency, a.SourceType)
+
+		var total *Total
+		switch a.Status {
+		case payment.StatusSuccessful, payment.StatusCaptured:
+			total = &sale.Successful
+		case payment.StatusFailed:
+			total = &sale.Failed
+		case payment.StatusExpired:
+			total = &sale.Expired
+		default:
+			continue
+		}
+		total.Count += a.Count
+		if total.Amount, err = total.Amount.Add(a.Amount); err != nil {
+			return nil, err
+		}
+		sales[key{a.Start.Unix(), a.Currency, a.SourceType}] = sale
+	}
+	for _, a := range refunds {
+		sale := bucket(a.Start, a.Currency, a.SourceType)
+		sale.Refunded.Count += a.Count
+		if sale.Refunded.Amount, err = sale.Refunded.Amount.Add(a.Amount); err != nil {
+			return nil, err
+		}
+		sales[key{a.Start.Unix(), a.Currency, a.SourceType}] = sale
+	}
+
+	res := make([]Sales, 0, len(sales))
+	for _, sale := range sales {
+		res = append(res, *sale)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		a, b := res[i], res[j]
+		if !a.Start.Equal(b.Start) {
+			return a.Start.Before(b.Start)
+		}
+		if a.Currency != b.Currency {
+			return a.Currency < b.Currency
+		}
+		return a.SourceType < b.SourceType
+	})
+	return res, nil
+}
@@ -0,0 +1,16 @@
+package report
+
+import "time"
+
+type mockRepository struct {
+	AggregatePaymentsFn func(from, to time.Time, period Period, loc *time.Location) ([]Aggregate, error)
+	AggregateRefundsFn  func(from, to time.Time, period Period, loc *time.Location) ([]RefundAggregate, error)
+}
+
+func (m *mockRepository) AggregatePayments(from, to time.Time, period Period, loc *time.Location) ([]Aggregate, error) {
+	return m.AggregatePaymentsFn(from, to, period, loc)
+}
+
+func (m *mockRepository) AggregateRefunds(from, to time.Time, period Period, loc *time.Location) ([]RefundAggregate, error) {
+	return m.AggregateRefundsFn(from, to, period, loc)
+}
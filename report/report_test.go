@@ -0,0 +1,92 @@
+package report
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+var bangkok = time.FixedZone("Asia/Bangkok", 7*60*60)
+
+func TestPeriod_Start(t *testing.T) {
+	// Sunday 31 January 2021 at 23:30 in Bangkok, which is still Sunday in UTC.
+	sunday := time.Date(2021, 1, 31, 16, 30, 0, 0, time.UTC)
+	// Monday 1 February 2021 at 01:00 in Bangkok, which is Sunday in UTC.
+	monday := time.Date(2021, 1, 31, 18, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		period Period
+		t      time.Time
+		want   time.Time
+	}{
+		{name: "day", period: PeriodDay, t: monday, want: time.Date(2021, 2, 1, 0, 0, 0, 0, bangkok)},
+		{name: "week from Sunday", period: PeriodWeek, t: sunday, want: time.Date(2021, 1, 25, 0, 0, 0, 0, bangkok)},
+		{name: "week from Monday", period: PeriodWeek, t: monday, want: time.Date(2021, 2, 1, 0, 0, 0, 0, bangkok)},
+		{name: "month", period: PeriodMonth, t: sunday, want: time.Date(2021, 1, 1, 0, 0, 0, 0, bangkok)},
+		{name: "next month", period: PeriodMonth, t: monday, want: time.Date(2021, 2, 1, 0, 0, 0, 0, bangkok)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.period.Start(tt.t, bangkok); !got.Equal(tt.want) {
+				t.Errorf("Period.Start() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_Sales(t *testing.T) {
+	thb := func(amount int64) payment.Money { return payment.NewMoney(amount, "THB") }
+	feb1 := time.Date(2021, 2, 1, 0, 0, 0, 0, bangkok)
+	feb2 := feb1.AddDate(0, 0, 1)
+	from, to := feb1, feb1.AddDate(0, 0, 7)
+
+	repo := &mockRepository{}
+	repo.AggregatePaymentsFn = func(gotFrom, gotTo time.Time, period Period, loc *time.Location) ([]Aggregate, error) {
+		if !gotFrom.Equal(from) || !gotTo.Equal(to) || period != PeriodDay || loc != bangkok {
+			t.Errorf("AggregatePayments() called with %v, %v, %v, %v", gotFrom, gotTo, period, loc)
+		}
+		return []Aggregate{
+			{Start: feb2, Currency: "THB", SourceType: "card", Status: payment.StatusSuccessful, Count: 1, Amount: thb(1000)},
+			{Start: feb1, Currency: "THB", SourceType: "card", Status: payment.StatusSuccessful, Count: 2, Amount: thb(3000)},
+			{Start: feb1, Currency: "THB", SourceType: "card", Status: payment.StatusCaptured, Count: 1, Amount: thb(500)},
+			{Start: feb1, Currency: "THB", SourceType: "card", Status: payment.StatusFailed, Count: 1, Amount: thb(700)},
+			{Start: feb1, Currency: "THB", SourceType: "promptpay", Status: payment.StatusExpired, Count: 3, Amount: thb(900)},
+			{Start: feb1, Currency: "THB", SourceType: "promptpay", Status: payment.StatusPending, Count: 1, Amount: thb(100)},
+			// only pending payments are not reported.
+			{Start: feb1, Currency: "THB", SourceType: "truemoney", Status: payment.StatusPending, Count: 1, Amount: thb(100)},
+		}, nil
+	}
+	repo.AggregateRefundsFn = func(gotFrom, gotTo time.Time, period Period, loc *time.Location) ([]RefundAggregate, error) {
+		if !gotFrom.Equal(from) || !gotTo.Equal(to) || period != PeriodDay || loc != bangkok {
+			t.Errorf("AggregateRefunds() called with %v, %v, %v, %v", gotFrom, gotTo, period, loc)
+		}
+		return []RefundAggregate{
+			{Start: feb2, Currency: "THB", SourceType: "card", Count: 2, Amount: thb(1500)},
+			// a refund of a payment created before the range.
+			{Start: feb2, Currency: "THB", SourceType: "promptpay", Count: 1, Amount: thb(300)},
+		}, nil
+	}
+
+	s := NewService(repo)
+	got, err := s.Sales(from, to, PeriodDay, bangkok)
+	if err != nil {
+		t.Fatalf("Service.Sales() error = %v", err)
+	}
+	zero := Total{Amount: thb(0)}
+	want := []Sales{
+		{Start: feb1, Currency: "THB", SourceType: "card", Successful: Total{3, thb(3500)}, Failed: Total{1, thb(700)}, Expired: zero, Refunded: zero},
+		{Start: feb1, Currency: "THB", SourceType: "promptpay", Successful: zero, Failed: zero, Expired: Total{3, thb(900)}, Refunded: zero},
+		{Start: feb2, Currency: "THB", SourceType: "card", Successful: Total{1, thb(1000)}, Failed: zero, Expired: zero, Refunded: Total{2, thb(1500)}},
+		{Start: feb2, Currency: "THB", SourceType: "promptpay", Successful: zero, Failed: zero, Expired: zero, Refunded: Total{1, thb(300)}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Service.Sales() = %+v, want %+v", got, want)
+	}
+
+	if _, err := s.Sales(from, to, Period("year"), bangkok); err != ErrInvalidPeriod {
+		t.Errorf("Service.Sales() error = %v, want %v", err, ErrInvalidPeriod)
+	}
+}
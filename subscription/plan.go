@@ -0,0 +1,97 @@
+package subscription
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+// Interval is the unit of a billing period.
+type Interval string
+
+// Intervals
+const (
+	IntervalDay   Interval = "day"
+	IntervalWeek  Interval = "week"
+	IntervalMonth Interval = "month"
+	IntervalYear  Interval = "year"
+)
+
+// MaxIntervalCount is the maximum number of intervals in a billing period.
+const MaxIntervalCount = 365
+
+// Plan represents a recurring price, a subscriber is charged the amount every IntervalCount intervals.
+type Plan struct {
+	ID            int
+	Name          string
+	Amount        payment.Money
+	Interval      Interval
+	IntervalCount int
+	CreatedAt     time.Time
+}
+
+// PlanRequest contains details for creating a plan.
+type PlanRequest struct {
+	Name          string
+	Amount        payment.Money
+	Interval      Interval
+	IntervalCount int
+}
+
+// due returns the due date of the nth billing period of a subscription started at start.
+// The periods are counted from the start so that short months do not shift the later due dates,
+// e.g. a monthly subscription started on 31 January is due on 28 February, then 31 March.
+func (p *Plan) due(start time.Time, n int) time.Time {
+	count := n * p.IntervalCount
+	switch p.Interval {
+	case IntervalDay:
+		return start.AddDate(0, 0, count)
+	case IntervalWeek:
+		return start.AddDate(0, 0, 7*count)
+	case IntervalYear:
+		return addMonths(start, 12*count)
+	default:
+		return addMonths(start, count)
+	}
+}
+
+// addMonths adds months to t, the day is clamped to the last day of the resulting month.
+func addMonths(t time.Time, months int) time.Time {
+	year, month, day := t.Date()
+	first := time.Date(year, month+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	if last := first.AddDate(0, 1, -1).Day(); day > last {
+		day = last
+	}
+	return first.AddDate(0, 0, day-1)
+}
+
+func validatePlanRequest(req *PlanRequest) error {
+	var errs []payment.FieldError
+	if req.Amount.Currency == "" {
+		errs = append(errs, payment.FieldError{Field: "currency", Code: payment.CodeRequired, Message: "currency is required"})
+	} else if !payment.SupportedCurrency(req.Amount.Currency) {
+		errs = append(errs, payment.FieldError{Field: "currency", Code: payment.CodeUnsupported, Message: fmt.Sprintf("currency %s is not supported", req.Amount.Currency)})
+	}
+	if req.Amount.Amount <= 0 {
+		errs = append(errs, payment.FieldError{Field: "amount", Code: payment.CodeInvalid, Message: "amount must be positive"})
+	}
+	switch req.Interval {
+	case IntervalDay, IntervalWeek, IntervalMonth, IntervalYear:
+	case "":
+		errs = append(errs, payment.FieldError{Field: "interval", Code: payment.CodeRequired, Message: "interval is required"})
+	default:
+		errs = append(errs, payment.FieldError{Field: "interval", Code: payment.CodeInvalid, Message: "interval must be one of day, week, month, year"})
+	}
+	if req.IntervalCount < 1 || req.IntervalCount > MaxIntervalCount {
+		errs = append(errs, payment.FieldError{Field: "interval_count", Code: payment.CodeOutOfRange, Message: fmt.Sprintf("interval_count must be between 1 and %d", MaxIntervalCount)})
+	}
+	if len(req.Name) > payment.MaxDescriptionLength {
+		errs = append(errs, payment.FieldError{Field: "name", Code: payment.CodeTooLong, Message: fmt.Sprintf("name must not exceed %d characters", payment.MaxDescriptionLength)})
+	}
+
+	if len(errs) > 0 {
+		return &payment.ValidationError{Errors: errs}
+	}
+	return nil
+}
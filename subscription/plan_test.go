@@ -0,0 +1,113 @@
+package subscription
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+func TestPlan_due(t *testing.T) {
+	start := time.Date(2021, 1, 31, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		plan *Plan
+		n    int
+		want time.Time
+	}{
+		{
+			name: "first period",
+			plan: &Plan{Interval: IntervalMonth, IntervalCount: 1},
+			n:    0,
+			want: start,
+		},
+		{
+			name: "month clamped to the last day",
+			plan: &Plan{Interval: IntervalMonth, IntervalCount: 1},
+			n:    1,
+			want: time.Date(2021, 2, 28, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "month after a short month",
+			plan: &Plan{Interval: IntervalMonth, IntervalCount: 1},
+			n:    2,
+			want: time.Date(2021, 3, 31, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "every 3 months",
+			plan: &Plan{Interval: IntervalMonth, IntervalCount: 3},
+			n:    1,
+			want: time.Date(2021, 4, 30, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "every 2 weeks",
+			plan: &Plan{Interval: IntervalWeek, IntervalCount: 2},
+			n:    2,
+			want: time.Date(2021, 2, 28, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "day",
+			plan: &Plan{Interval: IntervalDay, IntervalCount: 1},
+			n:    1,
+			want: time.Date(2021, 2, 1, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "year",
+			plan: &Plan{Interval: IntervalYear, IntervalCount: 1},
+			n:    1,
+			want: time.Date(2022, 1, 31, 9, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.plan.due(start, tt.n); !got.Equal(tt.want) {
+				t.Errorf("Plan.due() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_validatePlanRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     *PlanRequest
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			req:  &PlanRequest{Name: "Gold", Amount: payment.NewMoney(50000, "THB"), Interval: IntervalMonth, IntervalCount: 1},
+		},
+		{
+			name:    "unknown interval",
+			req:     &PlanRequest{Amount: payment.NewMoney(50000, "THB"), Interval: "fortnight", IntervalCount: 1},
+			wantErr: true,
+		},
+		{
+			name:    "currency not supported by the gateway",
+			req:     &PlanRequest{Amount: payment.NewMoney(50000, "VND"), Interval: IntervalMonth, IntervalCount: 1},
+			wantErr: true,
+		},
+		{
+			name:    "zero amount",
+			req:     &PlanRequest{Amount: payment.NewMoney(0, "THB"), Interval: IntervalMonth, IntervalCount: 1},
+			wantErr: true,
+		},
+		{
+			name:    "interval count out of range",
+			req:     &PlanRequest{Amount: payment.NewMoney(50000, "THB"), Interval: IntervalDay, IntervalCount: MaxIntervalCount + 1},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatePlanRequest(tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validatePlanRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, payment.ErrInvalidRequest) {
+				t.Errorf("validatePlanRequest() error = %v, want %v", err, payment.ErrInvalidRequest)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package subscription
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Scheduler charges due subscriptions periodically.
+type Scheduler struct {
+	service  Service
+	interval time.Duration
+}
+
+// NewScheduler returns a new scheduler which checks for due subscriptions every interval.
+func NewScheduler(service Service, interval time.Duration) *Scheduler {
+	return &Scheduler{
+		service:  service,
+		interval: interval,
+	}
+}
+
+// Run charges due subscriptions every interval until the context is done.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := s.service.ChargeDue(now); err != nil {
+				log.Println("charge due subscriptions:", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,515 @@
+package subscription
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+// Service provides subscription service methods.
+type Service interface {
+	CreatePlan(req *PlanRequest) (*Plan, error)
+	FindPlan(id int) (*Plan, error)
+	Create(req *Request) (*Subscription, error)
+	Find(id int) (*Subscription, error)
+	Pause(id int) (*Subscription, error)
+	Resume(id int) (*Subscription, error)
+	Cancel(id int) (*Subscription, error)
+	Charges(id int) ([]Charge, error)
+	ChargeDue(now time.Time) error
+}
+
+// Subscription represents a customer subscribed to a plan, the saved card of the customer is charged on each due date.
+// Period is the number of the next billing period to charge, counted from StartAt.
+// FailedAttempts is the number of failed charges of the period, it is reset when the period is paid.
+// PendingPaymentID is the payment of the period which is still pending, e.g. waiting for 3-D Secure,
+// the period is not charged again until it is no longer pending.
+// Version is increased on every update, a subscription is only updated if it was not updated since it was found.
+type Subscription struct {
+	ID               int
+	PlanID           int
+	CustomerID       int
+	CardID           string
+	Status           Status
+	StartAt          time.Time
+	Period           int
+	NextChargeAt     time.Time
+	FailedAttempts   int
+	PendingPaymentID int
+	CanceledAt       time.Time
+	Version          int
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+}
+
+// Status represents a subscription status.
+type Status string
+
+// Subscription statuses
+const (
+	StatusActive Status = "active"
+	// StatusPastDue is the status of a subscription whose charge failed and is retried.
+	StatusPastDue Status = "past_due"
+	// StatusUnpaid is the status of a subscription whose charge failed on every attempt,
+	// it is no longer charged until it is resumed.
+	StatusUnpaid   Status = "unpaid"
+	StatusPaused   Status = "paused"
+	StatusCanceled Status = "canceled"
+)
+
+// Charge represents an attempt to charge a billing period of a subscription.
+// PaymentID is zero if the payment could not be created. A charge whose outcome is unknown, e.g. because the gateway
+// was unavailable, is retried as the same attempt. The status of a pending charge is updated once
+// its payment is no longer pending.
+type Charge struct {
+	ID             int
+	SubscriptionID int
+	PaymentID      int
+	Period         int
+	Attempt        int
+	Amount         payment.Money
+	Status         payment.Status
+	FailureMessage string
+	DueAt          time.Time
+	CreatedAt      time.Time
+}
+
+// Request contains details for subscribing a customer to a plan.
+// StartAt is the due date of the first billing period, it defaults to now.
+type Request struct {
+	PlanID     int
+	CustomerID int
+	CardID     string
+	StartAt    time.Time
+}
+
+// Repository provides access plans, subscriptions and their charges in a data source.
+// Update fails with ErrConcurrentUpdate if the version of the subscription is not the stored one.
+type Repository interface {
+	CreatePlan(plan *Plan) error
+	FindPlan(id int) (*Plan, error)
+	Create(subscription *Subscription) error
+	Find(id int) (*Subscription, error)
+	Update(subscription *Subscription) error
+	FindDue(now time.Time) ([]*Subscription, error)
+	CreateCharge(charge *Charge) error
+	UpdateCharge(charge *Charge) error
+	FindCharges(subscriptionID int) ([]Charge, error)
+}
+
+// Payments charges subscriptions, it is implemented by payment.Service.
+type Payments interface {
+	CreatePaymentRequest(req *payment.Request) (*payment.Payment, error)
+	Find(id int) (*payment.Payment, error)
+	FindByReference(reference string) (*payment.Payment, error)
+}
+
+// Customers provides the saved cards of customers, it is implemented by payment.CustomerService.
+type Customers interface {
+	Cards(customerID int) ([]payment.SavedCard, error)
+}
+
+// Errors
+var (
+	ErrPlanNotFound         = &payment.Error{Code: payment.ErrorCodeNotFound, Message: "plan not found"}
+	ErrSubscriptionNotFound = &payment.Error{Code: payment.ErrorCodeNotFound, Message: "subscription not found"}
+	ErrCardNotFound         = &payment.Error{Code: payment.ErrorCodeNotFound, Message: "card not found"}
+	ErrConcurrentUpdate     = &payment.Error{Code: payment.ErrorCodeConflict, Message: "subscription was updated concurrently"}
+)
+
+// maxUpdateAttempts is the number of times a change is applied to a subscription which is updated concurrently.
+const maxUpdateAttempts = 3
+
+// Config contains the settings of the subscription service.
+// ReturnURI is the return URI of the charges, the payer is never redirected to it since nobody is present
+// when a subscription is charged, but card charges require one.
+// A failed charge is retried after RetryInterval until it has failed MaxAttempts times.
+type Config struct {
+	ReturnURI     string
+	MaxAttempts   int
+	RetryInterval time.Duration
+}
+
+type service struct {
+	payments  Payments
+	customers Customers
+	repo      Repository
+	config    Config
+	now       func() time.Time
+}
+
+// NewService returns a new subscription service which charges subscriptions through the payment service.
+func NewService(payments Payments, customers Customers, repo Repository, config Config) Service {
+	return &service{
+		payments:  payments,
+		customers: customers,
+		repo:      repo,
+		config:    config,
+		now:       time.Now,
+	}
+}
+
+// CreatePlan creates a plan.
+func (s *service) CreatePlan(req *PlanRequest) (*Plan, error) {
+	if err := validatePlanRequest(req); err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{
+		Name:          req.Name,
+		Amount:        req.Amount,
+		Interval:      req.Interval,
+		IntervalCount: req.IntervalCount,
+	}
+	if err := s.repo.CreatePlan(plan); err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+// FindPlan finds a plan with the given plan id.
+func (s *service) FindPlan(id int) (*Plan, error) {
+	return s.repo.FindPlan(id)
+}
+
+// Create subscribes the customer to the plan with a card saved to the customer.
+func (s *service) Create(req *Request) (*Subscription, error) {
+	if req.CardID == "" {
+		return nil, &payment.ValidationError{Errors: []payment.FieldError{
+			{Field: payment.FieldCardID, Code: payment.CodeRequired, Message: "card_id is required"},
+		}}
+	}
+
+	if _, err := s.repo.FindPlan(req.PlanID); err != nil {
+		return nil, err
+	}
+
+	cards, err := s.customers.Cards(req.CustomerID)
+	if err != nil {
+		return nil, err
+	}
+	if !hasCard(cards, req.CardID) {
+		return nil, ErrCardNotFound
+	}
+
+	now := s.now()
+	startAt := req.StartAt
+	if startAt.IsZero() || startAt.Before(now) {
+		startAt = now
+	}
+
+	subscription := &Subscription{
+		PlanID:       req.PlanID,
+		CustomerID:   req.CustomerID,
+		CardID:       req.CardID,
+		Status:       StatusActive,
+		StartAt:      startAt,
+		NextChargeAt: startAt,
+	}
+	if err := s.repo.Create(subscription); err != nil {
+		return nil, err
+	}
+
+	return subscription, nil
+}
+
+// Find finds a subscription with the given subscription id.
+func (s *service) Find(id int) (*Subscription, error) {
+	return s.repo.Find(id)
+}
+
+// Pause pauses an active or past due subscription, it is not charged until it is resumed.
+func (s *service) Pause(id int) (*Subscription, error) {
+	return s.transition(id, StatusPaused, func(sub *Subscription) bool {
+		return sub.Status == StatusActive || sub.Status == StatusPastDue
+	})
+}
+
+// Resume resumes a paused or unpaid subscription.
+// The periods which passed while it was paused are not charged, the current period is charged right away.
+func (s *service) Resume(id int) (*Subscription, error) {
+	return s.transition(id, StatusActive, func(sub *Subscription) bool {
+		return sub.Status == StatusPaused || sub.Status == StatusUnpaid
+	})
+}
+
+// Cancel cancels a subscription, it is never charged again.
+func (s *service) Cancel(id int) (*Subscription, error) {
+	return s.transition(id, StatusCanceled, func(sub *Subscription) bool {
+		return sub.Status != StatusCanceled
+	})
+}
+
+func (s *service) transition(id int, status Status, allowed func(sub *Subscription) bool) (*Subscription, error) {
+	sub, err := s.repo.Find(id)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := s.repo.FindPlan(sub.PlanID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	return s.update(sub, func(sub *Subscription) error {
+		if !allowed(sub) {
+			return &payment.Error{
+				Code:    payment.ErrorCodeConflict,
+				Message: fmt.Sprintf("%s subscription cannot be %s", sub.Status, status),
+			}
+		}
+
+		switch status {
+		case StatusActive:
+			for !plan.due(sub.StartAt, sub.Period+1).After(now) {
+				sub.Period++
+			}
+			sub.FailedAttempts = 0
+			sub.NextChargeAt = plan.due(sub.StartAt, sub.Period)
+			if sub.NextChargeAt.Before(now) {
+				sub.NextChargeAt = now
+			}
+		case StatusCanceled:
+			sub.CanceledAt = now
+		}
+		sub.Status = status
+		return nil
+	})
+}
+
+// update applies the change to the subscription and updates it. If the subscription was updated since it was found,
+// e.g. canceled while it was charged, the change is applied again to the subscription as it is now.
+func (s *service) update(sub *Subscription, change func(sub *Subscription) error) (*Subscription, error) {
+	for attempt := 1; ; attempt++ {
+		if err := change(sub); err != nil {
+			return nil, err
+		}
+
+		err := s.repo.Update(sub)
+		if err == nil {
+			return sub, nil
+		}
+		if err != ErrConcurrentUpdate || attempt == maxUpdateAttempts {
+			return nil, err
+		}
+
+		if sub, err = s.repo.Find(sub.ID); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Charges returns the charge history of a subscription.
+func (s *service) Charges(id int) ([]Charge, error) {
+	if _, err := s.repo.Find(id); err != nil {
+		return nil, err
+	}
+
+	return s.repo.FindCharges(id)
+}
+
+// ChargeDue charges every active or past due subscription which is due at the given time.
+// A failed charge does not stop the other subscriptions from being charged, it is recorded in the charge history.
+// Neither does a subscription which cannot be charged, e.g. because the repository failed, it is logged and
+// the returned error counts those subscriptions.
+func (s *service) ChargeDue(now time.Time) error {
+	subs, err := s.repo.FindDue(now)
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	for _, sub := range subs {
+		if err := s.charge(sub, now); err != nil {
+			log.Printf("charge subscription %d: %v", sub.ID, err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d due subscriptions were not charged", failed, len(subs))
+	}
+	return nil
+}
+
+// charge charges the current billing period of the subscription.
+// The payment reference identifies the period and the attempt, so a charge which was made but not recorded,
+// e.g. because the service stopped, is found instead of being charged twice.
+// Only a successful payment pays the period. A pending payment, e.g. waiting for 3-D Secure, may still be paid,
+// so it is kept on the subscription and refreshed instead of charging the period again.
+func (s *service) charge(sub *Subscription, now time.Time) error {
+	plan, err := s.repo.FindPlan(sub.PlanID)
+	if err != nil {
+		return err
+	}
+
+	if sub.PendingPaymentID != 0 {
+		if sub, err = s.refreshPending(sub, plan, now); err != nil || !sub.due(now) {
+			return err
+		}
+	}
+
+	attempt := sub.FailedAttempts + 1
+	reference := fmt.Sprintf("subscription-%d-%d-%d", sub.ID, sub.Period, attempt)
+
+	p, err := s.payments.CreatePaymentRequest(&payment.Request{
+		Amount:        plan.Amount,
+		ReturnURI:     s.config.ReturnURI,
+		SourceType:    payment.SourceTypeCard,
+		SourceDetails: payment.SourceDetails{CardID: sub.CardID},
+		CustomerID:    sub.CustomerID,
+		Capture:       true,
+		Reference:     reference,
+		Description:   plan.Name,
+		Metadata:      map[string]string{"subscription_id": strconv.Itoa(sub.ID)},
+	})
+	if errors.Is(err, payment.ErrDuplicateReference) {
+		p, err = s.payments.FindByReference(reference)
+	}
+
+	charge := &Charge{
+		SubscriptionID: sub.ID,
+		Period:         sub.Period,
+		Attempt:        attempt,
+		Amount:         plan.Amount,
+		DueAt:          plan.due(sub.StartAt, sub.Period),
+	}
+	var declined bool
+	switch {
+	case err != nil:
+		charge.Status = payment.StatusFailed
+		charge.FailureMessage = err.Error()
+		declined = errors.Is(err, payment.ErrGatewayDeclined) || errors.Is(err, payment.ErrRiskBlocked)
+	default:
+		charge.PaymentID = p.ID
+		charge.Status = p.Status
+		charge.FailureMessage = failureMessage(p)
+		declined = p.Status != payment.StatusSuccessful && p.Status != payment.StatusPending
+	}
+	if err := s.repo.CreateCharge(charge); err != nil {
+		return err
+	}
+
+	_, err = s.update(sub, s.settle(plan, charge, declined, now))
+	return err
+}
+
+// refreshPending refreshes the pending payment of the subscription and updates its charge once it is no longer
+// pending. The current period is still due if the payment was of a period which was skipped when the subscription
+// was resumed. A payment whose status cannot be refreshed is checked again later rather than risking a second charge.
+func (s *service) refreshPending(sub *Subscription, plan *Plan, now time.Time) (*Subscription, error) {
+	charge, err := s.pendingCharge(sub)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := s.payments.Find(sub.PendingPaymentID)
+	if err != nil || p.Status == payment.StatusPending {
+		return s.update(sub, func(sub *Subscription) error {
+			sub.NextChargeAt = now.Add(s.config.RetryInterval)
+			return nil
+		})
+	}
+
+	charge.Status = p.Status
+	charge.FailureMessage = failureMessage(p)
+	if err := s.repo.UpdateCharge(charge); err != nil {
+		return nil, err
+	}
+
+	return s.update(sub, s.settle(plan, charge, charge.Status != payment.StatusSuccessful, now))
+}
+
+// pendingCharge returns the charge of the pending payment of the subscription.
+func (s *service) pendingCharge(sub *Subscription) (*Charge, error) {
+	charges, err := s.repo.FindCharges(sub.ID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range charges {
+		if charges[i].PaymentID == sub.PendingPaymentID {
+			return &charges[i], nil
+		}
+	}
+	return nil, fmt.Errorf("charge of pending payment %d of subscription %d not found", sub.PendingPaymentID, sub.ID)
+}
+
+// settle returns the change of the subscription by the outcome of a charge.
+// A successful charge pays the period, a pending one is waited for and a declined one is a failed attempt.
+// Any other charge, e.g. when the gateway is unavailable, may have been made, so it is retried with the same
+// reference instead of counting as an attempt.
+// The subscription may have been paused or canceled while it was charged, it keeps its status then.
+// A charge of a period which was skipped when the subscription was resumed does not change the current period,
+// which is charged next.
+func (s *service) settle(plan *Plan, charge *Charge, declined bool, now time.Time) func(sub *Subscription) error {
+	return func(sub *Subscription) error {
+		if charge.Status == payment.StatusPending {
+			sub.PendingPaymentID = charge.PaymentID
+			sub.NextChargeAt = now.Add(s.config.RetryInterval)
+			return nil
+		}
+
+		sub.PendingPaymentID = 0
+		if charge.Period != sub.Period {
+			return nil
+		}
+
+		charged := sub.Status == StatusActive || sub.Status == StatusPastDue
+		switch {
+		case charge.Status == payment.StatusSuccessful:
+			sub.Period++
+			sub.FailedAttempts = 0
+			sub.NextChargeAt = plan.due(sub.StartAt, sub.Period)
+			if charged {
+				sub.Status = StatusActive
+			}
+		case declined:
+			sub.FailedAttempts++
+			sub.NextChargeAt = now.Add(s.config.RetryInterval)
+			if charged {
+				sub.Status = StatusPastDue
+				if sub.FailedAttempts >= s.config.MaxAttempts {
+					sub.Status = StatusUnpaid
+				}
+			}
+		default:
+			sub.NextChargeAt = now.Add(s.config.RetryInterval)
+			if charged {
+				sub.Status = StatusPastDue
+			}
+		}
+		return nil
+	}
+}
+
+// due reports whether the subscription is to be charged at the given time.
+func (sub *Subscription) due(now time.Time) bool {
+	return (sub.Status == StatusActive || sub.Status == StatusPastDue) &&
+		sub.PendingPaymentID == 0 && !sub.NextChargeAt.After(now)
+}
+
+// failureMessage returns the reason a payment did not pay a period, it is empty for a successful or pending payment.
+func failureMessage(p *payment.Payment) string {
+	if p.Status == payment.StatusSuccessful || p.Status == payment.StatusPending {
+		return ""
+	}
+	if p.OmiseCharge.FailureMessage != "" {
+		return p.OmiseCharge.FailureMessage
+	}
+	return fmt.Sprintf("payment is %s", p.Status)
+}
+
+func hasCard(cards []payment.SavedCard, id string) bool {
+	for _, c := range cards {
+		if c.ID == id {
+			return true
+		}
+	}
+	return false
+}
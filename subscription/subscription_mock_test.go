@@ -0,0 +1,81 @@
+package subscription
+
+import (
+	"time"
+
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+type mockPaymentService struct {
+	CreatePaymentRequestFn func(req *payment.Request) (*payment.Payment, error)
+	FindFn                 func(id int) (*payment.Payment, error)
+	FindByReferenceFn      func(reference string) (*payment.Payment, error)
+}
+
+func (m *mockPaymentService) CreatePaymentRequest(req *payment.Request) (*payment.Payment, error) {
+	return m.CreatePaymentRequestFn(req)
+}
+
+func (m *mockPaymentService) Find(id int) (*payment.Payment, error) {
+	return m.FindFn(id)
+}
+
+func (m *mockPaymentService) FindByReference(reference string) (*payment.Payment, error) {
+	return m.FindByReferenceFn(reference)
+}
+
+type mockCustomerService struct {
+	CardsFn func(customerID int) ([]payment.SavedCard, error)
+}
+
+func (m *mockCustomerService) Cards(customerID int) ([]payment.SavedCard, error) {
+	return m.CardsFn(customerID)
+}
+
+type mockRepository struct {
+	CreatePlanFn   func(plan *Plan) error
+	FindPlanFn     func(id int) (*Plan, error)
+	CreateFn       func(subscription *Subscription) error
+	FindFn         func(id int) (*Subscription, error)
+	UpdateFn       func(subscription *Subscription) error
+	FindDueFn      func(now time.Time) ([]*Subscription, error)
+	CreateChargeFn func(charge *Charge) error
+	UpdateChargeFn func(charge *Charge) error
+	FindChargesFn  func(subscriptionID int) ([]Charge, error)
+}
+
+func (m *mockRepository) CreatePlan(plan *Plan) error {
+	return m.CreatePlanFn(plan)
+}
+
+func (m *mockRepository) FindPlan(id int) (*Plan, error) {
+	return m.FindPlanFn(id)
+}
+
+func (m *mockRepository) Create(subscription *Subscription) error {
+	return m.CreateFn(subscription)
+}
+
+func (m *mockRepository) Find(id int) (*Subscription, error) {
+	return m.FindFn(id)
+}
+
+func (m *mockRepository) Update(subscription *Subscription) error {
+	return m.UpdateFn(subscription)
+}
+
+func (m *mockRepository) FindDue(now time.Time) ([]*Subscription, error) {
+	return m.FindDueFn(now)
+}
+
+func (m *mockRepository) CreateCharge(charge *Charge) error {
+	return m.CreateChargeFn(charge)
+}
+
+func (m *mockRepository) UpdateCharge(charge *Charge) error {
+	return m.UpdateChargeFn(charge)
+}
+
+func (m *mockRepository) FindCharges(subscriptionID int) ([]Charge, error) {
+	return m.FindChargesFn(subscriptionID)
+}
@@ -0,0 +1,536 @@
+package subscription
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+var (
+	now        = time.Date(2021, 1, 31, 9, 0, 0, 0, time.UTC)
+	monthly    = &Plan{ID: 1, Name: "Gold", Amount: payment.NewMoney(50000, "THB"), Interval: IntervalMonth, IntervalCount: 1}
+	testConfig = Config{ReturnURI: "https://example.com/return", MaxAttempts: 3, RetryInterval: 24 * time.Hour}
+)
+
+func newTestService(payments Payments, customers Customers, repo Repository) *service {
+	s := NewService(payments, customers, repo, testConfig).(*service)
+	s.now = func() time.Time { return now }
+	return s
+}
+
+func findPlan(id int) (*Plan, error) {
+	if id != monthly.ID {
+		return nil, ErrPlanNotFound
+	}
+	return monthly, nil
+}
+
+func TestService_Create(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     *Request
+		want    *Subscription
+		wantErr error
+	}{
+		{
+			name: "success",
+			req:  &Request{PlanID: 1, CustomerID: 1, CardID: "card_test_1"},
+			want: &Subscription{
+				ID:           1,
+				PlanID:       1,
+				CustomerID:   1,
+				CardID:       "card_test_1",
+				Status:       StatusActive,
+				StartAt:      now,
+				NextChargeAt: now,
+			},
+		},
+		{
+			name: "start later",
+			req:  &Request{PlanID: 1, CustomerID: 1, CardID: "card_test_1", StartAt: now.Add(48 * time.Hour)},
+			want: &Subscription{
+				ID:           1,
+				PlanID:       1,
+				CustomerID:   1,
+				CardID:       "card_test_1",
+				Status:       StatusActive,
+				StartAt:      now.Add(48 * time.Hour),
+				NextChargeAt: now.Add(48 * time.Hour),
+			},
+		},
+		{
+			name:    "missing card",
+			req:     &Request{PlanID: 1, CustomerID: 1},
+			wantErr: payment.ErrInvalidRequest,
+		},
+		{
+			name:    "plan not found",
+			req:     &Request{PlanID: 2, CustomerID: 1, CardID: "card_test_1"},
+			wantErr: ErrPlanNotFound,
+		},
+		{
+			name:    "card not saved to the customer",
+			req:     &Request{PlanID: 1, CustomerID: 1, CardID: "card_test_2"},
+			wantErr: ErrCardNotFound,
+		},
+		{
+			name:    "customer not found",
+			req:     &Request{PlanID: 1, CustomerID: 2, CardID: "card_test_1"},
+			wantErr: payment.ErrCustomerNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			customers := &mockCustomerService{}
+			repo := &mockRepository{}
+
+			customers.CardsFn = func(customerID int) ([]payment.SavedCard, error) {
+				if customerID != 1 {
+					return nil, payment.ErrCustomerNotFound
+				}
+				return []payment.SavedCard{{ID: "card_test_1"}}, nil
+			}
+			repo.FindPlanFn = findPlan
+			repo.CreateFn = func(subscription *Subscription) error {
+				subscription.ID = 1
+				return nil
+			}
+
+			s := newTestService(&mockPaymentService{}, customers, repo)
+			got, err := s.Create(tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Service.Create() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Service.Create() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_transitions(t *testing.T) {
+	tests := []struct {
+		name         string
+		subscription Subscription
+		fn           func(s Service, id int) (*Subscription, error)
+		want         Subscription
+		wantErr      error
+	}{
+		{
+			name:         "pause",
+			subscription: Subscription{ID: 1, PlanID: 1, Status: StatusActive},
+			fn:           Service.Pause,
+			want:         Subscription{ID: 1, PlanID: 1, Status: StatusPaused},
+		},
+		{
+			name:         "pause canceled",
+			subscription: Subscription{ID: 1, PlanID: 1, Status: StatusCanceled},
+			fn:           Service.Pause,
+			wantErr:      payment.ErrConflict,
+		},
+		{
+			name: "resume skips the periods passed while paused",
+			subscription: Subscription{
+				ID:           1,
+				PlanID:       1,
+				Status:       StatusPaused,
+				StartAt:      now.AddDate(0, -3, 0),
+				Period:       1,
+				NextChargeAt: now.AddDate(0, -2, 0),
+			},
+			fn: Service.Resume,
+			want: Subscription{
+				ID:           1,
+				PlanID:       1,
+				Status:       StatusActive,
+				StartAt:      now.AddDate(0, -3, 0),
+				Period:       3,
+				NextChargeAt: now,
+			},
+		},
+		{
+			name: "resume unpaid",
+			subscription: Subscription{
+				ID:             1,
+				PlanID:         1,
+				Status:         StatusUnpaid,
+				StartAt:        now.Add(-time.Hour),
+				FailedAttempts: 3,
+				NextChargeAt:   now.Add(time.Hour),
+			},
+			fn: Service.Resume,
+			want: Subscription{
+				ID:           1,
+				PlanID:       1,
+				Status:       StatusActive,
+				StartAt:      now.Add(-time.Hour),
+				NextChargeAt: now,
+			},
+		},
+		{
+			name:         "resume active",
+			subscription: Subscription{ID: 1, PlanID: 1, Status: StatusActive},
+			fn:           Service.Resume,
+			wantErr:      payment.ErrConflict,
+		},
+		{
+			name:         "cancel",
+			subscription: Subscription{ID: 1, PlanID: 1, Status: StatusPastDue},
+			fn:           Service.Cancel,
+			want:         Subscription{ID: 1, PlanID: 1, Status: StatusCanceled, CanceledAt: now},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &mockRepository{}
+
+			sub := tt.subscription
+			repo.FindFn = func(id int) (*Subscription, error) {
+				return &sub, nil
+			}
+			repo.FindPlanFn = findPlan
+			repo.UpdateFn = func(subscription *Subscription) error {
+				return nil
+			}
+
+			s := newTestService(&mockPaymentService{}, &mockCustomerService{}, repo)
+			got, err := tt.fn(s, 1)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Service transition error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("Service transition = %v, want %v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_ChargeDue(t *testing.T) {
+	type result struct {
+		payment *payment.Payment
+		err     error
+	}
+	successful := result{payment: &payment.Payment{ID: 10, Status: payment.StatusSuccessful}}
+	declined := result{payment: &payment.Payment{ID: 10, Status: payment.StatusFailed, OmiseCharge: &payment.OmiseCharge{FailureMessage: "insufficient funds"}}}
+
+	tests := []struct {
+		name          string
+		subscription  Subscription
+		result        result
+		referenceUsed bool
+		want          Subscription
+		wantCharge    Charge
+	}{
+		{
+			name:         "successful",
+			subscription: Subscription{ID: 1, PlanID: 1, Status: StatusActive, StartAt: now, NextChargeAt: now},
+			result:       successful,
+			want:         Subscription{ID: 1, PlanID: 1, Status: StatusActive, StartAt: now, Period: 1, NextChargeAt: time.Date(2021, 2, 28, 9, 0, 0, 0, time.UTC)},
+			wantCharge:   Charge{SubscriptionID: 1, PaymentID: 10, Period: 0, Attempt: 1, Amount: monthly.Amount, Status: payment.StatusSuccessful, DueAt: now},
+		},
+		{
+			name:         "declined is retried",
+			subscription: Subscription{ID: 1, PlanID: 1, Status: StatusActive, StartAt: now, NextChargeAt: now},
+			result:       declined,
+			want:         Subscription{ID: 1, PlanID: 1, Status: StatusPastDue, StartAt: now, FailedAttempts: 1, NextChargeAt: now.Add(24 * time.Hour)},
+			wantCharge:   Charge{SubscriptionID: 1, PaymentID: 10, Period: 0, Attempt: 1, Amount: monthly.Amount, Status: payment.StatusFailed, FailureMessage: "insufficient funds", DueAt: now},
+		},
+		{
+			name:         "last attempt declined",
+			subscription: Subscription{ID: 1, PlanID: 1, Status: StatusPastDue, StartAt: now, FailedAttempts: 2, NextChargeAt: now},
+			result:       declined,
+			want:         Subscription{ID: 1, PlanID: 1, Status: StatusUnpaid, StartAt: now, FailedAttempts: 3, NextChargeAt: now.Add(24 * time.Hour)},
+			wantCharge:   Charge{SubscriptionID: 1, PaymentID: 10, Period: 0, Attempt: 3, Amount: monthly.Amount, Status: payment.StatusFailed, FailureMessage: "insufficient funds", DueAt: now},
+		},
+		{
+			name:         "gateway error is retried as the same attempt",
+			subscription: Subscription{ID: 1, PlanID: 1, Status: StatusPastDue, StartAt: now, FailedAttempts: 1, NextChargeAt: now},
+			result:       result{err: payment.ErrGatewayUnavailable},
+			want:         Subscription{ID: 1, PlanID: 1, Status: StatusPastDue, StartAt: now, FailedAttempts: 1, NextChargeAt: now.Add(24 * time.Hour)},
+			wantCharge:   Charge{SubscriptionID: 1, Period: 0, Attempt: 2, Amount: monthly.Amount, Status: payment.StatusFailed, FailureMessage: "gateway_unavailable", DueAt: now},
+		},
+		{
+			name:         "declined by the gateway",
+			subscription: Subscription{ID: 1, PlanID: 1, Status: StatusActive, StartAt: now, NextChargeAt: now},
+			result:       result{err: &payment.Error{Code: payment.ErrorCodeGatewayDeclined, Message: "card is stolen"}},
+			want:         Subscription{ID: 1, PlanID: 1, Status: StatusPastDue, StartAt: now, FailedAttempts: 1, NextChargeAt: now.Add(24 * time.Hour)},
+			wantCharge:   Charge{SubscriptionID: 1, Period: 0, Attempt: 1, Amount: monthly.Amount, Status: payment.StatusFailed, FailureMessage: "card is stolen", DueAt: now},
+		},
+		{
+			name:         "pending is waited for",
+			subscription: Subscription{ID: 1, PlanID: 1, Status: StatusActive, StartAt: now, NextChargeAt: now},
+			result:       result{payment: &payment.Payment{ID: 10, Status: payment.StatusPending}},
+			want:         Subscription{ID: 1, PlanID: 1, Status: StatusActive, StartAt: now, PendingPaymentID: 10, NextChargeAt: now.Add(24 * time.Hour)},
+			wantCharge:   Charge{SubscriptionID: 1, PaymentID: 10, Period: 0, Attempt: 1, Amount: monthly.Amount, Status: payment.StatusPending, DueAt: now},
+		},
+		{
+			name:          "already charged",
+			subscription:  Subscription{ID: 1, PlanID: 1, Status: StatusActive, StartAt: now, NextChargeAt: now},
+			result:        result{err: payment.ErrDuplicateReference},
+			referenceUsed: true,
+			want:          Subscription{ID: 1, PlanID: 1, Status: StatusActive, StartAt: now, Period: 1, NextChargeAt: time.Date(2021, 2, 28, 9, 0, 0, 0, time.UTC)},
+			wantCharge:    Charge{SubscriptionID: 1, PaymentID: 10, Period: 0, Attempt: 1, Amount: monthly.Amount, Status: payment.StatusSuccessful, DueAt: now},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payments := &mockPaymentService{}
+			repo := &mockRepository{}
+
+			sub := tt.subscription
+			repo.FindDueFn = func(now time.Time) ([]*Subscription, error) {
+				return []*Subscription{&sub}, nil
+			}
+			repo.FindPlanFn = findPlan
+			var charges []Charge
+			repo.CreateChargeFn = func(charge *Charge) error {
+				charges = append(charges, *charge)
+				return nil
+			}
+			repo.UpdateFn = func(subscription *Subscription) error {
+				return nil
+			}
+
+			var reference string
+			payments.CreatePaymentRequestFn = func(req *payment.Request) (*payment.Payment, error) {
+				reference = req.Reference
+				if req.CustomerID != sub.CustomerID || req.CardID != sub.CardID || req.Amount != monthly.Amount {
+					t.Errorf("CreatePaymentRequest() called with %v", req)
+				}
+				return tt.result.payment, tt.result.err
+			}
+			payments.FindByReferenceFn = func(ref string) (*payment.Payment, error) {
+				if !tt.referenceUsed || ref != reference {
+					t.Errorf("FindByReference() called with %v", ref)
+				}
+				return successful.payment, nil
+			}
+
+			s := newTestService(payments, &mockCustomerService{}, repo)
+			if err := s.ChargeDue(now); err != nil {
+				t.Fatalf("Service.ChargeDue() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(sub, tt.want) {
+				t.Errorf("Service.ChargeDue() subscription = %v, want %v", sub, tt.want)
+			}
+			if want := []Charge{tt.wantCharge}; !reflect.DeepEqual(charges, want) {
+				t.Errorf("Service.ChargeDue() charges = %v, want %v", charges, want)
+			}
+		})
+	}
+}
+
+func TestService_ChargeDue_pending(t *testing.T) {
+	pending := &payment.Payment{ID: 10, Status: payment.StatusPending}
+	successful := &payment.Payment{ID: 10, Status: payment.StatusSuccessful}
+	declined := &payment.Payment{ID: 10, Status: payment.StatusFailed, OmiseCharge: &payment.OmiseCharge{FailureMessage: "authentication failed"}}
+	pendingCharge := Charge{ID: 5, SubscriptionID: 1, PaymentID: 10, Period: 0, Attempt: 1, Amount: monthly.Amount, Status: payment.StatusPending, DueAt: now}
+	nextMonth := time.Date(2021, 2, 28, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		subscription Subscription
+		found        *payment.Payment
+		findErr      error
+		want         Subscription
+		wantUpdated  []Charge
+		wantCreated  []Charge
+	}{
+		{
+			name:         "still pending",
+			subscription: Subscription{ID: 1, PlanID: 1, Status: StatusActive, StartAt: now, PendingPaymentID: 10, NextChargeAt: now},
+			found:        pending,
+			want:         Subscription{ID: 1, PlanID: 1, Status: StatusActive, StartAt: now, PendingPaymentID: 10, NextChargeAt: now.Add(24 * time.Hour)},
+		},
+		{
+			name:         "not refreshed",
+			subscription: Subscription{ID: 1, PlanID: 1, Status: StatusActive, StartAt: now, PendingPaymentID: 10, NextChargeAt: now},
+			findErr:      payment.ErrGatewayUnavailable,
+			want:         Subscription{ID: 1, PlanID: 1, Status: StatusActive, StartAt: now, PendingPaymentID: 10, NextChargeAt: now.Add(24 * time.Hour)},
+		},
+		{
+			name:         "paid",
+			subscription: Subscription{ID: 1, PlanID: 1, Status: StatusActive, StartAt: now, PendingPaymentID: 10, NextChargeAt: now},
+			found:        successful,
+			want:         Subscription{ID: 1, PlanID: 1, Status: StatusActive, StartAt: now, Period: 1, NextChargeAt: nextMonth},
+			wantUpdated:  []Charge{{ID: 5, SubscriptionID: 1, PaymentID: 10, Period: 0, Attempt: 1, Amount: monthly.Amount, Status: payment.StatusSuccessful, DueAt: now}},
+		},
+		{
+			name:         "failed is retried",
+			subscription: Subscription{ID: 1, PlanID: 1, Status: StatusActive, StartAt: now, PendingPaymentID: 10, NextChargeAt: now},
+			found:        declined,
+			want:         Subscription{ID: 1, PlanID: 1, Status: StatusPastDue, StartAt: now, FailedAttempts: 1, NextChargeAt: now.Add(24 * time.Hour)},
+			wantUpdated:  []Charge{{ID: 5, SubscriptionID: 1, PaymentID: 10, Period: 0, Attempt: 1, Amount: monthly.Amount, Status: payment.StatusFailed, FailureMessage: "authentication failed", DueAt: now}},
+		},
+		{
+			name:         "period skipped by a resume",
+			subscription: Subscription{ID: 1, PlanID: 1, Status: StatusActive, StartAt: now.AddDate(0, -1, 0), Period: 1, PendingPaymentID: 10, NextChargeAt: now},
+			found:        declined,
+			want:         Subscription{ID: 1, PlanID: 1, Status: StatusActive, StartAt: now.AddDate(0, -1, 0), Period: 2, NextChargeAt: nextMonth},
+			wantUpdated:  []Charge{{ID: 5, SubscriptionID: 1, PaymentID: 10, Period: 0, Attempt: 1, Amount: monthly.Amount, Status: payment.StatusFailed, FailureMessage: "authentication failed", DueAt: now}},
+			wantCreated:  []Charge{{SubscriptionID: 1, PaymentID: 11, Period: 1, Attempt: 1, Amount: monthly.Amount, Status: payment.StatusSuccessful, DueAt: now}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payments := &mockPaymentService{}
+			repo := &mockRepository{}
+
+			sub := tt.subscription
+			repo.FindDueFn = func(now time.Time) ([]*Subscription, error) {
+				return []*Subscription{&sub}, nil
+			}
+			repo.FindPlanFn = findPlan
+			repo.FindChargesFn = func(subscriptionID int) ([]Charge, error) {
+				return []Charge{pendingCharge}, nil
+			}
+			var updated, created []Charge
+			repo.UpdateChargeFn = func(charge *Charge) error {
+				updated = append(updated, *charge)
+				return nil
+			}
+			repo.CreateChargeFn = func(charge *Charge) error {
+				created = append(created, *charge)
+				return nil
+			}
+			repo.UpdateFn = func(subscription *Subscription) error {
+				return nil
+			}
+
+			payments.FindFn = func(id int) (*payment.Payment, error) {
+				if id != 10 {
+					t.Errorf("Find() called with %v", id)
+				}
+				return tt.found, tt.findErr
+			}
+			payments.CreatePaymentRequestFn = func(req *payment.Request) (*payment.Payment, error) {
+				if tt.wantCreated == nil {
+					t.Errorf("CreatePaymentRequest() called with %v", req)
+				}
+				return &payment.Payment{ID: 11, Status: payment.StatusSuccessful}, nil
+			}
+
+			s := newTestService(payments, &mockCustomerService{}, repo)
+			if err := s.ChargeDue(now); err != nil {
+				t.Fatalf("Service.ChargeDue() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(sub, tt.want) {
+				t.Errorf("Service.ChargeDue() subscription = %v, want %v", sub, tt.want)
+			}
+			if !reflect.DeepEqual(updated, tt.wantUpdated) {
+				t.Errorf("Service.ChargeDue() updated charges = %v, want %v", updated, tt.wantUpdated)
+			}
+			if !reflect.DeepEqual(created, tt.wantCreated) {
+				t.Errorf("Service.ChargeDue() created charges = %v, want %v", created, tt.wantCreated)
+			}
+		})
+	}
+}
+
+func TestService_ChargeDue_updatedWhileCharged(t *testing.T) {
+	canceledAt := now
+	tests := []struct {
+		name   string
+		found  *payment.Payment
+		update func(s Service, id int) (*Subscription, error)
+		want   Subscription
+	}{
+		{
+			name:   "canceled during a pending charge",
+			found:  &payment.Payment{ID: 10, Status: payment.StatusPending},
+			update: Service.Cancel,
+			want:   Subscription{ID: 1, PlanID: 1, Status: StatusCanceled, StartAt: now, PendingPaymentID: 10, NextChargeAt: now.Add(24 * time.Hour), CanceledAt: canceledAt, Version: 3},
+		},
+		{
+			name:   "paused during a successful charge",
+			found:  &payment.Payment{ID: 10, Status: payment.StatusSuccessful},
+			update: Service.Pause,
+			want:   Subscription{ID: 1, PlanID: 1, Status: StatusPaused, StartAt: now, Period: 1, NextChargeAt: time.Date(2021, 2, 28, 9, 0, 0, 0, time.UTC), Version: 3},
+		},
+		{
+			name:   "canceled during a failed charge",
+			found:  &payment.Payment{ID: 10, Status: payment.StatusFailed, OmiseCharge: &payment.OmiseCharge{FailureMessage: "insufficient funds"}},
+			update: Service.Cancel,
+			want:   Subscription{ID: 1, PlanID: 1, Status: StatusCanceled, StartAt: now, FailedAttempts: 1, NextChargeAt: now.Add(24 * time.Hour), CanceledAt: canceledAt, Version: 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payments := &mockPaymentService{}
+			repo := &mockRepository{}
+
+			stored := Subscription{ID: 1, PlanID: 1, Status: StatusActive, StartAt: now, NextChargeAt: now, Version: 1}
+			repo.FindDueFn = func(now time.Time) ([]*Subscription, error) {
+				found := stored
+				return []*Subscription{&found}, nil
+			}
+			repo.FindFn = func(id int) (*Subscription, error) {
+				found := stored
+				return &found, nil
+			}
+			repo.UpdateFn = func(subscription *Subscription) error {
+				if subscription.Version != stored.Version {
+					return ErrConcurrentUpdate
+				}
+				subscription.Version++
+				stored = *subscription
+				return nil
+			}
+			repo.FindPlanFn = findPlan
+			repo.CreateChargeFn = func(charge *Charge) error {
+				return nil
+			}
+
+			s := newTestService(payments, &mockCustomerService{}, repo)
+			payments.CreatePaymentRequestFn = func(req *payment.Request) (*payment.Payment, error) {
+				if _, err := tt.update(s, 1); err != nil {
+					t.Fatalf("updating the subscription while it is charged: %v", err)
+				}
+				return tt.found, nil
+			}
+
+			if err := s.ChargeDue(now); err != nil {
+				t.Fatalf("Service.ChargeDue() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(stored, tt.want) {
+				t.Errorf("Service.ChargeDue() subscription = %v, want %v", stored, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_ChargeDue_continuesAfterError(t *testing.T) {
+	payments := &mockPaymentService{}
+	repo := &mockRepository{}
+
+	missingPlan := Subscription{ID: 1, PlanID: 2, Status: StatusActive, StartAt: now, NextChargeAt: now}
+	sub := Subscription{ID: 2, PlanID: 1, Status: StatusActive, StartAt: now, NextChargeAt: now}
+	repo.FindDueFn = func(now time.Time) ([]*Subscription, error) {
+		return []*Subscription{&missingPlan, &sub}, nil
+	}
+	repo.FindPlanFn = findPlan
+	repo.CreateChargeFn = func(charge *Charge) error {
+		return nil
+	}
+	repo.UpdateFn = func(subscription *Subscription) error {
+		return nil
+	}
+	payments.CreatePaymentRequestFn = func(req *payment.Request) (*payment.Payment, error) {
+		return &payment.Payment{ID: 10, Status: payment.StatusSuccessful}, nil
+	}
+
+	s := newTestService(payments, &mockCustomerService{}, repo)
+	if err := s.ChargeDue(now); err == nil {
+		t.Errorf("Service.ChargeDue() error = nil, want an error for subscription %d", missingPlan.ID)
+	}
+
+	if sub.Period != 1 {
+		t.Errorf("Service.ChargeDue() subscription = %v, want it charged", sub)
+	}
+}
@@ -0,0 +1,38 @@
+package webhook
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Dispatcher sends due deliveries periodically.
+type Dispatcher struct {
+	service  Service
+	interval time.Duration
+}
+
+// NewDispatcher returns a new dispatcher which checks for due deliveries every interval.
+func NewDispatcher(service Service, interval time.Duration) *Dispatcher {
+	return &Dispatcher{
+		service:  service,
+		interval: interval,
+	}
+}
+
+// Run sends due deliveries every interval until the context is done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := d.service.DeliverDue(now); err != nil {
+				log.Println("deliver due webhooks:", err)
+			}
+		}
+	}
+}
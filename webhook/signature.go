@@ -0,0 +1,58 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers of a delivery
+const (
+	HeaderEventID   = "Webhook-Event-Id"
+	HeaderSignature = "Webhook-Signature"
+)
+
+// Sign returns the signature header of a delivery body sent at the given time, in the form t=<unix time>,v1=<signature>.
+// The signature is the hex-encoded HMAC-SHA256 of "<unix time>.<body>" with the endpoint secret,
+// the time allows the endpoint to reject replayed deliveries.
+func Sign(secret []byte, t time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + timestamp + ",v1=" + signature(secret, timestamp, body)
+}
+
+// Verify reports whether the signature header is valid for the body and was made within tolerance of now.
+func Verify(secret []byte, header string, body []byte, tolerance time.Duration, now time.Time) bool {
+	var timestamp, sig string
+	for _, part := range strings.Split(header, ",") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return false
+		}
+		switch kv[0] {
+		case "t":
+			timestamp = kv[1]
+		case "v1":
+			sig = kv[1]
+		}
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	if d := now.Sub(time.Unix(unix, 0)); d > tolerance || d < -tolerance {
+		return false
+	}
+
+	return hmac.Equal([]byte(signature(secret, timestamp, body)), []byte(sig))
+}
+
+func signature(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
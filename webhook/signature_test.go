@@ -0,0 +1,44 @@
+package webhook
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	// echo -n '1612083600.{"id":1}' | openssl dgst -sha256 -hmac secret
+	want := "t=1612083600,v1=cd903f5cd4f24a4b8b8d40061f8af59ac529ea42e090ecb737ebd3e782aeb708"
+	if got := Sign([]byte("secret"), now, []byte(`{"id":1}`)); got != want {
+		t.Errorf("Sign() = %v, want %v", got, want)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	secret := []byte("secret")
+	body := []byte(`{"id":1}`)
+	header := Sign(secret, now, body)
+
+	tests := []struct {
+		name   string
+		secret []byte
+		header string
+		body   []byte
+		now    time.Time
+		want   bool
+	}{
+		{name: "valid", secret: secret, header: header, body: body, now: now, want: true},
+		{name: "within tolerance", secret: secret, header: header, body: body, now: now.Add(5 * time.Minute), want: true},
+		{name: "too old", secret: secret, header: header, body: body, now: now.Add(6 * time.Minute)},
+		{name: "other body", secret: secret, header: header, body: []byte(`{"id":2}`), now: now},
+		{name: "other secret", secret: []byte("other"), header: header, body: body, now: now},
+		{name: "malformed header", secret: secret, header: "v1", body: body, now: now},
+		{name: "missing timestamp", secret: secret, header: header[13:], body: body, now: now},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Verify(tt.secret, tt.header, tt.body, 5*time.Minute, tt.now); got != tt.want {
+				t.Errorf("Verify() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,504 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+// Service provides webhook service methods.
+// It implements payment.Publisher to record an event for every payment status change and refund.
+type Service interface {
+	CreateEndpoint(req *EndpointRequest) (*Endpoint, error)
+	FindEndpoint(id int) (*Endpoint, error)
+	Endpoints() ([]Endpoint, error)
+	DeleteEndpoint(id int) error
+	Deliveries(endpointID int, status DeliveryStatus) ([]Delivery, error)
+	Replay(eventID int) ([]Delivery, error)
+	Publish(event *payment.Event) error
+	DeliverDue(now time.Time) error
+}
+
+// EventType is the type of an event sent to webhook endpoints.
+type EventType string
+
+// Event types
+const (
+	EventPaymentSucceeded EventType = "payment.succeeded"
+	EventPaymentFailed    EventType = "payment.failed"
+	EventPaymentExpired   EventType = "payment.expired"
+	EventRefundCreated    EventType = "refund.created"
+)
+
+// eventTypes contains every event type.
+var eventTypes = []EventType{EventPaymentSucceeded, EventPaymentFailed, EventPaymentExpired, EventRefundCreated}
+
+// paymentEventTypes maps payment statuses to the type of the event sent when a payment changes to the status.
+// There is no event for the other statuses.
+var paymentEventTypes = map[payment.Status]EventType{
+	payment.StatusSuccessful: EventPaymentSucceeded,
+	payment.StatusCaptured:   EventPaymentSucceeded,
+	payment.StatusFailed:     EventPaymentFailed,
+	payment.StatusExpired:    EventPaymentExpired,
+}
+
+// Endpoint represents a merchant HTTPS URL which receives the events of the subscribed types.
+// Secret signs the deliveries to the endpoint, it is only shown to the merchant when the endpoint is created.
+type Endpoint struct {
+	ID        int
+	URL       string
+	Events    []EventType
+	Secret    string
+	CreatedAt time.Time
+}
+
+// subscribes reports whether the endpoint receives events of the given type.
+func (e *Endpoint) subscribes(t EventType) bool {
+	for _, s := range e.Events {
+		if s == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Event represents something which happened to a payment, Data is the payment when the event occurred,
+// or the refund with the payment for a refund event.
+// DeduplicationID is the deduplication id of the payment event, it is recorded once.
+type Event struct {
+	ID              int
+	DeduplicationID string
+	Type            EventType
+	PaymentID       int
+	Data            json.RawMessage
+	CreatedAt       time.Time
+}
+
+// Delivery represents sending an event to an endpoint. A pending delivery is sent at NextAttemptAt,
+// and retried with an exponential backoff until it succeeds or it has failed MaxAttempts times.
+// ResponseStatus and LastError describe the last failed attempt.
+type Delivery struct {
+	ID             int
+	EventID        int
+	EndpointID     int
+	Status         DeliveryStatus
+	Attempts       int
+	NextAttemptAt  time.Time
+	ResponseStatus int
+	LastError      string
+	DeliveredAt    time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// DeliveryStatus represents a delivery status.
+type DeliveryStatus string
+
+// Delivery statuses
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliverySucceeded DeliveryStatus = "succeeded"
+	// DeliveryDead is the status of a delivery which is no longer retried, the event can be replayed.
+	DeliveryDead DeliveryStatus = "dead"
+)
+
+// EndpointRequest contains details for creating a webhook endpoint.
+type EndpointRequest struct {
+	URL    string
+	Events []EventType
+}
+
+// Repository provides access webhook endpoints, events and deliveries in a data source.
+// The pending deliveries are the outbox of the events, CreateEvent stores them with the event and sets their event id
+// so that an event is delivered even if the service stops before sending it.
+type Repository interface {
+	CreateEndpoint(endpoint *Endpoint) error
+	FindEndpoint(id int) (*Endpoint, error)
+	FindEndpoints() ([]Endpoint, error)
+	DeleteEndpoint(id int) error
+	CreateEvent(event *Event, deliveries []*Delivery) error
+	FindEvent(id int) (*Event, error)
+	FindEventByDeduplicationID(deduplicationID string) (*Event, error)
+	CreateDeliveries(deliveries []*Delivery) error
+	UpdateDelivery(delivery *Delivery) error
+	FindDueDeliveries(now time.Time) ([]*Delivery, error)
+	FindDeliveries(endpointID int, status DeliveryStatus) ([]Delivery, error)
+}
+
+// Errors
+var (
+	ErrEndpointNotFound = &payment.Error{Code: payment.ErrorCodeNotFound, Message: "webhook endpoint not found"}
+	ErrEventNotFound    = &payment.Error{Code: payment.ErrorCodeNotFound, Message: "webhook event not found"}
+	ErrDeliveryNotFound = &payment.Error{Code: payment.ErrorCodeNotFound, Message: "webhook delivery not found"}
+)
+
+// Config contains the settings of the webhook service.
+// A failed delivery is retried after RetryInterval, doubled on each attempt up to MaxRetryInterval,
+// until it has failed MaxAttempts times. Timeout limits each attempt.
+type Config struct {
+	MaxAttempts      int
+	RetryInterval    time.Duration
+	MaxRetryInterval time.Duration
+	Timeout          time.Duration
+}
+
+// secretSize is the number of random bytes of an endpoint secret.
+const secretSize = 24
+
+type service struct {
+	repo     Repository
+	config   Config
+	client   *http.Client
+	lookupIP func(host string) ([]net.IP, error)
+	now      func() time.Time
+}
+
+// NewService returns a new webhook service.
+func NewService(repo Repository, config Config) Service {
+	return &service{
+		repo:     repo,
+		config:   config,
+		client:   newClient(config.Timeout),
+		lookupIP: net.LookupIP,
+		now:      time.Now,
+	}
+}
+
+// CreateEndpoint creates a webhook endpoint with a random secret.
+// The URL must be HTTPS on a host which resolves to public addresses only.
+func (s *service) CreateEndpoint(req *EndpointRequest) (*Endpoint, error) {
+	if err := s.validateEndpointRequest(req); err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, secretSize)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	endpoint := &Endpoint{
+		URL:    req.URL,
+		Events: req.Events,
+		Secret: "whsec_" + base64.RawURLEncoding.EncodeToString(b),
+	}
+	if err := s.repo.CreateEndpoint(endpoint); err != nil {
+		return nil, err
+	}
+
+	return endpoint, nil
+}
+
+// FindEndpoint finds a webhook endpoint with the given id.
+func (s *service) FindEndpoint(id int) (*Endpoint, error) {
+	return s.repo.FindEndpoint(id)
+}
+
+// Endpoints returns every webhook endpoint.
+func (s *service) Endpoints() ([]Endpoint, error) {
+	return s.repo.FindEndpoints()
+}
+
+// DeleteEndpoint deletes a webhook endpoint, its pending deliveries become dead when they are due.
+func (s *service) DeleteEndpoint(id int) error {
+	return s.repo.DeleteEndpoint(id)
+}
+
+// Deliveries returns the deliveries to a webhook endpoint, of any status if the status is empty.
+func (s *service) Deliveries(endpointID int, status DeliveryStatus) ([]Delivery, error) {
+	if _, err := s.repo.FindEndpoint(endpointID); err != nil {
+		return nil, err
+	}
+
+	return s.repo.FindDeliveries(endpointID, status)
+}
+
+// Replay delivers an event again to every endpoint which currently subscribes to it.
+func (s *service) Replay(eventID int) ([]Delivery, error) {
+	event, err := s.repo.FindEvent(eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries, err := s.newDeliveries(event)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreateDeliveries(deliveries); err != nil {
+		return nil, err
+	}
+
+	res := make([]Delivery, len(deliveries))
+	for i, d := range deliveries {
+		res[i] = *d
+	}
+	return res, nil
+}
+
+// Publish records the event of a payment status change or refund with a delivery to every subscribed endpoint.
+// The event is recorded even if no endpoint subscribes to it so that it can be replayed.
+// A payment event which is published again is ignored.
+func (s *service) Publish(e *payment.Event) error {
+	var t EventType
+	var v interface{}
+	switch e.Type {
+	case payment.EventCreated, payment.EventStatusChanged:
+		var ok bool
+		if t, ok = paymentEventTypes[e.Payment.Status]; !ok {
+			return nil
+		}
+		v = newPaymentData(&e.Payment)
+	case payment.EventRefunded:
+		t = EventRefundCreated
+		v = newRefundData(e)
+	default:
+		return nil
+	}
+
+	_, err := s.repo.FindEventByDeduplicationID(e.DeduplicationID)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, payment.ErrNotFound) {
+		return err
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	event := &Event{
+		DeduplicationID: e.DeduplicationID,
+		Type:            t,
+		PaymentID:       e.PaymentID,
+		Data:            data,
+	}
+	deliveries, err := s.newDeliveries(event)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.CreateEvent(event, deliveries)
+}
+
+func (s *service) newDeliveries(event *Event) ([]*Delivery, error) {
+	endpoints, err := s.repo.FindEndpoints()
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	var deliveries []*Delivery
+	for i := range endpoints {
+		if !endpoints[i].subscribes(event.Type) {
+			continue
+		}
+		deliveries = append(deliveries, &Delivery{
+			EventID:       event.ID,
+			EndpointID:    endpoints[i].ID,
+			Status:        DeliveryPending,
+			NextAttemptAt: now,
+		})
+	}
+	return deliveries, nil
+}
+
+// DeliverDue sends every pending delivery which is due at the given time.
+// A failed delivery does not stop the other deliveries from being sent, it is retried later.
+func (s *service) DeliverDue(now time.Time) error {
+	deliveries, err := s.repo.FindDueDeliveries(now)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range deliveries {
+		if err := s.deliver(d, now); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deliver sends the event of the delivery to its endpoint, a 2xx response status is a successful delivery.
+func (s *service) deliver(d *Delivery, now time.Time) error {
+	event, err := s.repo.FindEvent(d.EventID)
+	if err != nil {
+		return err
+	}
+
+	d.Attempts++
+	endpoint, err := s.repo.FindEndpoint(d.EndpointID)
+	switch {
+	case errors.Is(err, payment.ErrNotFound):
+		d.Status = DeliveryDead
+		d.LastError = "webhook endpoint was deleted"
+		return s.repo.UpdateDelivery(d)
+	case err != nil:
+		return err
+	}
+
+	d.ResponseStatus, err = s.send(endpoint, event, now)
+	if err == nil {
+		d.Status = DeliverySucceeded
+		d.LastError = ""
+		d.DeliveredAt = now
+		return s.repo.UpdateDelivery(d)
+	}
+
+	d.LastError = err.Error()
+	if d.Attempts >= s.config.MaxAttempts {
+		d.Status = DeliveryDead
+	} else {
+		d.NextAttemptAt = now.Add(s.retryInterval(d.Attempts))
+	}
+	return s.repo.UpdateDelivery(d)
+}
+
+// retryInterval returns the delay before retrying a delivery which has failed the given number of attempts.
+func (s *service) retryInterval(attempts int) time.Duration {
+	interval := s.config.RetryInterval
+	for i := 1; i < attempts && interval < s.config.MaxRetryInterval; i++ {
+		interval *= 2
+	}
+	if interval > s.config.MaxRetryInterval {
+		interval = s.config.MaxRetryInterval
+	}
+	return interval
+}
+
+// eventBody is the body of a delivery.
+type eventBody struct {
+	ID        int             `json:"id"`
+	Type      EventType       `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// paymentData is the payment in the data of payment events.
+type paymentData struct {
+	ID             int               `json:"id"`
+	Reference      string            `json:"reference,omitempty"`
+	Metadata       map[string]string `json:"metadata,omitempty"`
+	Status         payment.Status    `json:"status"`
+	Amount         int64             `json:"amount"`
+	Currency       string            `json:"currency"`
+	SourceType     string            `json:"source_type"`
+	FailureCode    string            `json:"failure_code,omitempty"`
+	FailureMessage string            `json:"failure_message,omitempty"`
+	UpdatedAt      time.Time         `json:"updated_at"`
+}
+
+func newPaymentData(p *payment.Payment) *paymentData {
+	return &paymentData{
+		ID:             p.ID,
+		Reference:      p.Reference,
+		Metadata:       p.Metadata,
+		Status:         p.Status,
+		Amount:         p.Amount.Amount,
+		Currency:       p.Amount.Currency,
+		SourceType:     p.OmiseCharge.SourceType,
+		FailureCode:    p.OmiseCharge.FailureCode,
+		FailureMessage: p.OmiseCharge.FailureMessage,
+		UpdatedAt:      p.UpdatedAt,
+	}
+}
+
+// refundData is the refund in the data of refund events, with the payment after the refund.
+type refundData struct {
+	ID       string       `json:"id"`
+	Amount   int64        `json:"amount"`
+	Currency string       `json:"currency"`
+	Payment  *paymentData `json:"payment"`
+}
+
+func newRefundData(e *payment.Event) *refundData {
+	return &refundData{
+		ID:       e.RefundID,
+		Amount:   e.Amount.Amount,
+		Currency: e.Amount.Currency,
+		Payment:  newPaymentData(&e.Payment),
+	}
+}
+
+// send posts the event to the endpoint, it returns the response status code.
+func (s *service) send(endpoint *Endpoint, event *Event, now time.Time) (int, error) {
+	body, err := json.Marshal(&eventBody{
+		ID:        event.ID,
+		Type:      event.Type,
+		CreatedAt: event.CreatedAt,
+		Data:      event.Data,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEventID, strconv.Itoa(event.ID))
+	req.Header.Set(HeaderSignature, Sign([]byte(endpoint.Secret), now, body))
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("webhook endpoint responded %d", res.StatusCode)
+	}
+	return res.StatusCode, nil
+}
+
+func (s *service) validateEndpointRequest(req *EndpointRequest) error {
+	verr := &payment.ValidationError{}
+	add := func(field, code, message string) {
+		verr.Errors = append(verr.Errors, payment.FieldError{Field: field, Code: code, Message: message})
+	}
+
+	if req.URL == "" {
+		add("url", payment.CodeRequired, "url is required")
+	} else if u, err := url.Parse(req.URL); err != nil || !u.IsAbs() || u.Hostname() == "" || u.Scheme != "https" {
+		add("url", payment.CodeInvalid, "url must be an absolute HTTPS URL")
+	} else if err := s.checkHost(u.Hostname()); errors.Is(err, errPrivateAddress) {
+		add("url", payment.CodeInvalid, "url must not resolve to a private address")
+	} else if err != nil {
+		add("url", payment.CodeInvalid, "url host cannot be resolved")
+	}
+
+	if len(req.Events) == 0 {
+		add("events", payment.CodeRequired, "events is required")
+	}
+	for i, t := range req.Events {
+		if !isEventType(t) {
+			add(fmt.Sprintf("events[%d]", i), payment.CodeUnsupported, fmt.Sprintf("event type %s is not supported", t))
+		}
+	}
+
+	if len(verr.Errors) > 0 {
+		return verr
+	}
+	return nil
+}
+
+func isEventType(t EventType) bool {
+	for _, e := range eventTypes {
+		if e == t {
+			return true
+		}
+	}
+	return false
+}
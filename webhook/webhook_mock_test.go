@@ -0,0 +1,61 @@
+package webhook
+
+import "time"
+
+type mockRepository struct {
+	CreateEndpointFn             func(endpoint *Endpoint) error
+	FindEndpointFn               func(id int) (*Endpoint, error)
+	FindEndpointsFn              func() ([]Endpoint, error)
+	DeleteEndpointFn             func(id int) error
+	CreateEventFn                func(event *Event, deliveries []*Delivery) error
+	FindEventFn                  func(id int) (*Event, error)
+	FindEventByDeduplicationIDFn func(deduplicationID string) (*Event, error)
+	CreateDeliveriesFn           func(deliveries []*Delivery) error
+	UpdateDeliveryFn             func(delivery *Delivery) error
+	FindDueDeliveriesFn          func(now time.Time) ([]*Delivery, error)
+	FindDeliveriesFn             func(endpointID int, status DeliveryStatus) ([]Delivery, error)
+}
+
+func (m *mockRepository) CreateEndpoint(endpoint *Endpoint) error {
+	return m.CreateEndpointFn(endpoint)
+}
+
+func (m *mockRepository) FindEndpoint(id int) (*Endpoint, error) {
+	return m.FindEndpointFn(id)
+}
+
+func (m *mockRepository) FindEndpoints() ([]Endpoint, error) {
+	return m.FindEndpointsFn()
+}
+
+func (m *mockRepository) DeleteEndpoint(id int) error {
+	return m.DeleteEndpointFn(id)
+}
+
+func (m *mockRepository) CreateEvent(event *Event, deliveries []*Delivery) error {
+	return m.CreateEventFn(event, deliveries)
+}
+
+func (m *mockRepository) FindEvent(id int) (*Event, error) {
+	return m.FindEventFn(id)
+}
+
+func (m *mockRepository) FindEventByDeduplicationID(deduplicationID string) (*Event, error) {
+	return m.FindEventByDeduplicationIDFn(deduplicationID)
+}
+
+func (m *mockRepository) CreateDeliveries(deliveries []*Delivery) error {
+	return m.CreateDeliveriesFn(deliveries)
+}
+
+func (m *mockRepository) UpdateDelivery(delivery *Delivery) error {
+	return m.UpdateDeliveryFn(delivery)
+}
+
+func (m *mockRepository) FindDueDeliveries(now time.Time) ([]*Delivery, error) {
+	return m.FindDueDeliveriesFn(now)
+}
+
+func (m *mockRepository) FindDeliveries(endpointID int, status DeliveryStatus) ([]Delivery, error) {
+	return m.FindDeliveriesFn(endpointID, status)
+}
@@ -0,0 +1,343 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/noppawitt/paymentsvc/payment"
+)
+
+var (
+	now        = time.Date(2021, 1, 31, 9, 0, 0, 0, time.UTC)
+	testConfig = Config{MaxAttempts: 3, RetryInterval: time.Minute, MaxRetryInterval: 90 * time.Second, Timeout: time.Second}
+)
+
+func newTestService(repo Repository) *service {
+	s := NewService(repo, testConfig).(*service)
+	s.now = func() time.Time { return now }
+	s.lookupIP = func(host string) ([]net.IP, error) {
+		switch host {
+		case "example.com":
+			return []net.IP{net.ParseIP("93.184.216.34")}, nil
+		case "internal.example.com":
+			return []net.IP{net.ParseIP("93.184.216.34"), net.ParseIP("10.0.0.1")}, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return s
+}
+
+func TestService_CreateEndpoint(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     *EndpointRequest
+		wantErr error
+	}{
+		{
+			name: "success",
+			req:  &EndpointRequest{URL: "https://example.com/webhook", Events: []EventType{EventPaymentSucceeded}},
+		},
+		{
+			name:    "missing url",
+			req:     &EndpointRequest{Events: []EventType{EventPaymentSucceeded}},
+			wantErr: payment.ErrInvalidRequest,
+		},
+		{
+			name:    "relative url",
+			req:     &EndpointRequest{URL: "/webhook", Events: []EventType{EventPaymentSucceeded}},
+			wantErr: payment.ErrInvalidRequest,
+		},
+		{
+			name:    "http url",
+			req:     &EndpointRequest{URL: "http://example.com/webhook", Events: []EventType{EventPaymentSucceeded}},
+			wantErr: payment.ErrInvalidRequest,
+		},
+		{
+			name:    "loopback address",
+			req:     &EndpointRequest{URL: "https://127.0.0.1/webhook", Events: []EventType{EventPaymentSucceeded}},
+			wantErr: payment.ErrInvalidRequest,
+		},
+		{
+			name:    "link-local address",
+			req:     &EndpointRequest{URL: "https://[fe80::1]/webhook", Events: []EventType{EventPaymentSucceeded}},
+			wantErr: payment.ErrInvalidRequest,
+		},
+		{
+			name:    "host resolving to a private address",
+			req:     &EndpointRequest{URL: "https://internal.example.com/webhook", Events: []EventType{EventPaymentSucceeded}},
+			wantErr: payment.ErrInvalidRequest,
+		},
+		{
+			name:    "unknown host",
+			req:     &EndpointRequest{URL: "https://unknown.example.com/webhook", Events: []EventType{EventPaymentSucceeded}},
+			wantErr: payment.ErrInvalidRequest,
+		},
+		{
+			name:    "missing events",
+			req:     &EndpointRequest{URL: "https://example.com/webhook"},
+			wantErr: payment.ErrInvalidRequest,
+		},
+		{
+			name:    "unsupported event",
+			req:     &EndpointRequest{URL: "https://example.com/webhook", Events: []EventType{"payment.created"}},
+			wantErr: payment.ErrInvalidRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &mockRepository{}
+			repo.CreateEndpointFn = func(endpoint *Endpoint) error {
+				endpoint.ID = 1
+				return nil
+			}
+
+			s := newTestService(repo)
+			got, err := s.CreateEndpoint(tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("service.CreateEndpoint() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.URL != tt.req.URL || !reflect.DeepEqual(got.Events, tt.req.Events) {
+				t.Errorf("service.CreateEndpoint() = %v, want %v", got, tt.req)
+			}
+			if !strings.HasPrefix(got.Secret, "whsec_") || len(got.Secret) != 38 {
+				t.Errorf("service.CreateEndpoint() secret = %v, want whsec_ and 32 characters", got.Secret)
+			}
+		})
+	}
+}
+
+func TestService_Publish(t *testing.T) {
+	endpoints := []Endpoint{
+		{ID: 1, URL: "https://example.com/1", Events: []EventType{EventPaymentSucceeded, EventPaymentFailed}},
+		{ID: 2, URL: "https://example.com/2", Events: []EventType{EventPaymentFailed, EventRefundCreated}},
+	}
+
+	tests := []struct {
+		name          string
+		eventType     payment.EventType
+		status        payment.Status
+		published     bool
+		wantType      EventType
+		wantEndpoints []int
+	}{
+		{name: "successful", eventType: payment.EventStatusChanged, status: payment.StatusSuccessful, wantType: EventPaymentSucceeded, wantEndpoints: []int{1}},
+		{name: "captured", eventType: payment.EventStatusChanged, status: payment.StatusCaptured, wantType: EventPaymentSucceeded, wantEndpoints: []int{1}},
+		{name: "failed on create", eventType: payment.EventCreated, status: payment.StatusFailed, wantType: EventPaymentFailed, wantEndpoints: []int{1, 2}},
+		{name: "expired without subscribers", eventType: payment.EventStatusChanged, status: payment.StatusExpired, wantType: EventPaymentExpired},
+		{name: "pending", eventType: payment.EventCreated, status: payment.StatusPending},
+		{name: "refunded", eventType: payment.EventRefunded, status: payment.StatusSuccessful, wantType: EventRefundCreated, wantEndpoints: []int{2}},
+		{name: "published again", eventType: payment.EventStatusChanged, status: payment.StatusSuccessful, published: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &mockRepository{}
+			repo.FindEndpointsFn = func() ([]Endpoint, error) {
+				return endpoints, nil
+			}
+			repo.FindEventByDeduplicationIDFn = func(deduplicationID string) (*Event, error) {
+				if tt.published {
+					return &Event{ID: 1, DeduplicationID: deduplicationID}, nil
+				}
+				return nil, ErrEventNotFound
+			}
+			var gotEvent *Event
+			var gotEndpoints []int
+			repo.CreateEventFn = func(event *Event, deliveries []*Delivery) error {
+				gotEvent = event
+				for _, d := range deliveries {
+					if d.Status != DeliveryPending || !d.NextAttemptAt.Equal(now) {
+						t.Errorf("delivery = %v, want pending at %v", d, now)
+					}
+					gotEndpoints = append(gotEndpoints, d.EndpointID)
+				}
+				return nil
+			}
+
+			s := newTestService(repo)
+			e := &payment.Event{
+				ID:              1,
+				DeduplicationID: "dedup-1",
+				Type:            tt.eventType,
+				PaymentID:       1,
+				Payment:         payment.Payment{ID: 1, Status: tt.status, Amount: payment.NewMoney(2000, "THB"), OmiseCharge: &payment.OmiseCharge{SourceType: "promptpay"}},
+			}
+			if tt.eventType == payment.EventRefunded {
+				e.RefundID = "rfnd_1"
+				e.Amount = payment.NewMoney(500, "THB")
+			}
+			if err := s.Publish(e); err != nil {
+				t.Fatalf("service.Publish() error = %v", err)
+			}
+
+			if tt.wantType == "" {
+				if gotEvent != nil {
+					t.Errorf("service.Publish() event = %v, want none", gotEvent)
+				}
+				return
+			}
+			if gotEvent == nil || gotEvent.Type != tt.wantType || gotEvent.PaymentID != 1 || gotEvent.DeduplicationID != "dedup-1" {
+				t.Fatalf("service.Publish() event = %v, want %v of payment 1", gotEvent, tt.wantType)
+			}
+			if !reflect.DeepEqual(gotEndpoints, tt.wantEndpoints) {
+				t.Errorf("service.Publish() endpoints = %v, want %v", gotEndpoints, tt.wantEndpoints)
+			}
+			if tt.eventType == payment.EventRefunded && !strings.HasPrefix(string(gotEvent.Data), `{"id":"rfnd_1","amount":500,"currency":"THB","payment":{"id":1,`) {
+				t.Errorf("service.Publish() data = %s, want the refund with the payment", gotEvent.Data)
+			}
+		})
+	}
+}
+
+func TestService_DeliverDue(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		attempts int
+		deleted  bool
+		want     Delivery
+	}{
+		{
+			name:   "success",
+			status: http.StatusOK,
+			want:   Delivery{ID: 1, EventID: 1, EndpointID: 1, Status: DeliverySucceeded, Attempts: 1, NextAttemptAt: now, ResponseStatus: http.StatusOK, DeliveredAt: now},
+		},
+		{
+			name:   "retry",
+			status: http.StatusInternalServerError,
+			want:   Delivery{ID: 1, EventID: 1, EndpointID: 1, Status: DeliveryPending, Attempts: 1, NextAttemptAt: now.Add(time.Minute), ResponseStatus: http.StatusInternalServerError, LastError: "webhook endpoint responded 500"},
+		},
+		{
+			name:     "backoff up to the max retry interval",
+			status:   http.StatusInternalServerError,
+			attempts: 1,
+			want:     Delivery{ID: 1, EventID: 1, EndpointID: 1, Status: DeliveryPending, Attempts: 2, NextAttemptAt: now.Add(90 * time.Second), ResponseStatus: http.StatusInternalServerError, LastError: "webhook endpoint responded 500"},
+		},
+		{
+			name:     "dead after max attempts",
+			status:   http.StatusInternalServerError,
+			attempts: 2,
+			want:     Delivery{ID: 1, EventID: 1, EndpointID: 1, Status: DeliveryDead, Attempts: 3, NextAttemptAt: now, ResponseStatus: http.StatusInternalServerError, LastError: "webhook endpoint responded 500"},
+		},
+		{
+			name:    "endpoint deleted",
+			deleted: true,
+			want:    Delivery{ID: 1, EventID: 1, EndpointID: 1, Status: DeliveryDead, Attempts: 1, NextAttemptAt: now, LastError: "webhook endpoint was deleted"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := &Event{ID: 1, Type: EventPaymentSucceeded, PaymentID: 1, Data: json.RawMessage(`{"id":1}`), CreatedAt: now}
+
+			var gotBody []byte
+			var gotHeader http.Header
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotBody, _ = ioutil.ReadAll(r.Body)
+				gotHeader = r.Header
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+			endpoint := &Endpoint{ID: 1, URL: server.URL, Events: []EventType{EventPaymentSucceeded}, Secret: "whsec_test"}
+
+			repo := &mockRepository{}
+			repo.FindDueDeliveriesFn = func(time.Time) ([]*Delivery, error) {
+				return []*Delivery{{ID: 1, EventID: 1, EndpointID: 1, Status: DeliveryPending, Attempts: tt.attempts, NextAttemptAt: now}}, nil
+			}
+			repo.FindEventFn = func(id int) (*Event, error) {
+				return event, nil
+			}
+			repo.FindEndpointFn = func(id int) (*Endpoint, error) {
+				if tt.deleted {
+					return nil, ErrEndpointNotFound
+				}
+				return endpoint, nil
+			}
+			var got *Delivery
+			repo.UpdateDeliveryFn = func(delivery *Delivery) error {
+				got = delivery
+				return nil
+			}
+
+			s := newTestService(repo)
+			s.client = server.Client()
+			if err := s.DeliverDue(now); err != nil {
+				t.Fatalf("service.DeliverDue() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, &tt.want) {
+				t.Errorf("service.DeliverDue() delivery = %+v, want %+v", got, &tt.want)
+			}
+
+			if tt.deleted {
+				return
+			}
+			wantBody := `{"id":1,"type":"payment.succeeded","created_at":"2021-01-31T09:00:00Z","data":{"id":1}}`
+			if string(gotBody) != wantBody {
+				t.Errorf("body = %s, want %s", gotBody, wantBody)
+			}
+			if gotHeader.Get(HeaderEventID) != "1" {
+				t.Errorf("%s = %v, want 1", HeaderEventID, gotHeader.Get(HeaderEventID))
+			}
+			if !Verify([]byte(endpoint.Secret), gotHeader.Get(HeaderSignature), gotBody, time.Minute, now) {
+				t.Errorf("%s = %v is invalid", HeaderSignature, gotHeader.Get(HeaderSignature))
+			}
+		})
+	}
+}
+
+func TestService_Replay(t *testing.T) {
+	repo := &mockRepository{}
+	repo.FindEventFn = func(id int) (*Event, error) {
+		if id != 1 {
+			return nil, ErrEventNotFound
+		}
+		return &Event{ID: 1, Type: EventPaymentFailed, PaymentID: 1}, nil
+	}
+	repo.FindEndpointsFn = func() ([]Endpoint, error) {
+		return []Endpoint{
+			{ID: 1, Events: []EventType{EventPaymentSucceeded}},
+			{ID: 2, Events: []EventType{EventPaymentFailed}},
+		}, nil
+	}
+	repo.CreateDeliveriesFn = func(deliveries []*Delivery) error {
+		for i, d := range deliveries {
+			d.ID = i + 5
+		}
+		return nil
+	}
+
+	s := newTestService(repo)
+	got, err := s.Replay(1)
+	if err != nil {
+		t.Fatalf("service.Replay() error = %v", err)
+	}
+	want := []Delivery{{ID: 5, EventID: 1, EndpointID: 2, Status: DeliveryPending, NextAttemptAt: now}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("service.Replay() = %+v, want %+v", got, want)
+	}
+
+	if _, err := s.Replay(2); !errors.Is(err, ErrEventNotFound) {
+		t.Errorf("service.Replay() error = %v, want %v", err, ErrEventNotFound)
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	_, err := newClient(time.Second).Post(server.URL, "application/json", strings.NewReader("{}"))
+	if !errors.Is(err, errPrivateAddress) {
+		t.Errorf("newClient() error = %v, want %v", err, errPrivateAddress)
+	}
+}